@@ -0,0 +1,215 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !configs
+// +build !configs
+
+package apis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/stats"
+)
+
+// Names of the certificates in the expiry metrics
+const (
+	serverCertName = "server"
+	caCertName     = "ca"
+)
+
+// certStore holds the server certificate and the client CA pool of mTLS, reloaded when their files change
+type certStore struct {
+	certFile    string
+	keyFile     string
+	caFile      string
+	warningDays int
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	caPool   *x509.CertPool
+	caCerts  []*x509.Certificate
+	modTimes map[string]time.Time
+}
+
+// newCertStore - loads the server certificate, key and CA bundle of the mTLS config
+func newCertStore(conf *config.Config) (*certStore, error) {
+	c := &certStore{
+		certFile:    path.Join(conf.MTLSCertDir, conf.MTLSServerCertFilename),
+		keyFile:     path.Join(conf.MTLSCertDir, conf.MTLSServerKeyFilename),
+		caFile:      path.Join(conf.MTLSCertDir, conf.MTLSCACertFilename),
+		warningDays: conf.MTLSCertExpiryWarningDays,
+	}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// getCertificate - returns the current server certificate, used as tls.Config GetCertificate
+func (c *certStore) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// clientCAs - returns the current pool of CAs the client certificates are verified with
+func (c *certStore) clientCAs() *x509.CertPool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.caPool
+}
+
+// modTimesOf - returns the modification times of the certificate files
+func (c *certStore) modTimesOf() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time, 3)
+	for _, file := range []string{c.certFile, c.keyFile, c.caFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %v", file, err)
+		}
+		modTimes[file] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// changed - reports whether any certificate file is modified since it was loaded
+func (c *certStore) changed() bool {
+	modTimes, err := c.modTimesOf()
+	if err != nil {
+		// a file being replaced is retried on the next check
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for file, modTime := range modTimes {
+		if !modTime.Equal(c.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload - loads and validates the certificate files, the current ones are kept when they are invalid
+func (c *certStore) reload() error {
+	modTimes, err := c.modTimesOf()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate %s and key %s: %v", c.certFile, c.keyFile, err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("failed to parse server certificate %s: %v", c.certFile, err)
+		}
+	}
+
+	caPEM, err := os.ReadFile(c.caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client CA %s: %v", c.caFile, err)
+	}
+	caCerts := make([]*x509.Certificate, 0)
+	for block, rest := pem.Decode(caPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		caCert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse client CA %s: %v", c.caFile, err)
+		}
+		caCerts = append(caCerts, caCert)
+	}
+	if len(caCerts) == 0 {
+		return fmt.Errorf("no certificates found in client CA %s", c.caFile)
+	}
+	caPool, _ := x509.SystemCertPool()
+	if caPool == nil {
+		caPool = x509.NewCertPool()
+	}
+	for _, caCert := range caCerts {
+		caPool.AddCert(caCert)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil {
+		// replacing working material with certificates clients reject takes the API down, keep serving the current ones
+		now := time.Now()
+		if now.Before(cert.Leaf.NotBefore) || now.After(cert.Leaf.NotAfter) {
+			return fmt.Errorf("server certificate %s is valid from %v until %v only", c.certFile, cert.Leaf.NotBefore, cert.Leaf.NotAfter)
+		}
+	}
+	c.cert, c.caPool, c.caCerts, c.modTimes = &cert, caPool, caCerts, modTimes
+	log.Info().Str("cert", c.certFile).Str("ca", c.caFile).Time("expiry", cert.Leaf.NotAfter).Msg("mTLS certificates loaded")
+	return nil
+}
+
+// watch - reloads the certificate files when they change and checks their expiry daily, until ctx is done
+func (c *certStore) watch(ctx context.Context, interval time.Duration) {
+	c.checkExpiry()
+	expiryTicker := time.NewTicker(24 * time.Hour)
+	defer expiryTicker.Stop()
+	var reloadC <-chan time.Time
+	if interval > 0 {
+		reloadTicker := time.NewTicker(interval)
+		defer reloadTicker.Stop()
+		reloadC = reloadTicker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reloadC:
+			if !c.changed() {
+				continue
+			}
+			if err := c.reload(); err != nil {
+				// the files are retried until a consistent set is in place, e.g. the key is written after the certificate
+				log.Error().Err(err).Msg("failed to reload mTLS certificates, keeping the current ones")
+				continue
+			}
+			c.checkExpiry()
+		case <-expiryTicker.C:
+			c.checkExpiry()
+		}
+	}
+}
+
+// checkExpiry - updates the expiry metrics of the server and CA certificates and warns about the ones expiring soon
+func (c *certStore) checkExpiry() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	MonitorTLS(serverCertName, c.cert.Leaf, c.warningDays)
+	for _, caCert := range c.caCerts {
+		MonitorTLS(caCertName, caCert, c.warningDays)
+	}
+}
+
+// MonitorTLS - records the expiry time of the certificate and logs when it is expired, not valid yet or expires
+// within warningDays
+func MonitorTLS(name string, cert *x509.Certificate, warningDays int) {
+	stats.SetCertificateValue(float64(cert.NotAfter.Unix()), stats.TLSCertExpiry, name, cert.Subject.CommonName)
+
+	now := time.Now()
+	remainingHoursToExpire := int(cert.NotAfter.Sub(now).Hours())
+	switch {
+	case now.Before(cert.NotBefore):
+		log.Error().Str("certificate", name).Str("subject", cert.Subject.CommonName).Msgf("tls certificate starts from : %v", cert.NotBefore)
+	case now.After(cert.NotAfter):
+		log.Error().Str("certificate", name).Str("subject", cert.Subject.CommonName).Msgf("tls certificate is expired on : %v", cert.NotAfter)
+	case remainingHoursToExpire <= warningDays*24:
+		log.Warn().Str("certificate", name).Str("subject", cert.Subject.CommonName).Msgf("tls certificate will expire in %v days", remainingHoursToExpire/24)
+	}
+}
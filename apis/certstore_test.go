@@ -0,0 +1,167 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package apis
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+)
+
+// writeCert - writes a self-signed certificate with its key and returns the PEM of the certificate
+func writeCert(t *testing.T, certFile, keyFile, cn string, notBefore, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if len(keyFile) > 0 {
+		if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+			t.Fatalf("failed to write key: %v", err)
+		}
+	}
+	return certPEM
+}
+
+// touch - moves the modification time of the files forward, as a rotation within the mtime granularity would not be seen
+func touch(t *testing.T, files ...string) {
+	t.Helper()
+	later := time.Now().Add(time.Minute)
+	for _, file := range files {
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatalf("failed to change modification time of %s: %v", file, err)
+		}
+	}
+}
+
+func TestCertStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	conf := &config.Config{
+		MTLSCertDir:               dir,
+		MTLSCACertFilename:        "ca.pem",
+		MTLSServerCertFilename:    "server.crt",
+		MTLSServerKeyFilename:     "server.key",
+		MTLSCertExpiryWarningDays: 30,
+	}
+	certFile, keyFile, caFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem")
+	now := time.Now()
+	writeCert(t, certFile, keyFile, "l3afd-old", now.Add(-time.Hour), now.Add(24*time.Hour))
+	writeCert(t, caFile, "", "ca-old", now.Add(-time.Hour), now.Add(24*time.Hour))
+
+	c, err := newCertStore(conf)
+	if err != nil {
+		t.Fatalf("newCertStore() error = %v", err)
+	}
+	c.checkExpiry()
+	if c.changed() {
+		t.Errorf("changed() = true without modified files")
+	}
+	serverCN := func() string {
+		cert, _ := c.getCertificate(nil)
+		return cert.Leaf.Subject.CommonName
+	}
+
+	tests := []struct {
+		name    string
+		rotate  func()
+		wantErr bool
+		wantCN  string
+		wantCAs int
+	}{
+		{
+			name: "Rotated",
+			rotate: func() {
+				writeCert(t, certFile, keyFile, "l3afd-new", now.Add(-time.Hour), now.Add(48*time.Hour))
+				caPEM := writeCert(t, caFile, "", "ca-new", now.Add(-time.Hour), now.Add(48*time.Hour))
+				// CA bundle of the new and old CA during the rotation
+				bundle := append(caPEM, writeCert(t, filepath.Join(dir, "ca-old.pem"), "", "ca-old", now.Add(-time.Hour), now.Add(24*time.Hour))...)
+				if err := os.WriteFile(caFile, bundle, 0644); err != nil {
+					t.Fatalf("failed to write CA bundle: %v", err)
+				}
+			},
+			wantCN:  "l3afd-new",
+			wantCAs: 2,
+		},
+		{
+			name: "KeyMismatch",
+			rotate: func() {
+				writeCert(t, certFile, filepath.Join(dir, "other.key"), "l3afd-mismatch", now.Add(-time.Hour), now.Add(48*time.Hour))
+			},
+			wantErr: true,
+			wantCN:  "l3afd-new",
+			wantCAs: 2,
+		},
+		{
+			name: "Expired",
+			rotate: func() {
+				writeCert(t, certFile, keyFile, "l3afd-expired", now.Add(-48*time.Hour), now.Add(-time.Hour))
+			},
+			wantErr: true,
+			wantCN:  "l3afd-new",
+			wantCAs: 2,
+		},
+		{
+			name: "EmptyCA",
+			rotate: func() {
+				writeCert(t, certFile, keyFile, "l3afd-valid", now.Add(-time.Hour), now.Add(48*time.Hour))
+				if err := os.WriteFile(caFile, []byte("not a certificate"), 0644); err != nil {
+					t.Fatalf("failed to write CA: %v", err)
+				}
+			},
+			wantErr: true,
+			wantCN:  "l3afd-new",
+			wantCAs: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rotate()
+			touch(t, certFile, keyFile, caFile)
+			if !c.changed() {
+				t.Errorf("changed() = false after rotation")
+			}
+			if err := c.reload(); (err != nil) != tt.wantErr {
+				t.Errorf("reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cn := serverCN(); cn != tt.wantCN {
+				t.Errorf("server certificate %s, want %s", cn, tt.wantCN)
+			}
+			if len(c.caCerts) != tt.wantCAs || c.clientCAs() == nil {
+				t.Errorf("client CAs %d, want %d", len(c.caCerts), tt.wantCAs)
+			}
+		})
+	}
+}
@@ -10,13 +10,11 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/pem"
 	"errors"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"path"
 	"regexp"
 	"strings"
 	"time"
@@ -28,17 +26,17 @@ import (
 	"github.com/l3af-project/l3afd/kf"
 	"github.com/l3af-project/l3afd/routes"
 	"github.com/l3af-project/l3afd/signals"
+	"github.com/l3af-project/l3afd/tracing"
 
 	_ "github.com/l3af-project/l3afd/docs"
-
-	"github.com/rs/zerolog/log"
 )
 
 type Server struct {
 	KFRTConfigs   *kf.NFConfigs
 	HostName      string
 	l3afdServer   *http.Server
-	CaCertPool    *x509.CertPool
+	certs         *certStore
+	revocation    *revocationChecker
 	SANMatchRules []string
 }
 
@@ -69,7 +67,7 @@ func StartConfigWatcher(ctx context.Context, hostname, daemonName string, conf *
 	}()
 
 	go func() {
-		r := routes.NewRouter(apiRoutes(ctx, kfrtconfg))
+		r := routes.NewRouter(apiRoutes(ctx, kfrtconfg), tracing.Middleware)
 		if conf.SwaggerApiEnabled {
 			r.Mount("/swagger", httpSwagger.WrapHandler)
 		}
@@ -83,62 +81,35 @@ func StartConfigWatcher(ctx context.Context, hostname, daemonName string, conf *
 
 		if conf.MTLSEnabled {
 			log.Info().Msgf("l3afd server listening with mTLS - %s ", conf.L3afConfigsRestAPIAddr)
-			// Create a CA certificate pool and add client ca's to it
-			caCert, err := os.ReadFile(path.Join(conf.MTLSCertDir, conf.MTLSCACertFilename))
-			if err != nil {
-				log.Fatal().Err(err).Msgf("client CA %s file not found", conf.MTLSCACertFilename)
-			}
-
-			s.CaCertPool, _ = x509.SystemCertPool()
-			if s.CaCertPool == nil {
-				s.CaCertPool = x509.NewCertPool()
-			}
-			if ok := s.CaCertPool.AppendCertsFromPEM(caCert); !ok {
-				log.Warn().Msgf("No client certs appended for mTLS")
-			}
-			serverCertFile := path.Join(conf.MTLSCertDir, conf.MTLSServerCertFilename)
-			serverKeyFile := path.Join(conf.MTLSCertDir, conf.MTLSServerKeyFilename)
-			serverCert, err := tls.LoadX509KeyPair(serverCertFile, serverKeyFile)
-			if err != nil {
+			var err error
+			if s.certs, err = newCertStore(conf); err != nil {
 				log.Fatal().Err(err).Msgf("failure loading certs")
 			}
-			// build server config
+			// build server config, the certificate and client CAs are looked up per connection to pick up reloaded ones
 			s.l3afdServer.TLSConfig = &tls.Config{
-				Certificates: []tls.Certificate{serverCert},
+				GetCertificate: s.certs.getCertificate,
 				GetConfigForClient: func(hi *tls.ClientHelloInfo) (*tls.Config, error) {
 					serverConf := &tls.Config{
-						Certificates:          []tls.Certificate{serverCert},
+						GetCertificate:        s.certs.getCertificate,
 						MinVersion:            tls.VersionTLS12,
 						ClientAuth:            tls.RequireAndVerifyClientCert,
-						ClientCAs:             s.CaCertPool,
+						ClientCAs:             s.certs.clientCAs(),
 						VerifyPeerCertificate: s.getClientValidator(hi),
 					}
 					return serverConf, nil
 				},
 			}
 
-			cpb, _ := pem.Decode(caCert)
-			cert, err := x509.ParseCertificate(cpb.Bytes)
-			if err != nil {
-				log.Fatal().Err(err).Msgf("error in parsing tls certificate : %v", conf.MTLSCACertFilename)
+			go s.certs.watch(ctx, conf.MTLSCertReloadInterval)
+
+			if s.revocation, err = newRevocationChecker(conf); err != nil {
+				log.Fatal().Err(err).Msgf("failure loading certificate revocation list")
+			}
+			if s.revocation != nil {
+				go s.revocation.watch(ctx, conf.MTLSCRLReloadInterval)
 			}
-			expiry := cert.NotAfter
-			start := cert.NotBefore
-			go func() {
-				period := time.Hour * 24
-				ticker := time.NewTicker(period)
-				defer ticker.Stop()
-				for {
-					select {
-					case <-ticker.C:
-						MonitorTLS(start, expiry, conf)
-					case <-ctx.Done():
-						return
-					}
-				}
-			}()
 
-			if err := s.l3afdServer.ListenAndServeTLS(serverCertFile, serverKeyFile); err != nil {
+			if err := s.l3afdServer.ListenAndServeTLS("", ""); err != nil {
 				log.Fatal().Err(err).Msgf("failed to start L3AFD server with mTLS enabled")
 			}
 		} else {
@@ -186,43 +157,30 @@ func isLoopback(addr string) bool {
 	return true
 }
 
-func MonitorTLS(start time.Time, expiry time.Time, conf *config.Config) {
-	todayDate := time.Now()
-	expiryDate := expiry
-	startDate := start
-	diff := expiryDate.Sub(todayDate)
-	remainingHoursToStart := todayDate.Sub(startDate)
-	limit := conf.MTLSCertExpiryWarningDays * 24
-	remainingHoursToExpire := int(diff.Hours())
-	if remainingHoursToStart > 0 {
-		log.Fatal().Msgf("tls certificate start from : %v", startDate)
-	}
-	if remainingHoursToExpire <= limit {
-		if remainingHoursToExpire < 0 {
-			log.Fatal().Msgf("tls certificate is expired on : %v", expiryDate)
-		} else {
-			log.Warn().Msgf("tls certificate will expire in %v days", int64(remainingHoursToExpire/24))
-		}
-	}
-}
-
 func (s *Server) getClientValidator(helloInfo *tls.ClientHelloInfo) func([][]byte, [][]*x509.Certificate) error {
 
 	log.Debug().Msgf("Inside get client validator - %v", helloInfo.Conn.RemoteAddr())
 	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
 		// Verifying client certs with root ca
 		opts := x509.VerifyOptions{
-			Roots:         s.CaCertPool,
+			Roots:         s.certs.clientCAs(),
 			CurrentTime:   time.Now(),
 			Intermediates: x509.NewCertPool(),
 			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
 		}
-		_, err := verifiedChains[0][0].Verify(opts)
+		chains, err := verifiedChains[0][0].Verify(opts)
 		if err != nil {
 			log.Error().Err(err).Msgf("certs verification failed")
 			return err
 		}
 
+		if s.revocation != nil {
+			if err := s.revocation.check(chains[0]); err != nil {
+				log.Error().Err(err).Msgf("certs revocation check failed")
+				return err
+			}
+		}
+
 		log.Debug().Msgf("validating with SAN match rules - %s", s.SANMatchRules)
 		if len(s.SANMatchRules) == 0 {
 			return nil
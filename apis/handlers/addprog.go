@@ -5,14 +5,11 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 
 	"net/http"
 
-	"github.com/rs/zerolog/log"
-
 	"github.com/l3af-project/l3afd/kf"
 	"github.com/l3af-project/l3afd/models"
 )
@@ -20,10 +17,12 @@ import (
 // AddEbpfPrograms add new eBPF programs on node
 // @Summary Adds new eBPF Programs on node
 // @Description Adds new eBPF Programs on node
-// @Accept  json
+// @Accept  json,yaml
 // @Produce  json
 // @Param cfgs body []models.L3afBPFPrograms true "BPF programs"
 // @Success 200
+// @Failure 400
+// @Failure 415
 // @Router /l3af/configs/v1/add [post]
 func AddEbpfPrograms(ctx context.Context, kfcfg *kf.NFConfigs) http.HandlerFunc {
 
@@ -54,18 +53,18 @@ func AddEbpfPrograms(ctx context.Context, kfcfg *kf.NFConfigs) http.HandlerFunc
 		}
 
 		var t []models.L3afBPFPrograms
-		if err := json.Unmarshal(bodyBuffer, &t); err != nil {
-			mesg = fmt.Sprintf("failed to unmarshal payload: %v", err)
-			log.Error().Msg(mesg)
-			statusCode = http.StatusInternalServerError
+		if code, err := decodePayload(r, bodyBuffer, &t); err != nil {
+			mesg = payloadErrorMessage(err)
+			log.Error().Err(err).Msg("failed to decode payload")
+			statusCode = code
 			return
 		}
 
-		if err := kfcfg.AddeBPFPrograms(t); err != nil {
+		if err := kfcfg.AddeBPFPrograms(deployContext(r), t); err != nil {
 			mesg = fmt.Sprintf("failed to AddEbpfPrograms : %v", err)
 			log.Error().Msg(mesg)
 
-			statusCode = http.StatusInternalServerError
+			statusCode, mesg = deployStatus(err, mesg)
 			return
 		}
 	}
@@ -50,7 +50,7 @@ func Test_addprog(t *testing.T) {
 		{
 			name:   "FailedToUnmarshal",
 			Body:   strings.NewReader("Something"),
-			status: http.StatusInternalServerError,
+			status: http.StatusBadRequest,
 			header: map[string]string{},
 			cfg: &kf.NFConfigs{
 				HostConfig: &config.Config{
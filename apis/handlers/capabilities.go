@@ -0,0 +1,40 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"net/http"
+)
+
+// GetCapabilities Returns the eBPF features supported by the kernel of the node
+// @Summary Returns the eBPF features supported by the kernel of the node
+// @Description Probes the kernel for BTF, xdp and tcx links, program types, map types and the helpers of xdp and tc programs, features the probe could not decide are reported unsupported with the probe failure as reason
+// @Accept  json
+// @Produce  json,yaml
+// @Success 200 {object} models.L3afHostCapabilities
+// @Router /l3af/host/capabilities [get]
+func GetCapabilities(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	resp, contentType, err := marshalResponse(r, kfcfgs.Capabilities())
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	mesg = string(resp)
+}
@@ -0,0 +1,31 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/l3af-project/l3afd/kf"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_GetCapabilities(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/l3af/host/capabilities", nil)
+	rr := httptest.NewRecorder()
+	InitConfigs(&kf.NFConfigs{})
+	http.HandlerFunc(GetCapabilities).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GetCapabilities() status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var caps models.L3afHostCapabilities
+	if err := json.Unmarshal(rr.Body.Bytes(), &caps); err != nil {
+		t.Fatalf("GetCapabilities() returned invalid json: %v", err)
+	}
+	if caps.BTF.Name != "btf" || len(caps.Links) != 2 || len(caps.ProgramTypes) == 0 || len(caps.MapTypes) == 0 || len(caps.Helpers) != 2 {
+		t.Errorf("GetCapabilities() = %+v, want every probed feature reported", caps)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	chi "github.com/go-chi/chi/v5"
+
+	"github.com/l3af-project/l3afd/configstore"
+	"github.com/l3af-project/l3afd/kf"
+)
+
+// GetConfigHistory Returns the retained revisions of the eBPF program configs
+// @Summary Returns the retained revisions of the eBPF program configs
+// @Description Returns the retained revisions of the eBPF program configs with their time, author and changes, oldest first
+// @Accept  json
+// @Produce  json
+// @Success 200
+// @Router /l3af/configs/history [get]
+func GetConfigHistory(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	history, err := kfcfgs.ConfigStore().History()
+	if err != nil {
+		mesg = fmt.Sprintf("failed to read config history: %v", err)
+		log.Error().Msg(mesg)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+
+	resp, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	mesg = string(resp)
+}
+
+// RollbackConfig re-deploys an earlier revision of the eBPF program configs
+// @Summary Re-deploys an earlier revision of the eBPF program configs
+// @Description Re-deploys the configs of the revision like an update call, recording them as a new revision
+// @Accept  json
+// @Produce  json
+// @Param revision path int true "revision"
+// @Success 200
+// @Router /l3af/configs/rollback/{revision} [post]
+func RollbackConfig(ctx context.Context, kfcfg *kf.NFConfigs) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		mesg := ""
+		statusCode := http.StatusOK
+
+		w.Header().Add("Content-Type", "application/json")
+
+		defer func(mesg *string, statusCode *int) {
+			w.WriteHeader(*statusCode)
+			_, err := w.Write([]byte(*mesg))
+			if err != nil {
+				log.Warn().Msgf("Failed to write response bytes: %v", err)
+			}
+		}(&mesg, &statusCode)
+
+		revision, err := strconv.Atoi(chi.URLParam(r, "revision"))
+		if err != nil || revision <= 0 {
+			mesg = fmt.Sprintf("invalid revision %q", chi.URLParam(r, "revision"))
+			log.Error().Msg(mesg)
+			statusCode = http.StatusBadRequest
+			return
+		}
+
+		rev, err := kfcfg.ConfigStore().Get(revision)
+		if err != nil {
+			mesg = fmt.Sprintf("failed to read revision %d: %v", revision, err)
+			log.Error().Msg(mesg)
+			statusCode = http.StatusInternalServerError
+			if errors.Is(err, configstore.ErrRevisionNotFound) {
+				statusCode = http.StatusNotFound
+			}
+			return
+		}
+
+		author := fmt.Sprintf("%s (rollback to revision %d)", configstore.Author(r.Context()), revision)
+		if err := kfcfg.DeployeBPFPrograms(configstore.WithAuthor(deployContext(r), author), rev.Configs); err != nil {
+			mesg = fmt.Sprintf("failed to deploy ebpf programs of revision %d: %v", revision, err)
+			log.Error().Msg(mesg)
+
+			statusCode = http.StatusInternalServerError
+			return
+		}
+	}
+}
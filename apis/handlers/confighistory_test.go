@@ -0,0 +1,83 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	chi "github.com/go-chi/chi/v5"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/configstore"
+	"github.com/l3af-project/l3afd/kf"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_RollbackConfig(t *testing.T) {
+	cfg := &kf.NFConfigs{
+		HostName: "l3af-local-test",
+		HostConfig: &config.Config{
+			L3afConfigStoreFileName:    filepath.Join(t.TempDir(), "l3af-config.json"),
+			L3afConfigStoreHistorySize: 5,
+		},
+	}
+	prev := kfcfgs
+	kfcfgs = cfg
+	t.Cleanup(func() { kfcfgs = prev })
+
+	ctx := context.Background()
+	if err := cfg.ConfigStore().Save(ctx, []models.L3afBPFPrograms{}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := cfg.ConfigStore().Save(ctx, []models.L3afBPFPrograms{{
+		HostName:    "l3af-local-test",
+		Iface:       "fakeif0",
+		BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{{Name: "ratelimiting", Version: "1.0"}}},
+	}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	router := chi.NewRouter()
+	router.Post("/l3af/configs/rollback/{revision}", RollbackConfig(ctx, cfg))
+	tests := []struct {
+		name     string
+		revision string
+		status   int
+	}{
+		{name: "InvalidRevision", revision: "latest", status: http.StatusBadRequest},
+		{name: "UnknownRevision", revision: "9", status: http.StatusNotFound},
+		{name: "Rollback", revision: "1", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/l3af/configs/rollback/"+tt.revision, nil)
+			req = req.WithContext(configstore.WithAuthor(req.Context(), "l3af-controller"))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("RollbackConfig status = %d, want %d: %s", rr.Code, tt.status, rr.Body.String())
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(GetConfigHistory).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/l3af/configs/history", nil))
+	var history []configstore.Revision
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+		t.Fatalf("GetConfigHistory response is not json: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("GetConfigHistory returned %+v, want 3 revisions", history)
+	}
+	rollback := history[2]
+	if !strings.Contains(rollback.Author, "l3af-controller (rollback to revision 1)") || len(rollback.Changes) != 1 || rollback.Changes[0].Action != "removed" {
+		t.Errorf("rollback revision %+v, want the removal of ratelimiting by the rollback", rollback)
+	}
+}
@@ -5,14 +5,11 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 
 	"net/http"
 
-	"github.com/rs/zerolog/log"
-
 	"github.com/l3af-project/l3afd/kf"
 	"github.com/l3af-project/l3afd/models"
 )
@@ -20,10 +17,12 @@ import (
 // DeleteEbpfPrograms   remove eBPF programs on node
 // @Summary Removes eBPF Programs on node
 // @Description Removes eBPF Programs on node
-// @Accept  json
+// @Accept  json,yaml
 // @Produce  json
 // @Param cfgs body []models.L3afBPFProgramNames true "BPF program names"
 // @Success 200
+// @Failure 400
+// @Failure 415
 // @Router /l3af/configs/v1/delete [post]
 func DeleteEbpfPrograms(ctx context.Context, kfcfg *kf.NFConfigs) http.HandlerFunc {
 
@@ -54,14 +53,14 @@ func DeleteEbpfPrograms(ctx context.Context, kfcfg *kf.NFConfigs) http.HandlerFu
 		}
 
 		var t []models.L3afBPFProgramNames
-		if err := json.Unmarshal(bodyBuffer, &t); err != nil {
-			mesg = fmt.Sprintf("failed to unmarshal payload: %v", err)
-			log.Error().Msg(mesg)
-			statusCode = http.StatusInternalServerError
+		if code, err := decodePayload(r, bodyBuffer, &t); err != nil {
+			mesg = payloadErrorMessage(err)
+			log.Error().Err(err).Msg("failed to decode payload")
+			statusCode = code
 			return
 		}
 
-		if err := kfcfg.DeleteEbpfPrograms(t); err != nil {
+		if err := kfcfg.DeleteEbpfPrograms(deployContext(r), t); err != nil {
 			mesg = fmt.Sprintf("failed to DeleteEbpfPrograms : %v", err)
 			log.Error().Msg(mesg)
 
@@ -48,7 +48,7 @@ func Test_DeleteEbpfPrograms(t *testing.T) {
 		{
 			name:   "FailedToUnmarshal",
 			Body:   strings.NewReader("Something"),
-			status: http.StatusInternalServerError,
+			status: http.StatusBadRequest,
 			header: map[string]string{},
 			cfg: &kf.NFConfigs{
 				HostConfig: &config.Config{
@@ -0,0 +1,138 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/l3af-project/l3afd/kf"
+)
+
+// GetEvents Returns the lifecycle events of the eBPF Programs on a node
+// @Summary Returns the lifecycle events of the eBPF Programs on a node
+// @Description Returns the journal of program started, stopped, restarted, upgraded, moved, map args updated, root program attached and detached, restart budget exhausted and artifact events, oldest first
+// @Produce  json
+// @Param program query string false "eBPF program name"
+// @Param iface query string false "interface name"
+// @Param since query string false "RFC 3339 time, only events recorded after it are returned"
+// @Param since_seq query int false "sequence number, only events with a higher one are returned"
+// @Success 200
+// @Failure 400
+// @Router /l3af/events [get]
+func GetEvents(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	filter, err := eventFilter(r)
+	if err != nil {
+		mesg = err.Error()
+		statusCode = http.StatusBadRequest
+		return
+	}
+
+	resp, err := json.MarshalIndent(kf.Events().List(filter), "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	mesg = string(resp)
+}
+
+// WatchEvents Streams the lifecycle events of the eBPF Programs on a node
+// @Summary Streams the lifecycle events of the eBPF Programs on a node
+// @Description Streams one JSON event per line, the events recorded after since or since_seq first. The stream ends when the watcher falls behind, reconnect with the seq of the last received event as since_seq
+// @Produce  json
+// @Param program query string false "eBPF program name"
+// @Param iface query string false "interface name"
+// @Param since query string false "RFC 3339 time, only events recorded after it are streamed"
+// @Param since_seq query int false "sequence number, only events with a higher one are streamed"
+// @Success 200
+// @Failure 400
+// @Router /l3af/events/watch [get]
+func WatchEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := eventFilter(r)
+	if err != nil {
+		writeLogsError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Since.IsZero() && filter.SinceSeq == 0 {
+		// without since and since_seq only new events are streamed
+		filter.Since = time.Now()
+	}
+
+	backlog, watcher := kf.Events().Watch(filter)
+	defer watcher.Stop()
+
+	w.Header().Add("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for _, e := range backlog {
+		if err := enc.Encode(e); err != nil {
+			log.Debug().Err(err).Msg("stopped watching events")
+			return
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-watcher.Events():
+			if !ok {
+				return
+			}
+			if err := enc.Encode(e); err != nil {
+				log.Debug().Err(err).Msg("stopped watching events")
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// eventFilter - returns the event filter of the program, iface, since and since_seq query parameters
+func eventFilter(r *http.Request) (kf.EventFilter, error) {
+	query := r.URL.Query()
+	filter := kf.EventFilter{
+		Program: query.Get("program"),
+		Iface:   query.Get("iface"),
+	}
+	if v := query.Get("since"); len(v) > 0 {
+		since, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid since value %s, RFC 3339 time is expected", v)
+		}
+		filter.Since = since
+	}
+	if v := query.Get("since_seq"); len(v) > 0 {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid since_seq value %s, event sequence number is expected", v)
+		}
+		filter.SinceSeq = seq
+	}
+	return filter, nil
+}
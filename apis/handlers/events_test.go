@@ -0,0 +1,94 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/kf"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_GetEvents(t *testing.T) {
+	kf.Events().Record(models.L3afEvent{Reason: models.EventProgramStarted, Program: "evfoo", Iface: "fakeif0"})
+	events := kf.Events().List(kf.EventFilter{})
+	evfoo := events[len(events)-1].Seq
+	kf.Events().Record(models.L3afEvent{Reason: models.EventProgramStarted, Program: "evbar", Iface: "fakeif0"})
+
+	tests := []struct {
+		name      string
+		query     string
+		status    int
+		wantCount int
+	}{
+		{name: "Program", query: "?program=evfoo", status: http.StatusOK, wantCount: 1},
+		{name: "Iface", query: "?iface=fakeif0&program=evbar", status: http.StatusOK, wantCount: 1},
+		{name: "Since", query: "?program=evfoo&since=" + time.Now().Add(time.Hour).Format(time.RFC3339), status: http.StatusOK, wantCount: 0},
+		{name: "InvalidSince", query: "?since=yesterday", status: http.StatusBadRequest},
+		{name: "SinceSeq", query: "?iface=fakeif0&since_seq=" + strconv.FormatUint(evfoo, 10), status: http.StatusOK, wantCount: 1},
+		{name: "InvalidSinceSeq", query: "?since_seq=-1", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/l3af/events"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(GetEvents).ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Fatalf("GetEvents status = %d, want %d: %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var events []models.L3afEvent
+			if err := json.Unmarshal(rr.Body.Bytes(), &events); err != nil {
+				t.Fatalf("GetEvents response is not json: %v", err)
+			}
+			if len(events) != tt.wantCount {
+				t.Errorf("GetEvents returned %v, want %d events", events, tt.wantCount)
+			}
+		})
+	}
+}
+
+func Test_WatchEvents(t *testing.T) {
+	since := time.Now().Add(-time.Millisecond)
+	kf.Events().Record(models.L3afEvent{Reason: models.EventProgramStarted, Program: "watchfoo"})
+
+	srv := httptest.NewServer(http.HandlerFunc(WatchEvents))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?program=watchfoo&since="+since.Format(time.RFC3339Nano), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("watch request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	if !scanner.Scan() {
+		t.Fatalf("backlog event not streamed: %v", scanner.Err())
+	}
+	var e models.L3afEvent
+	if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Reason != models.EventProgramStarted {
+		t.Fatalf("streamed backlog event %s, want started event: %v", scanner.Text(), err)
+	}
+
+	kf.Events().Record(models.L3afEvent{Reason: models.EventProgramStarted, Program: "watchbar"})
+	kf.Events().Record(models.L3afEvent{Reason: models.EventProgramStopped, Program: "watchfoo"})
+	if !scanner.Scan() {
+		t.Fatalf("new event not streamed: %v", scanner.Err())
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Reason != models.EventProgramStopped {
+		t.Errorf("streamed event %s, want stopped event of watchfoo: %v", scanner.Text(), err)
+	}
+}
@@ -4,12 +4,10 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 
 	chi "github.com/go-chi/chi/v5"
 	"github.com/l3af-project/l3afd/kf"
-	"github.com/rs/zerolog/log"
 )
 
 var kfcfgs *kf.NFConfigs
@@ -21,9 +19,9 @@ func InitConfigs(cfgs *kf.NFConfigs) error {
 
 // GetConfig Returns details of the configuration of eBPF Programs for a given interface
 // @Summary Returns details of the configuration of eBPF Programs for a given interface
-// @Description Returns details of the configuration of eBPF Programs for a given interface
+// @Description Returns the desired configuration of eBPF Programs for a given interface as spec and their observed status
 // @Accept  json
-// @Produce  json
+// @Produce  json,yaml
 // @Param iface path string true "interface name"
 // @Success 200
 // @Router /l3af/configs/v1/{iface} [get]
@@ -49,21 +47,22 @@ func GetConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := json.MarshalIndent(kfcfgs.EBPFPrograms(iface), "", "  ")
+	resp, contentType, err := marshalResponse(r, kfcfgs.ProgramState(iface))
 	if err != nil {
 		mesg = "internal server error"
 		log.Error().Msgf("failed to marshal response: %v", err)
 		statusCode = http.StatusInternalServerError
 		return
 	}
+	w.Header().Set("Content-Type", contentType)
 	mesg = string(resp)
 }
 
 // GetConfigAll Returns details of the configuration of eBPF Programs for all interfaces on a node
 // @Summary Returns details of the configuration of eBPF Programs for all interfaces on a node
-// @Description Returns details of the configuration of eBPF Programs for all interfaces on a node
+// @Description Returns the desired configuration of eBPF Programs for all interfaces on a node as spec and their observed status
 // @Accept  json
-// @Produce  json
+// @Produce  json,yaml
 // @Success 200
 // @Router /l3af/configs/v1 [get]
 func GetConfigAll(w http.ResponseWriter, r *http.Request) {
@@ -80,12 +79,13 @@ func GetConfigAll(w http.ResponseWriter, r *http.Request) {
 		}
 	}(&mesg, &statusCode)
 
-	resp, err := json.MarshalIndent(kfcfgs.EBPFProgramsAll(), "", "  ")
+	resp, contentType, err := marshalResponse(r, kfcfgs.ProgramStateAll())
 	if err != nil {
 		mesg = "internal server error"
 		log.Error().Msgf("failed to marshal response: %v", err)
 		statusCode = http.StatusInternalServerError
 		return
 	}
+	w.Header().Set("Content-Type", contentType)
 	mesg = string(resp)
 }
@@ -0,0 +1,47 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+// GetHealth Returns aggregated health of the eBPF Programs on a node
+// @Summary Returns aggregated health of the eBPF Programs on a node
+// @Description Returns aggregated health of the eBPF Programs on a node, responds with 503 if any program is unhealthy
+// @Accept  json
+// @Produce  json
+// @Success 200
+// @Failure 503
+// @Router /l3af/health [get]
+func GetHealth(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	health := kfcfgs.Health()
+	resp, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	if health.Status == models.HealthUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+	mesg = string(resp)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"container/list"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/l3af-project/l3afd/kf"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_GetHealth(t *testing.T) {
+	notEvaluated := list.New()
+	notEvaluated.PushBack(&kf.BPF{Program: models.BPFProgram{Name: "foo", AdminStatus: models.Enabled}})
+	tests := []struct {
+		name   string
+		status int
+		cfg    *kf.NFConfigs
+	}{
+		{
+			name:   "NoPrograms",
+			status: http.StatusOK,
+			cfg:    &kf.NFConfigs{},
+		},
+		{
+			name:   "NotEvaluated",
+			status: http.StatusOK,
+			cfg: &kf.NFConfigs{
+				IngressXDPBpfs: map[string]*list.List{"fakeif0": notEvaluated},
+			},
+		},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "l3af/health", nil)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(GetHealth)
+		InitConfigs(tt.cfg)
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("GetHealth Failed %s", tt.name)
+		}
+	}
+}
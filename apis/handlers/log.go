@@ -0,0 +1,9 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import "github.com/l3af-project/l3afd/logging"
+
+// log - logger of the apis component, its level is set by the component-levels of the [logging] config section
+var log = logging.Component("apis")
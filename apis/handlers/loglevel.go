@@ -0,0 +1,121 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/l3af-project/l3afd/logging"
+	"github.com/l3af-project/l3afd/models"
+)
+
+// GetLogLevel Returns the log levels of l3afd
+// @Summary Returns the log levels of l3afd
+// @Description Returns the root log level and the log level of every component
+// @Produce  json
+// @Success 200
+// @Router /l3af/admin/loglevel [get]
+func GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	resp, err := json.MarshalIndent(logLevels(), "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	mesg = string(resp)
+}
+
+// SetLogLevel Changes the log levels of l3afd
+// @Summary Changes the log levels of l3afd
+// @Description Changes the root log level and the log level of components, an empty component level follows the root level
+// @Accept  json
+// @Produce  json
+// @Param levels body models.L3afLogLevels true "log levels"
+// @Success 200
+// @Failure 400
+// @Router /l3af/admin/loglevel [put]
+func SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	bodyBuffer, err := io.ReadAll(r.Body)
+	if err != nil {
+		mesg = fmt.Sprintf("failed to read request body: %v", err)
+		log.Error().Msg(mesg)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+
+	var levels models.L3afLogLevels
+	if err := json.Unmarshal(bodyBuffer, &levels); err != nil {
+		mesg = fmt.Sprintf("failed to unmarshal payload: %v", err)
+		log.Error().Msg(mesg)
+		statusCode = http.StatusBadRequest
+		return
+	}
+	if len(levels.Level) == 0 && len(levels.Components) == 0 {
+		mesg = "no log level to change"
+		statusCode = http.StatusBadRequest
+		return
+	}
+
+	if err := logging.SetLevels(levels.Level, levels.Components); err != nil {
+		mesg = err.Error()
+		log.Warn().Err(err).Msg("failed to change log levels")
+		statusCode = http.StatusBadRequest
+		return
+	}
+	log.Info().Str("level", levels.Level).Interface("components", levels.Components).Msg("log levels changed")
+
+	resp, err := json.MarshalIndent(logLevels(), "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	mesg = string(resp)
+}
+
+func logLevels() models.L3afLogLevels {
+	root, components := logging.Levels()
+	levels := models.L3afLogLevels{
+		Level:      root.String(),
+		Components: make(map[string]string, len(components)),
+	}
+	for name, level := range components {
+		levels.Components[name] = level.String()
+	}
+	if until := logging.DebugUntil(); !until.IsZero() {
+		levels.DebugUntil = &until
+	}
+	return levels
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/l3af-project/l3afd/logging"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_SetLogLevel(t *testing.T) {
+	t.Cleanup(func() { logging.Setup(logging.Config{}) })
+	tests := []struct {
+		name      string
+		body      string
+		status    int
+		wantLevel string
+		wantAPIs  string
+	}{
+		{
+			name:   "EmptyBody",
+			body:   "",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "NoLevels",
+			body:   `{}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "InvalidLevel",
+			body:   `{"level": "loud"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "UnknownComponent",
+			body:   `{"components": {"foo": "debug"}}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:      "RootAndComponent",
+			body:      `{"level": "warn", "components": {"apis": "debug"}}`,
+			status:    http.StatusOK,
+			wantLevel: "warn",
+			wantAPIs:  "debug",
+		},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("PUT", "/l3af/admin/loglevel", bytes.NewBufferString(tt.body))
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(SetLogLevel)
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("SetLogLevel Failed %s: status %d, want %d", tt.name, rr.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+
+		req, _ = http.NewRequest("GET", "/l3af/admin/loglevel", nil)
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(GetLogLevel).ServeHTTP(rr, req)
+		var levels models.L3afLogLevels
+		if err := json.Unmarshal(rr.Body.Bytes(), &levels); err != nil {
+			t.Fatalf("GetLogLevel returned invalid json: %v", err)
+		}
+		if levels.Level != tt.wantLevel || levels.Components["apis"] != tt.wantAPIs {
+			t.Errorf("GetLogLevel %s = %+v, want level %s apis %s", tt.name, levels, tt.wantLevel, tt.wantAPIs)
+		}
+	}
+}
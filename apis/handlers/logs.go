@@ -0,0 +1,115 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/l3af-project/l3afd/logfile"
+)
+
+const (
+	defaultLogTail = 100
+	maxLogTail     = 10000
+	followInterval = 500 * time.Millisecond
+)
+
+// GetProgramLogs Returns the captured output of the user program of an eBPF Program
+// @Summary Returns the captured output of the user program of an eBPF Program
+// @Description Returns the last lines of the captured stdout and stderr of the user program, follow streams new lines
+// @Produce  plain
+// @Param iface path string true "interface name"
+// @Param direction path string true "xdpingress, ingress or egress"
+// @Param program path string true "eBPF program name"
+// @Param tail query int false "number of lines, default 100"
+// @Param follow query bool false "stream new lines"
+// @Success 200
+// @Failure 400
+// @Failure 404
+// @Router /l3af/logs/{iface}/{direction}/{program} [get]
+func GetProgramLogs(w http.ResponseWriter, r *http.Request) {
+	iface := chi.URLParam(r, "iface")
+	direction := chi.URLParam(r, "direction")
+	program := chi.URLParam(r, "program")
+
+	tail := defaultLogTail
+	if v := r.URL.Query().Get("tail"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeLogsError(w, http.StatusBadRequest, fmt.Sprintf("invalid tail value %s", v))
+			return
+		}
+		tail = n
+	}
+	if tail > maxLogTail {
+		tail = maxLogTail
+	}
+	follow := false
+	if v := r.URL.Query().Get("follow"); len(v) > 0 {
+		var err error
+		if follow, err = strconv.ParseBool(v); err != nil {
+			writeLogsError(w, http.StatusBadRequest, fmt.Sprintf("invalid follow value %s", v))
+			return
+		}
+	}
+
+	path, err := kfcfgs.UserProgramLogPath(iface, direction, program)
+	if err != nil {
+		writeLogsError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	lines, err := logfile.Tail(path, tail)
+	if errors.Is(err, os.ErrNotExist) {
+		writeLogsError(w, http.StatusNotFound, fmt.Sprintf("no output captured for %s", program))
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msgf("failed to read log file %s", path)
+		writeLogsError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if len(lines) > 0 {
+		if _, err := w.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+			return
+		}
+	}
+	if !follow {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	err = logfile.Follow(r.Context(), path, followInterval, func(line string) error {
+		if _, err := w.Write([]byte(line + "\n")); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Debug().Err(err).Msgf("stopped following log file %s", path)
+	}
+}
+
+func writeLogsError(w http.ResponseWriter, statusCode int, mesg string) {
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(statusCode)
+	if _, err := w.Write([]byte(mesg)); err != nil {
+		log.Warn().Msgf("Failed to write response bytes: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/kf"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_GetProgramLogs(t *testing.T) {
+	logDir := t.TempDir()
+	lines := ""
+	for i := 0; i < 5; i++ {
+		lines += fmt.Sprintf("line %d\n", i)
+	}
+	if err := os.WriteFile(filepath.Join(logDir, "foo-fakeif0-xdpingress.log"), []byte(lines), 0640); err != nil {
+		t.Fatal(err)
+	}
+	bpfList := list.New()
+	bpfList.PushBack(kf.NewBpfProgram(context.Background(), models.BPFProgram{Name: "foo", ProgType: models.XDPType},
+		&config.Config{UserProgramLogDir: logDir}, "fakeif0"))
+	bpfList.PushBack(kf.NewBpfProgram(context.Background(), models.BPFProgram{Name: "bar", ProgType: models.XDPType},
+		&config.Config{UserProgramLogDir: logDir}, "fakeif0"))
+	InitConfigs(&kf.NFConfigs{IngressXDPBpfs: map[string]*list.List{"fakeif0": bpfList}})
+
+	tests := []struct {
+		name    string
+		program string
+		query   string
+		status  int
+		body    string
+	}{
+		{
+			name:    "Tail",
+			program: "foo",
+			query:   "?tail=2",
+			status:  http.StatusOK,
+			body:    "line 3\nline 4\n",
+		},
+		{
+			name:    "DefaultTail",
+			program: "foo",
+			status:  http.StatusOK,
+			body:    lines,
+		},
+		{
+			name:    "InvalidTail",
+			program: "foo",
+			query:   "?tail=abc",
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "UnknownProgram",
+			program: "baz",
+			status:  http.StatusNotFound,
+		},
+		{
+			name:    "NoOutput",
+			program: "bar",
+			status:  http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/l3af/logs/fakeif0/xdpingress/"+tt.program+tt.query, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("iface", "fakeif0")
+		rctx.URLParams.Add("direction", models.XDPIngressType)
+		rctx.URLParams.Add("program", tt.program)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(GetProgramLogs).ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("GetProgramLogs %s status = %d, want %d", tt.name, rr.Code, tt.status)
+		}
+		if len(tt.body) > 0 && rr.Body.String() != tt.body {
+			t.Errorf("GetProgramLogs %s body = %q, want %q", tt.name, rr.Body.String(), tt.body)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/l3af-project/l3afd/kf"
+	"github.com/l3af-project/l3afd/models"
+)
+
+const (
+	// maxArtifactSize - limit of an uploaded artifact
+	maxArtifactSize = 256 << 20
+	// maxUploadMemory - part of an upload kept in memory, the rest is stored in temporary files
+	maxUploadMemory = 32 << 20
+)
+
+// InspectPackage Returns the programs and maps of the object files of an eBPF package
+// @Summary Returns the programs and maps of the object files of an eBPF package
+// @Description Downloads the artifact of the package from its repo, or reads the artifact uploaded as multipart/form-data with the fields of the package, and returns the programs, maps, BTF availability, license and required kernel features of its object files without loading them into the kernel
+// @Accept  json,yaml,mpfd
+// @Produce  json
+// @Param package body models.L3afPackage true "eBPF package"
+// @Success 200 {object} models.L3afPackageInfo
+// @Failure 400
+// @Failure 415
+// @Router /l3af/packages/inspect [post]
+func InspectPackage(ctx context.Context, kfcfg *kf.NFConfigs) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		mesg := ""
+		statusCode := http.StatusOK
+
+		w.Header().Add("Content-Type", "application/json")
+
+		defer func(mesg *string, statusCode *int) {
+			w.WriteHeader(*statusCode)
+			_, err := w.Write([]byte(*mesg))
+			if err != nil {
+				log.Warn().Msgf("Failed to write response bytes: %v", err)
+			}
+		}(&mesg, &statusCode)
+
+		if r.Body == nil {
+			mesg = "empty request body"
+			log.Error().Msg(mesg)
+			statusCode = http.StatusBadRequest
+			return
+		}
+
+		var pkg models.L3afPackage
+		var upload io.ReadCloser
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+			var err error
+			if pkg, upload, err = readUpload(w, r); err != nil {
+				mesg = fmt.Sprintf("failed to read uploaded artifact: %v", err)
+				log.Error().Msg(mesg)
+				statusCode = http.StatusBadRequest
+				return
+			}
+			defer upload.Close()
+		} else {
+			bodyBuffer, err := io.ReadAll(r.Body)
+			if err != nil {
+				mesg = fmt.Sprintf("failed to read request body: %v", err)
+				log.Error().Msg(mesg)
+				statusCode = http.StatusInternalServerError
+				return
+			}
+			if code, err := decodePayload(r, bodyBuffer, &pkg); err != nil {
+				mesg = payloadErrorMessage(err)
+				log.Error().Err(err).Msg("failed to decode payload")
+				statusCode = code
+				return
+			}
+		}
+
+		if err := kf.ValidatePackage(pkg); err != nil {
+			mesg = fmt.Sprintf("invalid package: %v", err)
+			log.Error().Msg(mesg)
+			statusCode = http.StatusBadRequest
+			return
+		}
+
+		info, err := kf.InspectPackage(r.Context(), kfcfg.HostConfig, pkg, upload)
+		if err != nil {
+			mesg = fmt.Sprintf("failed to inspect package %s version %s: %v", pkg.Name, pkg.Version, err)
+			log.Error().Msg(mesg)
+			statusCode = http.StatusInternalServerError
+			return
+		}
+
+		resp, contentType, err := marshalResponse(r, info)
+		if err != nil {
+			mesg = "internal server error"
+			log.Error().Msgf("failed to marshal response: %v", err)
+			statusCode = http.StatusInternalServerError
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		mesg = string(resp)
+	}
+}
+
+// readUpload - returns the package described by the form fields and the uploaded artifact file, the artifact defaults
+// to the name of the uploaded file
+func readUpload(w http.ResponseWriter, r *http.Request) (models.L3afPackage, io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxArtifactSize)
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		return models.L3afPackage{}, nil, err
+	}
+	pkg := models.L3afPackage{
+		Name:       r.FormValue("name"),
+		Version:    r.FormValue("version"),
+		Artifact:   r.FormValue("artifact"),
+		ObjectFile: r.FormValue("object_file"),
+		MapName:    r.FormValue("map_name"),
+	}
+	file, header, err := r.FormFile("artifact")
+	if err != nil {
+		return pkg, nil, err
+	}
+	if len(pkg.Artifact) == 0 {
+		pkg.Artifact = filepath.Base(header.Filename)
+	}
+	return pkg, file, nil
+}
@@ -0,0 +1,52 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/kf"
+)
+
+func Test_InspectPackage(t *testing.T) {
+	form := &bytes.Buffer{}
+	mw := multipart.NewWriter(form)
+	mw.WriteField("name", "ratelimiting")
+	mw.WriteField("version", "1.0")
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		status      int
+	}{
+		{name: "UnknownField", body: `{"name": "ratelimiting", "version": "1.0", "artefact": "ratelimiting.tar.gz"}`, status: http.StatusBadRequest},
+		{name: "InvalidPackage", body: `{"name": "ratelimiting", "version": "../1.0", "artifact": "ratelimiting.tar.gz"}`, status: http.StatusBadRequest},
+		{name: "UnsupportedContentType", body: "name=ratelimiting", contentType: "text/plain", status: http.StatusUnsupportedMediaType},
+		{name: "UploadWithoutArtifact", body: form.String(), contentType: mw.FormDataContentType(), status: http.StatusBadRequest},
+		{name: "MissingArtifact", body: "name: ratelimiting\nversion: \"1.0\"\nartifact: ratelimiting.tar.gz\nebpf_package_repo_url: file:///nonexistent\n", contentType: "application/yaml", status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/l3af/packages/inspect", strings.NewReader(tt.body))
+			if len(tt.contentType) > 0 {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler := InspectPackage(context.Background(), &kf.NFConfigs{HostConfig: &config.Config{BPFDir: "/nonexistent"}})
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("InspectPackage() status = %d, want %d: %s", rr.Code, tt.status, rr.Body.String())
+			}
+		})
+	}
+}
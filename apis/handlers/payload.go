@@ -0,0 +1,99 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/l3af-project/l3afd/schema"
+)
+
+// requestFormat - returns the format of the request body by its content type, JSON when it is not set
+func requestFormat(r *http.Request) (schema.Format, error) {
+	return schema.ContentFormat(r.Header.Get("Content-Type"))
+}
+
+// decodePayload - decodes the request body in the format of its content type into v, values not matching the schema
+// of v and unknown fields are rejected. The status code of the failure is returned with the error.
+func decodePayload(r *http.Request, body []byte, v interface{}) (int, error) {
+	format, err := requestFormat(r)
+	if err != nil {
+		return http.StatusUnsupportedMediaType, err
+	}
+	if err := schema.Decode(body, format, v); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// payloadErrorMessage - returns the response body of a payload failure, field errors are listed with their path
+func payloadErrorMessage(err error) string {
+	var fieldErrs schema.Errors
+	if !errors.As(err, &fieldErrs) {
+		return fmt.Sprintf("failed to unmarshal payload: %v", err)
+	}
+	buf, merr := json.MarshalIndent(struct {
+		Errors schema.Errors `json:"errors"`
+	}{Errors: fieldErrs}, "", "  ")
+	if merr != nil {
+		return fmt.Sprintf("invalid payload: %v", err)
+	}
+	return string(buf)
+}
+
+// deployStatus - returns the status code of a failed deploy and its response body, programs rejected by the
+// validation are a bad request listing the problems
+func deployStatus(err error, mesg string) (int, string) {
+	var fieldErrs schema.Errors
+	if errors.As(err, &fieldErrs) {
+		return http.StatusBadRequest, payloadErrorMessage(err)
+	}
+	return http.StatusInternalServerError, mesg
+}
+
+// deployContext - returns the context of a deploy requested by r. The span and author of the request are kept, a
+// client going away does not abort the deploy halfway and leave the chains partially updated.
+func deployContext(r *http.Request) context.Context {
+	return context.WithoutCancel(r.Context())
+}
+
+// acceptsYAML - reports whether the client prefers a YAML response by the Accept header
+func acceptsYAML(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		if schema.MediaFormat(mediaType) == schema.YAML {
+			return true
+		}
+		if mediaType == "application/json" || mediaType == "*/*" || mediaType == "application/*" {
+			return false
+		}
+	}
+	return false
+}
+
+// marshalResponse - returns v as YAML when the client prefers it or else as indented JSON, and its content type
+func marshalResponse(r *http.Request, v interface{}) ([]byte, string, error) {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil || !acceptsYAML(r) {
+		return buf, "application/json", err
+	}
+	// converted from JSON to keep the field names of the json tags
+	var doc interface{}
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return nil, "", err
+	}
+	buf, err = yaml.Marshal(doc)
+	return buf, "application/yaml", err
+}
@@ -0,0 +1,67 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	chi "github.com/go-chi/chi/v5"
+
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/schema"
+)
+
+// payloads - payloads of the config endpoints by endpoint name, their schemas validate the requests
+var payloads = map[string]interface{}{
+	"update":  []models.L3afBPFPrograms{},
+	"add":     []models.L3afBPFPrograms{},
+	"delete":  []models.L3afBPFProgramNames{},
+	"inspect": models.L3afPackage{},
+}
+
+// GetSchema Returns the JSON Schema of the payload of a config endpoint
+// @Summary Returns the JSON Schema of the payload of a config endpoint
+// @Description Returns the JSON Schema generated from the models, requests not matching it are rejected. The payload of the update endpoint is returned without a payload name.
+// @Accept  json
+// @Produce  json
+// @Param payload path string false "update, add, delete or inspect"
+// @Success 200
+// @Router /l3af/schema/{payload} [get]
+func GetSchema(w http.ResponseWriter, r *http.Request) {
+	mesg := ""
+	statusCode := http.StatusOK
+
+	w.Header().Add("Content-Type", "application/schema+json")
+
+	defer func(mesg *string, statusCode *int) {
+		w.WriteHeader(*statusCode)
+		_, err := w.Write([]byte(*mesg))
+		if err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}(&mesg, &statusCode)
+
+	name := chi.URLParam(r, "payload")
+	if len(name) == 0 {
+		name = "update"
+	}
+	payload, ok := payloads[name]
+	if !ok {
+		mesg = fmt.Sprintf("unknown payload %s, use update, add, delete or inspect", name)
+		log.Error().Msg(mesg)
+		statusCode = http.StatusNotFound
+		return
+	}
+
+	resp, err := json.MarshalIndent(schema.For(payload), "", "  ")
+	if err != nil {
+		mesg = "internal server error"
+		log.Error().Msgf("failed to marshal response: %v", err)
+		statusCode = http.StatusInternalServerError
+		return
+	}
+	mesg = string(resp)
+}
@@ -0,0 +1,80 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	chi "github.com/go-chi/chi/v5"
+
+	"github.com/l3af-project/l3afd/schema"
+)
+
+func Test_GetSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		status   int
+		wantItem string
+	}{
+		{name: "Default", payload: "", status: http.StatusOK, wantItem: "#/$defs/L3afBPFPrograms"},
+		{name: "Delete", payload: "delete", status: http.StatusOK, wantItem: "#/$defs/L3afBPFProgramNames"},
+		{name: "Unknown", payload: "rollback", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/l3af/schema/"+tt.payload, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("payload", tt.payload)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+			GetSchema(rr, req)
+			if rr.Code != tt.status {
+				t.Fatalf("GetSchema() status = %d, want %d: %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var s struct {
+				Schema string `json:"$schema"`
+				Items  struct {
+					Ref string `json:"$ref"`
+				} `json:"items"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &s); err != nil || s.Schema != schema.Draft || s.Items.Ref != tt.wantItem {
+				t.Errorf("GetSchema() = %s, want items of %s: %v", rr.Body.String(), tt.wantItem, err)
+			}
+		})
+	}
+}
+
+func Test_marshalResponse(t *testing.T) {
+	v := map[string]interface{}{"iface": "fakeif0", "seq_id": 1}
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		want        string
+	}{
+		{name: "Default", accept: "", contentType: "application/json", want: `"seq_id": 1`},
+		{name: "YAML", accept: "application/yaml", contentType: "application/yaml", want: "seq_id: 1"},
+		{name: "JSONPreferred", accept: "application/json, application/yaml;q=0.5", contentType: "application/json", want: `"seq_id": 1`},
+		{name: "YAMLPreferred", accept: "text/yaml, */*", contentType: "application/yaml", want: "iface: fakeif0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/l3af/configs/v1", nil)
+			req.Header.Set("Accept", tt.accept)
+			buf, contentType, err := marshalResponse(req, v)
+			if err != nil || contentType != tt.contentType || !strings.Contains(string(buf), tt.want) {
+				t.Errorf("marshalResponse() = %s, %s, %v, want %s containing %q", buf, contentType, err, tt.contentType, tt.want)
+			}
+		})
+	}
+}
@@ -5,14 +5,12 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 
 	"net/http"
 
-	"github.com/rs/zerolog/log"
-
+	"github.com/l3af-project/l3afd/authz"
 	"github.com/l3af-project/l3afd/kf"
 	"github.com/l3af-project/l3afd/models"
 )
@@ -20,10 +18,12 @@ import (
 // UpdateConfig Update eBPF Programs configuration
 // @Summary Update eBPF Programs configuration
 // @Description Update eBPF Programs configuration
-// @Accept  json
+// @Accept  json,yaml
 // @Produce  json
 // @Param cfgs body []models.L3afBPFPrograms true "BPF programs"
 // @Success 200
+// @Failure 400
+// @Failure 415
 // @Router /l3af/configs/v1/update [post]
 func UpdateConfig(ctx context.Context, kfcfg *kf.NFConfigs) http.HandlerFunc {
 
@@ -54,18 +54,21 @@ func UpdateConfig(ctx context.Context, kfcfg *kf.NFConfigs) http.HandlerFunc {
 		}
 
 		var t []models.L3afBPFPrograms
-		if err := json.Unmarshal(bodyBuffer, &t); err != nil {
-			mesg = fmt.Sprintf("failed to unmarshal payload: %v", err)
-			log.Error().Msg(mesg)
-			statusCode = http.StatusInternalServerError
+		if code, err := decodePayload(r, bodyBuffer, &t); err != nil {
+			mesg = payloadErrorMessage(err)
+			log.Error().Err(err).Msg("failed to decode payload")
+			statusCode = code
 			return
 		}
 
-		if err := kfcfg.DeployeBPFPrograms(t); err != nil {
+		// a client limited to some interfaces or programs replaces only the programs within its scope
+		t = authz.MergeUnscoped(r.Context(), kfcfg.DesiredPrograms(), t)
+
+		if err := kfcfg.DeployeBPFPrograms(deployContext(r), t); err != nil {
 			mesg = fmt.Sprintf("failed to deploy ebpf programs: %v", err)
 			log.Error().Msg(mesg)
 
-			statusCode = http.StatusInternalServerError
+			statusCode, mesg = deployStatus(err, mesg)
 			return
 		}
 	}
@@ -34,9 +34,67 @@ func Test_UpdateConfig(t *testing.T) {
 		{
 			name:   "FailedToUnmarshal",
 			Body:   strings.NewReader("Something"),
-			status: http.StatusInternalServerError,
+			status: http.StatusBadRequest,
+			header: map[string]string{},
+			cfg: &kf.NFConfigs{
+				HostConfig: &config.Config{
+					L3afConfigStoreFileName: filepath.FromSlash("../../testdata/Test_l3af-config.json"),
+				},
+			},
+		},
+		{
+			name:   "UnknownField",
+			Body:   strings.NewReader(`[{"host_name": "l3af-local-test", "iface": "fakeif0", "bpf_programs": {"xdp_ingress": [{"name": "foo", "seqid": 1}]}}]`),
+			status: http.StatusBadRequest,
+			header: map[string]string{},
+			cfg: &kf.NFConfigs{
+				HostConfig: &config.Config{
+					L3afConfigStoreFileName: filepath.FromSlash("../../testdata/Test_l3af-config.json"),
+				},
+			},
+		},
+		{
+			name:   "InvalidPrograms",
+			Body:   strings.NewReader(`[{"host_name": "l3af-local-test", "iface": "fakeif0", "bpf_programs": {"tc_ingress": [{"name": "foo", "version": "1.0", "prog_type": "xdp"}, {"name": "foo", "version": "1.0"}]}}]`),
+			status: http.StatusBadRequest,
 			header: map[string]string{},
 			cfg: &kf.NFConfigs{
+				HostName: "l3af-local-test",
+				HostConfig: &config.Config{
+					L3afConfigStoreFileName: filepath.FromSlash("../../testdata/Test_l3af-config.json"),
+				},
+			},
+		},
+		{
+			name:   "UnsupportedContentType",
+			Body:   strings.NewReader(dummypayload),
+			status: http.StatusUnsupportedMediaType,
+			header: map[string]string{"Content-Type": "text/plain"},
+			cfg: &kf.NFConfigs{
+				HostConfig: &config.Config{
+					L3afConfigStoreFileName: filepath.FromSlash("../../testdata/Test_l3af-config.json"),
+				},
+			},
+		},
+		{
+			name:   "TOMLUnknownHostName",
+			Body:   strings.NewReader("[[items]]\nhost_name = \"l3af-local-test\"\niface = \"fakeif0\"\n[items.bpf_programs]\nxdp_ingress = []\n"),
+			status: http.StatusInternalServerError,
+			header: map[string]string{"Content-Type": "application/toml"},
+			cfg: &kf.NFConfigs{
+				HostName: "dummy",
+				HostConfig: &config.Config{
+					L3afConfigStoreFileName: filepath.FromSlash("../../testdata/Test_l3af-config.json"),
+				},
+			},
+		},
+		{
+			name:   "YAMLUnknownHostName",
+			Body:   strings.NewReader("- host_name: l3af-local-test\n  iface: fakeif0\n  bpf_programs:\n    xdp_ingress: []\n"),
+			status: http.StatusInternalServerError,
+			header: map[string]string{"Content-Type": "application/yaml"},
+			cfg: &kf.NFConfigs{
+				HostName: "dummy",
 				HostConfig: &config.Config{
 					L3afConfigStoreFileName: filepath.FromSlash("../../testdata/Test_l3af-config.json"),
 				},
@@ -0,0 +1,259 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !configs
+// +build !configs
+
+package apis
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/l3af-project/l3afd/config"
+)
+
+// maxOCSPResponseSize - limit of the OCSP responses read from the responder
+const maxOCSPResponseSize = 1024 * 1024
+
+// ocspCacheEntry holds an OCSP response until it expires
+type ocspCacheEntry struct {
+	status    int
+	revokedAt time.Time
+	expires   time.Time
+}
+
+// revocationChecker rejects revoked client certificates, listed in the CRL file or reported by their OCSP responder
+type revocationChecker struct {
+	crlFile string
+
+	ocspEnabled   bool
+	ocspResponder string
+	ocspFailOpen  bool
+	ocspCacheTTL  time.Duration
+	client        *http.Client
+
+	mu         sync.RWMutex
+	crls       []*x509.RevocationList
+	crlModTime time.Time
+
+	cacheMu sync.Mutex
+	cache   map[string]ocspCacheEntry
+}
+
+// newRevocationChecker - returns the checker of the mTLS config, nil when neither CRL nor OCSP checking is enabled
+func newRevocationChecker(conf *config.Config) (*revocationChecker, error) {
+	if len(conf.MTLSCRLFile) == 0 && !conf.MTLSOCSPEnabled {
+		return nil, nil
+	}
+	r := &revocationChecker{
+		crlFile:       conf.MTLSCRLFile,
+		ocspEnabled:   conf.MTLSOCSPEnabled,
+		ocspResponder: conf.MTLSOCSPResponderURL,
+		ocspFailOpen:  conf.MTLSOCSPFailOpen,
+		ocspCacheTTL:  conf.MTLSOCSPCacheTTL,
+		client:        &http.Client{Timeout: conf.MTLSOCSPTimeout},
+		cache:         make(map[string]ocspCacheEntry),
+	}
+	if len(r.crlFile) > 0 {
+		if err := r.loadCRL(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// loadCRL - reads the PEM or DER encoded CRLs of the CRL file, the current ones are kept when it is invalid
+func (r *revocationChecker) loadCRL() error {
+	info, err := os.Stat(r.crlFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat CRL %s: %v", r.crlFile, err)
+	}
+	buf, err := os.ReadFile(r.crlFile)
+	if err != nil {
+		return fmt.Errorf("failed to read CRL %s: %v", r.crlFile, err)
+	}
+
+	ders := make([][]byte, 0)
+	for block, rest := pem.Decode(buf); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "X509 CRL" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		ders = append(ders, buf)
+	}
+	crls := make([]*x509.RevocationList, 0, len(ders))
+	for _, der := range ders {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return fmt.Errorf("failed to parse CRL %s: %v", r.crlFile, err)
+		}
+		if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+			log.Warn().Str("crl", r.crlFile).Str("issuer", crl.Issuer.String()).Msgf("CRL is stale since %v", crl.NextUpdate)
+		}
+		crls = append(crls, crl)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.crls, r.crlModTime = crls, info.ModTime()
+	log.Info().Str("crl", r.crlFile).Int("crls", len(crls)).Msg("CRL loaded")
+	return nil
+}
+
+// watch - reloads the CRL file whenever it is modified, until ctx is done
+func (r *revocationChecker) watch(ctx context.Context, interval time.Duration) {
+	if len(r.crlFile) == 0 || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.mu.RLock()
+			loaded := r.crlModTime
+			r.mu.RUnlock()
+			if info, err := os.Stat(r.crlFile); err != nil || info.ModTime().Equal(loaded) {
+				continue
+			}
+			if err := r.loadCRL(); err != nil {
+				log.Error().Err(err).Msg("failed to reload CRL, keeping the current one")
+			}
+		}
+	}
+}
+
+// check - returns an error when a certificate of the verified chain is revoked, the leaf certificate first
+func (r *revocationChecker) check(chain []*x509.Certificate) error {
+	for i := 0; i+1 < len(chain); i++ {
+		if err := r.checkCRL(chain[i], chain[i+1]); err != nil {
+			return err
+		}
+	}
+	if r.ocspEnabled && len(chain) > 1 {
+		return r.checkOCSP(chain[0], chain[1])
+	}
+	return nil
+}
+
+// checkCRL - returns an error when a CRL signed by the issuer lists the certificate
+func (r *revocationChecker) checkCRL(cert, issuer *x509.Certificate) error {
+	r.mu.RLock()
+	crls := r.crls
+	r.mu.RUnlock()
+	for _, crl := range crls {
+		if !bytes.Equal(crl.RawIssuer, cert.RawIssuer) {
+			continue
+		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			log.Warn().Err(err).Str("issuer", crl.Issuer.String()).Msg("CRL is not signed by the certificate issuer")
+			continue
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("certificate %s serial %s is revoked on %v", cert.Subject, cert.SerialNumber, entry.RevocationTime)
+			}
+		}
+	}
+	return nil
+}
+
+// checkOCSP - returns an error when the OCSP responder reports the certificate revoked. An unreachable responder
+// or an unknown status is an error unless ocsp fail open is set.
+func (r *revocationChecker) checkOCSP(cert, issuer *x509.Certificate) error {
+	sum := sha256.Sum256(issuer.Raw)
+	key := hex.EncodeToString(sum[:]) + "/" + cert.SerialNumber.String()
+
+	r.cacheMu.Lock()
+	entry, ok := r.cache[key]
+	r.cacheMu.Unlock()
+	if !ok || time.Now().After(entry.expires) {
+		resp, err := r.queryOCSP(cert, issuer)
+		if err != nil {
+			if r.ocspFailOpen {
+				log.Warn().Err(err).Str("subject", cert.Subject.String()).Msg("OCSP check failed, allowing the certificate")
+				return nil
+			}
+			return fmt.Errorf("OCSP check of certificate %s failed: %v", cert.Subject, err)
+		}
+		entry = ocspCacheEntry{status: resp.Status, revokedAt: resp.RevokedAt, expires: time.Now().Add(r.ocspCacheTTL)}
+		if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(entry.expires) {
+			entry.expires = resp.NextUpdate
+		}
+		if resp.Status != ocsp.Unknown {
+			r.cacheMu.Lock()
+			r.cache[key] = entry
+			r.cacheMu.Unlock()
+		}
+	}
+
+	switch entry.status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("certificate %s serial %s is revoked on %v", cert.Subject, cert.SerialNumber, entry.revokedAt)
+	default:
+		if r.ocspFailOpen {
+			log.Warn().Str("subject", cert.Subject.String()).Msg("OCSP status of the certificate is unknown, allowing the certificate")
+			return nil
+		}
+		return fmt.Errorf("OCSP status of certificate %s is unknown", cert.Subject)
+	}
+}
+
+// queryOCSP - requests the status of the certificate from the configured responder or the one of the certificate
+func (r *revocationChecker) queryOCSP(cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	responders := cert.OCSPServer
+	if len(r.ocspResponder) > 0 {
+		responders = []string{r.ocspResponder}
+	}
+	if len(responders) == 0 {
+		return nil, fmt.Errorf("no OCSP responder for certificate %s", cert.Subject)
+	}
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCSP request: %v", err)
+	}
+
+	var lastErr error
+	for _, responder := range responders {
+		httpResp, err := r.client.Post(responder, "application/ocsp-request", bytes.NewReader(req))
+		if err != nil {
+			lastErr = fmt.Errorf("OCSP request to %s failed: %v", responder, err)
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxOCSPResponseSize))
+		httpResp.Body.Close()
+		if err != nil {
+			lastErr = fmt.Errorf("failed to read OCSP response of %s: %v", responder, err)
+			continue
+		}
+		if httpResp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("OCSP responder %s returned status code %d", responder, httpResp.StatusCode)
+			continue
+		}
+		resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+		if err != nil {
+			lastErr = fmt.Errorf("invalid OCSP response of %s: %v", responder, err)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,230 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package apis
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/l3af-project/l3afd/config"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T, cn string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue - returns a client certificate of the CA with the serial number
+func (ca *testCA) issue(t *testing.T, serial int64, ocspServer string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if len(ocspServer) > 0 {
+		tmpl.OCSPServer = []string{ocspServer}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create client certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse client certificate: %v", err)
+	}
+	return cert
+}
+
+// crl - returns the PEM encoded CRL of the CA revoking the serial numbers
+func (ca *testCA) crl(t *testing.T, serials ...int64) []byte {
+	t.Helper()
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(time.Now().UnixNano()),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, serial := range serials {
+		tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries,
+			x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now().Add(-time.Minute)})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, ca.cert, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create CRL: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func TestRevocationCheckerCRL(t *testing.T) {
+	ca, otherCA := newTestCA(t, "ca"), newTestCA(t, "other-ca")
+	crlFile := filepath.Join(t.TempDir(), "crl.pem")
+	// the CRL of another CA with the same name and serial is not trusted
+	forged := newTestCA(t, "ca")
+	if err := os.WriteFile(crlFile, append(append(ca.crl(t, 2), otherCA.crl(t, 3)...), forged.crl(t, 4)...), 0644); err != nil {
+		t.Fatalf("failed to write CRL: %v", err)
+	}
+	r, err := newRevocationChecker(&config.Config{MTLSCRLFile: crlFile})
+	if err != nil {
+		t.Fatalf("newRevocationChecker() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		chain   []*x509.Certificate
+		wantErr bool
+	}{
+		{name: "Good", chain: []*x509.Certificate{ca.issue(t, 5, ""), ca.cert}},
+		{name: "Revoked", chain: []*x509.Certificate{ca.issue(t, 2, ""), ca.cert}, wantErr: true},
+		{name: "RevokedByOtherCA", chain: []*x509.Certificate{ca.issue(t, 3, ""), ca.cert}},
+		{name: "ForgedCRL", chain: []*x509.Certificate{ca.issue(t, 4, ""), ca.cert}},
+		{name: "OtherCARevoked", chain: []*x509.Certificate{otherCA.issue(t, 3, ""), otherCA.cert}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.check(tt.chain); (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// reloaded CRL revokes the good certificate, an invalid one keeps it
+	if err := os.WriteFile(crlFile, ca.crl(t, 5), 0644); err != nil {
+		t.Fatalf("failed to write CRL: %v", err)
+	}
+	if err := r.loadCRL(); err != nil {
+		t.Fatalf("loadCRL() error = %v", err)
+	}
+	if err := os.WriteFile(crlFile, []byte("not a crl"), 0644); err != nil {
+		t.Fatalf("failed to write CRL: %v", err)
+	}
+	if err := r.loadCRL(); err == nil {
+		t.Errorf("loadCRL() of an invalid file succeeded")
+	}
+	if err := r.check([]*x509.Certificate{ca.issue(t, 5, ""), ca.cert}); err == nil {
+		t.Errorf("check() of a certificate revoked by the reloaded CRL succeeded")
+	}
+}
+
+func TestRevocationCheckerOCSP(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	var requests int32
+	var down atomic.Bool
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tmpl := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		switch req.SerialNumber.Int64() {
+		case 2:
+			tmpl.Status, tmpl.RevokedAt = ocsp.Revoked, time.Now().Add(-time.Minute)
+		case 3:
+			tmpl.Status = ocsp.Unknown
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, tmpl, ca.key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+	defer responder.Close()
+
+	tests := []struct {
+		name         string
+		serial       int64
+		failOpen     bool
+		down         bool
+		wantErr      bool
+		wantRequests int32
+	}{
+		{name: "Good", serial: 1, wantRequests: 1},
+		{name: "GoodCached", serial: 1, wantRequests: 0},
+		{name: "Revoked", serial: 2, wantErr: true, wantRequests: 1},
+		{name: "RevokedCached", serial: 2, down: true, wantErr: true, wantRequests: 0},
+		{name: "UnknownFailClosed", serial: 3, wantErr: true, wantRequests: 1},
+		{name: "UnknownFailOpen", serial: 3, failOpen: true, wantRequests: 1},
+		{name: "DownFailClosed", serial: 4, down: true, wantErr: true, wantRequests: 1},
+		{name: "DownFailOpen", serial: 4, down: true, failOpen: true, wantRequests: 1},
+	}
+	r, err := newRevocationChecker(&config.Config{MTLSOCSPEnabled: true, MTLSOCSPTimeout: time.Second, MTLSOCSPCacheTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("newRevocationChecker() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.ocspFailOpen = tt.failOpen
+			down.Store(tt.down)
+			before := atomic.LoadInt32(&requests)
+			if err := r.check([]*x509.Certificate{ca.issue(t, tt.serial, responder.URL), ca.cert}); (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&requests) - before; got != tt.wantRequests {
+				t.Errorf("OCSP requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
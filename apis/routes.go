@@ -5,39 +5,117 @@ package apis
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/l3af-project/l3afd/apis/handlers"
+	"github.com/l3af-project/l3afd/audit"
+	"github.com/l3af-project/l3afd/authz"
+	"github.com/l3af-project/l3afd/configstore"
 	"github.com/l3af-project/l3afd/kf"
 	"github.com/l3af-project/l3afd/routes"
 )
 
 func apiRoutes(ctx context.Context, kfcfg *kf.NFConfigs) []routes.Route {
 
+	// mutating calls are recorded in the audit log with the config changes they made
+	audited := audit.Handler()
+	// every call requires a role of the authorization policy allowing its action
+	authorized := func(action authz.Action) func(http.HandlerFunc) http.HandlerFunc {
+		return authz.Handler(action, kfcfg.DesiredPrograms)
+	}
+	// config revisions saved by mutating calls are recorded with the client as author
+	authored := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			client, _ := audit.ClientIdentity(r)
+			next(w, r.WithContext(configstore.WithAuthor(r.Context(), client)))
+		}
+	}
+
 	r := []routes.Route{
 		{
 			Method:      "POST",
 			Path:        "/l3af/configs/{version}/update",
-			HandlerFunc: handlers.UpdateConfig(ctx, kfcfg),
+			HandlerFunc: audited(authorized(authz.ActionUpdate)(authored(handlers.UpdateConfig(ctx, kfcfg)))),
 		},
 		{
 			Method:      "GET",
 			Path:        "/l3af/configs/{version}/{iface}",
-			HandlerFunc: handlers.GetConfig,
+			HandlerFunc: authorized(authz.ActionRead)(handlers.GetConfig),
 		},
 		{
 			Method:      "GET",
 			Path:        "/l3af/configs/{version}",
-			HandlerFunc: handlers.GetConfigAll,
+			HandlerFunc: authorized(authz.ActionRead)(handlers.GetConfigAll),
 		},
 		{
 			Method:      "POST",
 			Path:        "/l3af/configs/{version}/add",
-			HandlerFunc: handlers.AddEbpfPrograms(ctx, kfcfg),
+			HandlerFunc: audited(authorized(authz.ActionAdd)(authored(handlers.AddEbpfPrograms(ctx, kfcfg)))),
 		},
 		{
 			Method:      "POST",
 			Path:        "/l3af/configs/{version}/delete",
-			HandlerFunc: handlers.DeleteEbpfPrograms(ctx, kfcfg),
+			HandlerFunc: audited(authorized(authz.ActionDelete)(authored(handlers.DeleteEbpfPrograms(ctx, kfcfg)))),
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/configs/history",
+			HandlerFunc: authorized(authz.ActionRead)(handlers.GetConfigHistory),
+		},
+		{
+			Method:      "POST",
+			Path:        "/l3af/configs/rollback/{revision}",
+			HandlerFunc: audited(authorized(authz.ActionAdmin)(authored(handlers.RollbackConfig(ctx, kfcfg)))),
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/schema",
+			HandlerFunc: authorized(authz.ActionReadHost)(handlers.GetSchema),
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/schema/{payload}",
+			HandlerFunc: authorized(authz.ActionReadHost)(handlers.GetSchema),
+		},
+		{
+			Method:      "POST",
+			Path:        "/l3af/packages/inspect",
+			HandlerFunc: authorized(authz.ActionAdmin)(handlers.InspectPackage(ctx, kfcfg)),
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/host/capabilities",
+			HandlerFunc: authorized(authz.ActionReadHost)(handlers.GetCapabilities),
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/health",
+			HandlerFunc: authorized(authz.ActionRead)(handlers.GetHealth),
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/logs/{iface}/{direction}/{program}",
+			HandlerFunc: authorized(authz.ActionRead)(handlers.GetProgramLogs),
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/events",
+			HandlerFunc: authorized(authz.ActionRead)(handlers.GetEvents),
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/events/watch",
+			HandlerFunc: authorized(authz.ActionRead)(handlers.WatchEvents),
+		},
+		{
+			Method:      "GET",
+			Path:        "/l3af/admin/loglevel",
+			HandlerFunc: authorized(authz.ActionReadHost)(handlers.GetLogLevel),
+		},
+		{
+			Method:      "PUT",
+			Path:        "/l3af/admin/loglevel",
+			HandlerFunc: audited(authorized(authz.ActionAdmin)(handlers.SetLogLevel)),
 		},
 	}
 
@@ -0,0 +1,306 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package audit records who changed the eBPF program configs of l3afd, one JSON line per mutating API call.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/l3af-project/l3afd/logfile"
+	"github.com/l3af-project/l3afd/logging"
+	"github.com/l3af-project/l3afd/models"
+)
+
+// log - logger of the audit component
+var log = logging.Component("audit")
+
+// Outcomes of the audited API calls
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Change actions of the eBPF programs
+const (
+	ActionAdded   = "added"
+	ActionRemoved = "removed"
+	ActionChanged = "changed"
+)
+
+// Config defines where the audit entries are written
+type Config struct {
+	Enabled    bool
+	FileName   string
+	MaxSizeMB  int
+	MaxBackups int
+	// Syslog forwards the entries to syslog in addition to the file
+	Syslog        bool
+	SyslogNetwork string
+	SyslogAddr    string
+	SyslogTag     string
+}
+
+// Change defines the change of one eBPF program made by an API call
+type Change struct {
+	Iface      string   `json:"iface"`
+	Direction  string   `json:"direction"`
+	Program    string   `json:"program"`
+	Action     string   `json:"action"`                // added, removed or changed
+	OldVersion string   `json:"old_version,omitempty"` // version before the call
+	NewVersion string   `json:"new_version,omitempty"` // version after the call
+	Fields     []string `json:"fields,omitempty"`      // changed program fields
+}
+
+// Entry defines the audit record of a mutating API call
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Client     string    `json:"client"`                // client certificate common name, or remote address without mTLS
+	ClientSANs []string  `json:"client_sans,omitempty"` // DNS names of the client certificate
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	Endpoint   string    `json:"endpoint"`
+	BodySHA256 string    `json:"body_sha256"`
+	Status     int       `json:"status"`
+	Outcome    string    `json:"outcome"` // success or failure
+	Changes    []Change  `json:"changes"`
+}
+
+var (
+	mu  sync.Mutex
+	out []io.WriteCloser
+)
+
+// Setup - opens the audit file and the syslog connection, replacing the previous ones
+func Setup(cfg Config) error {
+	var writers []io.WriteCloser
+	if cfg.Enabled {
+		w, err := logfile.NewWriter(cfg.FileName, int64(cfg.MaxSizeMB)*1024*1024, cfg.MaxBackups)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log %s: %v", cfg.FileName, err)
+		}
+		writers = append(writers, w)
+		if cfg.Syslog {
+			s, err := newSyslogWriter(cfg.SyslogNetwork, cfg.SyslogAddr, cfg.SyslogTag)
+			if err != nil {
+				w.Close()
+				return err
+			}
+			writers = append(writers, s)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, w := range out {
+		w.Close()
+	}
+	out = writers
+	return nil
+}
+
+// Record - appends the entry to the audit log
+func Record(e Entry) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal audit entry")
+		return
+	}
+	line = append(line, '\n')
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, w := range out {
+		if _, err := w.Write(line); err != nil {
+			log.Error().Err(err).Str("endpoint", e.Endpoint).Str("client", e.Client).Msg("failed to write audit entry")
+		}
+	}
+}
+
+// statusRecorder keeps the status code written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// changeRecorder keeps the changes applied by an audited call
+type changeRecorder struct {
+	mu      sync.Mutex
+	changes []Change
+}
+
+type recorderKey struct{}
+
+// RecordChanges - records the changes a call applied to the eBPF program configs in the audit entry of the API call
+// of ctx. The changes are computed where they are applied, so concurrent calls do not show up in each other's entries.
+// Changes outside of audited API calls are ignored.
+func RecordChanges(ctx context.Context, changes []Change) {
+	rec, ok := ctx.Value(recorderKey{}).(*changeRecorder)
+	if !ok {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.changes = append(rec.changes, changes...)
+}
+
+// Handler - returns a wrapper recording an audit entry for every call of a mutating handler, with the changes the
+// handler recorded with RecordChanges.
+func Handler() func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var body []byte
+			if r.Body != nil {
+				var err error
+				if body, err = io.ReadAll(r.Body); err != nil {
+					log.Warn().Err(err).Msg("failed to read request body")
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			sum := sha256.Sum256(body)
+
+			changes := &changeRecorder{changes: make([]Change, 0)}
+			r = r.WithContext(context.WithValue(r.Context(), recorderKey{}, changes))
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next(rec, r)
+
+			changes.mu.Lock()
+			defer changes.mu.Unlock()
+
+			e := Entry{
+				Time:       time.Now(),
+				RemoteAddr: r.RemoteAddr,
+				Method:     r.Method,
+				Endpoint:   r.URL.Path,
+				BodySHA256: hex.EncodeToString(sum[:]),
+				Status:     rec.status,
+				Outcome:    OutcomeSuccess,
+				Changes:    changes.changes,
+			}
+			e.Client, e.ClientSANs = ClientIdentity(r)
+			if rec.status >= http.StatusBadRequest {
+				e.Outcome = OutcomeFailure
+			}
+			Record(e)
+		}
+	}
+}
+
+// ClientIdentity - returns the common name and DNS names of the client certificate, or the remote address without mTLS
+func ClientIdentity(r *http.Request) (string, []string) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert := r.TLS.PeerCertificates[0]
+		if len(cert.Subject.CommonName) > 0 {
+			return cert.Subject.CommonName, cert.DNSNames
+		}
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0], cert.DNSNames
+		}
+	}
+	return r.RemoteAddr, nil
+}
+
+// programKey identifies an eBPF program on a node
+type programKey struct {
+	iface, direction, name string
+}
+
+// programs - flattens the configs into the programs of every iface and direction
+func programs(cfgs []models.L3afBPFPrograms) map[programKey]models.BPFProgram {
+	progs := make(map[programKey]models.BPFProgram)
+	for _, cfg := range cfgs {
+		if cfg.BpfPrograms == nil {
+			continue
+		}
+		for direction, list := range map[string][]*models.BPFProgram{
+			models.XDPIngressType: cfg.BpfPrograms.XDPIngress,
+			models.IngressType:    cfg.BpfPrograms.TCIngress,
+			models.EgressType:     cfg.BpfPrograms.TCEgress,
+		} {
+			for _, prog := range list {
+				if prog != nil {
+					progs[programKey{cfg.Iface, direction, prog.Name}] = *prog
+				}
+			}
+		}
+	}
+	return progs
+}
+
+// Diff - returns the programs added, removed or changed between the before and after configs
+func Diff(before, after []models.L3afBPFPrograms) []Change {
+	oldProgs, newProgs := programs(before), programs(after)
+	changes := make([]Change, 0)
+	for key, newProg := range newProgs {
+		change := Change{Iface: key.iface, Direction: key.direction, Program: key.name, NewVersion: newProg.Version}
+		oldProg, ok := oldProgs[key]
+		if !ok {
+			change.Action = ActionAdded
+			changes = append(changes, change)
+			continue
+		}
+		if fields := changedFields(oldProg, newProg); len(fields) > 0 {
+			change.Action = ActionChanged
+			change.OldVersion = oldProg.Version
+			change.Fields = fields
+			changes = append(changes, change)
+		}
+	}
+	for key, oldProg := range oldProgs {
+		if _, ok := newProgs[key]; !ok {
+			changes = append(changes, Change{Iface: key.iface, Direction: key.direction, Program: key.name, Action: ActionRemoved, OldVersion: oldProg.Version})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Iface != b.Iface {
+			return a.Iface < b.Iface
+		}
+		if a.Direction != b.Direction {
+			return a.Direction < b.Direction
+		}
+		return a.Program < b.Program
+	})
+	return changes
+}
+
+// changedFields - returns the json names of the program fields that differ
+func changedFields(oldProg, newProg models.BPFProgram) []string {
+	oldFields, newFields := fieldsOf(oldProg), fieldsOf(newProg)
+	fields := make([]string, 0)
+	for name, value := range newFields {
+		if !reflect.DeepEqual(oldFields[name], value) {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func fieldsOf(prog models.BPFProgram) map[string]interface{} {
+	fields := map[string]interface{}{}
+	buf, err := json.Marshal(prog)
+	if err != nil {
+		return fields
+	}
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		log.Warn().Err(err).Str("program", prog.Name).Msg("failed to compare program fields")
+	}
+	return fields
+}
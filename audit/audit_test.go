@@ -0,0 +1,154 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/l3af-project/l3afd/logfile"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func config(iface string, progs ...*models.BPFProgram) []models.L3afBPFPrograms {
+	return []models.L3afBPFPrograms{{
+		HostName:    "l3af-local-test",
+		Iface:       iface,
+		BpfPrograms: &models.BPFPrograms{XDPIngress: progs},
+	}}
+}
+
+func TestHandler(t *testing.T) {
+	t.Cleanup(func() { Setup(Config{}) })
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := Setup(Config{Enabled: true, FileName: path, MaxSizeMB: 1, MaxBackups: 1}); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	cfg := config("fakeif0", &models.BPFProgram{Name: "ratelimiting", Version: "1.0"})
+	deploy := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "invalid") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		before := cfg
+		cfg = config("fakeif0", &models.BPFProgram{Name: "ratelimiting", Version: "1.1"})
+		RecordChanges(r.Context(), Diff(before, cfg))
+		// changes of other calls, e.g. of the remote config, are not recorded in the entry
+		RecordChanges(context.Background(), Diff(nil, config("fakeif1", &models.BPFProgram{Name: "connection-limit", Version: "1.0"})))
+	}
+	handler := Handler()(deploy)
+
+	tests := []struct {
+		name        string
+		body        string
+		tls         *tls.ConnectionState
+		wantClient  string
+		wantStatus  int
+		wantOutcome string
+		wantChanges int
+	}{
+		{
+			name: "ClientCertificate",
+			body: `[{"iface":"fakeif0"}]`,
+			tls: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+				Subject:  pkix.Name{CommonName: "l3af-controller"},
+				DNSNames: []string{"l3afd.l3af.io"},
+			}}},
+			wantClient:  "l3af-controller",
+			wantStatus:  http.StatusOK,
+			wantOutcome: OutcomeSuccess,
+			wantChanges: 1,
+		},
+		{
+			name:        "RemoteAddr",
+			body:        `invalid`,
+			wantClient:  "192.0.2.1:1234",
+			wantStatus:  http.StatusInternalServerError,
+			wantOutcome: OutcomeFailure,
+			wantChanges: 0,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/l3af/configs/v1/update", strings.NewReader(tt.body))
+			req.TLS = tt.tls
+			handler(httptest.NewRecorder(), req)
+
+			lines, err := logfile.Tail(path, 10)
+			if err != nil || len(lines) != i+1 {
+				t.Fatalf("audit log has %d lines %v, want %d: %v", len(lines), lines, i+1, err)
+			}
+			var e Entry
+			if err := json.Unmarshal([]byte(lines[i]), &e); err != nil {
+				t.Fatalf("audit entry %s is not json: %v", lines[i], err)
+			}
+			sum := sha256.Sum256([]byte(tt.body))
+			if e.Client != tt.wantClient || e.Status != tt.wantStatus || e.Outcome != tt.wantOutcome {
+				t.Errorf("entry client %s status %d outcome %s, want %s %d %s", e.Client, e.Status, e.Outcome, tt.wantClient, tt.wantStatus, tt.wantOutcome)
+			}
+			if e.BodySHA256 != hex.EncodeToString(sum[:]) || e.Endpoint != "/l3af/configs/v1/update" || e.Method != http.MethodPost {
+				t.Errorf("entry %+v does not match the request", e)
+			}
+			if len(e.Changes) != tt.wantChanges {
+				t.Errorf("entry changes %v, want %d", e.Changes, tt.wantChanges)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before []models.L3afBPFPrograms
+		after  []models.L3afBPFPrograms
+		want   []Change
+	}{
+		{
+			name:   "NoChange",
+			before: config("fakeif0", &models.BPFProgram{Name: "foo", Version: "1.0"}),
+			after:  config("fakeif0", &models.BPFProgram{Name: "foo", Version: "1.0"}),
+			want:   []Change{},
+		},
+		{
+			name:   "Added",
+			before: nil,
+			after:  config("fakeif0", &models.BPFProgram{Name: "foo", Version: "1.0"}),
+			want:   []Change{{Iface: "fakeif0", Direction: models.XDPIngressType, Program: "foo", Action: ActionAdded, NewVersion: "1.0"}},
+		},
+		{
+			name:   "Removed",
+			before: config("fakeif0", &models.BPFProgram{Name: "foo", Version: "1.0"}),
+			after:  config("fakeif0"),
+			want:   []Change{{Iface: "fakeif0", Direction: models.XDPIngressType, Program: "foo", Action: ActionRemoved, OldVersion: "1.0"}},
+		},
+		{
+			name:   "Changed",
+			before: config("fakeif0", &models.BPFProgram{Name: "foo", Version: "1.0", SeqID: 1}),
+			after:  config("fakeif0", &models.BPFProgram{Name: "foo", Version: "1.1", SeqID: 2}),
+			want: []Change{{Iface: "fakeif0", Direction: models.XDPIngressType, Program: "foo", Action: ActionChanged,
+				OldVersion: "1.0", NewVersion: "1.1", Fields: []string{"seq_id", "version"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package audit
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+)
+
+// newSyslogWriter - returns a writer sending the audit entries to syslog with the auth facility,
+// an empty network and addr connect to the local syslog server
+func newSyslogWriter(network, addr, tag string) (io.WriteCloser, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_AUTH|syslog.LOG_NOTICE, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog %s %s: %v", network, addr, err)
+	}
+	return w, nil
+}
@@ -0,0 +1,546 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package authz authorizes the API calls of mTLS clients with the roles of a policy file.
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+
+	"github.com/l3af-project/l3afd/audit"
+	"github.com/l3af-project/l3afd/logging"
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/schema"
+)
+
+// log - logger of the authz component
+var log = logging.Component("authz")
+
+// Roles, every role includes the permissions of the previous ones
+const (
+	RoleReadOnly = "read-only"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roleRanks = map[string]int{RoleReadOnly: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// operatorFields - program fields an operator is allowed to change
+var operatorFields = map[string]bool{"map_args": true, "admin_status": true}
+
+// Action defines what an API call does
+type Action int
+
+const (
+	// ActionRead - returns configs, health, events or logs, bindings limited to interfaces or programs are only
+	// allowed when the call names an interface or program within their scope
+	ActionRead Action = iota
+	// ActionReadHost - returns what is not about interfaces or programs, e.g. the schemas and the kernel capabilities
+	ActionReadHost
+	// ActionUpdate - replaces the programs of all interfaces, the ones missing in the request are removed
+	ActionUpdate
+	// ActionAdd - adds programs to interfaces
+	ActionAdd
+	// ActionDelete - removes programs from interfaces
+	ActionDelete
+	// ActionAdmin - changes l3afd itself or all of its configs, e.g. log levels and config rollbacks
+	ActionAdmin
+)
+
+// Binding grants a role to the clients matching its identity patterns. A client matches when every non-empty
+// pattern list has a match, a binding without patterns matches every client.
+type Binding struct {
+	Name string   `json:"name"`
+	SANs []string `json:"sans,omitempty"` // regular expressions of the DNS names of the client certificate
+	CNs  []string `json:"cns,omitempty"`  // regular expressions of the common name of the client certificate
+	OUs  []string `json:"ous,omitempty"`  // regular expressions of the organizational units of the client certificate
+	Role string   `json:"role"`           // read-only, operator or admin
+	// Ifaces and Programs limit the role to interfaces and programs matching these glob patterns
+	Ifaces   []string `json:"ifaces,omitempty"`
+	Programs []string `json:"programs,omitempty"`
+
+	sans, cns, ous []*regexp.Regexp
+}
+
+// Policy defines the roles of the API clients
+type Policy struct {
+	Bindings []*Binding `json:"bindings"`
+}
+
+// identity defines the client of an API call
+type identity struct {
+	sans []string
+	cn   string
+	ous  []string
+}
+
+func (id identity) String() string {
+	if len(id.cn) > 0 {
+		return id.cn
+	}
+	if len(id.sans) > 0 {
+		return id.sans[0]
+	}
+	return "anonymous"
+}
+
+var (
+	mu         sync.RWMutex
+	policy     *Policy
+	policyFile string
+	modTime    time.Time
+)
+
+// Setup - loads the policy file, an empty file disables the authorization and every call is allowed
+func Setup(file string) error {
+	if len(file) == 0 {
+		mu.Lock()
+		defer mu.Unlock()
+		policy, policyFile, modTime = nil, "", time.Time{}
+		return nil
+	}
+	mu.Lock()
+	policyFile = file
+	mu.Unlock()
+	return Reload()
+}
+
+// Reload - reloads the policy file, the current policy is kept when the file is invalid
+func Reload() error {
+	mu.RLock()
+	file := policyFile
+	mu.RUnlock()
+	if len(file) == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("failed to read authorization policy %s: %v", file, err)
+	}
+	p, err := Load(file)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	policy, modTime = p, info.ModTime()
+	log.Info().Str("path", file).Int("bindings", len(p.Bindings)).Msg("authorization policy loaded")
+	return nil
+}
+
+// Watch - reloads the policy file whenever it is modified, until ctx is done
+func Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			mu.RLock()
+			file, loaded := policyFile, modTime
+			mu.RUnlock()
+			if len(file) == 0 {
+				continue
+			}
+			if info, err := os.Stat(file); err != nil || info.ModTime().Equal(loaded) {
+				continue
+			}
+			if err := Reload(); err != nil {
+				log.Error().Err(err).Msg("failed to reload authorization policy, keeping the previous one")
+			}
+		}
+	}
+}
+
+// Load - reads and validates the policy file
+func Load(file string) (*Policy, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorization policy %s: %v", file, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	p := &Policy{}
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("failed to parse authorization policy %s: %v", file, err)
+	}
+	for i, b := range p.Bindings {
+		if err := b.compile(); err != nil {
+			return nil, fmt.Errorf("invalid binding %d %s of authorization policy %s: %v", i, b.Name, file, err)
+		}
+	}
+	return p, nil
+}
+
+// compile - validates the role and the patterns of the binding
+func (b *Binding) compile() error {
+	if _, ok := roleRanks[b.Role]; !ok {
+		return fmt.Errorf("unknown role %q, expected %s, %s or %s", b.Role, RoleReadOnly, RoleOperator, RoleAdmin)
+	}
+	var err error
+	if b.sans, err = compileAll(b.SANs); err != nil {
+		return err
+	}
+	if b.cns, err = compileAll(b.CNs); err != nil {
+		return err
+	}
+	if b.ous, err = compileAll(b.OUs); err != nil {
+		return err
+	}
+	for _, pattern := range append(append([]string{}, b.Ifaces...), b.Programs...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", pattern, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchAny(res []*regexp.Regexp, values ...string) bool {
+	for _, re := range res {
+		for _, v := range values {
+			if re.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func globAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matches - reports whether the binding applies to the client
+func (b *Binding) matches(id identity) bool {
+	if len(b.sans) > 0 && !matchAny(b.sans, id.sans...) {
+		return false
+	}
+	if len(b.cns) > 0 && !matchAny(b.cns, id.cn) {
+		return false
+	}
+	if len(b.ous) > 0 && !matchAny(b.ous, id.ous...) {
+		return false
+	}
+	return true
+}
+
+// scoped - reports whether the iface and program are within the scope of the binding, empty values are not checked
+func (b *Binding) scoped(iface, program string) bool {
+	if len(iface) > 0 && !globAny(b.Ifaces, iface) {
+		return false
+	}
+	if len(program) > 0 && !globAny(b.Programs, program) {
+		return false
+	}
+	return true
+}
+
+// request defines what an API call is about to change
+type request struct {
+	action  Action
+	iface   string
+	program string
+	changes []audit.Change
+	// current and configs are the desired programs before and after an update call
+	current, configs []models.L3afBPFPrograms
+}
+
+// limited - reports whether the binding is limited to some interfaces or programs
+func (b *Binding) limited() bool {
+	return len(b.Ifaces) > 0 || len(b.Programs) > 0
+}
+
+// merge - returns the configs of an update call with the current programs out of the scope of the binding added,
+// a limited binding replaces the programs within its scope only
+func (b *Binding) merge(current, cfgs []models.L3afBPFPrograms) []models.L3afBPFPrograms {
+	if !b.limited() {
+		return cfgs
+	}
+	merged := make([]models.L3afBPFPrograms, 0, len(cfgs))
+	index := make(map[string]int, len(cfgs))
+	for _, cfg := range cfgs {
+		progs := &models.BPFPrograms{}
+		if cfg.BpfPrograms != nil {
+			*progs = *cfg.BpfPrograms
+		}
+		cfg.BpfPrograms = progs
+		index[cfg.Iface] = len(merged)
+		merged = append(merged, cfg)
+	}
+	requested := programNames(cfgs)
+	for _, cfg := range current {
+		if cfg.BpfPrograms == nil {
+			continue
+		}
+		for direction, progs := range directions(cfg.BpfPrograms) {
+			for _, prog := range *progs {
+				if prog == nil || b.scoped(cfg.Iface, prog.Name) || requested[cfg.Iface+"/"+direction+"/"+prog.Name] {
+					continue
+				}
+				i, ok := index[cfg.Iface]
+				if !ok {
+					i = len(merged)
+					index[cfg.Iface] = i
+					merged = append(merged, models.L3afBPFPrograms{HostName: cfg.HostName, Iface: cfg.Iface, BpfPrograms: &models.BPFPrograms{}})
+				}
+				// the full slice expression keeps the programs of the request unchanged
+				list := directions(merged[i].BpfPrograms)[direction]
+				*list = append((*list)[:len(*list):len(*list)], prog)
+			}
+		}
+	}
+	return merged
+}
+
+// directions - returns the program lists of the config by direction
+func directions(progs *models.BPFPrograms) map[string]*[]*models.BPFProgram {
+	return map[string]*[]*models.BPFProgram{
+		models.XDPIngressType: &progs.XDPIngress,
+		models.IngressType:    &progs.TCIngress,
+		models.EgressType:     &progs.TCEgress,
+	}
+}
+
+// programNames - returns the iface/direction/name keys of the programs of the configs
+func programNames(cfgs []models.L3afBPFPrograms) map[string]bool {
+	names := make(map[string]bool)
+	for _, c := range audit.Diff(nil, cfgs) {
+		names[c.Iface+"/"+c.Direction+"/"+c.Program] = true
+	}
+	return names
+}
+
+// allows - returns why the binding does not allow the request, empty when it does
+func (b *Binding) allows(req request) string {
+	rank := roleRanks[b.Role]
+	switch req.action {
+	case ActionReadHost:
+		return ""
+	case ActionRead:
+		if len(b.Ifaces) > 0 && len(req.iface) == 0 {
+			return fmt.Sprintf("role %s of binding %s is limited to ifaces %s, the call must select an iface", b.Role, b.Name, strings.Join(b.Ifaces, ", "))
+		}
+		if len(b.Programs) > 0 && len(req.program) == 0 {
+			return fmt.Sprintf("role %s of binding %s is limited to programs %s, the call must select a program", b.Role, b.Name, strings.Join(b.Programs, ", "))
+		}
+		if !b.scoped(req.iface, req.program) {
+			return fmt.Sprintf("role %s of binding %s is not scoped to iface %s program %s", b.Role, b.Name, req.iface, req.program)
+		}
+		return ""
+	case ActionAdmin:
+		if rank < roleRanks[RoleAdmin] || len(b.Ifaces) > 0 || len(b.Programs) > 0 {
+			return fmt.Sprintf("role %s of binding %s is not allowed to change l3afd, an unscoped admin role is required", b.Role, b.Name)
+		}
+		return ""
+	case ActionUpdate:
+		if rank < roleRanks[RoleOperator] {
+			return fmt.Sprintf("role %s of binding %s is not allowed to change programs", b.Role, b.Name)
+		}
+		req.changes = audit.Diff(req.current, b.merge(req.current, req.configs))
+	default:
+		if rank < roleRanks[RoleAdmin] {
+			return fmt.Sprintf("role %s of binding %s is not allowed to add or delete programs", b.Role, b.Name)
+		}
+	}
+
+	for _, c := range req.changes {
+		if !b.scoped(c.Iface, c.Program) {
+			return fmt.Sprintf("role %s of binding %s is not scoped to program %s on iface %s", b.Role, b.Name, c.Program, c.Iface)
+		}
+		if rank >= roleRanks[RoleAdmin] {
+			continue
+		}
+		if c.Action != audit.ActionChanged {
+			return fmt.Sprintf("role %s of binding %s may not have program %s %s on iface %s", b.Role, b.Name, c.Program, c.Action, c.Iface)
+		}
+		for _, field := range c.Fields {
+			if !operatorFields[field] {
+				return fmt.Sprintf("role %s of binding %s may only change map_args and admin_status, %s of program %s on iface %s is changed",
+					b.Role, b.Name, field, c.Program, c.Iface)
+			}
+		}
+	}
+	return ""
+}
+
+// authorize - returns the binding allowing the client to make the request, or why none does. The binding is nil
+// when the authorization is disabled.
+func authorize(id identity, req request) (*Binding, string) {
+	mu.RLock()
+	p := policy
+	mu.RUnlock()
+	if p == nil {
+		return nil, ""
+	}
+
+	reasons := make([]string, 0)
+	for _, b := range p.Bindings {
+		if !b.matches(id) {
+			continue
+		}
+		reason := b.allows(req)
+		if len(reason) == 0 {
+			return b, ""
+		}
+		reasons = append(reasons, reason)
+	}
+	if len(reasons) == 0 {
+		return nil, fmt.Sprintf("client %s does not match any binding of the authorization policy", id)
+	}
+	return nil, fmt.Sprintf("client %s is not authorized: %s", id, strings.Join(reasons, "; "))
+}
+
+type bindingKey struct{}
+
+// MergeUnscoped - returns the configs of an update call allowed to a binding limited to some interfaces or programs,
+// with the current programs out of its scope added so they are kept. The configs are returned unchanged for
+// unlimited bindings and without authorization.
+func MergeUnscoped(ctx context.Context, current, cfgs []models.L3afBPFPrograms) []models.L3afBPFPrograms {
+	b, ok := ctx.Value(bindingKey{}).(*Binding)
+	if !ok {
+		return cfgs
+	}
+	return b.merge(current, cfgs)
+}
+
+// clientIdentity - returns the identity of the client certificate, empty without mTLS
+func clientIdentity(r *http.Request) identity {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return identity{}
+	}
+	cert := r.TLS.PeerCertificates[0]
+	return identity{sans: cert.DNSNames, cn: cert.Subject.CommonName, ous: cert.Subject.OrganizationalUnit}
+}
+
+// param - returns the url parameter, or the query parameter selecting the events of an iface or program
+func param(r *http.Request, name string) string {
+	if v := chi.URLParam(r, name); len(v) > 0 {
+		return v
+	}
+	return r.URL.Query().Get(name)
+}
+
+// Handler - returns a wrapper rejecting calls with 403 unless the policy grants the action to the client,
+// snapshot returns the current eBPF program configs the changes of update calls are computed against.
+func Handler(action Action, snapshot func() []models.L3afBPFPrograms) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.RLock()
+			enabled := policy != nil
+			mu.RUnlock()
+			if !enabled {
+				next(w, r)
+				return
+			}
+
+			req := request{action: action, iface: param(r, "iface"), program: param(r, "program")}
+			if action == ActionUpdate || action == ActionAdd || action == ActionDelete {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				format, err := schema.ContentFormat(r.Header.Get("Content-Type"))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+					return
+				}
+				if err = decodeRequest(&req, body, format, snapshot); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+
+			id := clientIdentity(r)
+			b, reason := authorize(id, req)
+			if len(reason) > 0 {
+				log.Warn().Str("client", id.String()).Str("endpoint", r.URL.Path).Str("reason", reason).Msg("API call denied")
+				http.Error(w, reason, http.StatusForbidden)
+				return
+			}
+			if b != nil && b.limited() {
+				r = r.WithContext(context.WithValue(r.Context(), bindingKey{}, b))
+			}
+			next(w, r)
+		}
+	}
+}
+
+// decodeRequest - sets the programs the update, add or delete call changes, the body is decoded in its format
+// like the handlers do. The changes of an update depend on the scope of the binding, they are computed per binding.
+func decodeRequest(req *request, body []byte, format schema.Format, snapshot func() []models.L3afBPFPrograms) error {
+	if req.action == ActionDelete {
+		var names []models.L3afBPFProgramNames
+		if err := schema.Decode(body, format, &names); err != nil {
+			return err
+		}
+		changes := make([]audit.Change, 0)
+		for _, n := range names {
+			if n.BpfProgramNames == nil {
+				continue
+			}
+			for direction, progs := range map[string][]string{
+				models.XDPIngressType: n.BpfProgramNames.XDPIngress,
+				models.IngressType:    n.BpfProgramNames.TCIngress,
+				models.EgressType:     n.BpfProgramNames.TCEgress,
+			} {
+				for _, name := range progs {
+					changes = append(changes, audit.Change{Iface: n.Iface, Direction: direction, Program: name, Action: audit.ActionRemoved})
+				}
+			}
+		}
+		req.changes = changes
+		return nil
+	}
+
+	var cfgs []models.L3afBPFPrograms
+	if err := schema.Decode(body, format, &cfgs); err != nil {
+		return err
+	}
+	if req.action == ActionAdd {
+		req.changes = audit.Diff(nil, cfgs)
+		return nil
+	}
+	req.current, req.configs = snapshot(), cfgs
+	return nil
+}
@@ -0,0 +1,346 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package authz
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/l3af-project/l3afd/audit"
+	"github.com/l3af-project/l3afd/models"
+)
+
+const testPolicy = `{
+  "bindings": [
+    {"name": "controller", "sans": ["^controller\\.l3af\\.io$"], "role": "admin"},
+    {"name": "netops", "ous": ["^netops$"], "role": "operator", "ifaces": ["fakeif*"], "programs": ["ratelimiting"]},
+    {"name": "scoped-admin", "cns": ["^oncall$"], "role": "admin", "ifaces": ["fakeif0"]},
+    {"name": "monitoring", "cns": ["^prometheus$"], "role": "read-only"},
+    {"name": "tenant", "cns": ["^tenant$"], "role": "read-only", "ifaces": ["fakeif1"]}
+  ]
+}`
+
+func writePolicy(t *testing.T, policy string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "authz.json")
+	if err := os.WriteFile(file, []byte(policy), 0644); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	return file
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{name: "Valid", policy: testPolicy},
+		{name: "UnknownRole", policy: `{"bindings": [{"name": "foo", "role": "root"}]}`, wantErr: "unknown role"},
+		{name: "InvalidRegexp", policy: `{"bindings": [{"name": "foo", "sans": ["("], "role": "admin"}]}`, wantErr: "invalid regular expression"},
+		{name: "InvalidGlob", policy: `{"bindings": [{"name": "foo", "ifaces": ["["], "role": "admin"}]}`, wantErr: "invalid glob pattern"},
+		{name: "UnknownField", policy: `{"bindings": [{"name": "foo", "role": "admin", "groups": ["bar"]}]}`, wantErr: "unknown field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writePolicy(t, tt.policy))
+			if len(tt.wantErr) == 0 && err != nil {
+				t.Errorf("Load() error = %v", err)
+			}
+			if len(tt.wantErr) > 0 && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Load() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func client(cn string, ous []string, sans ...string) *tls.ConnectionState {
+	return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+		Subject:  pkix.Name{CommonName: cn, OrganizationalUnit: ous},
+		DNSNames: sans,
+	}}}
+}
+
+func TestHandler(t *testing.T) {
+	t.Cleanup(func() { Setup("") })
+	if err := Setup(writePolicy(t, testPolicy)); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	current := []models.L3afBPFPrograms{
+		{
+			Iface: "fakeif0",
+			BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{
+				{Name: "ratelimiting", Version: "1.0", MapArgs: models.L3afDNFArgs{"rl_ports_map": "80"}},
+			}},
+		},
+		{
+			Iface:       "eth1",
+			BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{{Name: "connection-limit", Version: "1.0"}}},
+		},
+	}
+	snapshot := func() []models.L3afBPFPrograms { return current }
+
+	// an update replaces all the interfaces, eth1 is sent unchanged
+	const (
+		eth1          = `{"iface":"eth1","bpf_programs":{"xdp_ingress":[{"name":"connection-limit","version":"1.0"}]}}`
+		mapArgsUpdate = `[{"iface":"fakeif0","bpf_programs":{"xdp_ingress":[{"name":"ratelimiting","version":"1.0","map_args":{"rl_ports_map":"443"}}]}},` + eth1 + `]`
+		versionUpdate = `[{"iface":"fakeif0","bpf_programs":{"xdp_ingress":[{"name":"ratelimiting","version":"1.1"}]}},` + eth1 + `]`
+		updateArgs    = `[{"iface":"fakeif0","bpf_programs":{"xdp_ingress":[{"name":"ratelimiting","version":"1.0","map_args":{"rl_ports_map":"80"},"update_args":{"rl_ports_map":"443"}}]}},` + eth1 + `]`
+		removeUpdate  = `[{"iface":"fakeif0","bpf_programs":{"xdp_ingress":[]}},` + eth1 + `]`
+		omitEth1      = `[{"iface":"fakeif0","bpf_programs":{"xdp_ingress":[{"name":"ratelimiting","version":"1.1"}]}}]`
+		addOtherIface = `[{"iface":"fakeif1","bpf_programs":{"xdp_ingress":[{"name":"ratelimiting","version":"1.0"}]}}]`
+		deleteProgram = `[{"iface":"fakeif0","bpf_programs":{"xdp_ingress":["ratelimiting"]}}]`
+		eth1YAML      = "- iface: eth1\n  bpf_programs:\n    xdp_ingress:\n      - {name: connection-limit, version: \"1.0\"}\n"
+		mapArgsYAML   = "- iface: fakeif0\n  bpf_programs:\n    xdp_ingress:\n      - {name: ratelimiting, version: \"1.0\", map_args: {rl_ports_map: \"443\"}}\n" + eth1YAML
+		versionYAML   = "- iface: fakeif0\n  bpf_programs:\n    xdp_ingress:\n      - {name: ratelimiting, version: \"1.1\"}\n" + eth1YAML
+	)
+
+	tests := []struct {
+		name        string
+		action      Action
+		body        string
+		contentType string
+		tls         *tls.ConnectionState
+		wantStatus  int
+	}{
+		{name: "ReadOnlyRead", action: ActionRead, tls: client("prometheus", nil), wantStatus: http.StatusOK},
+		{name: "ReadOnlyUpdate", action: ActionUpdate, body: mapArgsUpdate, tls: client("prometheus", nil), wantStatus: http.StatusForbidden},
+		{name: "OperatorMapArgs", action: ActionUpdate, body: mapArgsUpdate, tls: client("alice", []string{"netops"}), wantStatus: http.StatusOK},
+		{name: "OperatorVersion", action: ActionUpdate, body: versionUpdate, tls: client("alice", []string{"netops"}), wantStatus: http.StatusForbidden},
+		{name: "OperatorUpdateArgs", action: ActionUpdate, body: updateArgs, tls: client("alice", []string{"netops"}), wantStatus: http.StatusForbidden},
+		{name: "OperatorRemove", action: ActionUpdate, body: removeUpdate, tls: client("alice", []string{"netops"}), wantStatus: http.StatusForbidden},
+		{name: "OperatorDelete", action: ActionDelete, body: deleteProgram, tls: client("alice", []string{"netops"}), wantStatus: http.StatusForbidden},
+		{name: "AdminVersion", action: ActionUpdate, body: versionUpdate, tls: client("", nil, "controller.l3af.io"), wantStatus: http.StatusOK},
+		{name: "AdminLogLevel", action: ActionAdmin, tls: client("", nil, "controller.l3af.io"), wantStatus: http.StatusOK},
+		{name: "ScopedAdminInScope", action: ActionDelete, body: deleteProgram, tls: client("oncall", nil), wantStatus: http.StatusOK},
+		{name: "ScopedAdminUpdateInScope", action: ActionUpdate, body: versionUpdate, tls: client("oncall", nil), wantStatus: http.StatusOK},
+		{name: "ScopedAdminOmitsIface", action: ActionUpdate, body: omitEth1, tls: client("oncall", nil), wantStatus: http.StatusOK},
+		{name: "ScopedAdminRemovesInScope", action: ActionUpdate, body: removeUpdate, tls: client("oncall", nil), wantStatus: http.StatusOK},
+		{name: "OperatorOmitsIface", action: ActionUpdate, body: `[{"iface":"fakeif0","bpf_programs":{"xdp_ingress":[{"name":"ratelimiting","version":"1.0","map_args":{"rl_ports_map":"443"}}]}}]`, tls: client("alice", []string{"netops"}), wantStatus: http.StatusOK},
+		{name: "ScopedAdminChangesOutOfScope", action: ActionUpdate, body: `[{"iface":"eth1","bpf_programs":{"xdp_ingress":[{"name":"connection-limit","version":"1.1"}]}}]`, tls: client("oncall", nil), wantStatus: http.StatusForbidden},
+		{name: "AdminOmitsIface", action: ActionUpdate, body: omitEth1, tls: client("", nil, "controller.l3af.io"), wantStatus: http.StatusOK},
+		{name: "ScopedAdminOutOfScope", action: ActionAdd, body: addOtherIface, tls: client("oncall", nil), wantStatus: http.StatusForbidden},
+		{name: "ScopedAdminLogLevel", action: ActionAdmin, tls: client("oncall", nil), wantStatus: http.StatusForbidden},
+		{name: "NoBinding", action: ActionRead, tls: client("mallory", nil, "mallory.example.com"), wantStatus: http.StatusForbidden},
+		{name: "NoCertificate", action: ActionRead, wantStatus: http.StatusForbidden},
+		{name: "InvalidBody", action: ActionUpdate, body: `{`, tls: client("", nil, "controller.l3af.io"), wantStatus: http.StatusBadRequest},
+		{name: "UnknownField", action: ActionUpdate, body: `[{"iface":"fakeif0","bpf_programs":{"xdp_ingress":[{"name":"ratelimiting","seqid":1}]}}]`, tls: client("", nil, "controller.l3af.io"), wantStatus: http.StatusBadRequest},
+		{name: "OperatorMapArgsYAML", action: ActionUpdate, body: mapArgsYAML, contentType: "application/yaml", tls: client("alice", []string{"netops"}), wantStatus: http.StatusOK},
+		{name: "OperatorVersionYAML", action: ActionUpdate, body: versionYAML, contentType: "application/yaml", tls: client("alice", []string{"netops"}), wantStatus: http.StatusForbidden},
+		{name: "UnsupportedContentType", action: ActionUpdate, body: mapArgsUpdate, contentType: "text/plain", tls: client("", nil, "controller.l3af.io"), wantStatus: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := Handler(tt.action, snapshot)(func(w http.ResponseWriter, r *http.Request) { called = true })
+			req := httptest.NewRequest(http.MethodPost, "/l3af/configs/v1/update", strings.NewReader(tt.body))
+			req.TLS = tt.tls
+			if len(tt.contentType) > 0 {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Handler() status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if called != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("Handler() called the next handler = %v with status %d", called, rr.Code)
+			}
+		})
+	}
+}
+
+func TestHandlerScopedRead(t *testing.T) {
+	t.Cleanup(func() { Setup("") })
+	if err := Setup(writePolicy(t, testPolicy)); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		action     Action
+		target     string
+		params     map[string]string
+		tls        *tls.ConnectionState
+		wantStatus int
+	}{
+		{name: "UnscopedAllConfigs", action: ActionRead, target: "/l3af/configs/v1", tls: client("prometheus", nil), wantStatus: http.StatusOK},
+		{name: "ScopedAllConfigs", action: ActionRead, target: "/l3af/configs/v1", tls: client("tenant", nil), wantStatus: http.StatusForbidden},
+		{name: "ScopedHistory", action: ActionRead, target: "/l3af/configs/history", tls: client("tenant", nil), wantStatus: http.StatusForbidden},
+		{name: "ScopedHealth", action: ActionRead, target: "/l3af/health", tls: client("tenant", nil), wantStatus: http.StatusForbidden},
+		{name: "ScopedAllEvents", action: ActionRead, target: "/l3af/events", tls: client("tenant", nil), wantStatus: http.StatusForbidden},
+		{name: "ScopedIfaceConfig", action: ActionRead, target: "/l3af/configs/v1/fakeif1", params: map[string]string{"iface": "fakeif1"}, tls: client("tenant", nil), wantStatus: http.StatusOK},
+		{name: "ScopedOtherIfaceConfig", action: ActionRead, target: "/l3af/configs/v1/fakeif0", params: map[string]string{"iface": "fakeif0"}, tls: client("tenant", nil), wantStatus: http.StatusForbidden},
+		{name: "ScopedIfaceEvents", action: ActionRead, target: "/l3af/events?iface=fakeif1", tls: client("tenant", nil), wantStatus: http.StatusOK},
+		{name: "ScopedOtherIfaceEvents", action: ActionRead, target: "/l3af/events/watch?iface=fakeif0", tls: client("tenant", nil), wantStatus: http.StatusForbidden},
+		{name: "ScopedProgramEvents", action: ActionRead, target: "/l3af/events?iface=fakeif0&program=ratelimiting", tls: client("alice", []string{"netops"}), wantStatus: http.StatusOK},
+		{name: "ScopedProgramMissing", action: ActionRead, target: "/l3af/events?iface=fakeif0", tls: client("alice", []string{"netops"}), wantStatus: http.StatusForbidden},
+		{name: "ScopedProgramLogs", action: ActionRead, target: "/l3af/logs/fakeif0/ingress/ratelimiting", params: map[string]string{"iface": "fakeif0", "program": "ratelimiting"}, tls: client("alice", []string{"netops"}), wantStatus: http.StatusOK},
+		{name: "ScopedSchema", action: ActionReadHost, target: "/l3af/schema", tls: client("tenant", nil), wantStatus: http.StatusOK},
+		{name: "NoBindingSchema", action: ActionReadHost, target: "/l3af/schema", tls: client("mallory", nil), wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := Handler(tt.action, nil)(func(w http.ResponseWriter, r *http.Request) { called = true })
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.TLS = tt.tls
+			rctx := chi.NewRouteContext()
+			for k, v := range tt.params {
+				rctx.URLParams.Add(k, v)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Handler() status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if called != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("Handler() called the next handler = %v with status %d", called, rr.Code)
+			}
+		})
+	}
+}
+
+func TestMergeUnscoped(t *testing.T) {
+	t.Cleanup(func() { Setup("") })
+	if err := Setup(writePolicy(t, testPolicy)); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	current := []models.L3afBPFPrograms{
+		{
+			Iface: "fakeif0",
+			BpfPrograms: &models.BPFPrograms{
+				XDPIngress: []*models.BPFProgram{{Name: "ratelimiting", Version: "1.0"}},
+				TCEgress:   []*models.BPFProgram{{Name: "tracer", Version: "1.0"}},
+			},
+		},
+		{
+			Iface:       "eth1",
+			BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{{Name: "connection-limit", Version: "1.0"}}},
+		},
+	}
+	snapshot := func() []models.L3afBPFPrograms { return current }
+	const (
+		ratelimiting = `[{"iface":"fakeif0","bpf_programs":{"xdp_ingress":[{"name":"ratelimiting","version":"1.0","map_args":{"rl_ports_map":"443"}}]}}]`
+		removeAll    = `[{"iface":"fakeif0","bpf_programs":{"xdp_ingress":[]}}]`
+	)
+
+	tests := []struct {
+		name string
+		body string
+		tls  *tls.ConnectionState
+		want map[string]string // programs of the merged configs by iface/direction/name and version
+	}{
+		{
+			name: "Unscoped",
+			body: ratelimiting,
+			tls:  client("", nil, "controller.l3af.io"),
+			want: map[string]string{"fakeif0/xdpingress/ratelimiting": "1.0"},
+		},
+		{
+			name: "ScopedIface",
+			body: removeAll,
+			tls:  client("oncall", nil),
+			want: map[string]string{"eth1/xdpingress/connection-limit": "1.0"},
+		},
+		{
+			name: "ScopedProgram",
+			body: ratelimiting,
+			tls:  client("alice", []string{"netops"}),
+			want: map[string]string{
+				"fakeif0/xdpingress/ratelimiting":  "1.0",
+				"fakeif0/egress/tracer":            "1.0",
+				"eth1/xdpingress/connection-limit": "1.0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var merged []models.L3afBPFPrograms
+			handler := Handler(ActionUpdate, snapshot)(func(w http.ResponseWriter, r *http.Request) {
+				var cfgs []models.L3afBPFPrograms
+				if err := json.NewDecoder(r.Body).Decode(&cfgs); err != nil {
+					t.Fatalf("failed to decode body: %v", err)
+				}
+				merged = MergeUnscoped(r.Context(), snapshot(), cfgs)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/l3af/configs/v1/update", strings.NewReader(tt.body))
+			req.TLS = tt.tls
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Handler() status = %d: %s", rr.Code, rr.Body.String())
+			}
+			got := map[string]string{}
+			for _, c := range audit.Diff(nil, merged) {
+				got[c.Iface+"/"+c.Direction+"/"+c.Program] = c.NewVersion
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeUnscoped() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if len(current[0].BpfPrograms.XDPIngress) != 1 || len(current[0].BpfPrograms.TCEgress) != 1 {
+		t.Errorf("MergeUnscoped() changed the current configs")
+	}
+}
+
+func TestHandlerDisabled(t *testing.T) {
+	if err := Setup(""); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	called := false
+	handler := Handler(ActionDelete, nil)(func(w http.ResponseWriter, r *http.Request) { called = true })
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/l3af/configs/v1/delete", nil))
+	if !called {
+		t.Errorf("Handler() rejected the call without a policy")
+	}
+}
+
+func TestReload(t *testing.T) {
+	t.Cleanup(func() { Setup("") })
+	file := writePolicy(t, `{"bindings": [{"name": "monitoring", "cns": ["^prometheus$"], "role": "read-only"}]}`)
+	if err := Setup(file); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	id := identity{cn: "prometheus"}
+	if _, reason := authorize(id, request{action: ActionAdmin}); len(reason) == 0 {
+		t.Fatalf("read-only client is allowed to change l3afd")
+	}
+
+	if err := os.WriteFile(file, []byte(`{"bindings": [{"name": "monitoring", "cns": ["^prometheus$"], "role": "admin"}]}`), 0644); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	if err := Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, reason := authorize(id, request{action: ActionAdmin}); len(reason) > 0 {
+		t.Errorf("reloaded admin client is denied: %s", reason)
+	}
+
+	// an invalid policy keeps the previous one
+	if err := os.WriteFile(file, []byte(`{"bindings": [{"name": "monitoring", "role": "root"}]}`), 0644); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	if err := Reload(); err == nil {
+		t.Errorf("Reload() of an invalid policy succeeded")
+	}
+	if _, reason := authorize(id, request{action: ActionAdmin}); len(reason) > 0 {
+		t.Errorf("previous policy is not kept: %s", reason)
+	}
+}
@@ -28,8 +28,21 @@ type Config struct {
 	EBPFRepoURL         string
 	HttpClientTimeout   time.Duration
 	MaxEBPFReStartCount int
-	Environment         string
-	BpfMapDefaultPath   string
+	// Restart backoff of eBPF programs monitored by the process monitor
+	EBPFReStartBackoffInitial time.Duration
+	EBPFReStartBackoffMax     time.Duration
+	// Duration a program has to run before its restart count is reset
+	EBPFReStartStableDuration time.Duration
+	// Unlink crash looping programs from the chain
+	EBPFCrashLoopUnlink bool
+	// Check the entry function and the maps of a downloaded object file before loading it
+	EBPFVerifyObjectFile bool
+	// Probe the kernel for the eBPF features used by programs and reject the ones it does not support
+	KernelFeatureCheck bool
+	// Directory of the BTF of kernels without their own, looked up by kernel release
+	BTFDir            string
+	Environment       string
+	BpfMapDefaultPath string
 	// Flag to enable chaining with root program
 	BpfChainingEnabled bool
 
@@ -73,6 +86,95 @@ type Config struct {
 
 	// l3af config store
 	L3afConfigStoreFileName string
+	// Revisions of the configs kept in L3afConfigStoreHistoryDir, none when the size is 0
+	L3afConfigStoreHistorySize int
+	L3afConfigStoreHistoryDir  string
+
+	// l3afd logs
+	LogLevel           string
+	LogFormat          string
+	LogOutput          string
+	LogFileName        string
+	LogFileMaxSizeMB   int
+	LogFileMaxBackups  int
+	LogSyslogNetwork   string
+	LogSyslogAddr      string
+	LogSyslogTag       string
+	LogComponentLevels []string
+	// Duration debug stays enabled after SIGUSR1
+	LogDebugToggleTimeout time.Duration
+
+	// roles of the API clients, authorization is disabled without a policy file
+	AuthzPolicyFile     string
+	AuthzReloadInterval time.Duration
+
+	// audit log of the mutating API calls
+	AuditEnabled       bool
+	AuditFileName      string
+	AuditMaxSizeMB     int
+	AuditMaxBackups    int
+	AuditSyslog        bool
+	AuditSyslogNetwork string
+	AuditSyslogAddr    string
+	AuditSyslogTag     string
+
+	// pull of the desired configs from a remote config service and registration with it
+	RemoteConfigEnabled         bool
+	RemoteConfigURL             string
+	RemoteConfigRegisterURL     string
+	RemoteConfigInterval        time.Duration
+	RemoteConfigTimeout         time.Duration
+	RemoteConfigPublicKeyFile   string
+	RemoteConfigSignatureHeader string
+	RemoteConfigAllowUnsigned   bool
+	RemoteConfigCACertFile      string
+	RemoteConfigClientCertFile  string
+	RemoteConfigClientKeyFile   string
+
+	// deploy of the manifests of a local directory
+	ManifestsEnabled        bool
+	ManifestsDir            string
+	ManifestsDebounce       time.Duration
+	ManifestsResyncInterval time.Duration
+
+	// reconciler converging the running eBPF programs to the desired configs
+	ReconcileEnabled        bool
+	ReconcileInterval       time.Duration
+	ReconcileBackoffInitial time.Duration
+	ReconcileBackoffMax     time.Duration
+	// corrections per reconcile pass, unlimited when 0
+	ReconcileMaxActions int
+
+	// journal of the lifecycle events of eBPF programs
+	EventJournalSize           int
+	EventJournalFile           string
+	EventJournalFileMaxSizeMB  int
+	EventJournalFileMaxBackups int
+
+	// OpenTelemetry traces exported with OTLP over HTTP
+	TracingEnabled     bool
+	TracingEndpoint    string
+	TracingInsecure    bool
+	TracingSampleRatio float64
+	TracingServiceName string
+
+	// captured stdout and stderr of user programs
+	UserProgramLogEnabled    bool
+	UserProgramLogDir        string
+	UserProgramLogMaxSizeMB  int
+	UserProgramLogMaxBackups int
+
+	// cgroup v2 resource isolation of user programs
+	CgroupEnabled   bool
+	CgroupRoot      string
+	CgroupParent    string
+	CgroupCPUPeriod time.Duration
+	CgroupPidsMax   int
+
+	// l3afd liveness and readiness probes
+	ProbesEnabled             bool
+	ProbesAddr                string
+	ProbesMonitorStallTimeout time.Duration
 
 	// mTLS
 	MTLSEnabled               bool
@@ -83,6 +185,17 @@ type Config struct {
 	MTLSServerKeyFilename     string
 	MTLSCertExpiryWarningDays int
 	MTLSSANMatchRules         []string
+	// Interval the certificate files are checked for modifications
+	MTLSCertReloadInterval time.Duration
+	// CRL file of the revoked client certificates and the interval it is checked for modifications
+	MTLSCRLFile           string
+	MTLSCRLReloadInterval time.Duration
+	// OCSP checking of the client certificates, fail open allows clients when the responder is unavailable
+	MTLSOCSPEnabled      bool
+	MTLSOCSPResponderURL string
+	MTLSOCSPTimeout      time.Duration
+	MTLSOCSPCacheTTL     time.Duration
+	MTLSOCSPFailOpen     bool
 }
 
 // ReadConfig - Initializes configuration from file
@@ -108,6 +221,13 @@ func ReadConfig(configPath string) (*Config, error) {
 		EBPFRepoURL:                    LoadConfigString(confReader, "ebpf-repo", "url"),
 		HttpClientTimeout:              LoadOptionalConfigDuration(confReader, "l3afd", "http-client-timeout", 10*time.Second),
 		MaxEBPFReStartCount:            LoadOptionalConfigInt(confReader, "l3afd", "max-ebpf-restart-count", 3),
+		EBPFReStartBackoffInitial:      LoadOptionalConfigDuration(confReader, "l3afd", "ebpf-restart-backoff-initial", 10*time.Second),
+		EBPFReStartBackoffMax:          LoadOptionalConfigDuration(confReader, "l3afd", "ebpf-restart-backoff-max", 5*time.Minute),
+		EBPFReStartStableDuration:      LoadOptionalConfigDuration(confReader, "l3afd", "ebpf-restart-stable-duration", 10*time.Minute),
+		EBPFCrashLoopUnlink:            LoadOptionalConfigBool(confReader, "l3afd", "ebpf-crash-loop-unlink", false),
+		EBPFVerifyObjectFile:           LoadOptionalConfigBool(confReader, "l3afd", "ebpf-verify-object-file", false),
+		KernelFeatureCheck:             LoadOptionalConfigBool(confReader, "l3afd", "kernel-feature-check", true),
+		BTFDir:                         LoadOptionalConfigString(confReader, "l3afd", "btf-dir", ""),
 		BpfChainingEnabled:             LoadConfigBool(confReader, "l3afd", "bpf-chaining-enabled"),
 		MetricsAddr:                    LoadConfigString(confReader, "web", "metrics-addr"),
 		EBPFPollInterval:               LoadOptionalConfigDuration(confReader, "web", "ebpf-poll-interval", 30*time.Second),
@@ -137,6 +257,70 @@ func ReadConfig(configPath string) (*Config, error) {
 		EBPFChainDebugEnabled:          LoadOptionalConfigBool(confReader, "ebpf-chain-debug", "enabled", false),
 		L3afConfigsRestAPIAddr:         LoadOptionalConfigString(confReader, "l3af-configs", "restapi-addr", "localhost:53000"),
 		L3afConfigStoreFileName:        LoadConfigString(confReader, "l3af-config-store", "filename"),
+		L3afConfigStoreHistorySize:     LoadOptionalConfigInt(confReader, "l3af-config-store", "history-size", 10),
+		L3afConfigStoreHistoryDir:      LoadOptionalConfigString(confReader, "l3af-config-store", "history-dir", ""),
+		LogLevel:                       LoadOptionalConfigString(confReader, "logging", "level", "info"),
+		LogFormat:                      LoadOptionalConfigString(confReader, "logging", "format", "console"),
+		LogOutput:                      LoadOptionalConfigString(confReader, "logging", "output", "stderr"),
+		LogFileName:                    LoadOptionalConfigString(confReader, "logging", "file", "/var/log/l3afd/l3afd.log"),
+		LogFileMaxSizeMB:               LoadOptionalConfigInt(confReader, "logging", "file-max-size-mb", 100),
+		LogFileMaxBackups:              LoadOptionalConfigInt(confReader, "logging", "file-max-backups", 5),
+		LogSyslogNetwork:               LoadOptionalConfigString(confReader, "logging", "syslog-network", ""),
+		LogSyslogAddr:                  LoadOptionalConfigString(confReader, "logging", "syslog-addr", ""),
+		LogSyslogTag:                   LoadOptionalConfigString(confReader, "logging", "syslog-tag", "l3afd"),
+		LogComponentLevels:             LoadOptionalConfigStringCSV(confReader, "logging", "component-levels", []string{}),
+		LogDebugToggleTimeout:          LoadOptionalConfigDuration(confReader, "logging", "debug-toggle-timeout", 10*time.Minute),
+		AuthzPolicyFile:                LoadOptionalConfigString(confReader, "authorization", "policy-file", ""),
+		AuthzReloadInterval:            LoadOptionalConfigDuration(confReader, "authorization", "reload-interval", 30*time.Second),
+		AuditEnabled:                   LoadOptionalConfigBool(confReader, "audit", "enabled", true),
+		AuditFileName:                  LoadOptionalConfigString(confReader, "audit", "file", "/var/log/l3afd/audit.log"),
+		AuditMaxSizeMB:                 LoadOptionalConfigInt(confReader, "audit", "max-size-mb", 100),
+		AuditMaxBackups:                LoadOptionalConfigInt(confReader, "audit", "max-backups", 10),
+		AuditSyslog:                    LoadOptionalConfigBool(confReader, "audit", "syslog", false),
+		AuditSyslogNetwork:             LoadOptionalConfigString(confReader, "audit", "syslog-network", ""),
+		AuditSyslogAddr:                LoadOptionalConfigString(confReader, "audit", "syslog-addr", ""),
+		AuditSyslogTag:                 LoadOptionalConfigString(confReader, "audit", "syslog-tag", "l3afd-audit"),
+		RemoteConfigEnabled:            LoadOptionalConfigBool(confReader, "remote-config", "enabled", false),
+		RemoteConfigURL:                LoadOptionalConfigString(confReader, "remote-config", "url", ""),
+		RemoteConfigRegisterURL:        LoadOptionalConfigString(confReader, "remote-config", "register-url", ""),
+		RemoteConfigInterval:           LoadOptionalConfigDuration(confReader, "remote-config", "interval", time.Minute),
+		RemoteConfigTimeout:            LoadOptionalConfigDuration(confReader, "remote-config", "timeout", 10*time.Second),
+		RemoteConfigPublicKeyFile:      LoadOptionalConfigString(confReader, "remote-config", "signature-public-key", ""),
+		RemoteConfigSignatureHeader:    LoadOptionalConfigString(confReader, "remote-config", "signature-header", "X-L3af-Signature"),
+		RemoteConfigAllowUnsigned:      LoadOptionalConfigBool(confReader, "remote-config", "allow-unsigned", false),
+		RemoteConfigCACertFile:         LoadOptionalConfigString(confReader, "remote-config", "ca-cert", ""),
+		RemoteConfigClientCertFile:     LoadOptionalConfigString(confReader, "remote-config", "client-cert", ""),
+		RemoteConfigClientKeyFile:      LoadOptionalConfigString(confReader, "remote-config", "client-key", ""),
+		ManifestsEnabled:               LoadOptionalConfigBool(confReader, "manifests", "enabled", false),
+		ManifestsDir:                   LoadOptionalConfigString(confReader, "manifests", "dir", "/etc/l3afd/manifests"),
+		ManifestsDebounce:              LoadOptionalConfigDuration(confReader, "manifests", "debounce", time.Second),
+		ManifestsResyncInterval:        LoadOptionalConfigDuration(confReader, "manifests", "resync-interval", time.Minute),
+		ReconcileEnabled:               LoadOptionalConfigBool(confReader, "reconciler", "enabled", true),
+		ReconcileInterval:              LoadOptionalConfigDuration(confReader, "reconciler", "interval", time.Minute),
+		ReconcileBackoffInitial:        LoadOptionalConfigDuration(confReader, "reconciler", "backoff-initial", 10*time.Second),
+		ReconcileBackoffMax:            LoadOptionalConfigDuration(confReader, "reconciler", "backoff-max", 10*time.Minute),
+		ReconcileMaxActions:            LoadOptionalConfigInt(confReader, "reconciler", "max-actions", 10),
+		EventJournalSize:               LoadOptionalConfigInt(confReader, "events", "journal-size", 1000),
+		EventJournalFile:               LoadOptionalConfigString(confReader, "events", "file", ""),
+		EventJournalFileMaxSizeMB:      LoadOptionalConfigInt(confReader, "events", "file-max-size-mb", 10),
+		EventJournalFileMaxBackups:     LoadOptionalConfigInt(confReader, "events", "file-max-backups", 1),
+		TracingEnabled:                 LoadOptionalConfigBool(confReader, "tracing", "enabled", false),
+		TracingEndpoint:                LoadOptionalConfigString(confReader, "tracing", "endpoint", "localhost:4318"),
+		TracingInsecure:                LoadOptionalConfigBool(confReader, "tracing", "insecure", true),
+		TracingSampleRatio:             LoadOptionalConfigFloat(confReader, "tracing", "sample-ratio", 1.0),
+		TracingServiceName:             LoadOptionalConfigString(confReader, "tracing", "service-name", "l3afd"),
+		UserProgramLogEnabled:          LoadOptionalConfigBool(confReader, "ebpf-program-logs", "enabled", true),
+		UserProgramLogDir:              LoadOptionalConfigString(confReader, "ebpf-program-logs", "dir", "/var/log/l3afd"),
+		UserProgramLogMaxSizeMB:        LoadOptionalConfigInt(confReader, "ebpf-program-logs", "max-size-mb", 10),
+		UserProgramLogMaxBackups:       LoadOptionalConfigInt(confReader, "ebpf-program-logs", "max-backups", 5),
+		CgroupEnabled:                  LoadOptionalConfigBool(confReader, "cgroup", "enabled", true),
+		CgroupRoot:                     LoadOptionalConfigString(confReader, "cgroup", "root", "/sys/fs/cgroup"),
+		CgroupParent:                   LoadOptionalConfigString(confReader, "cgroup", "parent", "l3afd"),
+		CgroupCPUPeriod:                LoadOptionalConfigDuration(confReader, "cgroup", "cpu-period", 100*time.Millisecond),
+		CgroupPidsMax:                  LoadOptionalConfigInt(confReader, "cgroup", "pids-max", 1024),
+		ProbesEnabled:                  LoadOptionalConfigBool(confReader, "probes", "enabled", true),
+		ProbesAddr:                     LoadOptionalConfigString(confReader, "probes", "addr", "localhost:53001"),
+		ProbesMonitorStallTimeout:      LoadOptionalConfigDuration(confReader, "probes", "monitor-stall-timeout", 5*time.Minute),
 		MTLSEnabled:                    LoadOptionalConfigBool(confReader, "mtls", "enabled", true),
 		MTLSMinVersion:                 minTLSVersion,
 		MTLSCertDir:                    LoadOptionalConfigString(confReader, "mtls", "cert-dir", ""),
@@ -145,6 +329,14 @@ func ReadConfig(configPath string) (*Config, error) {
 		MTLSServerKeyFilename:          LoadOptionalConfigString(confReader, "mtls", "server-key-filename", "server.key"),
 		MTLSCertExpiryWarningDays:      LoadOptionalConfigInt(confReader, "mtls", "cert-expiry-warning-days", 30),
 		MTLSSANMatchRules:              strings.Split(LoadOptionalConfigString(confReader, "mtls", "san-match-rules", ""), ","),
+		MTLSCertReloadInterval:         LoadOptionalConfigDuration(confReader, "mtls", "cert-reload-interval", 30*time.Second),
+		MTLSCRLFile:                    LoadOptionalConfigString(confReader, "mtls", "crl-file", ""),
+		MTLSCRLReloadInterval:          LoadOptionalConfigDuration(confReader, "mtls", "crl-reload-interval", 5*time.Minute),
+		MTLSOCSPEnabled:                LoadOptionalConfigBool(confReader, "mtls", "ocsp-enabled", false),
+		MTLSOCSPResponderURL:           LoadOptionalConfigString(confReader, "mtls", "ocsp-responder-url", ""),
+		MTLSOCSPTimeout:                LoadOptionalConfigDuration(confReader, "mtls", "ocsp-timeout", 5*time.Second),
+		MTLSOCSPCacheTTL:               LoadOptionalConfigDuration(confReader, "mtls", "ocsp-cache-ttl", time.Hour),
+		MTLSOCSPFailOpen:               LoadOptionalConfigBool(confReader, "mtls", "ocsp-fail-open", true),
 	}, nil
 }
 
@@ -0,0 +1,293 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package configstore persists the eBPF program configs of l3afd with crash-safe writes and a history of revisions.
+package configstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/l3af-project/l3afd/audit"
+	"github.com/l3af-project/l3afd/logging"
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/schema"
+)
+
+// log - logger of the configstore component
+var log = logging.Component("configstore")
+
+// ErrRevisionNotFound - returned when the requested revision is not retained in the history
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// DefaultAuthor - author of the revisions saved without a client, e.g. at startup
+const DefaultAuthor = "l3afd"
+
+const revisionPrefix = "revision-"
+
+// Revision defines a saved version of the eBPF program configs
+type Revision struct {
+	Revision int                      `json:"revision"`
+	Time     time.Time                `json:"time"`
+	Author   string                   `json:"author"`
+	Changes  []audit.Change           `json:"changes"`           // changes to the previous revision
+	Configs  []models.L3afBPFPrograms `json:"configs,omitempty"` // omitted in the history listing
+}
+
+// Store writes the configs file and keeps the last historySize revisions in historyDir
+type Store struct {
+	file        string
+	historyDir  string
+	historySize int
+
+	mu sync.Mutex
+}
+
+type authorKey struct{}
+
+// WithAuthor - returns a context saving revisions on behalf of the author
+func WithAuthor(ctx context.Context, author string) context.Context {
+	return context.WithValue(ctx, authorKey{}, author)
+}
+
+// Author - returns the author of the context, DefaultAuthor when it is not set
+func Author(ctx context.Context) string {
+	if author, ok := ctx.Value(authorKey{}).(string); ok && len(author) > 0 {
+		return author
+	}
+	return DefaultAuthor
+}
+
+// New - returns the store of the configs file, revisions are kept in historyDir or next to the file when it is empty,
+// no history is kept when historySize is 0
+func New(file, historyDir string, historySize int) *Store {
+	if len(historyDir) == 0 {
+		historyDir = file + ".history"
+	}
+	return &Store{file: file, historyDir: historyDir, historySize: historySize}
+}
+
+// Save - atomically replaces the configs file and records a revision when the configs changed
+func (s *Store) Save(ctx context.Context, cfgs []models.L3afBPFPrograms) error {
+	buf, err := json.MarshalIndent(cfgs, "", " ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal configs %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := WriteFileAtomic(s.file, buf, 0644); err != nil {
+		return fmt.Errorf("failed to save configs %v", err)
+	}
+	// revisions are recorded once saved, the history never holds configs the file does not
+	if s.historySize > 0 {
+		if err := s.record(ctx, cfgs); err != nil {
+			// the configs file is the record of the desired state, history failures do not block it
+			log.Error().Err(err).Str("path", s.historyDir).Msg("failed to record config revision")
+		}
+	}
+	return nil
+}
+
+// record - writes a new revision when the configs differ from the latest one
+func (s *Store) record(ctx context.Context, cfgs []models.L3afBPFPrograms) error {
+	numbers, err := s.revisions()
+	if err != nil {
+		return err
+	}
+	var previous []models.L3afBPFPrograms
+	next := 1
+	if len(numbers) > 0 {
+		latest, err := s.read(numbers[len(numbers)-1])
+		if err != nil {
+			return err
+		}
+		previous, next = latest.Configs, latest.Revision+1
+	}
+	changes := audit.Diff(previous, cfgs)
+	if len(numbers) > 0 && len(changes) == 0 {
+		return nil
+	}
+
+	rev := Revision{Revision: next, Time: time.Now(), Author: Author(ctx), Changes: changes, Configs: cfgs}
+	buf, err := json.MarshalIndent(rev, "", " ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal revision %d: %v", next, err)
+	}
+	if err := os.MkdirAll(s.historyDir, 0755); err != nil {
+		return fmt.Errorf("failed to create history directory %s: %v", s.historyDir, err)
+	}
+	if err := WriteFileAtomic(s.revisionFile(next), buf, 0644); err != nil {
+		return fmt.Errorf("failed to write revision %d: %v", next, err)
+	}
+	log.Info().Int("revision", next).Str("author", rev.Author).Int("changes", len(changes)).Msg("config revision recorded")
+
+	numbers = append(numbers, next)
+	for len(numbers) > s.historySize {
+		if err := os.Remove(s.revisionFile(numbers[0])); err != nil {
+			log.Warn().Err(err).Int("revision", numbers[0]).Msg("failed to remove old revision")
+		}
+		numbers = numbers[1:]
+	}
+	return nil
+}
+
+// Load - reads the configs file. When it can not be parsed, the latest revision that can is restored.
+// A missing configs file returns no configs.
+func (s *Store) Load() ([]models.L3afBPFPrograms, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Warn().Msgf("no persistent config exists")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read persistent file (%s): %v", s.file, err)
+	}
+	// decoded strictly like the payloads, a config with unknown fields is treated as corrupted
+	var cfgs []models.L3afBPFPrograms
+	if err = schema.Decode(buf, schema.JSON, &cfgs); err == nil {
+		return cfgs, nil
+	}
+	loadErr := fmt.Errorf("persistent config %s does not match the schema of the configs: %v", s.file, err)
+
+	numbers, err := s.revisions()
+	if err != nil || len(numbers) == 0 {
+		return nil, loadErr
+	}
+	for i := len(numbers) - 1; i >= 0; i-- {
+		rev, err := s.read(numbers[i])
+		if err != nil {
+			log.Warn().Err(err).Int("revision", numbers[i]).Msg("skipping unreadable revision")
+			continue
+		}
+		log.Warn().Err(loadErr).Int("revision", rev.Revision).Msg("persistent config is corrupted, restoring the last good revision")
+		if buf, err := json.MarshalIndent(rev.Configs, "", " "); err == nil {
+			if err := WriteFileAtomic(s.file, buf, 0644); err != nil {
+				log.Error().Err(err).Str("path", s.file).Msg("failed to restore persistent config")
+			}
+		}
+		return rev.Configs, nil
+	}
+	return nil, loadErr
+}
+
+// History - returns the retained revisions without their configs, oldest first
+func (s *Store) History() ([]Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	numbers, err := s.revisions()
+	if err != nil {
+		return nil, err
+	}
+	history := make([]Revision, 0, len(numbers))
+	for _, n := range numbers {
+		rev, err := s.read(n)
+		if err != nil {
+			log.Warn().Err(err).Int("revision", n).Msg("skipping unreadable revision")
+			continue
+		}
+		rev.Configs = nil
+		history = append(history, *rev)
+	}
+	return history, nil
+}
+
+// Get - returns the revision with its configs
+func (s *Store) Get(revision int) (*Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := os.Stat(s.revisionFile(revision)); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %d", ErrRevisionNotFound, revision)
+	}
+	return s.read(revision)
+}
+
+func (s *Store) revisionFile(revision int) string {
+	return filepath.Join(s.historyDir, fmt.Sprintf("%s%06d.json", revisionPrefix, revision))
+}
+
+// revisions - returns the numbers of the retained revisions in ascending order
+func (s *Store) revisions() ([]int, error) {
+	entries, err := os.ReadDir(s.historyDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history directory %s: %v", s.historyDir, err)
+	}
+	numbers := make([]int, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, revisionPrefix) || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, revisionPrefix), ".json"))
+		if err != nil {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+func (s *Store) read(revision int) (*Revision, error) {
+	buf, err := os.ReadFile(s.revisionFile(revision))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revision %d: %v", revision, err)
+	}
+	rev := &Revision{}
+	if err := json.Unmarshal(buf, rev); err != nil {
+		return nil, fmt.Errorf("failed to parse revision %d: %v", revision, err)
+	}
+	return rev, nil
+}
+
+// WriteFileAtomic - writes the data to a temporary file, syncs it and renames it to name,
+// a crash leaves either the previous or the new content
+func WriteFileAtomic(name string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file in %s: %v", dir, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %v", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		log.Debug().Err(err).Str("path", tmp.Name()).Msg("failed to set file mode")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %v", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %v", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %v", tmp.Name(), name, err)
+	}
+	// persist the rename, directories can not be synced on every platform
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
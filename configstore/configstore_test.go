@@ -0,0 +1,126 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package configstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+func configs(version string) []models.L3afBPFPrograms {
+	return []models.L3afBPFPrograms{{
+		HostName:    "l3af-local-test",
+		Iface:       "fakeif0",
+		BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{{Name: "ratelimiting", Version: version}}},
+	}}
+}
+
+func TestStoreSaveHistory(t *testing.T) {
+	dir := t.TempDir()
+	s := New(filepath.Join(dir, "l3af-config.json"), "", 3)
+	ctx := WithAuthor(context.Background(), "l3af-controller")
+
+	for _, version := range []string{"1.0", "1.0", "1.1", "1.2", "1.3"} {
+		if err := s.Save(ctx, configs(version)); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	history, err := s.History()
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	// the unchanged save is not recorded, the oldest revision is pruned
+	if len(history) != 3 || history[0].Revision != 2 || history[2].Revision != 4 {
+		t.Fatalf("History() = %+v, want revisions 2 to 4", history)
+	}
+	latest := history[2]
+	if latest.Author != "l3af-controller" || latest.Configs != nil || len(latest.Changes) != 1 || latest.Changes[0].NewVersion != "1.3" {
+		t.Errorf("latest revision %+v, want the version change to 1.3 by l3af-controller without configs", latest)
+	}
+
+	rev, err := s.Get(2)
+	if err != nil || rev.Configs[0].BpfPrograms.XDPIngress[0].Version != "1.1" {
+		t.Errorf("Get(2) = %+v, %v, want the configs of version 1.1", rev, err)
+	}
+	if _, err := s.Get(1); !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("Get(1) error = %v, want ErrRevisionNotFound", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("temporary file %s left behind", e.Name())
+		}
+	}
+}
+
+func TestStoreSaveFailure(t *testing.T) {
+	dir := t.TempDir()
+	s := New(filepath.Join(dir, "missing", "l3af-config.json"), filepath.Join(dir, "history"), 3)
+	if err := s.Save(context.Background(), configs("1.0")); err == nil {
+		t.Fatal("Save() error = nil, want the configs file not written")
+	}
+	// the configs never saved are not in the history
+	if history, err := s.History(); err != nil || len(history) != 0 {
+		t.Errorf("History() = %+v, %v, want no revisions", history, err)
+	}
+}
+
+func TestStoreLoad(t *testing.T) {
+	tests := []struct {
+		name        string
+		historySize int
+		corrupt     string
+		wantVersion string
+		wantErr     bool
+	}{
+		{name: "Valid", historySize: 2, wantVersion: "1.1"},
+		{name: "CorruptedRestored", historySize: 2, corrupt: `[{"iface": "fakeif0", "bpf_pro`, wantVersion: "1.1"},
+		{name: "CorruptedWithoutHistory", historySize: 0, corrupt: `[{"iface": "fakeif0", "bpf_pro`, wantErr: true},
+		{name: "UnknownFieldRestored", historySize: 2, corrupt: `[{"iface": "fakeif0", "bpf_programs": {"xdp_ingress": [{"name": "ratelimiting", "seqid": 1}]}}]`, wantVersion: "1.1"},
+		{name: "UnknownFieldWithoutHistory", historySize: 0, corrupt: `[{"iface": "fakeif0", "bpf_programs": {"xdp_ingress": [{"name": "ratelimiting", "seqid": 1}]}}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "l3af-config.json")
+			s := New(file, "", tt.historySize)
+			for _, version := range []string{"1.0", "1.1"} {
+				if err := s.Save(context.Background(), configs(version)); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+			if len(tt.corrupt) > 0 {
+				if err := os.WriteFile(file, []byte(tt.corrupt), 0644); err != nil {
+					t.Fatalf("failed to corrupt configs: %v", err)
+				}
+			}
+
+			cfgs, err := s.Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := cfgs[0].BpfPrograms.XDPIngress[0].Version; got != tt.wantVersion {
+				t.Errorf("Load() version = %s, want %s", got, tt.wantVersion)
+			}
+			// the restored configs are written back
+			if cfgs, err := New(file, "", 0).Load(); err != nil || len(cfgs) != 1 {
+				t.Errorf("configs file not restored: %v", err)
+			}
+		})
+	}
+
+	if cfgs, err := New(filepath.Join(t.TempDir(), "missing.json"), "", 2).Load(); cfgs != nil || err != nil {
+		t.Errorf("Load() of a missing file = %v, %v, want no configs", cfgs, err)
+	}
+}
@@ -202,7 +202,11 @@ const docTemplate = `{
                     "type": "string"
                 },
                 "cpu": {
-                    "description": "User program cpu limits",
+                    "description": "User program cpu limit in percent of a cpu, applied with cgroup v2, in seconds with prlimit when CPUSeconds is unset",
+                    "type": "integer"
+                },
+                "cpu_seconds": {
+                    "description": "User program cpu time limit in seconds, applied with prlimit where cgroup v2 is unavailable",
                     "type": "integer"
                 },
                 "ebpf_package_repo_url": {
@@ -24,19 +24,22 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/logfile"
 	"github.com/l3af-project/l3afd/models"
 	"github.com/l3af-project/l3afd/stats"
+	"github.com/l3af-project/l3afd/tracing"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 	"github.com/cilium/ebpf/rlimit"
 	tc "github.com/florianl/go-tc"
 	ps "github.com/mitchellh/go-ps"
-	"github.com/rs/zerolog/log"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
 var (
@@ -57,6 +60,10 @@ type BPF struct {
 	Cmd               *exec.Cmd                 `json:"-"`
 	FilePath          string                    // Binary file path
 	RestartCount      int                       // To track restart count
+	CrashLooping      bool                      // Restart attempts are exhausted
+	Unlinked          bool                      // Removed from the chain while crash looping
+	LastRestartTime   time.Time                 // Time of the last restart attempt
+	NextRestartTime   time.Time                 // Restart attempts are backed off until this time
 	PrevMapNamePath   string                    // Previous Map name with path to link
 	MapNamePath       string                    // Map name with path
 	ProgID            ebpf.ProgramID            // eBPF Program ID
@@ -70,6 +77,14 @@ type BPF struct {
 	hostConfig        *config.Config
 	TCFilter          *tc.Filter `json:"-"` // handle to tc filter
 	XDPLink           link.Link  `json:"-"` // handle xdp link object
+	backend           kernelBackend
+	cgroupPath        string          // cgroup v2 leaf of the user program
+	logWriter         *logfile.Writer // captured output of the user program
+	stdout            *lineWriter
+	stderr            *lineWriter
+	health            atomic.Pointer[models.L3afBPFProgramHealth] // last evaluated health
+	liveness          atomic.Pointer[livenessResult]              // last result of the liveness probe
+	livenessProbing   atomic.Bool                                 // liveness probe is in flight
 }
 
 func NewBpfProgram(ctx context.Context, program models.BPFProgram, conf *config.Config, ifaceName string) *BPF {
@@ -81,11 +96,11 @@ func NewBpfProgram(ctx context.Context, program models.BPFProgram, conf *config.
 		} else if program.ProgType == models.TCType {
 			progMapFilePath = filepath.Join(conf.BpfMapDefaultPath, models.TCMapPinPath, ifaceName, program.MapName)
 		} else {
-			log.Error().Msgf("unsupported program type - %s", program.ProgType)
+			log.Error().Str("program", program.Name).Str("iface", ifaceName).Str("prog_type", program.ProgType).Msg("unsupported program type")
 			return nil
 		}
 		if strings.Contains(progMapFilePath, "..") {
-			log.Error().Msgf("program map file contains relative path %s", progMapFilePath)
+			log.Error().Str("program", program.Name).Str("iface", ifaceName).Str("path", progMapFilePath).Msg("program map file contains relative path")
 			return nil
 		}
 	}
@@ -105,10 +120,25 @@ func NewBpfProgram(ctx context.Context, program models.BPFProgram, conf *config.
 	return bpf
 }
 
+// kernel - returns the kernel backend of the program, falling back to the default one
+func (b *BPF) kernel() kernelBackend {
+	if b.backend == nil {
+		return defaultKernel
+	}
+	return b.backend
+}
+
 // LoadRootProgram - Loading the Root Program for a given interface.
-func LoadRootProgram(ifaceName string, direction string, progType string, conf *config.Config) (*BPF, error) {
+func LoadRootProgram(ctx context.Context, ifaceName string, direction string, progType string, conf *config.Config) (*BPF, error) {
+	return loadRootProgram(ctx, ifaceName, direction, progType, conf, defaultKernel)
+}
 
-	log.Info().Msgf("LoadRootProgram iface %s direction %s progType %s", ifaceName, direction, progType)
+// loadRootProgram - Loading the Root Program for a given interface using the provided kernel backend.
+func loadRootProgram(ctx context.Context, ifaceName string, direction string, progType string, conf *config.Config, backend kernelBackend) (_ *BPF, err error) {
+	ctx, span := tracing.Start(ctx, "LoadRootProgram", tracing.IfaceKey.String(ifaceName), tracing.DirectionKey.String(direction))
+	defer func() { tracing.End(span, err) }()
+
+	log.Info().Str("iface", ifaceName).Str("direction", direction).Str("prog_type", progType).Msg("LoadRootProgram")
 	var rootProgBPF *BPF
 
 	switch progType {
@@ -136,6 +166,7 @@ func LoadRootProgram(ifaceName string, direction string, progType string, conf *
 			hostConfig:      conf,
 			MapNamePath:     filepath.Join(conf.BpfMapDefaultPath, ifaceName, conf.XDPRootMapName),
 			XDPLink:         nil,
+			backend:         backend,
 		}
 	case models.TCType:
 		rootProgBPF = &BPF{
@@ -155,6 +186,7 @@ func LoadRootProgram(ifaceName string, direction string, progType string, conf *
 			FilePath:        "",
 			PrevMapNamePath: "",
 			hostConfig:      conf,
+			backend:         backend,
 		}
 		if direction == models.IngressType {
 			rootProgBPF.Program.MapName = conf.TCRootIngressMapName
@@ -170,17 +202,17 @@ func LoadRootProgram(ifaceName string, direction string, progType string, conf *
 		return nil, fmt.Errorf("unknown direction %s for root program in iface %s", direction, ifaceName)
 	}
 
-	if err := rootProgBPF.VerifyAndGetArtifacts(conf); err != nil {
-		log.Error().Err(err).Msg("failed to get root artifacts")
+	if err := rootProgBPF.VerifyAndGetArtifacts(ctx, conf); err != nil {
+		rootProgBPF.logger(ifaceName, direction).Error().Err(err).Msg("failed to get root artifacts")
 		return nil, err
 	}
 
 	// On l3afd crashing scenario verify root program are unloaded properly by checking existence of persisted maps
 	// if map file exists then root program didn't clean up pinned map files
 	if fileExists(rootProgBPF.MapNamePath) {
-		log.Warn().Msgf("previous instance of root program %s persisted map %s file exists", rootProgBPF.Program.Name, rootProgBPF.MapNamePath)
+		rootProgBPF.logger(ifaceName, direction).Warn().Str("path", rootProgBPF.MapNamePath).Msg("previous instance of root program persisted map file exists")
 		if err := rootProgBPF.RemoveRootProgMapFile(ifaceName); err != nil {
-			log.Info().Msgf("previous instance of root program %s map file removed successfully - %s ", rootProgBPF.Program.Name, rootProgBPF.MapNamePath)
+			rootProgBPF.logger(ifaceName, direction).Info().Str("path", rootProgBPF.MapNamePath).Msg("previous instance of root program map file removed successfully")
 		}
 	}
 
@@ -195,6 +227,7 @@ func LoadRootProgram(ifaceName string, direction string, progType string, conf *
 		}
 	}
 
+	rootProgBPF.recordEvent(models.EventNormal, models.EventRootProgramAttached, ifaceName, direction, "")
 	return rootProgBPF, nil
 }
 
@@ -216,11 +249,11 @@ func StopExternalRunningProcess(processName string) error {
 	if err != nil {
 		return fmt.Errorf("failed to fetch processes list")
 	}
-	log.Info().Msgf("Searching for process %s and not ppid %d", processName, myPid)
+	log.Info().Str("process", processName).Int("ppid", myPid).Msg("Searching for process not started by l3afd")
 	for _, process := range processList {
 		if strings.Contains(process.Executable(), psName) {
 			if process.PPid() != myPid {
-				log.Warn().Msgf("found process id %d name %s ppid %d, stopping it", process.Pid(), process.Executable(), process.PPid())
+				log.Warn().Int("pid", process.Pid()).Str("process", process.Executable()).Int("ppid", process.PPid()).Msg("found external process, stopping it")
 				osProcess, err := os.FindProcess(process.Pid())
 				if err == nil {
 					err = osProcess.Kill()
@@ -238,28 +271,31 @@ func StopExternalRunningProcess(processName string) error {
 // Stops the user programs if any, and unloads the BPF program.
 // Clean up all map handles.
 // Verify next program pinned map file is removed
-func (b *BPF) Stop(ifaceName, direction string, chain bool) error {
+func (b *BPF) Stop(ctx context.Context, ifaceName, direction string, chain bool) (err error) {
+	ctx, span := b.startSpan(ctx, "BPF.Stop", ifaceName, direction)
+	defer func() { tracing.End(span, err) }()
+
 	if b.Program.UserProgramDaemon && b.Cmd == nil {
 		return fmt.Errorf("BPFProgram is not running %s", b.Program.Name)
 	}
 
-	log.Info().Msgf("Stopping BPF Program - %s", b.Program.Name)
+	b.logger(ifaceName, direction).Info().Msg("Stopping BPF Program")
 
 	// Removing maps
 	for key, val := range b.BpfMaps {
-		log.Debug().Msgf("removing BPF maps %s value map %#v", key, val)
+		b.logger(ifaceName, direction).Debug().Str("map", key).Uint32("map_id", uint32(val.MapID)).Msg("removing BPF map")
 		delete(b.BpfMaps, key)
 	}
 
 	// Removing Metrics maps
 	for key, val := range b.MetricsBpfMaps {
-		log.Debug().Msgf("removing metric bpf maps %s value %#v", key, val)
+		b.logger(ifaceName, direction).Debug().Str("map", key).Uint32("map_id", uint32(val.MapID)).Msg("removing metric BPF map")
 		delete(b.MetricsBpfMaps, key)
 	}
 
 	// Stop KFconfigs
 	if len(b.Program.CmdConfig) > 0 && len(b.Program.ConfigFilePath) > 0 {
-		log.Info().Msgf("Stopping KF configs %s ", b.Program.Name)
+		b.logger(ifaceName, direction).Info().Msg("Stopping KF configs")
 		b.Done <- true
 	}
 
@@ -272,6 +308,37 @@ func (b *BPF) Stop(ifaceName, direction string, chain bool) error {
 	stats.SetWithVersion(0.0, stats.NFRunning, b.Program.Name, b.Program.Version, direction, ifaceName)
 
 	// Stop User Programs if any
+	if err = b.stopUserProgram(ctx, ifaceName, direction); err != nil {
+		return err
+	}
+
+	// unload the BPF programs
+	if b.ProgMapCollection != nil {
+		_, unloadSpan := b.startSpan(ctx, "BPF.UnloadProgram", ifaceName, direction)
+		err = b.UnloadProgram(ifaceName, direction)
+		tracing.End(unloadSpan, err)
+		if err != nil {
+			return fmt.Errorf("BPFProgram %s unload failed on interface %s with error: %v", b.Program.Name, ifaceName, err)
+		}
+		b.logger(ifaceName, direction).Info().Msg("program is unloaded/detached successfully")
+	}
+	_, cleanupSpan := b.startSpan(ctx, "BPF.VerifyCleanupMaps", ifaceName, direction)
+	err = b.VerifyCleanupMaps(chain)
+	tracing.End(cleanupSpan, err)
+	if err != nil {
+		b.logger(ifaceName, direction).Error().Err(err).Msg("stop user program - failed to remove map files")
+		return fmt.Errorf("stop user program - failed to remove map files %s", b.Program.Name)
+	}
+
+	b.recordEvent(models.EventNormal, models.EventProgramStopped, ifaceName, direction, "")
+	return nil
+}
+
+// stopUserProgram - terminates the user program, or runs its stop command
+func (b *BPF) stopUserProgram(ctx context.Context, ifaceName, direction string) (err error) {
+	_, span := b.startSpan(ctx, "BPF.stopUserProgram", ifaceName, direction)
+	defer func() { tracing.End(span, err) }()
+
 	if len(b.Program.CmdStop) < 1 && b.Program.UserProgramDaemon {
 		// Loaded using user program
 		if err := b.ProcessTerminate(); err != nil {
@@ -279,10 +346,12 @@ func (b *BPF) Stop(ifaceName, direction string, chain bool) error {
 		}
 		if b.Cmd != nil {
 			if err := b.Cmd.Wait(); err != nil {
-				log.Error().Err(err).Msgf("cmd wait at stopping bpf program %s errored", b.Program.Name)
+				b.logger(ifaceName, direction).Error().Err(err).Msg("cmd wait at stopping bpf program errored")
 			}
 			b.Cmd = nil
 		}
+		b.closeOutput()
+		b.RemoveCgroup()
 	} else if len(b.Program.CmdStop) > 0 && b.Program.UserProgramDaemon {
 		cmd := filepath.Join(b.FilePath, b.Program.CmdStop)
 
@@ -297,31 +366,21 @@ func (b *BPF) Stop(ifaceName, direction string, chain bool) error {
 		for k, val := range b.Program.StopArgs {
 			if v, ok := val.(string); !ok {
 				err := fmt.Errorf("stop args is not a string for the bpf program %s", b.Program.Name)
-				log.Error().Err(err).Msgf("failed to convert stop args value into string for program %s", b.Program.Name)
+				b.logger(ifaceName, direction).Error().Err(err).Msg("failed to convert stop args value into string")
 				return err
 			} else {
 				args = append(args, "--"+k+" ="+v)
 			}
 		}
 
-		log.Info().Msgf("bpf program stop command : %s %v", cmd, args)
+		b.logger(ifaceName, direction).Info().Str("cmd", cmd).Strs("args", args).Msg("bpf program stop command")
 		prog := execCommand(cmd, args...)
 		if err := prog.Run(); err != nil {
-			log.Warn().Err(err).Msgf("l3afd : Failed to stop the program %s", b.Program.CmdStop)
+			b.logger(ifaceName, direction).Warn().Err(err).Str("cmd", b.Program.CmdStop).Msg("l3afd : Failed to stop the program")
 		}
 		b.Cmd = nil
-	}
-
-	// unload the BPF programs
-	if b.ProgMapCollection != nil {
-		if err := b.UnloadProgram(ifaceName, direction); err != nil {
-			return fmt.Errorf("BPFProgram %s unload failed on interface %s with error: %v", b.Program.Name, ifaceName, err)
-		}
-		log.Info().Msgf("%s => %s direction => %s - program is unloaded/detached successfully", ifaceName, b.Program.Name, direction)
-	}
-	if err := b.VerifyCleanupMaps(chain); err != nil {
-		log.Error().Err(err).Msgf("stop user program - failed to remove map files %s", b.Program.Name)
-		return fmt.Errorf("stop user program - failed to remove map files %s", b.Program.Name)
+		b.closeOutput()
+		b.RemoveCgroup()
 	}
 
 	return nil
@@ -332,7 +391,10 @@ func (b *BPF) Stop(ifaceName, direction string, chain bool) error {
 // After starting the user program, will update the kernel progam fd into prevprogram map.
 // This method waits till prog fd entry is updated, else returns error assuming kernel program is not loaded.
 // It also verifies the next program pinned map is created or not.
-func (b *BPF) Start(ifaceName, direction string, chain bool) error {
+func (b *BPF) Start(ctx context.Context, ifaceName, direction string, chain bool) (err error) {
+	ctx, span := b.startSpan(ctx, "BPF.Start", ifaceName, direction)
+	defer func() { tracing.End(span, err) }()
+
 	if b.FilePath == "" {
 		return errors.New("no program binary path found")
 	}
@@ -345,58 +407,81 @@ func (b *BPF) Start(ifaceName, direction string, chain bool) error {
 	}
 
 	// Making sure old map entry is removed before passing the prog fd map to the program.
-	if len(b.PrevMapNamePath) > 0 {
+	// The entry of an unlinked program is the bypass to the next program, it is kept until the program is linked back.
+	if len(b.PrevMapNamePath) > 0 && !b.Unlinked {
 		if err := b.RemovePrevProgFD(); err != nil {
-			log.Error().Err(err).Msgf("ProgramMap %s entry removal failed", b.PrevMapNamePath)
+			b.logger(ifaceName, direction).Error().Err(err).Str("path", b.PrevMapNamePath).Msg("ProgramMap entry removal failed")
 		}
 	}
 
 	// Both xdp and tc are loaded using the same mechanism.
 	if len(b.Program.ObjectFile) > 0 {
+		_, loadSpan := b.startSpan(ctx, "BPF.LoadBPFProgram", ifaceName, direction)
 		if chain {
-			if err := b.LoadBPFProgramChain(ifaceName, direction); err != nil {
-				return fmt.Errorf("loading bpf program %s - error %v", b.Program.Name, err)
-			}
+			err = b.LoadBPFProgramChain(ifaceName, direction)
 		} else {
-			if err := b.AttachBPFProgram(ifaceName, direction); err != nil {
-				return fmt.Errorf("attaching bpf program %s - error %v", b.Program.Name, err)
-			}
+			err = b.AttachBPFProgram(ifaceName, direction)
+		}
+		tracing.End(loadSpan, err)
+		if err != nil && chain {
+			return fmt.Errorf("loading bpf program %s - error %v", b.Program.Name, err)
+		} else if err != nil {
+			return fmt.Errorf("attaching bpf program %s - error %v", b.Program.Name, err)
 		}
 	} else {
-		log.Info().Msgf("bpf program object file is not defined - %s", b.Program.Name)
+		b.logger(ifaceName, direction).Info().Msg("bpf program object file is not defined")
 	}
 
 	// Start user program before loading
 	if len(b.Program.CmdStart) > 0 {
-		if err := b.StartUserProgram(ifaceName, direction, chain); err != nil {
+		if err := b.StartUserProgram(ctx, ifaceName, direction, chain); err != nil {
 			return fmt.Errorf("user program startup failed %s - error %v", b.Program.CmdStart, err)
 		}
 	}
 
 	// making sure program fd map pinned file is created
-	if err := b.VerifyPinnedProgMap(chain, true); err != nil {
+	_, pinnedSpan := b.startSpan(ctx, "BPF.VerifyPinnedProgMap", ifaceName, direction)
+	err = b.VerifyPinnedProgMap(chain, true)
+	tracing.End(pinnedSpan, err)
+	if err != nil {
 		return fmt.Errorf("failed to find pinned file %s  %v", b.MapNamePath, err)
 	}
 
+	// Program map is pinned by the user program, keep its ID to link the next program
+	if chain && b.ProgMapCollection == nil && len(b.Program.MapName) > 0 {
+		mapID, err := b.kernel().PinnedMapID(b.MapNamePath)
+		if err != nil {
+			b.logger(ifaceName, direction).Warn().Err(err).Msg("failed to fetch the program map ID")
+		} else {
+			b.ProgMapID = mapID
+		}
+	}
+
 	// BPF map config values
 	if len(b.Program.MapArgs) > 0 {
-		if err := b.UpdateBPFMaps(ifaceName, direction); err != nil {
-			log.Error().Err(err).Msg("failed to update ebpf program BPF maps")
+		_, mapsSpan := b.startSpan(ctx, "BPF.UpdateBPFMaps", ifaceName, direction)
+		err = b.UpdateBPFMaps(ifaceName, direction)
+		tracing.End(mapsSpan, err)
+		if err != nil {
+			b.logger(ifaceName, direction).Error().Err(err).Msg("failed to update ebpf program BPF maps")
 			return fmt.Errorf("failed to update ebpf program BPF maps %v", err)
 		}
 	}
 
 	// Update args config values
 	if len(b.Program.UpdateArgs) > 0 {
-		if err := b.UpdateArgs(ifaceName, direction); err != nil {
-			log.Error().Err(err).Msg("failed to update ebpf program config update")
+		_, argsSpan := b.startSpan(ctx, "BPF.UpdateArgs", ifaceName, direction)
+		err = b.UpdateArgs(ifaceName, direction)
+		tracing.End(argsSpan, err)
+		if err != nil {
+			b.logger(ifaceName, direction).Error().Err(err).Msg("failed to update ebpf program config update")
 			return fmt.Errorf("failed to update ebpf program config update %v", err)
 		}
 	}
 
 	// Fetch when prev program map is updated only when loaded using user program
 	if len(b.PrevMapNamePath) > 0 && b.ProgMapCollection == nil {
-		var err error
+		_, progIDSpan := b.startSpan(ctx, "BPF.GetProgID", ifaceName, direction)
 		// retry 10 times to verify entry is created
 		for i := 0; i < 10; i++ {
 			b.ProgID, err = b.GetProgID()
@@ -404,19 +489,21 @@ func (b *BPF) Start(ifaceName, direction string, chain bool) error {
 				break
 			}
 
-			log.Warn().Msg("failed to fetch the program ID, retrying after a second ... ")
+			progIDSpan.AddEvent("retry")
+			b.logger(ifaceName, direction).Warn().Msg("failed to fetch the program ID, retrying after a second ... ")
 			time.Sleep(1 * time.Second)
 		}
+		tracing.End(progIDSpan, err)
 
 		if err != nil {
-			log.Error().Err(err).Msg("failed to fetch ebpf program FD")
+			b.logger(ifaceName, direction).Error().Err(err).Msg("failed to fetch ebpf program FD")
 			return fmt.Errorf("failed to fetch ebpf program FD %v", err)
 		}
 	}
 
 	// KFconfigs
 	if len(b.Program.CmdConfig) > 0 && len(b.Program.ConfigFilePath) > 0 {
-		log.Info().Msgf("eBPF program specific config monitoring - %s", b.Program.ConfigFilePath)
+		b.logger(ifaceName, direction).Info().Str("path", b.Program.ConfigFilePath).Msg("eBPF program specific config monitoring")
 		b.Done = make(chan bool)
 		go b.RunKFConfigs()
 	}
@@ -426,11 +513,12 @@ func (b *BPF) Start(ifaceName, direction string, chain bool) error {
 
 	userProgram, bpfProgram, err := b.isRunning()
 	if !userProgram && !bpfProgram {
-		log.Error().Err(err).Msg("eBPF program failed to start")
+		b.logger(ifaceName, direction).Error().Err(err).Msg("eBPF program failed to start")
 		return fmt.Errorf("bpf program %s failed to start %v", b.Program.Name, err)
 	}
 
-	log.Info().Msgf("BPF program - %s started Program ID %d", b.Program.Name, uint32(b.ProgID))
+	b.logger(ifaceName, direction).Info().Msg("BPF program started")
+	b.recordEvent(models.EventNormal, models.EventProgramStarted, ifaceName, direction, "")
 	return nil
 }
 
@@ -440,10 +528,10 @@ func (b *BPF) UpdateBPFMaps(ifaceName, direction string) error {
 
 		if v, ok := val.(string); !ok {
 			err := fmt.Errorf("update map args is not a string for the ebpf program %s", b.Program.Name)
-			log.Error().Err(err).Msgf("failed to convert map args value into string for program %s", b.Program.Name)
+			b.logger(ifaceName, direction).Error().Err(err).Msg("failed to convert map args value into string")
 			return err
 		} else {
-			log.Info().Msgf("Update map args key %s val %s", k, v)
+			b.logger(ifaceName, direction).Info().Str("map", k).Str("value", v).Msg("Update map args")
 
 			bpfMap, ok := b.BpfMaps[k]
 			if !ok {
@@ -483,18 +571,18 @@ func (b *BPF) UpdateArgs(ifaceName, direction string) error {
 	for k, val := range b.Program.UpdateArgs {
 		if v, ok := val.(string); !ok {
 			err := fmt.Errorf("update args is not a string for the ebpf program %s", b.Program.Name)
-			log.Error().Err(err).Msgf("failed to convert update args value into string for program %s", b.Program.Name)
+			b.logger(ifaceName, direction).Error().Err(err).Msg("failed to convert update args value into string")
 			return err
 		} else {
 			args = append(args, "--"+k+"="+v)
 		}
 	}
 
-	log.Info().Msgf("BPF Program update command : %s %v", cmd, args)
+	b.logger(ifaceName, direction).Info().Str("cmd", cmd).Strs("args", args).Msg("BPF Program update command")
 	UpdateCmd := execCommand(cmd, args...)
 	if err := UpdateCmd.Start(); err != nil {
 		stats.Incr(stats.NFUpdateFailedCount, b.Program.Name, direction, ifaceName)
-		log.Info().Err(err).Msgf("user mode BPF program failed - %s", b.Program.Name)
+		b.logger(ifaceName, direction).Info().Err(err).Msg("user mode BPF program failed")
 		return fmt.Errorf("failed to start : %s %v", cmd, args)
 	}
 
@@ -505,7 +593,7 @@ func (b *BPF) UpdateArgs(ifaceName, direction string) error {
 
 	stats.Incr(stats.NFUpdateCount, b.Program.Name, direction, ifaceName)
 
-	log.Info().Msgf("BPF program - %s config updated", b.Program.Name)
+	b.logger(ifaceName, direction).Info().Msg("BPF program config updated")
 	return nil
 }
 
@@ -527,25 +615,25 @@ func (b *BPF) isRunning() (bool, bool, error) {
 			for k, val := range b.Program.StatusArgs {
 				if v, ok := val.(string); !ok {
 					err = fmt.Errorf("status args is not a string for the ebpf program %s", b.Program.Name)
-					log.Warn().Err(err).Msgf("failed to convert status args value into string for program %s", b.Program.Name)
+					b.logger("", "").Warn().Err(err).Msg("failed to convert status args value into string")
 				} else {
 					args = append(args, "--"+k+" ="+v)
 				}
 			}
 			prog := execCommand(cmd, args...)
-			var out bytes.Buffer
+			var out, stderr bytes.Buffer
 			prog.Stdout = &out
-			prog.Stderr = &out
+			prog.Stderr = &stderr
 			if err = prog.Run(); err != nil {
-				log.Warn().Err(err).Msgf("l3afd : Failed to execute %s", b.Program.CmdStatus)
+				b.logger("", "").Warn().Err(err).Str("cmd", b.Program.CmdStatus).Msg("l3afd : Failed to execute")
 			}
-			outStr, errStr := out.String(), out.String()
+			outStr, errStr := out.String(), stderr.String()
 			if strings.EqualFold(outStr, bpfStatus) {
 				userProgram = true
 				bpfProgram = true
 			} else {
 				userProgram = false
-				log.Warn().Msgf("bpf program not running error - %s", errStr)
+				b.logger("", "").Warn().Str("stderr", errStr).Msg("bpf program not running")
 			}
 		}
 		return userProgram, bpfProgram, err
@@ -553,11 +641,11 @@ func (b *BPF) isRunning() (bool, bool, error) {
 	if len(b.Program.CmdStart) > 1 && b.Program.UserProgramDaemon {
 		if err := b.VerifyProcessObject(); err != nil {
 			userProgram = false
-			log.Warn().Err(err).Msgf("process object is not created for command start - %s", b.Program.CmdStart)
+			b.logger("", "").Warn().Err(err).Str("cmd", b.Program.CmdStart).Msg("process object is not created for command start")
 		} else {
 			userProgram, err = IsProcessRunning(b.Cmd.Process.Pid, b.Program.Name)
 			if err != nil {
-				log.Warn().Err(err).Msgf("failed to execute command status - %s user program %v", b.Program.CmdStart, userProgram)
+				b.logger("", "").Warn().Err(err).Str("cmd", b.Program.CmdStart).Bool("user_program", userProgram).Msg("failed to execute command status")
 			} else {
 				userProgram = true
 			}
@@ -568,19 +656,27 @@ func (b *BPF) isRunning() (bool, bool, error) {
 }
 
 // VerifyAndGetArtifacts -Check binary already exists
-func (b *BPF) VerifyAndGetArtifacts(conf *config.Config) error {
+func (b *BPF) VerifyAndGetArtifacts(ctx context.Context, conf *config.Config) error {
 
 	fPath := filepath.Join(conf.BPFDir, b.Program.Name, b.Program.Version, strings.Split(b.Program.Artifact, ".")[0])
 	if _, err := os.Stat(fPath); os.IsNotExist(err) {
-		return b.GetArtifacts(conf)
+		return b.GetArtifacts(ctx, conf)
 	}
 
 	b.FilePath = fPath
+	b.recordEvent(models.EventNormal, models.EventArtifactVerified, "", "", "found in "+fPath)
 	return nil
 }
 
 // GetArtifacts downloads artifacts from the specified eBPF repo
-func (b *BPF) GetArtifacts(conf *config.Config) error {
+func (b *BPF) GetArtifacts(ctx context.Context, conf *config.Config) (err error) {
+	ctx, span := b.startSpan(ctx, "BPF.GetArtifacts", "", "")
+	defer func() {
+		if err == nil {
+			b.recordEvent(models.EventNormal, models.EventArtifactDownloaded, "", "", "extracted to "+b.FilePath)
+		}
+		tracing.End(span, err)
+	}()
 
 	buf := &bytes.Buffer{}
 	isDefaultURLUsed := false
@@ -605,7 +701,8 @@ func (b *BPF) GetArtifacts(conf *config.Config) error {
 	}
 
 	URL.Path = path.Join(URL.Path, b.Program.Name, b.Program.Version, platform, b.Program.Artifact)
-	log.Info().Msgf("Retrieving artifact - %s", URL)
+	b.logger("", "").Info().Stringer("url", URL).Msg("Retrieving artifact")
+	span.SetAttributes(semconv.URLFull(URL.String()))
 	switch URL.Scheme {
 	case httpsScheme, httpScheme:
 		{
@@ -616,16 +713,9 @@ func (b *BPF) GetArtifacts(conf *config.Config) error {
 			client := http.Client{Transport: netTransport, Timeout: timeOut}
 
 			// Get the data
-			resp, err := client.Get(URL.String())
-			if err != nil {
-				return fmt.Errorf("download failed: %v", err)
-			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode != http.StatusOK {
-				return fmt.Errorf("get request returned unexpected status code: %d (%s), %d was expected\n\tResponse Body: %s", resp.StatusCode, http.StatusText(resp.StatusCode), http.StatusOK, buf.Bytes())
+			if err := b.downloadArtifact(ctx, &client, URL.String(), buf); err != nil {
+				return err
 			}
-			buf.ReadFrom(resp.Body)
 		}
 	case fileScheme:
 		{
@@ -744,6 +834,29 @@ func (b *BPF) GetArtifacts(conf *config.Config) error {
 	}
 }
 
+// downloadArtifact - downloads the artifact at rawURL into buf
+func (b *BPF) downloadArtifact(ctx context.Context, client *http.Client, rawURL string, buf *bytes.Buffer) (err error) {
+	ctx, span := b.startSpan(ctx, "artifact download", "", "")
+	defer func() { tracing.End(span, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("download failed: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("download failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get request returned unexpected status code: %d (%s), %d was expected\n\tResponse Body: %s", resp.StatusCode, http.StatusText(resp.StatusCode), http.StatusOK, buf.Bytes())
+	}
+	buf.ReadFrom(resp.Body)
+	return nil
+}
+
 // create rules file
 func (b *BPF) createUpdateRulesFile(direction string) (string, error) {
 
@@ -809,7 +922,7 @@ func (b *BPF) GetBPFMap(mapName string) (*BPFMap, error) {
 		BPFProg: b,
 	}
 
-	log.Info().Msgf("added mapID %d Name %s Type %s", newBPFMap.MapID, newBPFMap.Name, newBPFMap.Type)
+	newBPFMap.logger().Info().Stringer("type", newBPFMap.Type).Msg("added map")
 	return &newBPFMap, nil
 }
 
@@ -826,7 +939,7 @@ func (b *BPF) AddMetricsBPFMap(mapName, aggregator string, key, samplesLength in
 	tmpMetricsBPFMap.aggregator = aggregator
 	tmpMetricsBPFMap.Values = ring.New(samplesLength)
 
-	log.Info().Msgf("added Metrics map ID %d Name %s Type %s Key %d Aggregator %s", tmpMetricsBPFMap.MapID, tmpMetricsBPFMap.Name, tmpMetricsBPFMap.Type, tmpMetricsBPFMap.key, tmpMetricsBPFMap.aggregator)
+	tmpMetricsBPFMap.logger().Info().Stringer("type", tmpMetricsBPFMap.Type).Int("key", key).Str("aggregator", aggregator).Msg("added metrics map")
 	map_key := mapName + strconv.Itoa(key) + aggregator
 	b.MetricsBpfMaps[map_key] = &tmpMetricsBPFMap
 
@@ -836,7 +949,7 @@ func (b *BPF) AddMetricsBPFMap(mapName, aggregator string, key, samplesLength in
 // This method to fetch values from bpf maps and publish to metrics
 func (b *BPF) MonitorMaps(ifaceName string, intervals int) error {
 	for _, element := range b.Program.MonitorMaps {
-		log.Debug().Msgf("monitor maps element %s key %d aggregator %s", element.Name, element.Key, element.Aggregator)
+		b.logger(ifaceName, "").Debug().Str("map", element.Name).Int("key", element.Key).Str("aggregator", element.Aggregator).Msg("monitor maps element")
 		mapKey := element.Name + strconv.Itoa(element.Key) + element.Aggregator
 		_, ok := b.MetricsBpfMaps[mapKey]
 		if !ok {
@@ -858,22 +971,9 @@ func (b *BPF) PutNextProgFDFromID(progID int) error {
 		return nil
 	}
 
-	log.Info().Msgf("PutNextProgFDFromID : Map Name %s ID %d", b.Program.MapName, progID)
-	ebpfMap, err := ebpf.NewMapFromID(b.ProgMapID)
-	if err != nil {
-		return fmt.Errorf("unable to access pinned next prog map %s %v", b.Program.MapName, err)
-	}
-	defer ebpfMap.Close()
-
-	bpfProg, err := ebpf.NewProgramFromID(ebpf.ProgramID(progID))
-	if err != nil {
-		return fmt.Errorf("failed to get next prog FD from ID for program %s %v", b.Program.Name, err)
-	}
-	key := 0
-	fd := bpfProg.FD()
-	log.Info().Msgf("PutNextProgFDFromID : Map Name %s FD %d", b.Program.MapName, fd)
-	if err = ebpfMap.Update(unsafe.Pointer(&key), unsafe.Pointer(&fd), 0); err != nil {
-		return fmt.Errorf("unable to update prog next map %s %v", b.Program.MapName, err)
+	b.logger("", "").Info().Str("map", b.Program.MapName).Int("next_prog_id", progID).Msg("PutNextProgFDFromID")
+	if err := b.kernel().ProgArrayUpdate(b.ProgMapID, ebpf.ProgramID(progID)); err != nil {
+		return fmt.Errorf("unable to update prog next map %s for program %s %v", b.Program.MapName, b.Program.Name, err)
 	}
 	return nil
 }
@@ -881,65 +981,71 @@ func (b *BPF) PutNextProgFDFromID(progID int) error {
 // GetProgID - This returns ID of the bpf program
 func (b *BPF) GetProgID() (ebpf.ProgramID, error) {
 
-	ebpfMap, err := ebpf.LoadPinnedMap(b.PrevMapNamePath, &ebpf.LoadPinOptions{ReadOnly: true})
+	mapPath := b.linkMapPath()
+	value, err := b.kernel().ProgArrayLookupPinned(mapPath)
 	if err != nil {
-		log.Error().Err(err).Msgf("unable to access pinned prog map %s", b.PrevMapNamePath)
-		return 0, fmt.Errorf("unable to access pinned prog map %s %v", b.PrevMapNamePath, err)
-	}
-	defer ebpfMap.Close()
-	var value ebpf.ProgramID
-	key := 0
-
-	if err = ebpfMap.Lookup(unsafe.Pointer(&key), unsafe.Pointer(&value)); err != nil {
-		log.Warn().Err(err).Msgf("unable to look up prog map %s", b.PrevMapNamePath)
-		return 0, fmt.Errorf("unable to look up prog map %v", err)
+		b.logger("", "").Warn().Err(err).Str("path", mapPath).Msg("unable to look up prog map")
+		return 0, err
 	}
 
 	// verify progID before storing in locally.
-	_, err = ebpf.NewProgramFromID(ebpf.ProgramID(value))
-	if err != nil {
-		log.Warn().Err(err).Msgf("failed to verify program ID %s", b.PrevMapNamePath)
+	if err = b.kernel().ProgramExists(value); err != nil {
+		b.logger("", "").Warn().Err(err).Str("path", mapPath).Msg("failed to verify program ID")
 		return 0, fmt.Errorf("failed to verify program ID %s %v", b.Program.Name, err)
 	}
 
-	log.Info().Msgf("GetProgID - Name %s PrevMapName %s ID %d", b.Program.Name, b.PrevMapNamePath, value)
+	b.logger("", "").Info().Str("path", mapPath).Uint32("prev_prog_id", uint32(value)).Msg("GetProgID")
 	return value, nil
 }
 
+// linkMapPath - returns the prog map the user program links the program into, the map of the previous program or
+// while the program is unlinked from the chain a map of its own, so the bypass of the previous program is kept
+func (b *BPF) linkMapPath() string {
+	if b.Unlinked {
+		return b.unlinkedMapPath()
+	}
+	return b.PrevMapNamePath
+}
+
+// unlinkedMapPath - returns the path of the prog map the program is linked into by its user program while unlinked
+func (b *BPF) unlinkedMapPath() string {
+	return b.MapNamePath + "_unlinked"
+}
+
+// removeUnlinkedMap - removes the prog map the program was linked into while unlinked
+func (b *BPF) removeUnlinkedMap() error {
+	if err := os.Remove(b.unlinkedMapPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to remove prog map %s %v", b.unlinkedMapPath(), err)
+	}
+	return nil
+}
+
 // RemoveNextProgFD Delete the entry if its last program in the chain.
-// This method is called when sequence of the program changed to last in the chain
+// This method is called when sequence of the program changed to last in the chain. The entry of the program's own
+// prog map is removed, earlier versions removed the one of the previous program's map and unlinked the program itself.
 func (b *BPF) RemoveNextProgFD() error {
 	if len(b.Program.MapName) == 0 {
 		// no chaining map in case of root programs
 		return nil
 	}
 
-	ebpfMap, err := ebpf.NewMapFromID(b.PrevProgMapID)
-	if err != nil {
-		return fmt.Errorf("unable to access pinned next prog map %s %v", b.Program.MapName, err)
-	}
-	defer ebpfMap.Close()
-	key := 0
-
-	if err := ebpfMap.Delete(unsafe.Pointer(&key)); err != nil {
-		return fmt.Errorf("failed to delete prog fd entry")
+	if err := b.kernel().ProgArrayDelete(b.ProgMapID); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return fmt.Errorf("failed to delete prog fd entry of next prog map %s %v", b.Program.MapName, err)
 	}
 	return nil
 }
 
-// RemovePrevProgFD Delete the entry if the last element
+// RemovePrevProgFD Delete the entry if the last element. Only an empty entry is ignored, earlier versions also ignored
+// failures to update the map and left the program linked.
 func (b *BPF) RemovePrevProgFD() error {
 
-	ebpfMap, err := ebpf.NewMapFromID(b.PrevProgMapID)
-	if err != nil {
-		return fmt.Errorf("unable to access pinned prev prog map %s %v", b.PrevMapNamePath, err)
-	}
-	defer ebpfMap.Close()
-	key := 0
-
-	if err := ebpfMap.Delete(unsafe.Pointer(&key)); err != nil {
+	if err := b.kernel().ProgArrayDelete(b.PrevProgMapID); err != nil {
 		// Some cases map may be empty ignore it.
-		log.Debug().Err(err).Msg("RemovePrevProgFD failed")
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			b.logger("", "").Debug().Err(err).Msg("RemovePrevProgFD failed")
+			return nil
+		}
+		return fmt.Errorf("unable to remove entry of prev prog map %s %v", b.PrevMapNamePath, err)
 	}
 	return nil
 }
@@ -952,21 +1058,21 @@ func (b *BPF) VerifyPinnedProgMap(chain, exists bool) error {
 	}
 	var err error
 	if len(b.Program.MapName) > 0 {
-		log.Debug().Msgf("VerifyPinnedMap : Program %s MapName %s Exists %t", b.Program.Name, b.Program.MapName, exists)
+		b.logger("", "").Debug().Str("map", b.Program.MapName).Bool("exists", exists).Msg("VerifyPinnedMap")
 
 		for i := 0; i < 10; i++ {
 			_, err = os.Stat(b.MapNamePath)
 			if err == nil && exists {
-				log.Info().Msgf("VerifyPinnedProgMap creation : map file created %s", b.MapNamePath)
+				b.logger("", "").Info().Str("path", b.MapNamePath).Msg("VerifyPinnedProgMap creation : map file created")
 				return nil
 			} else if err != nil && !exists {
 				if _, err = os.Stat(b.MapNamePath); os.IsNotExist(err) {
-					log.Info().Msgf("VerifyPinnedProgMap removal : map file removed successfully - %s ", b.MapNamePath)
+					b.logger("", "").Info().Str("path", b.MapNamePath).Msg("VerifyPinnedProgMap removal : map file removed successfully")
 					return nil
 				} else if err != nil {
-					log.Warn().Err(err).Msg("VerifyPinnedProgMap removal : Error checking for map file")
+					b.logger("", "").Warn().Err(err).Str("path", b.MapNamePath).Msg("VerifyPinnedProgMap removal : Error checking for map file")
 				} else {
-					log.Warn().Msg("VerifyPinnedProgMap removal : program pinned file still exists, checking again after a second")
+					b.logger("", "").Warn().Str("path", b.MapNamePath).Msg("VerifyPinnedProgMap removal : program pinned file still exists, checking again after a second")
 				}
 			}
 			time.Sleep(1 * time.Second)
@@ -974,10 +1080,10 @@ func (b *BPF) VerifyPinnedProgMap(chain, exists bool) error {
 
 		if err != nil && exists {
 			err = fmt.Errorf("VerifyPinnedProgMap creation : failed to find pinned file %s err %v", b.MapNamePath, err)
-			log.Error().Err(err).Msg("")
+			b.logger("", "").Error().Err(err).Msg("")
 		} else if err != nil {
 			err = fmt.Errorf("VerifyPinnedProgMap removal : %s map file was never removed by BPF program %s err %v", b.MapNamePath, b.Program.Name, err)
-			log.Error().Err(err).Msg("")
+			b.logger("", "").Error().Err(err).Msg("")
 		}
 		return err
 	}
@@ -990,7 +1096,7 @@ func (b *BPF) VerifyProcessObject() error {
 
 	if b.Cmd == nil {
 		err := fmt.Errorf("command object is nil - %s", b.Program.Name)
-		log.Error().Err(err).Msg("command object is nil -")
+		b.logger("", "").Error().Err(err).Msg("command object is nil")
 		return err
 	}
 
@@ -998,11 +1104,11 @@ func (b *BPF) VerifyProcessObject() error {
 		if b.Cmd.Process != nil {
 			return nil
 		}
-		log.Warn().Msgf("VerifyProcessObject: process object not found, checking again after a second")
+		b.logger("", "").Warn().Msg("VerifyProcessObject: process object not found, checking again after a second")
 		time.Sleep(1 * time.Second)
 	}
 	err := fmt.Errorf("process object is nil - %s", b.Program.Name)
-	log.Error().Err(err).Msg("")
+	b.logger("", "").Error().Err(err).Msg("")
 	return err
 }
 
@@ -1012,9 +1118,8 @@ func (b *BPF) VerifyMetricsMapsVanish() error {
 	for i := 0; i < 10; i++ {
 		mapExists := false
 		for _, v := range b.BpfMaps {
-			_, err := ebpf.NewMapFromID(v.MapID)
-			if err == nil {
-				log.Warn().Msgf("VerifyMetricsMapsVanish: bpf map reference still exists - %s", v.Name)
+			if err := b.kernel().MapExists(v.MapID); err == nil {
+				v.logger().Warn().Msg("VerifyMetricsMapsVanish: bpf map reference still exists")
 				mapExists = true
 			}
 		}
@@ -1022,12 +1127,12 @@ func (b *BPF) VerifyMetricsMapsVanish() error {
 			return nil
 		}
 
-		log.Warn().Msgf("VerifyMetricsMapsVanish: bpf map reference still exists - %s, checking again after a second", b.Program.Name)
+		b.logger("", "").Warn().Msg("VerifyMetricsMapsVanish: bpf map reference still exists, checking again after a second")
 		time.Sleep(1 * time.Second)
 	}
 
 	err := fmt.Errorf("metrics maps are never removed by Kernel %s", b.Program.Name)
-	log.Error().Err(err).Msg("")
+	b.logger("", "").Error().Err(err).Msg("")
 	return err
 }
 
@@ -1035,7 +1140,7 @@ func (b *BPF) VerifyMetricsMapsVanish() error {
 func (b *BPF) LoadXDPAttachProgram(ifaceName string) error {
 	iface, err := net.InterfaceByName(ifaceName)
 	if err != nil {
-		log.Error().Err(err).Msgf("LoadXDPAttachProgram -look up network iface %q", ifaceName)
+		b.logger(ifaceName, "").Error().Err(err).Msg("LoadXDPAttachProgram - look up network iface failed")
 		return err
 	}
 
@@ -1043,10 +1148,7 @@ func (b *BPF) LoadXDPAttachProgram(ifaceName string) error {
 		return err
 	}
 
-	b.XDPLink, err = link.AttachXDP(link.XDPOptions{
-		Program:   b.ProgMapCollection.Programs[b.Program.EntryFunctionName],
-		Interface: iface.Index,
-	})
+	b.XDPLink, err = b.kernel().AttachXDP(b.ProgMapCollection.Programs[b.Program.EntryFunctionName], iface.Index)
 	if err != nil {
 		return fmt.Errorf("could not attach xdp program %s to interface %s : %v", b.Program.Name, ifaceName, err)
 	}
@@ -1064,7 +1166,7 @@ func (b *BPF) LoadXDPAttachProgram(ifaceName string) error {
 func (b *BPF) UnloadProgram(ifaceName, direction string) error {
 	_, err := net.InterfaceByName(ifaceName)
 	if err != nil {
-		log.Error().Err(err).Msgf("UnloadProgram - look up network iface %q", ifaceName)
+		b.logger(ifaceName, direction).Error().Err(err).Msg("UnloadProgram - look up network iface failed")
 		return err
 	}
 
@@ -1073,11 +1175,11 @@ func (b *BPF) UnloadProgram(ifaceName, direction string) error {
 	if b.Program.SeqID == 0 || !b.hostConfig.BpfChainingEnabled {
 		if b.Program.ProgType == models.TCType {
 			if err := b.UnloadTCProgram(ifaceName, direction); err != nil {
-				log.Warn().Msgf("removing tc filter failed iface %q direction %s error - %v", ifaceName, direction, err)
+				b.logger(ifaceName, direction).Warn().Err(err).Msg("removing tc filter failed")
 			}
 		} else if b.Program.ProgType == models.XDPType {
 			if err := b.XDPLink.Close(); err != nil {
-				log.Warn().Msgf("removing xdp attached program failed iface %q direction %s error - %v", ifaceName, direction, err)
+				b.logger(ifaceName, direction).Warn().Err(err).Msg("removing xdp attached program failed")
 			}
 		}
 	}
@@ -1089,7 +1191,7 @@ func (b *BPF) UnloadProgram(ifaceName, direction string) error {
 
 	// remove pinned map file
 	if err := b.RemoveMapFiles(ifaceName); err != nil {
-		log.Error().Msgf("failed to remove map file for program %s => %s", ifaceName, b.Program.Name)
+		b.logger(ifaceName, direction).Error().Err(err).Msg("failed to remove map file")
 	}
 
 	return nil
@@ -1104,7 +1206,7 @@ func (b *BPF) RemoveMapFiles(ifaceName string) error {
 		} else {
 			mapFilename = filepath.Join(b.hostConfig.BpfMapDefaultPath, ifaceName, k)
 		}
-		if err := v.Unpin(); err != nil {
+		if err := b.kernel().UnpinMap(v); err != nil {
 			return fmt.Errorf("BPF program %s prog type %s ifacename %s map %s:failed to pin the map err - %#v",
 				b.Program.Name, b.Program.ProgType, ifaceName, mapFilename, err)
 		}
@@ -1113,7 +1215,7 @@ func (b *BPF) RemoveMapFiles(ifaceName string) error {
 				b.Program.Name, b.Program.ProgType, ifaceName, mapFilename)
 		}
 		if err := os.RemoveAll(mapFilename); os.IsNotExist(err) {
-			log.Info().Msgf("RemoveMapFiles: BPF program %s map file removed successfully - %s err - %#v", b.Program.Name, mapFilename, err)
+			b.logger(ifaceName, "").Info().Str("path", mapFilename).Msg("RemoveMapFiles: map file removed successfully")
 		}
 	}
 
@@ -1130,7 +1232,7 @@ func (b *BPF) RemoveRootProgMapFile(ifacename string) error {
 	case models.XDPType:
 		mapFilename = filepath.Join(b.hostConfig.BpfMapDefaultPath, ifacename, b.Program.MapName)
 	default:
-		log.Warn().Msgf("RemoveRootProgMapFile: program %s map file %s - unknown type", b.Program.Name, b.MapNamePath)
+		b.logger(ifacename, "").Warn().Str("path", b.MapNamePath).Str("prog_type", b.Program.ProgType).Msg("RemoveRootProgMapFile: unknown program type")
 		return fmt.Errorf("removeMapFile: program %s unknown type %s", b.Program.Name, b.Program.ProgType)
 	}
 
@@ -1141,7 +1243,7 @@ func (b *BPF) RemoveRootProgMapFile(ifacename string) error {
 
 	if err := os.Remove(mapFilename); err != nil {
 		if !os.IsNotExist(err) {
-			log.Warn().Msgf("RemoveRootProgMapFile: %s program type %s map file remove unsuccessfully - %s err - %#v", b.Program.ProgType, b.Program.Name, mapFilename, err)
+			b.logger(ifacename, "").Warn().Err(err).Str("path", mapFilename).Str("prog_type", b.Program.ProgType).Msg("RemoveRootProgMapFile: map file remove unsuccessful")
 			return fmt.Errorf("%s - remove failed with error %#v", mapFilename, err)
 		}
 	}
@@ -1152,13 +1254,13 @@ func (b *BPF) RemoveRootProgMapFile(ifacename string) error {
 func (b *BPF) VerifyCleanupMaps(chain bool) error {
 	// verify pinned map file is removed.
 	if err := b.VerifyPinnedProgMap(chain, false); err != nil {
-		log.Error().Err(err).Msgf("stop user program - failed to remove pinned file %s", b.Program.Name)
+		b.logger("", "").Error().Err(err).Msg("stop user program - failed to remove pinned file")
 		return fmt.Errorf("stop user program - failed to remove pinned file %s", b.Program.Name)
 	}
 
 	// Verify all metrics map references are removed from kernel
 	if err := b.VerifyMetricsMapsVanish(); err != nil {
-		log.Error().Err(err).Msgf("stop user program - failed to remove metric map references %s", b.Program.Name)
+		b.logger("", "").Error().Err(err).Msg("stop user program - failed to remove metric map references")
 		return fmt.Errorf("stop user program - failed to remove metric map references %s", b.Program.Name)
 	}
 
@@ -1183,15 +1285,36 @@ func (b *BPF) LoadBPFProgram(ifaceName string) error {
 		return fmt.Errorf("%s: file doesn't exist", ObjectFile)
 	}
 
+	if b.hostConfig != nil && (b.hostConfig.EBPFVerifyObjectFile || b.hostConfig.KernelFeatureCheck) {
+		spec, err := ebpf.LoadCollectionSpec(ObjectFile)
+		if err != nil {
+			return fmt.Errorf("%s: parsing of object file failed - %v", ObjectFile, err)
+		}
+		if b.hostConfig.EBPFVerifyObjectFile {
+			if err := checkObjectSpec(&b.Program, spec); err != nil {
+				return fmt.Errorf("invalid object file of the program %s: %v", b.Program.Name, err)
+			}
+		}
+		if b.hostConfig.KernelFeatureCheck {
+			if err := checkObjectFeatures(b.kernel(), &b.Program, spec); err != nil {
+				return fmt.Errorf("object file of the program %s is not supported by the kernel: %v", b.Program.Name, err)
+			}
+		}
+	}
+
 	// Allow the current process to lock memory for eBPF resources.
 	if err := rlimit.RemoveMemlock(); err != nil {
-		log.Error().Msgf("failed to remove memory lock limits  %#v", err)
+		b.logger(ifaceName, "").Error().Err(err).Msg("failed to remove memory lock limits")
 		return fmt.Errorf("%s: remove rlimit lock failed", b.Program.Name)
 	}
 
-	prg, err := ebpf.LoadCollection(ObjectFile)
+	kernelTypes, source, err := b.kernelTypes()
+	if err != nil {
+		return fmt.Errorf("%s: kernel types of the bpf program are not available - %v", ObjectFile, err)
+	}
+	prg, err := b.kernel().LoadCollection(ObjectFile, kernelTypes)
 	if err != nil {
-		return fmt.Errorf("%s: loading of bpf program failed - %#v", ObjectFile, err)
+		return loadError(ObjectFile, kernelTypes, source, err)
 	}
 
 	// Persist program handle
@@ -1210,7 +1333,7 @@ func (b *BPF) LoadBPFProgram(ifaceName string) error {
 	ok := false
 	b.ProgID, ok = progInfo.ID()
 	if !ok {
-		log.Warn().Msgf("Program ID fetch failed: %s", b.Program.Name)
+		b.logger(ifaceName, "").Warn().Msg("Program ID fetch failed")
 	}
 
 	// Initialise metric maps
@@ -1228,18 +1351,18 @@ func (b *BPF) LoadBPFProgram(ifaceName string) error {
 // InitialiseMetricMaps - This method initialises all the monitor maps
 func (b *BPF) InitialiseMetricMaps() error {
 	if b.ProgMapCollection == nil {
-		log.Warn().Msgf("prog is not loaded by l3afd")
+		b.logger("", "").Warn().Msg("prog is not loaded by l3afd")
 		return nil
 	}
 	for _, tmpMap := range b.Program.MonitorMaps {
 		tmpMetricsMap := b.ProgMapCollection.Maps[tmpMap.Name]
 		if tmpMetricsMap == nil {
-			log.Error().Msgf("%s map is not loaded", tmpMap.Name)
+			b.logger("", "").Error().Str("map", tmpMap.Name).Msg("map is not loaded")
 			continue
 		}
 
 		var err error
-		log.Debug().Msgf("Program - %s map name %s key size %d value size %d\n", b.Program.Name, tmpMap.Name, tmpMetricsMap.KeySize(), tmpMetricsMap.ValueSize())
+		b.logger("", "").Debug().Str("map", tmpMap.Name).Uint32("key_size", tmpMetricsMap.KeySize()).Uint32("value_size", tmpMetricsMap.ValueSize()).Msg("initialising metric map")
 		if tmpMetricsMap.KeySize() == 1 {
 			var k int8
 			switch tmpMetricsMap.ValueSize() {
@@ -1256,7 +1379,7 @@ func (b *BPF) InitialiseMetricMaps() error {
 				var v int64
 				err = tmpMetricsMap.Update(unsafe.Pointer(&k), unsafe.Pointer(&v), 0)
 			default:
-				log.Error().Msgf("unsupported key type int8 and value size - %d", tmpMetricsMap.ValueSize())
+				b.logger("", "").Error().Str("map", tmpMap.Name).Uint32("value_size", tmpMetricsMap.ValueSize()).Msg("unsupported value size for key type int8")
 			}
 		} else if tmpMetricsMap.KeySize() == 2 {
 			var k int16
@@ -1274,7 +1397,7 @@ func (b *BPF) InitialiseMetricMaps() error {
 				var v int64
 				err = tmpMetricsMap.Update(unsafe.Pointer(&k), unsafe.Pointer(&v), 0)
 			default:
-				log.Error().Msgf("unsupported map key type int16 and value size - %d", tmpMetricsMap.ValueSize())
+				b.logger("", "").Error().Str("map", tmpMap.Name).Uint32("value_size", tmpMetricsMap.ValueSize()).Msg("unsupported value size for key type int16")
 			}
 		} else if tmpMetricsMap.KeySize() == 4 {
 			var k int32
@@ -1292,7 +1415,7 @@ func (b *BPF) InitialiseMetricMaps() error {
 				var v int64
 				err = tmpMetricsMap.Update(unsafe.Pointer(&k), unsafe.Pointer(&v), 0)
 			default:
-				log.Error().Msgf("unsupported map key type int32 and value size - %d", tmpMetricsMap.ValueSize())
+				b.logger("", "").Error().Str("map", tmpMap.Name).Uint32("value_size", tmpMetricsMap.ValueSize()).Msg("unsupported value size for key type int32")
 			}
 		} else if tmpMetricsMap.KeySize() == 8 {
 			var k int64
@@ -1310,7 +1433,7 @@ func (b *BPF) InitialiseMetricMaps() error {
 				var v int64
 				err = tmpMetricsMap.Update(unsafe.Pointer(&k), unsafe.Pointer(&v), 0)
 			default:
-				log.Error().Msgf("unsupported key type int64 and value size - %d", tmpMetricsMap.ValueSize())
+				b.logger("", "").Error().Str("map", tmpMap.Name).Uint32("value_size", tmpMetricsMap.ValueSize()).Msg("unsupported value size for key type int64")
 			}
 		}
 		if err != nil {
@@ -1323,16 +1446,17 @@ func (b *BPF) InitialiseMetricMaps() error {
 // IsLoaded - Method verifies whether bpf program is loaded or not
 // Here it checks whether prog ID is valid and active
 func (b *BPF) IsLoaded() bool {
-	ebpfProg, err := ebpf.NewProgramFromID(b.ProgID)
-	if err != nil && errors.Is(err, os.ErrNotExist) {
-		log.Debug().Msgf("IsLoaded - %s is not loaded or invalid program id %d", b.Program.Name, uint32(b.ProgID))
+	if err := b.kernel().ProgramExists(b.ProgID); err != nil && errors.Is(err, os.ErrNotExist) {
+		b.logger("", "").Debug().Msg("IsLoaded - program is not loaded or invalid program id")
 		return false
 	}
-	defer ebpfProg.Close()
 	return true
 }
 
-func (b *BPF) StartUserProgram(ifaceName, direction string, chain bool) error {
+func (b *BPF) StartUserProgram(ctx context.Context, ifaceName, direction string, chain bool) (err error) {
+	_, span := b.startSpan(ctx, "BPF.StartUserProgram", ifaceName, direction)
+	defer func() { tracing.End(span, err) }()
+
 	cmd := filepath.Join(b.FilePath, b.Program.CmdStart)
 	// Validate
 	if err := assertExecutable(cmd); err != nil {
@@ -1346,7 +1470,12 @@ func (b *BPF) StartUserProgram(ifaceName, direction string, chain bool) error {
 	if chain && b.ProgMapCollection == nil {
 		// chaining from user program
 		if len(b.PrevMapNamePath) > 1 {
-			args = append(args, "--map-name="+b.PrevMapNamePath)
+			if b.Unlinked {
+				if err := b.kernel().PinProgArray(b.unlinkedMapPath()); err != nil {
+					return fmt.Errorf("failed to create prog map of unlinked program %s - error %v", b.Program.Name, err)
+				}
+			}
+			args = append(args, "--map-name="+b.linkMapPath())
 		}
 	}
 
@@ -1364,30 +1493,47 @@ func (b *BPF) StartUserProgram(ifaceName, direction string, chain bool) error {
 	for k, val := range b.Program.StartArgs {
 		if v, ok := val.(string); !ok {
 			err := fmt.Errorf("start args is not a string for the bpf program %s", b.Program.Name)
-			log.Error().Err(err).Msgf("failed to convert start args value into string for program %s", b.Program.Name)
+			b.logger(ifaceName, direction).Error().Err(err).Msg("failed to convert start args value into string")
 			return err
 		} else {
 			args = append(args, "--"+k+"="+v)
 		}
 	}
 
-	log.Info().Msgf("BPF Program start command : %s %v", cmd, args)
-	b.Cmd = execCommand(cmd, args...)
-	if err := b.Cmd.Start(); err != nil {
-		log.Info().Err(err).Msgf("user program failed - %s", b.Program.Name)
+	b.logger(ifaceName, direction).Info().Str("cmd", cmd).Strs("args", args).Msg("BPF Program start command")
+	if b.Program.Security != nil {
+		sandboxed, err := b.sandboxCommand(cmd, args)
+		if err != nil {
+			return fmt.Errorf("failed to sandbox %s: %v", b.Program.Name, err)
+		}
+		b.Cmd = sandboxed
+	} else {
+		b.Cmd = execCommand(cmd, args...)
+	}
+	b.captureOutput(ifaceName, direction)
+	cgroupDone := func(bool) {}
+	if b.Program.UserProgramDaemon {
+		cgroupDone = b.startInCgroup(ifaceName, direction)
+	}
+	err = b.Cmd.Start()
+	cgroupDone(err == nil)
+	if err != nil {
+		b.logger(ifaceName, direction).Info().Err(err).Msg("user program failed")
 		return fmt.Errorf("failed to start : %s %v", cmd, args)
 	}
 	if !b.Program.UserProgramDaemon {
-		log.Info().Msgf("no user program - %s No Pid", b.Program.Name)
+		b.logger(ifaceName, direction).Info().Msg("no user program daemon, waiting for the command to exit")
 		if err := b.Cmd.Wait(); err != nil {
-			log.Warn().Msgf("failed at wait - %s err %s", b.Program.Name, err.Error())
+			b.logger(ifaceName, direction).Warn().Err(err).Msg("failed at wait")
 		}
 		b.Cmd = nil
+		b.closeOutput()
 	} else {
-		if err := b.SetPrLimits(); err != nil {
-			log.Warn().Err(err).Msg("failed to set resource limits")
+		if err := b.SetResourceLimits(ifaceName, direction); err != nil {
+			b.logger(ifaceName, direction).Warn().Err(err).Msg("failed to set resource limits")
 		}
-		log.Info().Msgf("BPF program - %s User program Process id %d started", b.Program.Name, b.Cmd.Process.Pid)
+		span.SetAttributes(semconv.ProcessPID(b.Cmd.Process.Pid))
+		b.logger(ifaceName, direction).Info().Int("pid", b.Cmd.Process.Pid).Msg("BPF program user program started")
 	}
 
 	return nil
@@ -1443,7 +1589,7 @@ func (b *BPF) PinBpfMaps(ifaceName string) error {
 		}
 		// In case one of the program pins the map then other program will skip
 		if !fileExists(mapFilename) {
-			if err := v.Pin(mapFilename); err != nil {
+			if err := b.kernel().PinMap(v, mapFilename); err != nil {
 				return fmt.Errorf("eBPF program %s map %s:failed to pin the map err - %#v", b.Program.Name, mapFilename, err)
 			}
 		}
@@ -1486,24 +1632,17 @@ func (b *BPF) LoadBPFProgramChain(ifaceName, direction string) error {
 		return err
 	}
 
-	// Link this program into previous program map
-	ebpfMap, err := ebpf.NewMapFromID(b.PrevProgMapID)
-	if err != nil {
-		return fmt.Errorf("unable to access pinned previous prog map %s %v", b.PrevMapNamePath, err)
-	}
-	defer ebpfMap.Close()
-
-	bpfProg := b.ProgMapCollection.Programs[b.Program.EntryFunctionName]
-	if bpfProg == nil {
-		return fmt.Errorf("%s entry function is not found in the loaded object file of the program %s", b.Program.EntryFunctionName, b.Program.Name)
+	// Unlinked programs are linked back by the process monitor once they run stable
+	if b.Unlinked {
+		b.logger(ifaceName, direction).Info().Msg("eBPF program loaded successfully, it stays unlinked from the chain")
+		return nil
 	}
 
-	key := 0
-	fd := bpfProg.FD()
-	log.Info().Msgf("previous program map path %s FD %d", b.PrevMapNamePath, fd)
-	if err = ebpfMap.Update(unsafe.Pointer(&key), unsafe.Pointer(&fd), 0); err != nil {
-		return fmt.Errorf("unable to update prog next map %s %v", b.Program.MapName, err)
+	// Link this program into previous program map
+	b.logger(ifaceName, direction).Info().Str("path", b.PrevMapNamePath).Msg("linking program into previous program map")
+	if err := b.kernel().ProgArrayUpdate(b.PrevProgMapID, b.ProgID); err != nil {
+		return fmt.Errorf("unable to update previous prog map %s %v", b.PrevMapNamePath, err)
 	}
-	log.Info().Msgf("eBPF program %s loaded on interface %s direction %s successfully", b.Program.Name, ifaceName, direction)
+	b.logger(ifaceName, direction).Info().Msg("eBPF program loaded successfully")
 	return nil
 }
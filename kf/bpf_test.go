@@ -205,7 +205,7 @@ func TestBPF_Stop(t *testing.T) {
 				FilePath:     tt.fields.FilePath,
 				RestartCount: tt.fields.RestartCount,
 			}
-			if err := b.Stop(ifaceName, models.IngressType, false); (err != nil) != tt.wantErr {
+			if err := b.Stop(context.Background(), ifaceName, models.IngressType, false); (err != nil) != tt.wantErr {
 				t.Errorf("BPF.Stop() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -307,7 +307,7 @@ func TestBPF_Start(t *testing.T) {
 				RestartCount: tt.fields.RestartCount,
 				hostConfig:   tt.fields.hostConfig,
 			}
-			if err := b.Start(tt.fields.ifaceName, models.IngressType, true); (err != nil) != tt.wantErr {
+			if err := b.Start(context.Background(), tt.fields.ifaceName, models.IngressType, true); (err != nil) != tt.wantErr {
 				t.Errorf("BPF.Start() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -533,7 +533,7 @@ func TestBPF_GetArtifacts(t *testing.T) {
 			} else {
 				m.EXPECT().GetPlatform().Return("focal", nil).AnyTimes()
 			}
-			err := b.GetArtifacts(tt.args.conf)
+			err := b.GetArtifacts(context.Background(), tt.args.conf)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("BPF.download() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -12,7 +12,6 @@ import (
 	"unsafe"
 
 	"github.com/cilium/ebpf"
-	"github.com/rs/zerolog/log"
 )
 
 type BPFMap struct {
@@ -33,6 +32,14 @@ type MetricsBPFMap struct {
 	lastValue  float64
 }
 
+// kernel - returns the kernel backend of the owning program
+func (b *BPFMap) kernel() kernelBackend {
+	if b.BPFProg == nil {
+		return defaultKernel
+	}
+	return b.BPFProg.kernel()
+}
+
 // The update function is used to update eBPF maps, which are used by network functions.
 // Supported types are Array and Hash
 // Multiple values are comma separated
@@ -53,12 +60,11 @@ type MetricsBPFMap struct {
 //		key => 0 value => 10000
 func (b *BPFMap) Update(value string) error {
 
-	log.Debug().Msgf("update map name %s ID %d", b.Name, b.MapID)
-	ebpfMap, err := ebpf.NewMapFromID(b.MapID)
-	if err != nil {
+	b.logger().Debug().Msg("update map")
+	kernel := b.kernel()
+	if err := kernel.MapExists(b.MapID); err != nil {
 		return fmt.Errorf("access new map from ID failed %v", err)
 	}
-	defer ebpfMap.Close()
 
 	// check values are single or multiple
 	s := strings.Split(value, ",")
@@ -67,27 +73,29 @@ func (b *BPFMap) Update(value string) error {
 		// clear map elements
 		key := 0
 		val := 0
-		entries := ebpfMap.Iterate()
-		for entries.Next(unsafe.Pointer(&key), unsafe.Pointer(&val)) {
+		if err := kernel.MapIterate(b.MapID, unsafe.Pointer(&key), unsafe.Pointer(&val), func() error {
 			// Order of keys is non-deterministic due to randomized map seed
-			if err := ebpfMap.Delete(unsafe.Pointer(&key)); err != nil {
-				log.Warn().Err(err).Msgf("delete hash map for key %d failed", key)
+			if err := kernel.MapDelete(b.MapID, unsafe.Pointer(&key)); err != nil {
+				b.logger().Warn().Err(err).Int("key", key).Msg("delete hash map key failed")
 			}
+			return nil
+		}); err != nil {
+			b.logger().Warn().Err(err).Msg("iterating hash map failed")
 		}
 
 		for key, val := range s {
 			v, _ := strconv.ParseInt(val, 10, 64)
 			x := 1
-			log.Info().Msgf("updating map %s key %d mapid %d", b.Name, v, b.MapID)
-			if err := ebpfMap.Update(unsafe.Pointer(&v), unsafe.Pointer(&x), 0); err != nil {
+			b.logger().Info().Int64("key", v).Msg("updating map")
+			if err := kernel.MapUpdate(b.MapID, unsafe.Pointer(&v), unsafe.Pointer(&x)); err != nil {
 				return fmt.Errorf("update hash map element failed for key %d error %v", key, err)
 			}
 		}
 	} else if b.Type == ebpf.Array {
 		for key, val := range s {
 			v, _ := strconv.ParseInt(val, 10, 64)
-			log.Info().Msgf("updating map %s key %d mapid %d", b.Name, v, b.MapID)
-			if err := ebpfMap.Update(unsafe.Pointer(&key), unsafe.Pointer(&v), 0); err != nil {
+			b.logger().Info().Int64("value", v).Msg("updating map")
+			if err := kernel.MapUpdate(b.MapID, unsafe.Pointer(&key), unsafe.Pointer(&v)); err != nil {
 				return fmt.Errorf("update array map index %d %v", key, err)
 			}
 		}
@@ -103,29 +111,27 @@ func (b *BPFMap) Update(value string) error {
 // avg - stores the values in the circular queue
 // We can implement more aggregate function as needed.
 func (b *MetricsBPFMap) GetValue() float64 {
-	ebpfMap, err := ebpf.NewMapFromID(b.MapID)
-	if err != nil {
+	kernel := b.kernel()
+	if err := kernel.MapExists(b.MapID); err != nil {
 		// We have observed in smaller configuration VM's, if we restart KF's
 		// Stale mapID's are reported, in such cases re-checking map id
-		log.Warn().Err(err).Msgf("GetValue : NewMapFromID failed ID %d, re-looking up of map id", b.MapID)
+		b.logger().Warn().Err(err).Msg("GetValue: map id is stale, re-looking up map id")
 		tmpBPF, err := b.BPFProg.GetBPFMap(b.Name)
 		if err != nil {
-			log.Warn().Err(err).Msgf("GetValue: Update new map ID %d", tmpBPF.MapID)
+			b.logger().Warn().Err(err).Msg("GetValue: failed to look up map id")
 			return 0
 		}
-		log.Info().Msgf("GetValue: Update new map ID %d", tmpBPF.MapID)
+		b.logger().Info().Uint32("new_map_id", uint32(tmpBPF.MapID)).Msg("GetValue: update map id")
 		b.MapID = tmpBPF.MapID
-		ebpfMap, err = ebpf.NewMapFromID(b.MapID)
-		if err != nil {
-			log.Warn().Err(err).Msgf("GetValue : retry of NewMapFromID failed ID %d", b.MapID)
+		if err = kernel.MapExists(b.MapID); err != nil {
+			b.logger().Warn().Err(err).Msg("GetValue: map id is stale after re-lookup")
 			return 0
 		}
 	}
-	defer ebpfMap.Close()
 
 	var value int64
-	if err = ebpfMap.Lookup(unsafe.Pointer(&b.key), unsafe.Pointer(&value)); err != nil {
-		log.Warn().Err(err).Msgf("GetValue Lookup failed : Name %s ID %d", b.Name, b.MapID)
+	if err := kernel.MapLookup(b.MapID, unsafe.Pointer(&b.key), unsafe.Pointer(&value)); err != nil {
+		b.logger().Warn().Err(err).Int("key", b.key).Msg("GetValue: lookup failed")
 		return 0
 	}
 
@@ -143,7 +149,7 @@ func (b *MetricsBPFMap) GetValue() float64 {
 		b.Values = b.Values.Next()
 		retVal = b.AvgValue()
 	default:
-		log.Warn().Msgf("unsupported aggregator %s and value %d", b.aggregator, value)
+		b.logger().Warn().Str("aggregator", b.aggregator).Int64("value", value).Msg("unsupported aggregator")
 	}
 
 	return retVal
@@ -0,0 +1,231 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/schema"
+	"github.com/l3af-project/l3afd/stats"
+)
+
+const (
+	// xdpLinkType - kernel type of the bpf links attaching xdp programs
+	xdpLinkType = "bpf_xdp_link"
+	// tcxLinkType - kernel type of the bpf links attaching tc programs with tcx
+	tcxLinkType = "tcx_link"
+
+	xdpLink = "xdp"
+	tcxLink = "tcx"
+)
+
+// linkTypes - links reported in the capabilities and the kernel types implementing them
+var linkTypes = []struct{ name, kernelType string }{{xdpLink, xdpLinkType}, {tcxLink, tcxLinkType}}
+
+// helperProgramTypes - program types the helpers are reported for, the ones l3afd attaches
+var helperProgramTypes = []ebpf.ProgramType{ebpf.XDP, ebpf.SchedCLS}
+
+// notSupported - tells whether the probe found the feature missing, any other probe error leaves the support unknown
+// and nothing is rejected because of it
+func notSupported(err error) bool {
+	return errors.Is(err, ebpf.ErrNotSupported)
+}
+
+// capability - returns the support of the feature name given the result of its probe
+func capability(name string, err error) models.L3afCapability {
+	switch {
+	case err == nil:
+		return models.L3afCapability{Name: name, Supported: true}
+	case notSupported(err):
+		return models.L3afCapability{Name: name, Reason: err.Error()}
+	default:
+		return models.L3afCapability{Name: name, Reason: fmt.Sprintf("probe failed: %v", err)}
+	}
+}
+
+// Capabilities - probes the kernel for the BTF, links, program types, map types and helpers l3afd and its programs
+// depend on, and publishes them in the KernelFeature metrics. The probe results are cached by cilium/ebpf.
+func (c *NFConfigs) Capabilities() models.L3afHostCapabilities {
+	return probeCapabilities(c.kernel())
+}
+
+func probeCapabilities(k kernelBackend) models.L3afHostCapabilities {
+	caps := models.L3afHostCapabilities{
+		Links:        make([]models.L3afCapability, 0, len(linkTypes)),
+		ProgramTypes: make([]models.L3afCapability, 0),
+		MapTypes:     make([]models.L3afCapability, 0),
+		Helpers:      make([]models.L3afHelperSupport, 0, len(helperProgramTypes)),
+	}
+	if version, err := k.KernelVersion(); err != nil {
+		log.Warn().Err(err).Msg("failed to read the kernel version")
+	} else {
+		caps.KernelVersion = version
+	}
+
+	// links are looked up in the kernel BTF, their support is unknown without it
+	caps.BTF = models.L3afCapability{Name: "btf", Supported: true}
+	if err := k.HaveKernelType("int"); err != nil {
+		caps.BTF = models.L3afCapability{Name: "btf", Reason: err.Error()}
+	}
+	for _, lt := range linkTypes {
+		caps.Links = append(caps.Links, capability(lt.name, k.HaveKernelType(lt.kernelType)))
+	}
+
+	for pt := ebpf.SocketFilter; pt <= ebpf.Syscall; pt++ {
+		caps.ProgramTypes = append(caps.ProgramTypes, capability(pt.String(), k.HaveProgramType(pt)))
+	}
+	for mt := ebpf.Hash; mt <= ebpf.TaskStorage; mt++ {
+		caps.MapTypes = append(caps.MapTypes, capability(mt.String(), k.HaveMapType(mt)))
+	}
+
+	for _, pt := range helperProgramTypes {
+		support := models.L3afHelperSupport{ProgramType: pt.String(), Helpers: make([]string, 0)}
+		if err := k.HaveProgramType(pt); err != nil {
+			support.Reason = capability(pt.String(), err).Reason
+			caps.Helpers = append(caps.Helpers, support)
+			continue
+		}
+		for helper := asm.BuiltinFunc(1); helper <= helper.Max(); helper++ {
+			if err := k.HaveProgramHelper(pt, helper); err == nil {
+				support.Helpers = append(support.Helpers, helper.String())
+			}
+		}
+		sort.Strings(support.Helpers)
+		caps.Helpers = append(caps.Helpers, support)
+	}
+
+	publishCapabilities(caps)
+	return caps
+}
+
+// publishCapabilities - reports the support of the features in the KernelFeature gauge, 1 when supported
+func publishCapabilities(caps models.L3afHostCapabilities) {
+	if stats.KernelFeature == nil {
+		// metrics are not set up
+		return
+	}
+	set := func(kind string, capability models.L3afCapability) {
+		value := 0.0
+		if capability.Supported {
+			value = 1
+		}
+		stats.SetFeatureValue(value, stats.KernelFeature, kind, capability.Name)
+	}
+	set("btf", caps.BTF)
+	for _, kinds := range []struct {
+		kind string
+		caps []models.L3afCapability
+	}{{"link", caps.Links}, {"program_type", caps.ProgramTypes}, {"map_type", caps.MapTypes}} {
+		for _, capability := range kinds.caps {
+			set(kinds.kind, capability)
+		}
+	}
+}
+
+// CheckKernelFeatures - checks the kernel supports the program types and maps l3afd attaches programs with, the
+// error tells the missing feature
+func CheckKernelFeatures(conf *config.Config) error {
+	return checkKernelFeatures(defaultKernel, conf)
+}
+
+func checkKernelFeatures(k kernelBackend, conf *config.Config) error {
+	for _, pt := range helperProgramTypes {
+		if err := k.HaveProgramType(pt); notSupported(err) {
+			return fmt.Errorf("program type %s is not supported by the kernel: %v", pt, err)
+		}
+	}
+	if conf.BpfChainingEnabled {
+		if err := k.HaveMapType(ebpf.ProgramArray); notSupported(err) {
+			return fmt.Errorf("map type %s required by bpf chaining is not supported by the kernel: %v", ebpf.ProgramArray, err)
+		}
+	}
+	return nil
+}
+
+// featureErrors - returns the features of the kernel missing for the programs of a direction, programs are
+// attached to xdp through bpf links, the root program with chaining and the programs with an object file without
+func (c *NFConfigs) featureErrors(progs []*models.BPFProgram, direction, path string, chaining bool) schema.Errors {
+	var errs schema.Errors
+	k := c.kernel()
+	pt := ebpf.SchedCLS
+	if direction == models.XDPIngressType {
+		pt = ebpf.XDP
+	}
+	for j, prog := range progs {
+		if prog == nil {
+			continue
+		}
+		progPath := path + "[" + strconv.Itoa(j) + "]"
+		if err := k.HaveProgramType(pt); notSupported(err) {
+			errs = append(errs, schema.FieldError{Path: progPath + ".prog_type", Message: fmt.Sprintf("program type %s is not supported by the kernel", pt)})
+		}
+		if len(prog.MapName) > 0 {
+			if err := k.HaveMapType(ebpf.ProgramArray); notSupported(err) {
+				errs = append(errs, schema.FieldError{Path: progPath + ".map_name", Message: fmt.Sprintf("map type %s is not supported by the kernel", ebpf.ProgramArray)})
+			}
+		}
+		if pt == ebpf.XDP && (chaining || len(prog.ObjectFile) > 0) {
+			if err := k.HaveKernelType(xdpLinkType); notSupported(err) {
+				errs = append(errs, schema.FieldError{Path: progPath, Message: "xdp links are not supported by the kernel"})
+			}
+		}
+	}
+	return errs
+}
+
+// checkObjectFeatures - checks the kernel supports the program types, map types and helpers used by the object file
+func checkObjectFeatures(k kernelBackend, prog *models.BPFProgram, spec *ebpf.CollectionSpec) error {
+	var errs schema.Errors
+	names := make([]string, 0, len(spec.Programs))
+	for name := range spec.Programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := spec.Programs[name]
+		if err := k.HaveProgramType(p.Type); notSupported(err) {
+			errs = append(errs, schema.FieldError{Path: "object_file", Message: fmt.Sprintf("program type %s of %s in %s is not supported by the kernel", p.Type, name, prog.ObjectFile)})
+			continue
+		}
+		helpers := make(map[asm.BuiltinFunc]bool)
+		for _, ins := range p.Instructions {
+			if ins.IsBuiltinCall() {
+				helpers[asm.BuiltinFunc(ins.Constant)] = true
+			}
+		}
+		missing := make([]string, 0)
+		for helper := range helpers {
+			if err := k.HaveProgramHelper(p.Type, helper); notSupported(err) {
+				missing = append(missing, helper.String())
+			}
+		}
+		sort.Strings(missing)
+		for _, helper := range missing {
+			errs = append(errs, schema.FieldError{Path: "object_file", Message: fmt.Sprintf("helper %s of %s in %s is not supported by the kernel for program type %s", helper, name, prog.ObjectFile, p.Type)})
+		}
+	}
+	names = names[:0]
+	for name := range spec.Maps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := spec.Maps[name]
+		if err := k.HaveMapType(m.Type); notSupported(err) {
+			errs = append(errs, schema.FieldError{Path: "object_file", Message: fmt.Sprintf("map type %s of %s in %s is not supported by the kernel", m.Type, name, prog.ObjectFile)})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
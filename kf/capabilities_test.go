@@ -0,0 +1,152 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestProbeCapabilities(t *testing.T) {
+	kernel := newFakeKernel()
+	kernel.unsupported[tcxLinkType] = true
+	kernel.unsupported["Syscall"] = true
+	kernel.unsupported["TaskStorage"] = true
+	kernel.unsupported["SchedCLS"] = true
+	kernel.unsupported["FnTailCall"] = true
+
+	caps := probeCapabilities(kernel)
+	if caps.KernelVersion != "6.1.0" || !caps.BTF.Supported {
+		t.Errorf("probeCapabilities() kernel version = %q, btf = %+v", caps.KernelVersion, caps.BTF)
+	}
+	wantLinks := []models.L3afCapability{{Name: "xdp", Supported: true}, {Name: "tcx", Reason: "tcx_link: not supported"}}
+	if !reflect.DeepEqual(caps.Links, wantLinks) {
+		t.Errorf("probeCapabilities() links = %+v, want %+v", caps.Links, wantLinks)
+	}
+	last := caps.ProgramTypes[len(caps.ProgramTypes)-1]
+	if caps.ProgramTypes[0] != (models.L3afCapability{Name: "SocketFilter", Supported: true}) || last.Name != "Syscall" || last.Supported {
+		t.Errorf("probeCapabilities() program types = %+v", caps.ProgramTypes)
+	}
+	if last := caps.MapTypes[len(caps.MapTypes)-1]; last.Name != "TaskStorage" || last.Supported {
+		t.Errorf("probeCapabilities() map types = %+v", caps.MapTypes)
+	}
+	xdp, tc := caps.Helpers[0], caps.Helpers[1]
+	if xdp.ProgramType != "XDP" || len(xdp.Helpers) != int(asm.BuiltinFunc(0).Max())-1 || len(xdp.Reason) > 0 {
+		t.Errorf("probeCapabilities() xdp helpers = %d, reason %q, want all but FnTailCall", len(xdp.Helpers), xdp.Reason)
+	}
+	for _, helper := range xdp.Helpers {
+		if helper == "FnTailCall" {
+			t.Errorf("probeCapabilities() reports unsupported helper FnTailCall")
+		}
+	}
+	if tc.ProgramType != "SchedCLS" || len(tc.Helpers) != 0 || tc.Reason != "SchedCLS: not supported" {
+		t.Errorf("probeCapabilities() tc helpers = %+v, want the program type unsupported", tc)
+	}
+
+	kernel.noBTF = true
+	caps = probeCapabilities(kernel)
+	if caps.BTF.Supported || caps.Links[0].Supported || !strings.HasPrefix(caps.Links[0].Reason, "probe failed: ") {
+		t.Errorf("probeCapabilities() without BTF = %+v, links %+v, want unknown link support", caps.BTF, caps.Links)
+	}
+}
+
+func TestCheckKernelFeatures(t *testing.T) {
+	tests := []struct {
+		name        string
+		unsupported string
+		chaining    bool
+		wantErr     string
+	}{
+		{name: "Supported", chaining: true},
+		{name: "NoXDP", unsupported: "XDP", wantErr: "program type XDP is not supported"},
+		{name: "NoProgramArray", unsupported: "ProgramArray", chaining: true, wantErr: "map type ProgramArray required by bpf chaining"},
+		{name: "NoProgramArrayWithoutChaining", unsupported: "ProgramArray"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kernel := newFakeKernel()
+			kernel.unsupported[tt.unsupported] = true
+			err := checkKernelFeatures(kernel, &config.Config{BpfChainingEnabled: tt.chaining})
+			if (err == nil) != (len(tt.wantErr) == 0) || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkKernelFeatures() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateProgramsFeatures(t *testing.T) {
+	cfgs := []models.L3afBPFPrograms{{Iface: "fakeif0", BpfPrograms: &models.BPFPrograms{
+		XDPIngress: []*models.BPFProgram{{Name: "ratelimiting", Version: "1.0", SeqID: 1, ProgType: models.XDPType, MapName: "xdp_rl_ingress_next_prog"}},
+		TCIngress:  []*models.BPFProgram{{Name: "ratelimiting", Version: "1.0", SeqID: 1}},
+	}}}
+	tests := []struct {
+		name         string
+		unsupported  []string
+		featureCheck bool
+		want         []string
+	}{
+		{name: "Supported", featureCheck: true},
+		{name: "Disabled", unsupported: []string{"XDP", "ProgramArray", xdpLinkType}},
+		{
+			name:         "Unsupported",
+			unsupported:  []string{"XDP", "SchedCLS", "ProgramArray", xdpLinkType},
+			featureCheck: true,
+			want: []string{
+				"[0].bpf_programs.xdp_ingress[0].prog_type: program type XDP is not supported by the kernel",
+				"[0].bpf_programs.xdp_ingress[0].map_name: map type ProgramArray is not supported by the kernel",
+				"[0].bpf_programs.xdp_ingress[0]: xdp links are not supported by the kernel",
+				"[0].bpf_programs.tc_ingress[0].prog_type: program type SchedCLS is not supported by the kernel",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kernel := newFakeKernel()
+			for _, name := range tt.unsupported {
+				kernel.unsupported[name] = true
+			}
+			c := &NFConfigs{HostConfig: &config.Config{BpfChainingEnabled: true, KernelFeatureCheck: tt.featureCheck}, backend: kernel}
+			if got := fieldErrors(t, c.ValidatePrograms(cfgs)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidatePrograms() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckObjectFeatures(t *testing.T) {
+	spec := &ebpf.CollectionSpec{
+		Programs: map[string]*ebpf.ProgramSpec{
+			"_xdp_ratelimiting": {Type: ebpf.XDP, Instructions: asm.Instructions{asm.FnMapLookupElem.Call(), asm.FnTailCall.Call(), asm.Return()}},
+			"_lsm_ratelimiting": {Type: ebpf.LSM, Instructions: asm.Instructions{asm.FnGetCurrentTask.Call(), asm.Return()}},
+		},
+		Maps: map[string]*ebpf.MapSpec{
+			"xdp_rl_ingress_next_prog": {Type: ebpf.ProgramArray},
+			"rl_events":                {Type: ebpf.RingBuf},
+		},
+	}
+	prog := &models.BPFProgram{ObjectFile: "ratelimiting.bpf.o"}
+	kernel := newFakeKernel()
+	if err := checkObjectFeatures(kernel, prog, spec); err != nil {
+		t.Errorf("checkObjectFeatures() error = %v, want the features supported", err)
+	}
+
+	kernel.unsupported["LSM"] = true
+	kernel.unsupported["RingBuf"] = true
+	kernel.unsupported["FnTailCall"] = true
+	want := []string{
+		"object_file: program type LSM of _lsm_ratelimiting in ratelimiting.bpf.o is not supported by the kernel",
+		"object_file: helper FnTailCall of _xdp_ratelimiting in ratelimiting.bpf.o is not supported by the kernel for program type XDP",
+		"object_file: map type RingBuf of rl_events in ratelimiting.bpf.o is not supported by the kernel",
+	}
+	if got := fieldErrors(t, checkObjectFeatures(kernel, prog, spec)); !reflect.DeepEqual(got, want) {
+		t.Errorf("checkObjectFeatures() = %q, want %q", got, want)
+	}
+}
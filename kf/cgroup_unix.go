@@ -0,0 +1,262 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/l3af-project/l3afd/stats"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupControllers - controllers enabled for the leaf cgroups of the user programs
+var cgroupControllers = []string{"cpu", "memory", "pids"}
+
+// isCgroupV2 - reports whether path is on a cgroup v2 filesystem
+var isCgroupV2 = func(path string) bool {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(path, &fs); err != nil {
+		return false
+	}
+	return fs.Type == unix.CGROUP2_SUPER_MAGIC
+}
+
+// startInCgroup - creates the cgroup v2 leaf of the user program before its command is started and makes the command
+// start inside of it, so that the program never runs outside of its limits. The returned func is called once the
+// command is started. When the leaf can not be used the program is placed into it by SetResourceLimits.
+func (b *BPF) startInCgroup(ifaceName, direction string) func(started bool) {
+	done := func(bool) {}
+	if b.Cmd == nil || !b.hostConfig.CgroupEnabled || !isCgroupV2(b.hostConfig.CgroupRoot) || !cloneIntoCgroup(b.kernel()) {
+		return done
+	}
+	cgroupPath, err := b.createCgroup(ifaceName, direction)
+	if err != nil {
+		b.logger(ifaceName, direction).Warn().Err(err).Msg("failed to create cgroup before starting the user program")
+		return done
+	}
+	dir, err := os.Open(cgroupPath)
+	if err != nil {
+		b.logger(ifaceName, direction).Warn().Err(err).Str("cgroup", cgroupPath).Msg("failed to open cgroup before starting the user program")
+		return done
+	}
+	if b.Cmd.SysProcAttr == nil {
+		b.Cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	b.Cmd.SysProcAttr.UseCgroupFD = true
+	b.Cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return func(started bool) {
+		dir.Close()
+		if started {
+			b.cgroupPath = cgroupPath
+		} else if err := os.Remove(cgroupPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			b.logger(ifaceName, direction).Warn().Err(err).Str("cgroup", cgroupPath).Msg("failed to remove cgroup")
+		}
+	}
+}
+
+// cloneIntoCgroup - reports whether the kernel starts processes in a cgroup with CLONE_INTO_CGROUP, added in 5.7
+func cloneIntoCgroup(k kernelBackend) bool {
+	version, err := k.KernelVersion()
+	if err != nil {
+		return false
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(version, "%d.%d", &major, &minor); err != nil {
+		return false
+	}
+	return major > 5 || (major == 5 && minor >= 7)
+}
+
+// SetResourceLimits - places the user program into its own cgroup v2 leaf with the cpu, memory and pids limits
+// of the program, unless it was started inside of it. Where cgroup v2 is unavailable the limits are applied with prlimit.
+func (b *BPF) SetResourceLimits(ifaceName, direction string) error {
+	if b.Cmd == nil {
+		return errors.New("no Process to set limits")
+	}
+	if b.Cmd.SysProcAttr != nil && b.Cmd.SysProcAttr.UseCgroupFD {
+		b.logger(ifaceName, direction).Info().Int("pid", b.Cmd.Process.Pid).Str("cgroup", b.cgroupPath).Msg("user program started in cgroup")
+		return nil
+	}
+	if !b.hostConfig.CgroupEnabled || !isCgroupV2(b.hostConfig.CgroupRoot) {
+		b.logger(ifaceName, direction).Debug().Msg("cgroup v2 is not available, setting prlimit")
+		return b.SetPrLimits()
+	}
+
+	cgroupPath, err := b.createCgroup(ifaceName, direction)
+	if err != nil {
+		b.logger(ifaceName, direction).Warn().Err(err).Msg("failed to create cgroup, setting prlimit")
+		return b.SetPrLimits()
+	}
+	if err := writeCgroupFile(cgroupPath, "cgroup.procs", strconv.Itoa(b.Cmd.Process.Pid)); err != nil {
+		b.logger(ifaceName, direction).Warn().Err(err).Str("cgroup", cgroupPath).Msg("failed to move user program into cgroup, setting prlimit")
+		return b.SetPrLimits()
+	}
+	b.cgroupPath = cgroupPath
+	b.logger(ifaceName, direction).Info().Int("pid", b.Cmd.Process.Pid).Str("cgroup", cgroupPath).Msg("user program placed in cgroup")
+	return nil
+}
+
+// createCgroup - creates the leaf cgroup of the user program under the configured parent and writes its limits
+func (b *BPF) createCgroup(ifaceName, direction string) (string, error) {
+	parent := filepath.Join(b.hostConfig.CgroupRoot, b.hostConfig.CgroupParent)
+	leaf := b.Program.Name + "-" + ifaceName + "-" + direction
+	if strings.Contains(parent, "..") || strings.ContainsAny(leaf, "/") || strings.Contains(leaf, "..") {
+		return "", fmt.Errorf("invalid cgroup path %s/%s", parent, leaf)
+	}
+
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cgroup %s: %v", parent, err)
+	}
+	// controllers have to be enabled in every ancestor of the leaf
+	dir := b.hostConfig.CgroupRoot
+	if err := enableCgroupControllers(dir); err != nil {
+		return "", err
+	}
+	for _, name := range strings.Split(filepath.Clean(b.hostConfig.CgroupParent), string(filepath.Separator)) {
+		if len(name) == 0 || name == "." {
+			continue
+		}
+		dir = filepath.Join(dir, name)
+		if err := enableCgroupControllers(dir); err != nil {
+			return "", err
+		}
+	}
+
+	cgroupPath := filepath.Join(parent, leaf)
+	if err := os.MkdirAll(cgroupPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cgroup %s: %v", cgroupPath, err)
+	}
+
+	limits := map[string]string{
+		"cpu.max":    b.cgroupCPUMax(),
+		"memory.max": "max",
+		"pids.max":   "max",
+	}
+	if b.Program.Memory > 0 {
+		limits["memory.max"] = strconv.Itoa(b.Program.Memory)
+	}
+	if b.hostConfig.CgroupPidsMax > 0 {
+		limits["pids.max"] = strconv.Itoa(b.hostConfig.CgroupPidsMax)
+	}
+	for name, value := range limits {
+		if err := writeCgroupFile(cgroupPath, name, value); err != nil {
+			return "", err
+		}
+	}
+	return cgroupPath, nil
+}
+
+// cgroupCPUMax - returns the cpu.max value of the program, CPU is the limit in percent of a single cpu
+func (b *BPF) cgroupCPUMax() string {
+	period := b.hostConfig.CgroupCPUPeriod.Microseconds()
+	if period <= 0 {
+		period = 100000
+	}
+	if b.Program.CPU <= 0 {
+		return "max " + strconv.FormatInt(period, 10)
+	}
+	quota := period * int64(b.Program.CPU) / 100
+	if quota < 1000 { // minimum quota allowed by the kernel is 1ms
+		quota = 1000
+	}
+	return strconv.FormatInt(quota, 10) + " " + strconv.FormatInt(period, 10)
+}
+
+func enableCgroupControllers(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return fmt.Errorf("failed to read controllers of cgroup %s: %v", dir, err)
+	}
+	enabled := strings.Fields(string(data))
+	for _, controller := range cgroupControllers {
+		if contains(enabled, controller) {
+			continue
+		}
+		if err := writeCgroupFile(dir, "cgroup.subtree_control", "+"+controller); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to write %s to %s of cgroup %s: %v", value, name, dir, err)
+	}
+	return nil
+}
+
+// RemoveCgroup - removes the leaf cgroup of the stopped user program
+func (b *BPF) RemoveCgroup() {
+	if len(b.cgroupPath) == 0 {
+		return
+	}
+	if err := os.Remove(b.cgroupPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		b.logger("", "").Warn().Err(err).Str("cgroup", b.cgroupPath).Msg("failed to remove cgroup")
+		return
+	}
+	b.cgroupPath = ""
+}
+
+// updateResourceUsage - exports the cpu, memory and pids usage of the user program cgroup
+func (b *BPF) updateResourceUsage(ifaceName, direction string) {
+	if len(b.cgroupPath) == 0 {
+		return
+	}
+	if usec, err := readCgroupStat(b.cgroupPath, "cpu.stat", "usage_usec"); err == nil {
+		stats.Set(float64(usec)/1e6, stats.NFCPUUsageSeconds, b.Program.Name, direction, ifaceName)
+	}
+	if bytes, err := readCgroupValue(b.cgroupPath, "memory.current"); err == nil {
+		stats.Set(float64(bytes), stats.NFMemoryUsage, b.Program.Name, direction, ifaceName)
+	}
+	if pids, err := readCgroupValue(b.cgroupPath, "pids.current"); err == nil {
+		stats.Set(float64(pids), stats.NFProcessCount, b.Program.Name, direction, ifaceName)
+	}
+}
+
+func readCgroupValue(dir, name string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readCgroupStat - returns the value of key of a flat keyed cgroup file like cpu.stat
+func readCgroupStat(dir, name, key string) (uint64, error) {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("%s not found in %s of cgroup %s", key, name, dir)
+}
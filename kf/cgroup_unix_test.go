@@ -0,0 +1,167 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestBPF_createCgroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		program models.BPFProgram
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "NoLimits",
+			program: models.BPFProgram{Name: "foo"},
+			want:    map[string]string{"cpu.max": "max 100000", "memory.max": "max", "pids.max": "64"},
+		},
+		{
+			name:    "Limits",
+			program: models.BPFProgram{Name: "foo", CPU: 50, Memory: 1 << 20},
+			want:    map[string]string{"cpu.max": "50000 100000", "memory.max": "1048576", "pids.max": "64"},
+		},
+		{
+			name:    "InvalidName",
+			program: models.BPFProgram{Name: "../foo"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, dir := range []string{root, filepath.Join(root, "l3afd")} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("cpu"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			b := &BPF{
+				Program: tt.program,
+				hostConfig: &config.Config{
+					CgroupRoot:      root,
+					CgroupParent:    "l3afd",
+					CgroupCPUPeriod: 100 * time.Millisecond,
+					CgroupPidsMax:   64,
+				},
+			}
+			path, err := b.createCgroup("fakeif0", models.IngressType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createCgroup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if want := filepath.Join(root, "l3afd", "foo-fakeif0-ingress"); path != want {
+				t.Errorf("createCgroup() path = %s, want %s", path, want)
+			}
+			for name, value := range tt.want {
+				data, err := os.ReadFile(filepath.Join(path, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != value {
+					t.Errorf("%s = %q, want %q", name, data, value)
+				}
+			}
+		})
+	}
+}
+
+func TestBPF_startInCgroup(t *testing.T) {
+	isV2 := isCgroupV2
+	isCgroupV2 = func(string) bool { return true }
+	defer func() { isCgroupV2 = isV2 }()
+
+	tests := []struct {
+		name    string
+		version string
+		started bool
+		wantFD  bool
+	}{
+		{name: "Started", version: "5.7.0", started: true, wantFD: true},
+		{name: "StartFailed", version: "6.1.0", wantFD: true},
+		{name: "OldKernel", version: "5.4.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte("cpu memory pids"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			kernel := newFakeKernel()
+			kernel.version = tt.version
+			b := &BPF{
+				Program:    models.BPFProgram{Name: "foo"},
+				Cmd:        exec.Command("true"),
+				hostConfig: &config.Config{CgroupEnabled: true, CgroupRoot: root},
+				backend:    kernel,
+			}
+			done := b.startInCgroup("fakeif0", models.IngressType)
+			gotFD := b.Cmd.SysProcAttr != nil && b.Cmd.SysProcAttr.UseCgroupFD && b.Cmd.SysProcAttr.CgroupFD > 0
+			if gotFD != tt.wantFD {
+				t.Fatalf("startInCgroup() SysProcAttr = %+v, want the cgroup fd %v", b.Cmd.SysProcAttr, tt.wantFD)
+			}
+			done(tt.started)
+
+			leaf := filepath.Join(root, "foo-fakeif0-ingress")
+			// the leaf of a command which failed to start is not recorded, it is removed
+			if want := map[bool]string{true: leaf}[tt.started]; b.cgroupPath != want {
+				t.Errorf("cgroupPath = %q, want %q", b.cgroupPath, want)
+			}
+		})
+	}
+}
+
+func TestBPF_cgroupCPUMax(t *testing.T) {
+	tests := []struct {
+		cpu    int
+		period time.Duration
+		want   string
+	}{
+		{cpu: 0, period: 100 * time.Millisecond, want: "max 100000"},
+		{cpu: 200, period: 100 * time.Millisecond, want: "200000 100000"},
+		{cpu: 1, period: 10 * time.Millisecond, want: "1000 10000"},
+		{cpu: 25, period: 0, want: "25000 100000"},
+	}
+	for _, tt := range tests {
+		b := &BPF{
+			Program:    models.BPFProgram{CPU: tt.cpu},
+			hostConfig: &config.Config{CgroupCPUPeriod: tt.period},
+		}
+		if got := b.cgroupCPUMax(); got != tt.want {
+			t.Errorf("cgroupCPUMax() cpu %d period %s = %s, want %s", tt.cpu, tt.period, got, tt.want)
+		}
+	}
+}
+
+func Test_readCgroupStat(t *testing.T) {
+	dir := t.TempDir()
+	stat := "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n"
+	if err := os.WriteFile(filepath.Join(dir, "cpu.stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readCgroupStat(dir, "cpu.stat", "usage_usec")
+	if err != nil || got != 2500000 {
+		t.Errorf("readCgroupStat() = %d, %v, want 2500000", got, err)
+	}
+	if _, err := readCgroupStat(dir, "cpu.stat", "nr_periods"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("readCgroupStat() of missing key error = %v", err)
+	}
+}
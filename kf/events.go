@@ -0,0 +1,254 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/logfile"
+	"github.com/l3af-project/l3afd/models"
+)
+
+const (
+	defaultEventJournalSize = 1000
+	// eventWatchBuffer - events queued for a watcher, a watcher falling further behind is closed
+	eventWatchBuffer = 100
+)
+
+// EventFilter selects events, empty fields match all events
+type EventFilter struct {
+	Program string
+	Iface   string
+	// Since selects events recorded after this time
+	Since time.Time
+	// SinceSeq selects events with a higher sequence number, unlike Since it does not skip the events recorded at
+	// the same time as the last one received
+	SinceSeq uint64
+}
+
+// Match - reports whether the event is selected by the filter
+func (f EventFilter) Match(e models.L3afEvent) bool {
+	if len(f.Program) > 0 && f.Program != e.Program {
+		return false
+	}
+	if len(f.Iface) > 0 && f.Iface != e.Iface {
+		return false
+	}
+	if f.SinceSeq > 0 && e.Seq <= f.SinceSeq {
+		return false
+	}
+	return f.Since.IsZero() || e.Time.After(f.Since)
+}
+
+// EventWatcher receives the events recorded after it was created
+type EventWatcher struct {
+	filter  EventFilter
+	events  chan models.L3afEvent
+	journal *EventJournal
+}
+
+// Events - returns the channel of the watched events, it is closed when the watcher is stopped or fell behind
+func (w *EventWatcher) Events() <-chan models.L3afEvent {
+	return w.events
+}
+
+// Stop - stops delivering events to the watcher
+func (w *EventWatcher) Stop() {
+	w.journal.mu.Lock()
+	defer w.journal.mu.Unlock()
+	w.journal.removeWatcher(w)
+}
+
+// EventJournal keeps the last lifecycle events of the BPF programs in memory and optionally appends them to a file
+type EventJournal struct {
+	mu       sync.Mutex
+	size     int
+	events   []models.L3afEvent
+	seq      uint64
+	watchers map[*EventWatcher]struct{}
+	out      io.WriteCloser
+}
+
+// journal - event journal of this host, replaced by SetupEventJournal while programs record events
+var journal atomic.Pointer[EventJournal]
+
+func init() {
+	journal.Store(NewEventJournal(defaultEventJournalSize))
+}
+
+// NewEventJournal - returns an in-memory journal keeping the last size events
+func NewEventJournal(size int) *EventJournal {
+	if size <= 0 {
+		size = defaultEventJournalSize
+	}
+	return &EventJournal{
+		size:     size,
+		events:   make([]models.L3afEvent, 0, size),
+		watchers: make(map[*EventWatcher]struct{}),
+	}
+}
+
+// Events - returns the event journal of this host
+func Events() *EventJournal {
+	return journal.Load()
+}
+
+// SetupEventJournal - replaces the event journal of this host as configured in the [events] section,
+// a persisted journal is reloaded from its file
+func SetupEventJournal(conf *config.Config) error {
+	j := NewEventJournal(conf.EventJournalSize)
+	if len(conf.EventJournalFile) > 0 {
+		if err := j.persist(conf.EventJournalFile, int64(conf.EventJournalFileMaxSizeMB)*1024*1024, conf.EventJournalFileMaxBackups); err != nil {
+			return err
+		}
+	}
+	return journal.Swap(j).Close()
+}
+
+// persist - loads the events of the journal file at path and appends new events to it
+func (j *EventJournal) persist(path string, maxSize int64, maxBackups int) error {
+	lines, err := logfile.Tail(path, j.size)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read event journal %s: %v", path, err)
+	}
+	for _, line := range lines {
+		var e models.L3afEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("skipping invalid event journal line")
+			continue
+		}
+		j.append(e)
+		if e.Seq > j.seq {
+			j.seq = e.Seq
+		}
+	}
+	w, err := logfile.NewWriter(path, maxSize, maxBackups)
+	if err != nil {
+		return fmt.Errorf("failed to open event journal %s: %v", path, err)
+	}
+	j.out = w
+	return nil
+}
+
+// Record - adds the event to the journal and delivers it to the watchers
+func (j *EventJournal) Record(e models.L3afEvent) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.seq++
+	e.Seq = j.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if len(e.Type) == 0 {
+		e.Type = models.EventNormal
+	}
+	j.append(e)
+
+	if j.out != nil {
+		if line, err := json.Marshal(e); err != nil {
+			log.Warn().Err(err).Msg("failed to marshal event")
+		} else if _, err := j.out.Write(append(line, '\n')); err != nil {
+			log.Warn().Err(err).Msg("failed to persist event")
+		}
+	}
+
+	for w := range j.watchers {
+		if !w.filter.Match(e) {
+			continue
+		}
+		select {
+		case w.events <- e:
+		default:
+			log.Warn().Msg("event watcher fell behind, closing it")
+			j.removeWatcher(w)
+		}
+	}
+}
+
+// append - keeps the last size events, the caller holds the lock or owns the journal
+func (j *EventJournal) append(e models.L3afEvent) {
+	if len(j.events) == j.size {
+		copy(j.events, j.events[1:])
+		j.events = j.events[:j.size-1]
+	}
+	j.events = append(j.events, e)
+}
+
+// List - returns the events selected by the filter, oldest first
+func (j *EventJournal) List(filter EventFilter) []models.L3afEvent {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.list(filter)
+}
+
+func (j *EventJournal) list(filter EventFilter) []models.L3afEvent {
+	events := make([]models.L3afEvent, 0)
+	for _, e := range j.events {
+		if filter.Match(e) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Watch - returns the events selected by the filter and a watcher receiving the ones recorded later, without gaps
+func (j *EventJournal) Watch(filter EventFilter) ([]models.L3afEvent, *EventWatcher) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	w := &EventWatcher{
+		filter:  filter,
+		events:  make(chan models.L3afEvent, eventWatchBuffer),
+		journal: j,
+	}
+	j.watchers[w] = struct{}{}
+	return j.list(filter), w
+}
+
+// removeWatcher - closes the channel of the watcher, the caller holds the lock
+func (j *EventJournal) removeWatcher(w *EventWatcher) {
+	if _, ok := j.watchers[w]; !ok {
+		return
+	}
+	delete(j.watchers, w)
+	close(w.events)
+}
+
+// Close - stops the watchers and closes the journal file
+func (j *EventJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for w := range j.watchers {
+		j.removeWatcher(w)
+	}
+	if j.out == nil {
+		return nil
+	}
+	err := j.out.Close()
+	j.out = nil
+	return err
+}
+
+// recordEvent - records a lifecycle event of the program in the event journal of this host
+func (b *BPF) recordEvent(eventType, reason, ifaceName, direction, message string) {
+	journal.Load().Record(models.L3afEvent{
+		Type:      eventType,
+		Reason:    reason,
+		Program:   b.Program.Name,
+		Version:   b.Program.Version,
+		Iface:     ifaceName,
+		Direction: direction,
+		Message:   message,
+	})
+}
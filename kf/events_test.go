@@ -0,0 +1,164 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestEventJournalList(t *testing.T) {
+	j := NewEventJournal(3)
+	start := time.Now()
+	for i, e := range []models.L3afEvent{
+		{Reason: models.EventProgramStarted, Program: "foo", Iface: "fakeif0", Time: start.Add(1 * time.Second)},
+		{Reason: models.EventProgramStarted, Program: "bar", Iface: "fakeif0", Time: start.Add(2 * time.Second)},
+		{Reason: models.EventProgramStopped, Program: "foo", Iface: "fakeif0", Time: start.Add(3 * time.Second)},
+		{Reason: models.EventProgramStarted, Program: "foo", Iface: "fakeif1", Time: start.Add(4 * time.Second)},
+	} {
+		j.Record(e)
+		if i == 0 && j.List(EventFilter{})[0].Type != models.EventNormal {
+			t.Errorf("Record() type = %s, want Normal by default", j.List(EventFilter{})[0].Type)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		filter  EventFilter
+		wantSeq []uint64
+	}{
+		{name: "All", filter: EventFilter{}, wantSeq: []uint64{2, 3, 4}},
+		{name: "Program", filter: EventFilter{Program: "foo"}, wantSeq: []uint64{3, 4}},
+		{name: "Iface", filter: EventFilter{Iface: "fakeif0"}, wantSeq: []uint64{2, 3}},
+		{name: "Since", filter: EventFilter{Since: start.Add(3 * time.Second)}, wantSeq: []uint64{4}},
+		{name: "SinceSeq", filter: EventFilter{SinceSeq: 2}, wantSeq: []uint64{3, 4}},
+		{name: "SinceSeqAndProgram", filter: EventFilter{Program: "foo", SinceSeq: 3}, wantSeq: []uint64{4}},
+		{name: "NoMatch", filter: EventFilter{Program: "baz"}, wantSeq: []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := j.List(tt.filter)
+			if len(events) != len(tt.wantSeq) {
+				t.Fatalf("List() returned %d events %v, want seq %v", len(events), events, tt.wantSeq)
+			}
+			for i, e := range events {
+				if e.Seq != tt.wantSeq[i] {
+					t.Errorf("List()[%d].Seq = %d, want %d", i, e.Seq, tt.wantSeq[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEventJournalWatch(t *testing.T) {
+	j := NewEventJournal(10)
+	j.Record(models.L3afEvent{Reason: models.EventProgramStarted, Program: "foo"})
+
+	backlog, w := j.Watch(EventFilter{Program: "foo"})
+	if len(backlog) != 1 {
+		t.Fatalf("Watch() backlog = %v, want the started event", backlog)
+	}
+	j.Record(models.L3afEvent{Reason: models.EventProgramStarted, Program: "bar"})
+	j.Record(models.L3afEvent{Reason: models.EventProgramStopped, Program: "foo"})
+
+	select {
+	case e := <-w.Events():
+		if e.Reason != models.EventProgramStopped || e.Seq != 3 {
+			t.Errorf("watched event = %+v, want stopped event of foo with seq 3", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("watched event not delivered")
+	}
+
+	w.Stop()
+	if _, ok := <-w.Events(); ok {
+		t.Errorf("watcher channel is open after Stop()")
+	}
+	w.Stop()
+
+	// a watcher falling behind is closed, recording is not blocked
+	_, slow := j.Watch(EventFilter{})
+	for i := 0; i < eventWatchBuffer+1; i++ {
+		j.Record(models.L3afEvent{Reason: models.EventProgramRestarted, Program: "foo"})
+	}
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	if received != eventWatchBuffer {
+		t.Errorf("slow watcher received %d events, want %d before it was closed", received, eventWatchBuffer)
+	}
+}
+
+func TestSetupEventJournalPersisted(t *testing.T) {
+	prev := journal.Load()
+	t.Cleanup(func() {
+		journal.Swap(prev).Close()
+	})
+
+	conf := &config.Config{
+		EventJournalSize:           2,
+		EventJournalFile:           filepath.Join(t.TempDir(), "events.json"),
+		EventJournalFileMaxSizeMB:  1,
+		EventJournalFileMaxBackups: 1,
+	}
+	if err := SetupEventJournal(conf); err != nil {
+		t.Fatalf("SetupEventJournal() error = %v", err)
+	}
+	b := &BPF{Program: models.BPFProgram{Name: "foo", Version: "1.0"}}
+	b.recordEvent(models.EventNormal, models.EventProgramStarted, "fakeif0", models.XDPIngressType, "")
+	b.recordEvent(models.EventNormal, models.EventProgramStopped, "fakeif0", models.XDPIngressType, "")
+	b.recordEvent(models.EventWarning, models.EventRestartBudgetExhausted, "fakeif0", models.XDPIngressType, "not restarted")
+
+	// reloaded after restart
+	if err := SetupEventJournal(conf); err != nil {
+		t.Fatalf("SetupEventJournal() error = %v", err)
+	}
+	events := Events().List(EventFilter{})
+	if len(events) != 2 {
+		t.Fatalf("reloaded %d events %v, want the last 2", len(events), events)
+	}
+	if events[0].Reason != models.EventProgramStopped || events[1].Reason != models.EventRestartBudgetExhausted {
+		t.Errorf("reloaded events %v, want stopped and restart budget exhausted", events)
+	}
+	if events[1].Type != models.EventWarning || events[1].Program != "foo" || events[1].Version != "1.0" || events[1].Iface != "fakeif0" {
+		t.Errorf("reloaded event %+v does not match the recorded one", events[1])
+	}
+
+	Events().Record(models.L3afEvent{Reason: models.EventProgramStarted})
+	if events := Events().List(EventFilter{}); events[len(events)-1].Seq != 4 {
+		t.Errorf("seq after reload = %d, want 4", events[len(events)-1].Seq)
+	}
+}
+
+func TestSetupEventJournalWhileRecording(t *testing.T) {
+	prev := journal.Load()
+	t.Cleanup(func() {
+		journal.Swap(prev).Close()
+	})
+
+	b := &BPF{Program: models.BPFProgram{Name: "foo", Version: "1.0"}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			b.recordEvent(models.EventNormal, models.EventProgramStarted, "fakeif0", models.XDPIngressType, "")
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if err := SetupEventJournal(&config.Config{EventJournalSize: 10}); err != nil {
+			t.Fatalf("SetupEventJournal() error = %v", err)
+		}
+	}
+	<-done
+
+	b.recordEvent(models.EventNormal, models.EventProgramStopped, "fakeif0", models.XDPIngressType, "")
+	if events := Events().List(EventFilter{}); len(events) == 0 || events[len(events)-1].Reason != models.EventProgramStopped {
+		t.Errorf("events %v, want the last event recorded in the current journal", events)
+	}
+}
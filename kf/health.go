@@ -0,0 +1,287 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/stats"
+)
+
+// Health check names
+const (
+	healthCheckRunning  = "running"
+	healthCheckLinkage  = "linkage"
+	healthCheckAttach   = "attach"
+	healthCheckLiveness = "liveness"
+)
+
+var defaultProbeTimeout = 5 * time.Second
+
+// livenessResult is the outcome of a liveness probe run in the background
+type livenessResult struct {
+	probe *models.L3afDNFProbe
+	check models.L3afHealthCheck
+}
+
+// checkHealth - evaluates the health checks of the program at element e of the bpf list and stores the result.
+// userProgram and bpfProgram are the results of the running check done by the caller.
+func checkHealth(e *list.Element, ifaceName, direction string, chain, userProgram, bpfProgram bool, now time.Time) models.L3afBPFProgramHealth {
+	bpf := e.Value.(*BPF)
+	health := bpf.newHealth(ifaceName, direction)
+	health.CheckedAt = now
+
+	running := models.L3afHealthCheck{Name: healthCheckRunning, Healthy: userProgram && bpfProgram}
+	if !userProgram {
+		running.Message = "user program is not running"
+	} else if !bpfProgram {
+		running.Message = "eBPF program is not loaded"
+	}
+	health.Checks = append(health.Checks, running)
+
+	if check, ok := bpf.checkLinkage(e, chain); ok {
+		health.Checks = append(health.Checks, check)
+	}
+	if check, ok := bpf.checkAttach(ifaceName, direction); ok {
+		health.Checks = append(health.Checks, check)
+	}
+	if check, ok := bpf.checkLiveness(); ok {
+		health.Checks = append(health.Checks, check)
+	}
+
+	health.Status = models.HealthHealthy
+	for _, check := range health.Checks {
+		if !check.Healthy {
+			health.Status = models.HealthUnhealthy
+			bpf.logger(ifaceName, direction).Warn().Str("check", check.Name).Str("reason", check.Message).Msg("health check failed")
+		}
+	}
+
+	healthy := 0.0
+	if health.Status == models.HealthHealthy {
+		healthy = 1.0
+	}
+	stats.SetWithVersion(healthy, stats.NFHealthy, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+
+	bpf.health.Store(&health)
+	return health
+}
+
+// newHealth - returns the health of the program without any check results
+func (b *BPF) newHealth(ifaceName, direction string) models.L3afBPFProgramHealth {
+	return models.L3afBPFProgramHealth{
+		Iface:        ifaceName,
+		Direction:    direction,
+		Name:         b.Program.Name,
+		Version:      b.Program.Version,
+		SeqID:        b.Program.SeqID,
+		Status:       models.HealthUnknown,
+		CrashLooping: b.CrashLooping,
+		Checks:       []models.L3afHealthCheck{},
+	}
+}
+
+// Health - returns the last evaluated health of the program, status is unknown until it is evaluated
+func (b *BPF) Health(ifaceName, direction string) models.L3afBPFProgramHealth {
+	if health := b.health.Load(); health != nil {
+		h := *health
+		h.CrashLooping = b.CrashLooping
+		return h
+	}
+	return b.newHealth(ifaceName, direction)
+}
+
+// checkLinkage - verifies the prog map of the previous program in the chain points to this program
+func (b *BPF) checkLinkage(e *list.Element, chain bool) (models.L3afHealthCheck, bool) {
+	if !chain || e.Prev() == nil {
+		return models.L3afHealthCheck{}, false
+	}
+	check := models.L3afHealthCheck{Name: healthCheckLinkage}
+	if b.Unlinked {
+		check.Message = "unlinked from the chain while crash looping"
+		return check, true
+	}
+
+	prevBPF := e.Prev().Value.(*BPF)
+	progID, err := b.kernel().ProgArrayLookupPinned(prevBPF.MapNamePath)
+	if err != nil {
+		check.Message = fmt.Sprintf("failed to read prog map of previous program %s: %v", prevBPF.Program.Name, err)
+		return check, true
+	}
+	if progID != b.ProgID {
+		check.Message = fmt.Sprintf("prog map of previous program %s points to program id %d instead of %d",
+			prevBPF.Program.Name, uint32(progID), uint32(b.ProgID))
+		return check, true
+	}
+	check.Healthy = true
+	return check, true
+}
+
+// checkAttach - verifies the program attached by l3afd is still attached to the interface
+func (b *BPF) checkAttach(ifaceName, direction string) (models.L3afHealthCheck, bool) {
+	var err error
+	if b.XDPLink != nil {
+		err = b.kernel().XDPAttached(b.XDPLink)
+	} else if b.TCFilter != nil {
+		err = b.kernel().TCAttached(ifaceName, direction, b.ProgID)
+	} else {
+		return models.L3afHealthCheck{}, false
+	}
+
+	check := models.L3afHealthCheck{Name: healthCheckAttach, Healthy: err == nil}
+	if err != nil {
+		check.Message = err.Error()
+	}
+	return check, true
+}
+
+// checkLiveness - returns the last result of the liveness probe of the program if defined.
+// The probe runs in its own goroutine so that a slow probe does not hold up the process monitor,
+// a new run is started when the previous one has completed. The check is skipped until the
+// first run of the current probe has completed.
+func (b *BPF) checkLiveness() (models.L3afHealthCheck, bool) {
+	probe := b.Program.LivenessProbe
+	if probe == nil || (len(probe.HTTPGet) == 0 && len(probe.Exec) == 0) {
+		return models.L3afHealthCheck{}, false
+	}
+
+	if b.livenessProbing.CompareAndSwap(false, true) {
+		go b.runLiveness(probe, b.FilePath, b.Program.Name)
+	}
+
+	result := b.liveness.Load()
+	if result == nil || result.probe != probe {
+		return models.L3afHealthCheck{}, false
+	}
+	return result.check, true
+}
+
+// runLiveness - runs the liveness probe and stores the result for checkLiveness
+func (b *BPF) runLiveness(probe *models.L3afDNFProbe, filePath, progName string) {
+	defer b.livenessProbing.Store(false)
+
+	timeout := defaultProbeTimeout
+	if probe.TimeoutSeconds > 0 {
+		timeout = time.Duration(probe.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var err error
+	if len(probe.HTTPGet) > 0 {
+		err = httpProbe(ctx, probe.HTTPGet)
+	} else {
+		err = execProbe(ctx, probe, filePath, progName)
+	}
+
+	check := models.L3afHealthCheck{Name: healthCheckLiveness, Healthy: err == nil}
+	if err != nil {
+		check.Message = err.Error()
+	}
+	b.liveness.Store(&livenessResult{probe: probe, check: check})
+}
+
+func httpProbe(ctx context.Context, probeURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid http probe url %s: %v", probeURL, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http probe %s failed: %v", probeURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("http probe %s returned status code %d", probeURL, resp.StatusCode)
+	}
+	return nil
+}
+
+func execProbe(ctx context.Context, probe *models.L3afDNFProbe, filePath, progName string) error {
+	cmd, err := ValidatePath(probe.Exec, filePath)
+	if err != nil {
+		return fmt.Errorf("invalid exec probe %s: %v", probe.Exec, err)
+	}
+	if err := assertExecutable(cmd); err != nil {
+		return fmt.Errorf("no executable permissions on %s - error %v", probe.Exec, err)
+	}
+
+	keys := make([]string, 0, len(probe.ExecArgs))
+	for k := range probe.ExecArgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v, ok := probe.ExecArgs[k].(string)
+		if !ok {
+			return fmt.Errorf("exec probe args is not a string for the bpf program %s", progName)
+		}
+		args = append(args, "--"+k+"="+v)
+	}
+
+	if out, err := exec.CommandContext(ctx, cmd, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("exec probe %s failed: %v %s", probe.Exec, err, out)
+	}
+	return nil
+}
+
+// Health - Method provides aggregated health of the eBPF programs on all ifaces on the host
+func (c *NFConfigs) Health() models.L3afHealth {
+	health := models.L3afHealth{
+		HostName: c.HostName,
+		Status:   models.HealthHealthy,
+		Programs: make([]models.L3afBPFProgramHealth, 0),
+	}
+
+	for direction, bpfProgs := range map[string]map[string]*list.List{
+		models.XDPIngressType: c.IngressXDPBpfs,
+		models.IngressType:    c.IngressTCBpfs,
+		models.EgressType:     c.EgressTCBpfs,
+	} {
+		for ifaceName, bpfList := range bpfProgs {
+			if bpfList == nil {
+				continue
+			}
+			for e := bpfList.Front(); e != nil; e = e.Next() {
+				bpf := e.Value.(*BPF)
+				if bpf.Program.AdminStatus == models.Disabled {
+					continue
+				}
+				health.Programs = append(health.Programs, bpf.Health(ifaceName, direction))
+			}
+		}
+	}
+
+	for _, program := range health.Programs {
+		if program.Status == models.HealthUnhealthy {
+			health.Status = models.HealthUnhealthy
+			break
+		}
+		if program.Status == models.HealthUnknown {
+			health.Status = models.HealthUnknown
+		}
+	}
+
+	sort.Slice(health.Programs, func(i, j int) bool {
+		a, b := health.Programs[i], health.Programs[j]
+		if a.Iface != b.Iface {
+			return a.Iface < b.Iface
+		}
+		if a.Direction != b.Direction {
+			return a.Direction < b.Direction
+		}
+		return a.SeqID < b.SeqID
+	})
+	return health
+}
@@ -0,0 +1,211 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	tc "github.com/florianl/go-tc"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestCheckHealth(t *testing.T) {
+	c := newChainTest(t)
+	for _, p := range []struct {
+		name   string
+		seqID  int
+		progID ebpf.ProgramID
+		mapID  ebpf.MapID
+	}{
+		{name: "a", seqID: 1, progID: 11, mapID: 101},
+		{name: "b", seqID: 2, progID: 12, mapID: 102},
+	} {
+		prog := c.program(p.name, p.seqID, p.progID, p.mapID)
+		if err := c.cfg.InsertAndStartBPFProgram(context.Background(), prog, chainTestIface, models.XDPIngressType); err != nil {
+			t.Fatalf("InsertAndStartBPFProgram(%s) error = %v", p.name, err)
+		}
+	}
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer unhealthy.Close()
+
+	tests := []struct {
+		name       string
+		program    string
+		setup      func(b *BPF)
+		running    bool
+		wantStatus string
+		wantChecks map[string]bool
+	}{
+		{
+			name:       "Linked",
+			program:    "b",
+			running:    true,
+			wantStatus: models.HealthHealthy,
+			wantChecks: map[string]bool{healthCheckRunning: true, healthCheckLinkage: true},
+		},
+		{
+			name:    "NotRunning",
+			program: "b",
+			setup: func(b *BPF) {
+				b.Program.LivenessProbe = nil
+			},
+			running:    false,
+			wantStatus: models.HealthUnhealthy,
+			wantChecks: map[string]bool{healthCheckRunning: false, healthCheckLinkage: true},
+		},
+		{
+			name:    "SlotCleared",
+			program: "b",
+			setup: func(b *BPF) {
+				c.kernel.progArrays[101] = 0
+			},
+			running:    true,
+			wantStatus: models.HealthUnhealthy,
+			wantChecks: map[string]bool{healthCheckRunning: true, healthCheckLinkage: false},
+		},
+		{
+			name:    "RootDetached",
+			program: "xdp-root",
+			setup: func(b *BPF) {
+				b.TCFilter = &tc.Filter{}
+			},
+			running:    true,
+			wantStatus: models.HealthUnhealthy,
+			wantChecks: map[string]bool{healthCheckRunning: true, healthCheckAttach: false},
+		},
+		{
+			name:    "RootAttached",
+			program: "xdp-root",
+			setup: func(b *BPF) {
+				c.kernel.tcFilters[chainTestIface+"/"+models.XDPIngressType] = chainTestRootID
+			},
+			running:    true,
+			wantStatus: models.HealthHealthy,
+			wantChecks: map[string]bool{healthCheckRunning: true, healthCheckAttach: true},
+		},
+		{
+			name:    "HTTPProbe",
+			program: "a",
+			setup: func(b *BPF) {
+				b.Program.LivenessProbe = &models.L3afDNFProbe{HTTPGet: healthy.URL}
+			},
+			running:    true,
+			wantStatus: models.HealthHealthy,
+			wantChecks: map[string]bool{healthCheckRunning: true, healthCheckLinkage: true, healthCheckLiveness: true},
+		},
+		{
+			name:    "HTTPProbeFailed",
+			program: "a",
+			setup: func(b *BPF) {
+				b.Program.LivenessProbe = &models.L3afDNFProbe{HTTPGet: unhealthy.URL}
+			},
+			running:    true,
+			wantStatus: models.HealthUnhealthy,
+			wantChecks: map[string]bool{healthCheckRunning: true, healthCheckLinkage: true, healthCheckLiveness: false},
+		},
+		{
+			name:    "ExecProbeMissing",
+			program: "a",
+			setup: func(b *BPF) {
+				b.Program.LivenessProbe = &models.L3afDNFProbe{Exec: "probe"}
+			},
+			running:    true,
+			wantStatus: models.HealthUnhealthy,
+			wantChecks: map[string]bool{healthCheckRunning: true, healthCheckLinkage: true, healthCheckLiveness: false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := c.element(tt.program)
+			if tt.setup != nil {
+				tt.setup(e.Value.(*BPF))
+			}
+			waitLiveness(t, e.Value.(*BPF))
+			got := checkHealth(e, chainTestIface, models.XDPIngressType, true, tt.running, true, time.Now())
+			if got.Status != tt.wantStatus {
+				t.Errorf("checkHealth() status = %s, want %s %+v", got.Status, tt.wantStatus, got.Checks)
+			}
+			gotChecks := make(map[string]bool)
+			for _, check := range got.Checks {
+				gotChecks[check.Name] = check.Healthy
+			}
+			if len(gotChecks) != len(tt.wantChecks) {
+				t.Errorf("checkHealth() checks = %v, want %v", gotChecks, tt.wantChecks)
+			}
+			for name, healthy := range tt.wantChecks {
+				if h, ok := gotChecks[name]; !ok || h != healthy {
+					t.Errorf("checkHealth() checks = %v, want %v", gotChecks, tt.wantChecks)
+				}
+			}
+		})
+	}
+
+	health := c.cfg.Health()
+	if health.Status != models.HealthUnhealthy {
+		t.Errorf("Health() status = %s, want %s", health.Status, models.HealthUnhealthy)
+	}
+	if len(health.Programs) != 3 {
+		t.Fatalf("Health() programs = %d, want 3", len(health.Programs))
+	}
+	for i, name := range []string{"xdp-root", "a", "b"} {
+		if health.Programs[i].Name != name {
+			t.Errorf("Health() program %d = %s, want %s", i, health.Programs[i].Name, name)
+		}
+	}
+}
+
+// waitLiveness - starts the liveness probe of b if defined and waits for its result
+func waitLiveness(t *testing.T, b *BPF) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := b.checkLiveness(); ok || b.Program.LivenessProbe == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("liveness probe of %s did not complete", b.Program.Name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCheckLivenessAsync(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+	}))
+	defer srv.Close()
+
+	b := &BPF{Program: models.BPFProgram{Name: "slow", LivenessProbe: &models.L3afDNFProbe{HTTPGet: srv.URL}}}
+	for i := 0; i < 100 && requests.Load() == 0; i++ {
+		if check, ok := b.checkLiveness(); ok {
+			t.Fatalf("checkLiveness() = %+v while the probe is in flight, want no result", check)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.checkLiveness()
+	if n := requests.Load(); n != 1 {
+		t.Errorf("probe requests = %d while the probe is in flight, want 1", n)
+	}
+	close(release)
+
+	waitLiveness(t, b)
+	if check, ok := b.checkLiveness(); !ok || !check.Healthy {
+		t.Errorf("checkLiveness() = %+v, %v, want healthy", check, ok)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+// ValidatePackage - checks the package to inspect, its name, version and artifact are used as file names
+func ValidatePackage(pkg models.L3afPackage) error {
+	for _, f := range []struct{ field, value string }{{"name", pkg.Name}, {"version", pkg.Version}, {"artifact", pkg.Artifact}} {
+		if len(f.value) == 0 {
+			return fmt.Errorf("%s is required", f.field)
+		}
+		if strings.Contains(f.value, "..") || strings.ContainsAny(f.value, `/\`) {
+			return fmt.Errorf("%s %q is not a file name", f.field, f.value)
+		}
+	}
+	if len(pkg.EPRURL) > 0 {
+		u, err := url.Parse(pkg.EPRURL)
+		if err != nil {
+			return fmt.Errorf("invalid ebpf_package_repo_url: %v", err)
+		}
+		if u.Scheme != httpScheme && u.Scheme != httpsScheme && u.Scheme != fileScheme {
+			return fmt.Errorf("ebpf_package_repo_url scheme %q is not %s, %s or %s", u.Scheme, httpScheme, httpsScheme, fileScheme)
+		}
+	}
+	return nil
+}
+
+// InspectPackage - downloads the artifact of the package like GetArtifacts does for a program and returns the programs and
+// maps of its object files, nothing is loaded into the kernel. An uploaded artifact is read from upload instead of the
+// repo. The package is extracted into a temporary directory removed afterwards.
+func InspectPackage(ctx context.Context, conf *config.Config, pkg models.L3afPackage, upload io.Reader) (*models.L3afPackageInfo, error) {
+	if err := ValidatePackage(pkg); err != nil {
+		return nil, err
+	}
+
+	tempDir, err := os.MkdirTemp("", "l3afd-inspect-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create inspect directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if upload != nil {
+		repoDir := filepath.Join(tempDir, "upload")
+		if err := saveUpload(repoDir, pkg, upload); err != nil {
+			return nil, err
+		}
+		pkg.EPRURL = (&url.URL{Scheme: fileScheme, Path: filepath.ToSlash(repoDir)}).String()
+	}
+
+	inspectConf := *conf
+	inspectConf.BPFDir = filepath.Join(tempDir, "packages")
+	b := &BPF{Program: models.BPFProgram{Name: pkg.Name, Version: pkg.Version, Artifact: pkg.Artifact, EPRURL: pkg.EPRURL}, hostConfig: &inspectConf}
+	if err := b.GetArtifacts(ctx, &inspectConf); err != nil {
+		return nil, err
+	}
+
+	files, err := objectFiles(b.FilePath, pkg.ObjectFile)
+	if err != nil {
+		return nil, err
+	}
+	info := &models.L3afPackageInfo{Name: pkg.Name, Version: pkg.Version, Artifact: pkg.Artifact, Objects: make([]models.L3afObjectInfo, 0, len(files))}
+	for _, file := range files {
+		spec, err := ebpf.LoadCollectionSpec(filepath.Join(b.FilePath, file))
+		if err != nil {
+			info.Objects = append(info.Objects, models.L3afObjectInfo{File: file, Error: err.Error()})
+			continue
+		}
+		info.Objects = append(info.Objects, describeObject(file, spec, pkg.MapName))
+	}
+	return info, nil
+}
+
+// saveUpload - stores the uploaded artifact at its path in a file repo
+func saveUpload(repoDir string, pkg models.L3afPackage, upload io.Reader) error {
+	platform, err := GetPlatform()
+	if err != nil {
+		return fmt.Errorf("failed to identify platform type: %v", err)
+	}
+	dir := filepath.Join(repoDir, pkg.Name, pkg.Version, platform)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to store the uploaded artifact: %v", err)
+	}
+	f, err := os.Create(filepath.Join(dir, pkg.Artifact))
+	if err != nil {
+		return fmt.Errorf("failed to store the uploaded artifact: %v", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, upload); err != nil {
+		return fmt.Errorf("failed to store the uploaded artifact: %v", err)
+	}
+	return nil
+}
+
+// objectFiles - returns the object file, or else the .o files of the extracted package, relative to its directory
+func objectFiles(dir, objectFile string) ([]string, error) {
+	if len(objectFile) > 0 {
+		if _, err := ValidatePath(objectFile, dir); err != nil {
+			return nil, err
+		}
+		if !fileExists(filepath.Join(dir, objectFile)) {
+			return nil, fmt.Errorf("object file %s is not found in the package", objectFile)
+		}
+		return []string{objectFile}, nil
+	}
+	files := make([]string, 0)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && strings.HasSuffix(d.Name(), ".o") {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the object files of the package: %v", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// describeObject - returns the programs, maps and required kernel features of the object file spec, and whether mapName
+// is a prog array of it
+func describeObject(file string, spec *ebpf.CollectionSpec, mapName string) models.L3afObjectInfo {
+	info := models.L3afObjectInfo{
+		File:     file,
+		BTF:      spec.Types != nil,
+		Programs: make([]models.L3afObjectProgram, 0, len(spec.Programs)),
+		Maps:     make([]models.L3afObjectMap, 0, len(spec.Maps)),
+	}
+	progTypes := make(map[string]bool)
+	mapTypes := make(map[string]bool)
+	helpers := make(map[string]bool)
+
+	for name, prog := range spec.Programs {
+		p := models.L3afObjectProgram{Name: name, Section: prog.SectionName, Type: prog.Type.String(), Instructions: len(prog.Instructions)}
+		if prog.AttachType != ebpf.AttachNone {
+			p.AttachType = prog.AttachType.String()
+		}
+		info.Programs = append(info.Programs, p)
+		if len(info.License) == 0 {
+			info.License = prog.License
+		}
+		progTypes[p.Type] = true
+		for _, ins := range prog.Instructions {
+			if ins.IsBuiltinCall() {
+				helpers[asm.BuiltinFunc(ins.Constant).String()] = true
+			}
+		}
+	}
+	for name, m := range spec.Maps {
+		info.Maps = append(info.Maps, models.L3afObjectMap{
+			Name:       name,
+			Type:       m.Type.String(),
+			KeySize:    m.KeySize,
+			ValueSize:  m.ValueSize,
+			MaxEntries: m.MaxEntries,
+			Flags:      m.Flags,
+			Pinning:    m.Pinning.String(),
+		})
+		mapTypes[m.Type.String()] = true
+	}
+	sort.Slice(info.Programs, func(i, j int) bool { return info.Programs[i].Name < info.Programs[j].Name })
+	sort.Slice(info.Maps, func(i, j int) bool { return info.Maps[i].Name < info.Maps[j].Name })
+	info.RequiredFeatures = models.L3afKernelFeatures{ProgramTypes: sortedKeys(progTypes), MapTypes: sortedKeys(mapTypes), Helpers: sortedKeys(helpers)}
+
+	if len(mapName) > 0 {
+		m, ok := spec.Maps[mapName]
+		info.MapName = &models.L3afObjectMapName{Name: mapName, Exists: ok, ProgArray: ok && m.Type == ebpf.ProgramArray}
+	}
+	return info
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
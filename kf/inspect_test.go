@@ -0,0 +1,174 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+// testPackage - returns a tar.gz artifact extracting into the directory of its name
+func testPackage(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "ratelimiting/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: "ratelimiting/" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDescribeObject(t *testing.T) {
+	spec := &ebpf.CollectionSpec{
+		Programs: map[string]*ebpf.ProgramSpec{
+			"_xdp_ratelimiting": {Type: ebpf.XDP, SectionName: "xdp", License: "Dual BSD/GPL", Instructions: asm.Instructions{
+				asm.FnMapLookupElem.Call(), asm.FnTailCall.Call(), asm.Mov.Imm(asm.R0, 2), asm.Return(),
+			}},
+			"_tc_ratelimiting": {Type: ebpf.SchedCLS, SectionName: "classifier", License: "Dual BSD/GPL", Instructions: asm.Instructions{
+				asm.FnKtimeGetNs.Call(), asm.Return(),
+			}},
+		},
+		Maps: map[string]*ebpf.MapSpec{
+			"xdp_rl_ingress_next_prog": {Type: ebpf.ProgramArray, KeySize: 4, ValueSize: 4, MaxEntries: 1, Pinning: ebpf.PinByName},
+			"rl_ports_map":             {Type: ebpf.Hash, KeySize: 2, ValueSize: 1, MaxEntries: 50},
+		},
+	}
+	tests := []struct {
+		name    string
+		mapName string
+		want    *models.L3afObjectMapName
+	}{
+		{name: "NoMapName"},
+		{name: "ProgArray", mapName: "xdp_rl_ingress_next_prog", want: &models.L3afObjectMapName{Name: "xdp_rl_ingress_next_prog", Exists: true, ProgArray: true}},
+		{name: "NotProgArray", mapName: "rl_ports_map", want: &models.L3afObjectMapName{Name: "rl_ports_map", Exists: true}},
+		{name: "Missing", mapName: "next_prog", want: &models.L3afObjectMapName{Name: "next_prog"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := describeObject("ratelimiting.bpf.o", spec, tt.mapName)
+			if !reflect.DeepEqual(info.MapName, tt.want) {
+				t.Errorf("describeObject() map_name = %+v, want %+v", info.MapName, tt.want)
+			}
+			if info.BTF || info.License != "Dual BSD/GPL" || len(info.Programs) != 2 || info.Programs[0].Name != "_tc_ratelimiting" || info.Programs[1].Section != "xdp" || info.Programs[1].Instructions != 4 {
+				t.Errorf("describeObject() = %+v, want the programs sorted by name", info)
+			}
+			if len(info.Maps) != 2 || info.Maps[0].Name != "rl_ports_map" || info.Maps[1].Type != "ProgramArray" || info.Maps[1].Pinning != "PinByName" {
+				t.Errorf("describeObject() maps = %+v, want the maps sorted by name", info.Maps)
+			}
+			want := models.L3afKernelFeatures{
+				ProgramTypes: []string{"SchedCLS", "XDP"},
+				MapTypes:     []string{"Hash", "ProgramArray"},
+				Helpers:      []string{"FnKtimeGetNs", "FnMapLookupElem", "FnTailCall"},
+			}
+			if !reflect.DeepEqual(info.RequiredFeatures, want) {
+				t.Errorf("describeObject() required features = %+v, want %+v", info.RequiredFeatures, want)
+			}
+		})
+	}
+}
+
+func TestValidatePackage(t *testing.T) {
+	tests := []struct {
+		name    string
+		pkg     models.L3afPackage
+		wantErr string
+	}{
+		{name: "Valid", pkg: models.L3afPackage{Name: "ratelimiting", Version: "1.0", Artifact: "ratelimiting.tar.gz", EPRURL: "https://l3af.io/"}},
+		{name: "NoVersion", pkg: models.L3afPackage{Name: "ratelimiting", Artifact: "ratelimiting.tar.gz"}, wantErr: "version is required"},
+		{name: "RelativeName", pkg: models.L3afPackage{Name: "../etc", Version: "1.0", Artifact: "ratelimiting.tar.gz"}, wantErr: "is not a file name"},
+		{name: "Scheme", pkg: models.L3afPackage{Name: "ratelimiting", Version: "1.0", Artifact: "ratelimiting.tar.gz", EPRURL: "ftp://l3af.io/"}, wantErr: "scheme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePackage(tt.pkg)
+			if (err == nil) != (len(tt.wantErr) == 0) || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ValidatePackage() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInspectPackage(t *testing.T) {
+	execCommand = func(string, ...string) *exec.Cmd { return exec.Command("echo", "focal") }
+	defer func() { execCommand = exec.Command }()
+	platform, err := GetPlatform()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifact := testPackage(t, map[string]string{"ratelimiting.bpf.o": "not an ELF file", "ratelimiting": "#!/bin/sh"})
+	repo := t.TempDir()
+	dir := filepath.Join(repo, "ratelimiting", "1.0", platform)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ratelimiting.tar.gz"), artifact, 0644); err != nil {
+		t.Fatal(err)
+	}
+	repoURL := (&url.URL{Scheme: fileScheme, Path: filepath.ToSlash(repo)}).String()
+
+	tests := []struct {
+		name    string
+		pkg     models.L3afPackage
+		upload  []byte
+		wantErr bool
+	}{
+		{name: "Repo", pkg: models.L3afPackage{Name: "ratelimiting", Version: "1.0", Artifact: "ratelimiting.tar.gz", EPRURL: repoURL}},
+		{name: "Upload", pkg: models.L3afPackage{Name: "ratelimiting", Version: "2.0", Artifact: "ratelimiting.tar.gz", EPRURL: "https://l3af.io/"}, upload: artifact},
+		{name: "ObjectFile", pkg: models.L3afPackage{Name: "ratelimiting", Version: "1.0", Artifact: "ratelimiting.tar.gz", EPRURL: repoURL, ObjectFile: "ratelimiting.bpf.o"}},
+		{name: "MissingObjectFile", pkg: models.L3afPackage{Name: "ratelimiting", Version: "1.0", Artifact: "ratelimiting.tar.gz", EPRURL: repoURL, ObjectFile: "tc.bpf.o"}, wantErr: true},
+		{name: "MissingArtifact", pkg: models.L3afPackage{Name: "ratelimiting", Version: "3.0", Artifact: "ratelimiting.tar.gz", EPRURL: repoURL}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upload io.Reader
+			if tt.upload != nil {
+				upload = bytes.NewReader(tt.upload)
+			}
+			// the BPFDir of the host is not used
+			info, err := InspectPackage(context.Background(), &config.Config{BPFDir: "/nonexistent"}, tt.pkg, upload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InspectPackage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			// the object file is not valid ELF, its parse error is reported with it
+			if len(info.Objects) != 1 || info.Objects[0].File != "ratelimiting.bpf.o" || len(info.Objects[0].Error) == 0 {
+				t.Errorf("InspectPackage() objects = %+v, want the error of ratelimiting.bpf.o", info.Objects)
+			}
+		})
+	}
+}
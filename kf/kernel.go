@@ -0,0 +1,291 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/features"
+	"github.com/cilium/ebpf/link"
+	tc "github.com/florianl/go-tc"
+)
+
+// kernelBackend abstracts the kernel operations performed by BPF and NFConfigs.
+// The default implementation talks to the kernel through cilium/ebpf and go-tc,
+// tests substitute an in-memory implementation so chain manipulation can be
+// exercised without CAP_BPF.
+type kernelBackend interface {
+	// LoadCollection loads all the programs and maps of an object file, CO-RE relocations are resolved
+	// against kernelTypes, the BTF of the running kernel when nil.
+	LoadCollection(objectFile string, kernelTypes *btf.Spec) (*ebpf.Collection, error)
+	// AttachXDP attaches prog to the interface with index ifindex.
+	AttachXDP(prog *ebpf.Program, ifindex int) (link.Link, error)
+	// AttachTC adds a bpf filter running prog on the clsact qdisc of the interface.
+	AttachTC(prog *ebpf.Program, ifaceName, direction string) (*tc.Filter, error)
+	// DetachTC removes the bpf filter running prog from the interface.
+	DetachTC(filter *tc.Filter, prog *ebpf.Program, ifaceName, direction string) error
+	// XDPAttached reports an error if the xdp link is no longer attached to an interface.
+	XDPAttached(xdpLink link.Link) error
+	// TCAttached reports an error if no bpf filter running progID is attached to the interface.
+	TCAttached(ifaceName, direction string, progID ebpf.ProgramID) error
+	// PinMap pins m to fileName in the bpf filesystem.
+	PinMap(m *ebpf.Map, fileName string) error
+	// UnpinMap removes the pin of m from the bpf filesystem.
+	UnpinMap(m *ebpf.Map) error
+	// PinnedMapID returns the ID of the map pinned at pinPath.
+	PinnedMapID(pinPath string) (ebpf.MapID, error)
+	// PinProgArray creates an empty prog array of one entry pinned at pinPath, replacing the map pinned there.
+	PinProgArray(pinPath string) error
+	// ProgArrayUpdate stores the program progID at index 0 of the prog array mapID.
+	ProgArrayUpdate(mapID ebpf.MapID, progID ebpf.ProgramID) error
+	// ProgArrayDelete clears index 0 of the prog array mapID.
+	ProgArrayDelete(mapID ebpf.MapID) error
+	// ProgArrayLookupPinned returns the program ID stored at index 0 of the prog array pinned at pinPath.
+	ProgArrayLookupPinned(pinPath string) (ebpf.ProgramID, error)
+	// MapLookup reads the value stored under key in the map mapID.
+	MapLookup(mapID ebpf.MapID, key, value unsafe.Pointer) error
+	// MapUpdate stores value under key in the map mapID.
+	MapUpdate(mapID ebpf.MapID, key, value unsafe.Pointer) error
+	// MapDelete removes key from the map mapID.
+	MapDelete(mapID ebpf.MapID, key unsafe.Pointer) error
+	// MapIterate decodes every entry of the map mapID into key and value and calls fn for each one.
+	MapIterate(mapID ebpf.MapID, key, value unsafe.Pointer, fn func() error) error
+	// MapExists reports an error if the map mapID can not be found.
+	MapExists(mapID ebpf.MapID) error
+	// ProgramExists reports an error if the program progID can not be found.
+	ProgramExists(progID ebpf.ProgramID) error
+	// HaveProgramType reports an error wrapping ebpf.ErrNotSupported if the kernel can not load programs of type pt.
+	HaveProgramType(pt ebpf.ProgramType) error
+	// HaveMapType reports an error wrapping ebpf.ErrNotSupported if the kernel can not create maps of type mt.
+	HaveMapType(mt ebpf.MapType) error
+	// HaveProgramHelper reports an error wrapping ebpf.ErrNotSupported if programs of type pt can not call helper.
+	HaveProgramHelper(pt ebpf.ProgramType, helper asm.BuiltinFunc) error
+	// HaveKernelType reports an error wrapping ebpf.ErrNotSupported if the BTF of the kernel has no type named name,
+	// an error of its own if the kernel has no BTF.
+	HaveKernelType(name string) error
+	// KernelVersion returns the version of the running kernel.
+	KernelVersion() (string, error)
+}
+
+// defaultKernel is used by BPF and NFConfigs when no backend is injected.
+var defaultKernel kernelBackend = &ebpfKernel{}
+
+// ebpfKernel implements kernelBackend on top of cilium/ebpf and go-tc.
+type ebpfKernel struct{}
+
+func (k *ebpfKernel) LoadCollection(objectFile string, kernelTypes *btf.Spec) (*ebpf.Collection, error) {
+	spec, err := ebpf.LoadCollectionSpec(objectFile)
+	if err != nil {
+		return nil, err
+	}
+	return ebpf.NewCollectionWithOptions(spec, ebpf.CollectionOptions{
+		Programs: ebpf.ProgramOptions{KernelTypes: kernelTypes},
+	})
+}
+
+func (k *ebpfKernel) AttachXDP(prog *ebpf.Program, ifindex int) (link.Link, error) {
+	return link.AttachXDP(link.XDPOptions{
+		Program:   prog,
+		Interface: ifindex,
+	})
+}
+
+func (k *ebpfKernel) XDPAttached(xdpLink link.Link) error {
+	info, err := xdpLink.Info()
+	if err != nil {
+		return fmt.Errorf("fetching xdp link info failed %v", err)
+	}
+	if xdp := info.XDP(); xdp != nil && xdp.Ifindex == 0 {
+		return fmt.Errorf("xdp link %d is detached", info.ID)
+	}
+	return nil
+}
+
+func (k *ebpfKernel) PinMap(m *ebpf.Map, fileName string) error {
+	return m.Pin(fileName)
+}
+
+func (k *ebpfKernel) UnpinMap(m *ebpf.Map) error {
+	return m.Unpin()
+}
+
+func (k *ebpfKernel) PinnedMapID(pinPath string) (ebpf.MapID, error) {
+	ebpfMap, err := ebpf.LoadPinnedMap(pinPath, &ebpf.LoadPinOptions{ReadOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("unable to access pinned map %s %v", pinPath, err)
+	}
+	defer ebpfMap.Close()
+
+	info, err := ebpfMap.Info()
+	if err != nil {
+		return 0, fmt.Errorf("fetching map info failed for %s %v", pinPath, err)
+	}
+	mapID, ok := info.ID()
+	if !ok {
+		return 0, fmt.Errorf("fetching map id failed for %s", pinPath)
+	}
+	return mapID, nil
+}
+
+func (k *ebpfKernel) PinProgArray(pinPath string) error {
+	if err := os.Remove(pinPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to remove pinned map %s %v", pinPath, err)
+	}
+	ebpfMap, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.ProgramArray, KeySize: 4, ValueSize: 4, MaxEntries: 1})
+	if err != nil {
+		return fmt.Errorf("unable to create prog map %s %v", pinPath, err)
+	}
+	defer ebpfMap.Close()
+
+	if err := ebpfMap.Pin(pinPath); err != nil {
+		return fmt.Errorf("unable to pin prog map %s %v", pinPath, err)
+	}
+	return nil
+}
+
+func (k *ebpfKernel) ProgArrayUpdate(mapID ebpf.MapID, progID ebpf.ProgramID) error {
+	ebpfMap, err := ebpf.NewMapFromID(mapID)
+	if err != nil {
+		return fmt.Errorf("unable to access prog map id %d %v", mapID, err)
+	}
+	defer ebpfMap.Close()
+
+	bpfProg, err := ebpf.NewProgramFromID(progID)
+	if err != nil {
+		return fmt.Errorf("failed to get prog FD from ID %d %v", progID, err)
+	}
+	defer bpfProg.Close()
+
+	key := 0
+	fd := bpfProg.FD()
+	if err = ebpfMap.Update(unsafe.Pointer(&key), unsafe.Pointer(&fd), 0); err != nil {
+		return fmt.Errorf("unable to update prog map id %d %v", mapID, err)
+	}
+	return nil
+}
+
+func (k *ebpfKernel) ProgArrayDelete(mapID ebpf.MapID) error {
+	ebpfMap, err := ebpf.NewMapFromID(mapID)
+	if err != nil {
+		return fmt.Errorf("unable to access prog map id %d %v", mapID, err)
+	}
+	defer ebpfMap.Close()
+
+	key := 0
+	return ebpfMap.Delete(unsafe.Pointer(&key))
+}
+
+func (k *ebpfKernel) ProgArrayLookupPinned(pinPath string) (ebpf.ProgramID, error) {
+	ebpfMap, err := ebpf.LoadPinnedMap(pinPath, &ebpf.LoadPinOptions{ReadOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("unable to access pinned prog map %s %v", pinPath, err)
+	}
+	defer ebpfMap.Close()
+
+	var value ebpf.ProgramID
+	key := 0
+	if err = ebpfMap.Lookup(unsafe.Pointer(&key), unsafe.Pointer(&value)); err != nil {
+		return 0, fmt.Errorf("unable to look up prog map %v", err)
+	}
+	return value, nil
+}
+
+func (k *ebpfKernel) MapLookup(mapID ebpf.MapID, key, value unsafe.Pointer) error {
+	ebpfMap, err := ebpf.NewMapFromID(mapID)
+	if err != nil {
+		return fmt.Errorf("access new map from ID failed %v", err)
+	}
+	defer ebpfMap.Close()
+	return ebpfMap.Lookup(key, value)
+}
+
+func (k *ebpfKernel) MapUpdate(mapID ebpf.MapID, key, value unsafe.Pointer) error {
+	ebpfMap, err := ebpf.NewMapFromID(mapID)
+	if err != nil {
+		return fmt.Errorf("access new map from ID failed %v", err)
+	}
+	defer ebpfMap.Close()
+	return ebpfMap.Update(key, value, 0)
+}
+
+func (k *ebpfKernel) MapDelete(mapID ebpf.MapID, key unsafe.Pointer) error {
+	ebpfMap, err := ebpf.NewMapFromID(mapID)
+	if err != nil {
+		return fmt.Errorf("access new map from ID failed %v", err)
+	}
+	defer ebpfMap.Close()
+	return ebpfMap.Delete(key)
+}
+
+func (k *ebpfKernel) MapIterate(mapID ebpf.MapID, key, value unsafe.Pointer, fn func() error) error {
+	ebpfMap, err := ebpf.NewMapFromID(mapID)
+	if err != nil {
+		return fmt.Errorf("access new map from ID failed %v", err)
+	}
+	defer ebpfMap.Close()
+
+	entries := ebpfMap.Iterate()
+	for entries.Next(key, value) {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return entries.Err()
+}
+
+func (k *ebpfKernel) MapExists(mapID ebpf.MapID) error {
+	ebpfMap, err := ebpf.NewMapFromID(mapID)
+	if err != nil {
+		return err
+	}
+	return ebpfMap.Close()
+}
+
+func (k *ebpfKernel) ProgramExists(progID ebpf.ProgramID) error {
+	ebpfProg, err := ebpf.NewProgramFromID(progID)
+	if err != nil {
+		return err
+	}
+	return ebpfProg.Close()
+}
+
+func (k *ebpfKernel) HaveProgramType(pt ebpf.ProgramType) error {
+	return features.HaveProgramType(pt)
+}
+
+func (k *ebpfKernel) HaveMapType(mt ebpf.MapType) error {
+	return features.HaveMapType(mt)
+}
+
+func (k *ebpfKernel) HaveProgramHelper(pt ebpf.ProgramType, helper asm.BuiltinFunc) error {
+	return features.HaveProgramHelper(pt, helper)
+}
+
+func (k *ebpfKernel) HaveKernelType(name string) error {
+	spec, err := btf.LoadKernelSpec()
+	if err != nil {
+		return fmt.Errorf("kernel BTF is not available: %v", err)
+	}
+	if _, err := spec.AnyTypeByName(name); err != nil {
+		if errors.Is(err, btf.ErrNotFound) {
+			return fmt.Errorf("kernel type %s: %w", name, ebpf.ErrNotSupported)
+		}
+		return err
+	}
+	return nil
+}
+
+func (k *ebpfKernel) KernelVersion() (string, error) {
+	code, err := features.LinuxVersionCode()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%d.%d", code>>16, code>>8&0xff, code&0xff), nil
+}
@@ -0,0 +1,644 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/link"
+	tc "github.com/florianl/go-tc"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+// fakeMap is an in-memory bpf map storing raw key and value bytes
+type fakeMap struct {
+	keySize   int
+	valueSize int
+	entries   map[string][]byte
+}
+
+// fakeKernel is an in-memory kernelBackend used to exercise chaining without CAP_BPF
+type fakeKernel struct {
+	progs      map[ebpf.ProgramID]bool
+	tcFilters  map[string]ebpf.ProgramID
+	progArrays map[ebpf.MapID]ebpf.ProgramID
+	pinned     map[string]ebpf.MapID
+	maps       map[ebpf.MapID]*fakeMap
+
+	// program IDs which user programs insert into their previous program map once started
+	pending []ebpf.ProgramID
+
+	// names of the program types, map types, helpers and kernel types the kernel does not support
+	unsupported map[string]bool
+	noBTF       bool
+	// kernel release, 6.1.0 when empty
+	version string
+	// ID of the next prog array created by PinProgArray
+	nextMapID ebpf.MapID
+}
+
+func newFakeKernel() *fakeKernel {
+	return &fakeKernel{
+		progs:       make(map[ebpf.ProgramID]bool),
+		tcFilters:   make(map[string]ebpf.ProgramID),
+		progArrays:  make(map[ebpf.MapID]ebpf.ProgramID),
+		pinned:      make(map[string]ebpf.MapID),
+		maps:        make(map[ebpf.MapID]*fakeMap),
+		unsupported: make(map[string]bool),
+	}
+}
+
+func (k *fakeKernel) LoadCollection(objectFile string, kernelTypes *btf.Spec) (*ebpf.Collection, error) {
+	return nil, fmt.Errorf("fake kernel can not load %s", objectFile)
+}
+
+func (k *fakeKernel) AttachXDP(prog *ebpf.Program, ifindex int) (link.Link, error) {
+	return nil, fmt.Errorf("fake kernel can not attach xdp programs")
+}
+
+func (k *fakeKernel) AttachTC(prog *ebpf.Program, ifaceName, direction string) (*tc.Filter, error) {
+	return nil, fmt.Errorf("fake kernel can not attach tc programs")
+}
+
+func (k *fakeKernel) DetachTC(filter *tc.Filter, prog *ebpf.Program, ifaceName, direction string) error {
+	return fmt.Errorf("fake kernel can not detach tc programs")
+}
+
+func (k *fakeKernel) XDPAttached(xdpLink link.Link) error {
+	return fmt.Errorf("fake kernel has no xdp links")
+}
+
+func (k *fakeKernel) TCAttached(ifaceName, direction string, progID ebpf.ProgramID) error {
+	if k.tcFilters[ifaceName+"/"+direction] != progID {
+		return fmt.Errorf("no tc filter of program id %d found on interface %s direction %s", progID, ifaceName, direction)
+	}
+	return nil
+}
+
+func (k *fakeKernel) PinMap(m *ebpf.Map, fileName string) error {
+	return fmt.Errorf("fake kernel can not pin maps")
+}
+
+func (k *fakeKernel) UnpinMap(m *ebpf.Map) error {
+	return fmt.Errorf("fake kernel can not unpin maps")
+}
+
+func (k *fakeKernel) PinnedMapID(pinPath string) (ebpf.MapID, error) {
+	mapID, ok := k.pinned[pinPath]
+	if !ok {
+		return 0, os.ErrNotExist
+	}
+	return mapID, nil
+}
+
+func (k *fakeKernel) ProgArrayUpdate(mapID ebpf.MapID, progID ebpf.ProgramID) error {
+	if _, ok := k.progArrays[mapID]; !ok {
+		return fmt.Errorf("unable to access prog map id %d", mapID)
+	}
+	if !k.progs[progID] {
+		return fmt.Errorf("failed to get prog FD from ID %d", progID)
+	}
+	k.progArrays[mapID] = progID
+	return nil
+}
+
+func (k *fakeKernel) ProgArrayDelete(mapID ebpf.MapID) error {
+	progID, ok := k.progArrays[mapID]
+	if !ok {
+		return fmt.Errorf("unable to access prog map id %d", mapID)
+	}
+	if progID == 0 {
+		return ebpf.ErrKeyNotExist
+	}
+	k.progArrays[mapID] = 0
+	return nil
+}
+
+func (k *fakeKernel) ProgArrayLookupPinned(pinPath string) (ebpf.ProgramID, error) {
+	mapID, ok := k.pinned[pinPath]
+	if !ok {
+		return 0, fmt.Errorf("unable to access pinned prog map %s", pinPath)
+	}
+	// user program inserts itself into the previous program map when started
+	if k.progArrays[mapID] == 0 && len(k.pending) > 0 {
+		k.progArrays[mapID] = k.pending[0]
+		k.pending = k.pending[1:]
+	}
+	if k.progArrays[mapID] == 0 {
+		return 0, ebpf.ErrKeyNotExist
+	}
+	return k.progArrays[mapID], nil
+}
+
+func (k *fakeKernel) PinProgArray(pinPath string) error {
+	if k.nextMapID == 0 {
+		k.nextMapID = 1000
+	}
+	if mapID, ok := k.pinned[pinPath]; ok {
+		delete(k.progArrays, mapID)
+	}
+	if err := os.WriteFile(pinPath, nil, 0600); err != nil {
+		return err
+	}
+	k.pinned[pinPath] = k.nextMapID
+	k.progArrays[k.nextMapID] = 0
+	k.nextMapID++
+	return nil
+}
+
+func (k *fakeKernel) lookupMap(mapID ebpf.MapID) (*fakeMap, error) {
+	m, ok := k.maps[mapID]
+	if !ok {
+		return nil, fmt.Errorf("map id %d: %w", mapID, os.ErrNotExist)
+	}
+	return m, nil
+}
+
+func (k *fakeKernel) MapLookup(mapID ebpf.MapID, key, value unsafe.Pointer) error {
+	m, err := k.lookupMap(mapID)
+	if err != nil {
+		return err
+	}
+	val, ok := m.entries[string(unsafe.Slice((*byte)(key), m.keySize))]
+	if !ok {
+		return ebpf.ErrKeyNotExist
+	}
+	copy(unsafe.Slice((*byte)(value), m.valueSize), val)
+	return nil
+}
+
+func (k *fakeKernel) MapUpdate(mapID ebpf.MapID, key, value unsafe.Pointer) error {
+	m, err := k.lookupMap(mapID)
+	if err != nil {
+		return err
+	}
+	m.entries[string(unsafe.Slice((*byte)(key), m.keySize))] = append([]byte(nil), unsafe.Slice((*byte)(value), m.valueSize)...)
+	return nil
+}
+
+func (k *fakeKernel) MapDelete(mapID ebpf.MapID, key unsafe.Pointer) error {
+	m, err := k.lookupMap(mapID)
+	if err != nil {
+		return err
+	}
+	keyBytes := string(unsafe.Slice((*byte)(key), m.keySize))
+	if _, ok := m.entries[keyBytes]; !ok {
+		return ebpf.ErrKeyNotExist
+	}
+	delete(m.entries, keyBytes)
+	return nil
+}
+
+func (k *fakeKernel) MapIterate(mapID ebpf.MapID, key, value unsafe.Pointer, fn func() error) error {
+	m, err := k.lookupMap(mapID)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(m.entries))
+	for keyBytes := range m.entries {
+		keys = append(keys, keyBytes)
+	}
+	sort.Strings(keys)
+	for _, keyBytes := range keys {
+		copy(unsafe.Slice((*byte)(key), m.keySize), keyBytes)
+		copy(unsafe.Slice((*byte)(value), m.valueSize), m.entries[keyBytes])
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k *fakeKernel) MapExists(mapID ebpf.MapID) error {
+	_, err := k.lookupMap(mapID)
+	return err
+}
+
+func (k *fakeKernel) ProgramExists(progID ebpf.ProgramID) error {
+	if !k.progs[progID] {
+		return fmt.Errorf("program id %d: %w", progID, os.ErrNotExist)
+	}
+	return nil
+}
+
+func (k *fakeKernel) supported(name string) error {
+	if k.unsupported[name] {
+		return fmt.Errorf("%s: %w", name, ebpf.ErrNotSupported)
+	}
+	return nil
+}
+
+func (k *fakeKernel) HaveProgramType(pt ebpf.ProgramType) error {
+	return k.supported(pt.String())
+}
+
+func (k *fakeKernel) HaveMapType(mt ebpf.MapType) error {
+	return k.supported(mt.String())
+}
+
+func (k *fakeKernel) HaveProgramHelper(pt ebpf.ProgramType, helper asm.BuiltinFunc) error {
+	if err := k.supported(pt.String()); err != nil {
+		return err
+	}
+	return k.supported(helper.String())
+}
+
+func (k *fakeKernel) HaveKernelType(name string) error {
+	if k.noBTF {
+		return fmt.Errorf("kernel BTF is not available")
+	}
+	return k.supported(name)
+}
+
+func (k *fakeKernel) KernelVersion() (string, error) {
+	if len(k.version) > 0 {
+		return k.version, nil
+	}
+	return "6.1.0", nil
+}
+
+// chainTest holds a fake root program and the user programs chained behind it
+type chainTest struct {
+	t       *testing.T
+	kernel  *fakeKernel
+	cfg     *NFConfigs
+	bpfList *list.List
+}
+
+const (
+	chainTestIface     = "fakeif0"
+	chainTestRootMap   = "xdp_root_array"
+	chainTestRootID    = ebpf.ProgramID(10)
+	chainTestRootMapID = ebpf.MapID(100)
+)
+
+func newChainTest(t *testing.T) *chainTest {
+	dir := t.TempDir()
+	conf := &config.Config{
+		BPFDir:             filepath.Join(dir, "bpf"),
+		BpfMapDefaultPath:  filepath.Join(dir, "maps"),
+		BpfChainingEnabled: true,
+	}
+	if err := os.MkdirAll(filepath.Join(conf.BpfMapDefaultPath, chainTestIface), 0750); err != nil {
+		t.Fatalf("failed to create map dir %v", err)
+	}
+
+	kernel := newFakeKernel()
+	root := &BPF{
+		Program: models.BPFProgram{
+			Name:     "xdp-root",
+			MapName:  chainTestRootMap,
+			ProgType: models.XDPType,
+		},
+		MapNamePath: filepath.Join(conf.BpfMapDefaultPath, chainTestIface, chainTestRootMap),
+		ProgID:      chainTestRootID,
+		ProgMapID:   chainTestRootMapID,
+		hostConfig:  conf,
+		backend:     kernel,
+	}
+	kernel.progs[chainTestRootID] = true
+	kernel.progArrays[chainTestRootMapID] = 0
+	kernel.pinned[root.MapNamePath] = chainTestRootMapID
+
+	bpfList := list.New()
+	bpfList.PushBack(root)
+	cfg := &NFConfigs{
+		ctx:            context.Background(),
+		HostConfig:     conf,
+		IngressXDPBpfs: map[string]*list.List{chainTestIface: bpfList},
+		IngressTCBpfs:  make(map[string]*list.List),
+		EgressTCBpfs:   make(map[string]*list.List),
+		backend:        kernel,
+	}
+	return &chainTest{t: t, kernel: kernel, cfg: cfg, bpfList: bpfList}
+}
+
+// program prepares the artifacts, pinned prog map and kernel program of a user program
+func (c *chainTest) program(name string, seqID int, progID ebpf.ProgramID, mapID ebpf.MapID) *models.BPFProgram {
+	prog := &models.BPFProgram{
+		Name:        name,
+		SeqID:       seqID,
+		Artifact:    name + ".tar.gz",
+		MapName:     name + "_array",
+		Version:     "1.0",
+		AdminStatus: models.Enabled,
+		ProgType:    models.XDPType,
+	}
+	if err := os.MkdirAll(filepath.Join(c.cfg.HostConfig.BPFDir, name, prog.Version, name), 0750); err != nil {
+		c.t.Fatalf("failed to create artifact dir %v", err)
+	}
+	mapPath := filepath.Join(c.cfg.HostConfig.BpfMapDefaultPath, chainTestIface, prog.MapName)
+	if err := os.WriteFile(mapPath, nil, 0600); err != nil {
+		c.t.Fatalf("failed to create pinned map file %v", err)
+	}
+	c.kernel.progs[progID] = true
+	c.kernel.progArrays[mapID] = 0
+	c.kernel.pinned[mapPath] = mapID
+	c.kernel.pending = append(c.kernel.pending, progID)
+	return prog
+}
+
+// element returns the list element of the program name
+func (c *chainTest) element(name string) *list.Element {
+	for e := c.bpfList.Front(); e != nil; e = e.Next() {
+		if e.Value.(*BPF).Program.Name == name {
+			return e
+		}
+	}
+	c.t.Fatalf("program %s not found in the chain", name)
+	return nil
+}
+
+// order returns the program names of the chain starting from the root program
+func (c *chainTest) order() []string {
+	var names []string
+	for e := c.bpfList.Front(); e != nil; e = e.Next() {
+		names = append(names, e.Value.(*BPF).Program.Name)
+	}
+	return names
+}
+
+func TestChainInsertMoveDelete(t *testing.T) {
+	c := newChainTest(t)
+
+	for _, p := range []struct {
+		name   string
+		seqID  int
+		progID ebpf.ProgramID
+		mapID  ebpf.MapID
+	}{
+		{name: "a", seqID: 1, progID: 11, mapID: 101},
+		{name: "c", seqID: 3, progID: 13, mapID: 103},
+		{name: "b", seqID: 2, progID: 12, mapID: 102},
+	} {
+		prog := c.program(p.name, p.seqID, p.progID, p.mapID)
+		if err := c.cfg.InsertAndStartBPFProgram(context.Background(), prog, chainTestIface, models.XDPIngressType); err != nil {
+			t.Fatalf("InsertAndStartBPFProgram(%s) error = %v", p.name, err)
+		}
+	}
+
+	if got, want := c.order(), []string{"xdp-root", "a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chain order after insert = %v, want %v", got, want)
+	}
+	want := map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 12, 102: 13, 103: 0}
+	if !reflect.DeepEqual(c.kernel.progArrays, want) {
+		t.Errorf("prog arrays after insert = %v, want %v", c.kernel.progArrays, want)
+	}
+
+	// moving b to the end of the chain
+	b := c.element("b")
+	b.Value.(*BPF).Program.SeqID = 4
+	if err := c.cfg.MoveToLocation(b, c.bpfList); err != nil {
+		t.Fatalf("MoveToLocation() error = %v", err)
+	}
+	if got, want := c.order(), []string{"xdp-root", "a", "c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chain order after move = %v, want %v", got, want)
+	}
+	want = map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 13, 102: 0, 103: 12}
+	if !reflect.DeepEqual(c.kernel.progArrays, want) {
+		t.Errorf("prog arrays after move = %v, want %v", c.kernel.progArrays, want)
+	}
+
+	// deleting a, its user program removes the pinned map on exit
+	a := c.element("a")
+	if err := os.Remove(a.Value.(*BPF).MapNamePath); err != nil {
+		t.Fatalf("failed to remove pinned map file %v", err)
+	}
+	delete(c.kernel.progArrays, 101)
+	delete(c.kernel.progs, 11)
+	if err := c.cfg.DeleteProgramsOnInterfaceHelper(context.Background(), a, chainTestIface, models.XDPIngressType, c.bpfList); err != nil {
+		t.Fatalf("DeleteProgramsOnInterfaceHelper() error = %v", err)
+	}
+	if got, want := c.order(), []string{"xdp-root", "c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chain order after delete = %v, want %v", got, want)
+	}
+	want = map[ebpf.MapID]ebpf.ProgramID{100: 13, 102: 0, 103: 12}
+	if !reflect.DeepEqual(c.kernel.progArrays, want) {
+		t.Errorf("prog arrays after delete = %v, want %v", c.kernel.progArrays, want)
+	}
+}
+
+func TestChainUpgrade(t *testing.T) {
+	c := newChainTest(t)
+
+	progs := map[string]*models.BPFProgram{}
+	for _, p := range []struct {
+		name   string
+		seqID  int
+		progID ebpf.ProgramID
+		mapID  ebpf.MapID
+	}{
+		{name: "a", seqID: 1, progID: 11, mapID: 101},
+		{name: "b", seqID: 2, progID: 12, mapID: 102},
+		{name: "c", seqID: 3, progID: 13, mapID: 103},
+	} {
+		progs[p.name] = c.program(p.name, p.seqID, p.progID, p.mapID)
+		if err := c.cfg.InsertAndStartBPFProgram(context.Background(), progs[p.name], chainTestIface, models.XDPIngressType); err != nil {
+			t.Fatalf("InsertAndStartBPFProgram(%s) error = %v", p.name, err)
+		}
+	}
+
+	// upgrading b, the old user program removes its pinned map on exit, the new one loads program 22 and pins
+	// the map again
+	b := c.element("b").Value.(*BPF)
+	if err := os.Remove(b.MapNamePath); err != nil {
+		t.Fatalf("failed to remove pinned map file %v", err)
+	}
+	upgraded := *progs["b"]
+	upgraded.Version = "1.1"
+	upgraded.CmdStart = "b_start"
+	dir := filepath.Join(c.cfg.HostConfig.BPFDir, "b", upgraded.Version, "b")
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		t.Fatalf("failed to create artifact dir %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, upgraded.CmdStart), []byte("#!/bin/sh\n: > "+b.MapNamePath+"\n"), 0755); err != nil {
+		t.Fatalf("failed to create user program %v", err)
+	}
+	delete(c.kernel.progs, 12)
+	c.kernel.progs[22] = true
+	c.kernel.progArrays[102] = 0
+	c.kernel.pending = append(c.kernel.pending, 22)
+	if err := c.cfg.VerifyNUpdateBPFProgram(context.Background(), &upgraded, chainTestIface, models.XDPIngressType); err != nil {
+		t.Fatalf("VerifyNUpdateBPFProgram() error = %v", err)
+	}
+
+	if got, want := c.order(), []string{"xdp-root", "a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chain order after upgrade = %v, want %v", got, want)
+	}
+	if b.ProgID != 22 || b.Program.Version != "1.1" {
+		t.Errorf("upgraded program id = %d version = %s, want 22 and 1.1", b.ProgID, b.Program.Version)
+	}
+	want := map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 22, 102: 13, 103: 0}
+	if !reflect.DeepEqual(c.kernel.progArrays, want) {
+		t.Errorf("prog arrays after upgrade = %v, want %v", c.kernel.progArrays, want)
+	}
+}
+
+// chainLinkTest returns b chained after a in the prog arrays 100 (root) -> 101 (a) -> 102 (b), b runs program 12
+// and its next program is 13
+func chainLinkTest() (*fakeKernel, *BPF, *BPF) {
+	kernel := newFakeKernel()
+	for _, id := range []ebpf.ProgramID{11, 12, 13} {
+		kernel.progs[id] = true
+	}
+	kernel.progArrays = map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 12, 102: 13}
+	a := &BPF{Program: models.BPFProgram{Name: "a", MapName: "a_array"}, MapNamePath: "a_array", ProgID: 11, ProgMapID: 101, PrevProgMapID: 100, backend: kernel}
+	b := &BPF{Program: models.BPFProgram{Name: "b", MapName: "b_array"}, MapNamePath: "b_array", ProgID: 12, ProgMapID: 102, PrevProgMapID: 101, backend: kernel}
+	return kernel, a, b
+}
+
+// TestRemoveNextProgFD - the entry of the own prog map of the program is removed, it used to be the entry of the
+// previous program's map unlinking the program itself
+func TestRemoveNextProgFD(t *testing.T) {
+	kernel, _, b := chainLinkTest()
+	if err := b.RemoveNextProgFD(); err != nil {
+		t.Fatalf("RemoveNextProgFD() error = %v", err)
+	}
+	want := map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 12, 102: 0}
+	if !reflect.DeepEqual(kernel.progArrays, want) {
+		t.Errorf("prog arrays = %v, want %v", kernel.progArrays, want)
+	}
+	// an empty entry is not an error
+	if err := b.RemoveNextProgFD(); err != nil {
+		t.Errorf("RemoveNextProgFD() of an empty entry error = %v", err)
+	}
+}
+
+// TestRemovePrevProgFD - a previous prog map that can not be updated is an error, only an empty entry used to be
+// ignored together with every other failure
+func TestRemovePrevProgFD(t *testing.T) {
+	kernel, _, b := chainLinkTest()
+	if err := b.RemovePrevProgFD(); err != nil {
+		t.Fatalf("RemovePrevProgFD() error = %v", err)
+	}
+	want := map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 0, 102: 13}
+	if !reflect.DeepEqual(kernel.progArrays, want) {
+		t.Errorf("prog arrays = %v, want %v", kernel.progArrays, want)
+	}
+	if err := b.RemovePrevProgFD(); err != nil {
+		t.Errorf("RemovePrevProgFD() of an empty entry error = %v", err)
+	}
+	delete(kernel.progArrays, 101)
+	if err := b.RemovePrevProgFD(); err == nil {
+		t.Errorf("RemovePrevProgFD() of a missing map succeeded")
+	}
+}
+
+// TestLinkBPFPrograms - the right program is linked through the prog map of the left program, it used to get the
+// previous prog map of the left program as its own previous map
+func TestLinkBPFPrograms(t *testing.T) {
+	kernel, a, _ := chainLinkTest()
+	kernel.progs[22] = true
+	right := &BPF{Program: models.BPFProgram{Name: "d", MapName: "d_array"}, ProgID: 22, backend: kernel}
+	if err := linkBPFPrograms(a, right); err != nil {
+		t.Fatalf("linkBPFPrograms() error = %v", err)
+	}
+	if right.PrevProgMapID != a.ProgMapID || right.PrevMapNamePath != a.MapNamePath {
+		t.Errorf("previous prog map = %d %s, want %d %s", right.PrevProgMapID, right.PrevMapNamePath, a.ProgMapID, a.MapNamePath)
+	}
+	want := map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 22, 102: 13}
+	if !reflect.DeepEqual(kernel.progArrays, want) {
+		t.Errorf("prog arrays = %v, want %v", kernel.progArrays, want)
+	}
+	// unlinking the right program clears the entry of the left program, not the root's
+	if err := right.RemovePrevProgFD(); err != nil {
+		t.Fatalf("RemovePrevProgFD() error = %v", err)
+	}
+	if kernel.progArrays[100] != 11 || kernel.progArrays[101] != 0 {
+		t.Errorf("prog arrays after unlink = %v, want 100: 11 and 101: 0", kernel.progArrays)
+	}
+}
+
+func TestBPFMapUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapType ebpf.MapType
+		initial map[int64]int64
+		value   string
+		want    map[int64]int64
+		wantErr bool
+	}{
+		{
+			name:    "array",
+			mapType: ebpf.Array,
+			initial: map[int64]int64{0: 5, 1: 6, 2: 7},
+			value:   "80,443",
+			want:    map[int64]int64{0: 80, 1: 443, 2: 7},
+		},
+		{
+			name:    "hash",
+			mapType: ebpf.Hash,
+			initial: map[int64]int64{22: 1, 80: 1},
+			value:   "80,443",
+			want:    map[int64]int64{80: 1, 443: 1},
+		},
+		{
+			name:    "unsupported",
+			mapType: ebpf.LRUHash,
+			initial: map[int64]int64{},
+			value:   "80",
+			want:    map[int64]int64{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kernel := newFakeKernel()
+			m := &fakeMap{keySize: 8, valueSize: 8, entries: make(map[string][]byte)}
+			kernel.maps[1] = m
+			for k, v := range tt.initial {
+				if err := kernel.MapUpdate(1, unsafe.Pointer(&k), unsafe.Pointer(&v)); err != nil {
+					t.Fatalf("failed to set up map %v", err)
+				}
+			}
+
+			bpfMap := &BPFMap{
+				Name:    "test_map",
+				MapID:   1,
+				Type:    tt.mapType,
+				BPFProg: &BPF{backend: kernel},
+			}
+			if err := bpfMap.Update(tt.value); (err != nil) != tt.wantErr {
+				t.Fatalf("Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			got := make(map[int64]int64)
+			var key, val int64
+			if err := kernel.MapIterate(1, unsafe.Pointer(&key), unsafe.Pointer(&val), func() error {
+				got[key] = val
+				return nil
+			}); err != nil {
+				t.Fatalf("failed to iterate map %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Update() map = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPFMapUpdateMissingMap(t *testing.T) {
+	bpfMap := &BPFMap{
+		Name:    "test_map",
+		MapID:   1,
+		Type:    ebpf.Array,
+		BPFProg: &BPF{backend: newFakeKernel()},
+	}
+	if err := bpfMap.Update("1"); err == nil {
+		t.Errorf("Update() error = nil, want missing map error")
+	}
+}
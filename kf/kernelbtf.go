@@ -0,0 +1,218 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+	"github.com/ulikunitz/xz"
+)
+
+// badRelocation - helper call cilium/ebpf replaces the instructions of unresolved CO-RE relocations with, like libbpf
+const badRelocation = 0xbad2310
+
+// osReleaseFile - kernel release the BTF of btf-dir is looked up by
+var osReleaseFile = "/proc/sys/kernel/osrelease"
+
+// btfArchiveSuffix - suffix of the compressed BTF files of a BTFHub archive
+const btfArchiveSuffix = ".tar.xz"
+
+// btfDirCache - BTF of the kernel release loaded from btf-dir, it is the same for every program
+var btfDirCache struct {
+	sync.Mutex
+	dir     string
+	release string
+	path    string
+	spec    *btf.Spec
+}
+
+// kernelTypes - returns the BTF the CO-RE relocations of the program are resolved against and where it is from. The
+// btf_file of the package takes precedence over the BTF of the running kernel, the btf-dir of the host is used for
+// kernels without BTF. A nil spec stands for the BTF of the running kernel.
+func (b *BPF) kernelTypes() (*btf.Spec, string, error) {
+	if len(b.Program.BTFFile) > 0 {
+		path, err := ValidatePath(b.Program.BTFFile, b.FilePath)
+		if err != nil {
+			return nil, "", err
+		}
+		spec, err := btf.LoadSpec(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load btf_file %s: %v", b.Program.BTFFile, err)
+		}
+		return spec, "btf_file " + b.Program.BTFFile, nil
+	}
+
+	// every kernel with BTF has the type int
+	if b.hostConfig == nil || len(b.hostConfig.BTFDir) == 0 || b.kernel().HaveKernelType("int") == nil {
+		return nil, "the kernel BTF", nil
+	}
+	release, err := os.ReadFile(osReleaseFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read the kernel release: %v", err)
+	}
+	kernelRelease := strings.TrimSpace(string(release))
+
+	btfDirCache.Lock()
+	defer btfDirCache.Unlock()
+	if btfDirCache.spec != nil && btfDirCache.dir == b.hostConfig.BTFDir && btfDirCache.release == kernelRelease {
+		return btfDirCache.spec, btfDirCache.path, nil
+	}
+
+	path, err := findKernelBTF(b.hostConfig.BTFDir, kernelRelease)
+	if err != nil {
+		return nil, "", err
+	}
+	spec, err := loadKernelBTF(path, kernelRelease)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load the kernel BTF %s: %v", path, err)
+	}
+	btfDirCache.dir, btfDirCache.release, btfDirCache.path, btfDirCache.spec = b.hostConfig.BTFDir, kernelRelease, path, spec
+	return spec, path, nil
+}
+
+// findKernelBTF - returns the BTF file of the kernel release in dir, <dir>/<release>.btf or one in the
+// <id>/<version>/<arch> subdirectories of a BTFHub archive. The <release>.btf.tar.xz files of BTFHub are
+// found as well, an extracted <release>.btf in the same directory takes precedence.
+func findKernelBTF(dir, release string) (string, error) {
+	name := release + ".btf"
+	for _, path := range []string{filepath.Join(dir, name), filepath.Join(dir, name+btfArchiveSuffix)} {
+		if fileExists(path) {
+			return path, nil
+		}
+	}
+
+	errFound := errors.New("found")
+	path := ""
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		switch d.Name() {
+		case name:
+			// an extracted file takes precedence over the archives
+			path = p
+			return errFound
+		case name + btfArchiveSuffix:
+			if len(path) == 0 {
+				path = p
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errFound) || (err == nil && len(path) > 0) {
+		return path, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up the BTF of kernel %s in %s: %v", release, dir, err)
+	}
+	return "", fmt.Errorf("no BTF of kernel %s found in %s", release, dir)
+}
+
+// loadKernelBTF - loads the BTF of the kernel release from path, a <release>.btf file or its BTFHub
+// <release>.btf.tar.xz archive
+func loadKernelBTF(path, release string) (*btf.Spec, error) {
+	if !strings.HasSuffix(path, btfArchiveSuffix) {
+		return btf.LoadSpec(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	xzr, err := xz.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read xz archive: %v", err)
+	}
+	tr := tar.NewReader(xzr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("no %s.btf in the archive", release)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || filepath.Base(hdr.Name) != release+".btf" {
+			continue
+		}
+		buf, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %v", hdr.Name, err)
+		}
+		return btf.LoadSpecFromReader(bytes.NewReader(buf))
+	}
+}
+
+// unresolvedRelocations - returns the CO-RE relocations of the programs in spec which can not be resolved against
+// kernelTypes, the BTF of the running kernel when nil
+func unresolvedRelocations(spec *ebpf.CollectionSpec, kernelTypes *btf.Spec) ([]string, error) {
+	names := make([]string, 0, len(spec.Programs))
+	for name := range spec.Programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	unresolved := make([]string, 0)
+	for _, name := range names {
+		var relos []*btf.CORERelocation
+		var reloInsns []asm.Instruction
+		for _, ins := range spec.Programs[name].Instructions {
+			if relo := btf.CORERelocationMetadata(&ins); relo != nil {
+				relos = append(relos, relo)
+				reloInsns = append(reloInsns, ins)
+			}
+		}
+		if len(relos) == 0 {
+			continue
+		}
+
+		fixups, err := btf.CORERelocate(relos, kernelTypes, spec.ByteOrder)
+		if err != nil {
+			return nil, fmt.Errorf("program %s: %v", name, err)
+		}
+		for i, fixup := range fixups {
+			// the instruction is a copy, applying the fixup tells whether the relocation is poisoned
+			if err := fixup.Apply(&reloInsns[i]); err != nil {
+				unresolved = append(unresolved, fmt.Sprintf("%s: %s: %v", name, relos[i], err))
+			} else if reloInsns[i].IsBuiltinCall() && reloInsns[i].Constant == badRelocation {
+				unresolved = append(unresolved, fmt.Sprintf("%s: %s", name, relos[i]))
+			}
+		}
+	}
+	return unresolved, nil
+}
+
+// loadError - returns the error loading the object file, listing the CO-RE relocations not resolved against the
+// kernel types of source when there are any
+func loadError(objectFile string, kernelTypes *btf.Spec, source string, err error) error {
+	spec, specErr := ebpf.LoadCollectionSpec(objectFile)
+	if specErr != nil {
+		return fmt.Errorf("%s: loading of bpf program failed - %#v", objectFile, err)
+	}
+	unresolved, reloErr := unresolvedRelocations(spec, kernelTypes)
+	if reloErr != nil {
+		return fmt.Errorf("%s: loading of bpf program failed, CO-RE relocations can not be resolved against %s: %v", objectFile, source, reloErr)
+	}
+	if len(unresolved) > 0 {
+		return fmt.Errorf("%s: loading of bpf program failed, unresolved CO-RE relocations against %s: %s", objectFile, source, strings.Join(unresolved, "; "))
+	}
+	return fmt.Errorf("%s: loading of bpf program failed - %#v", objectFile, err)
+}
@@ -0,0 +1,270 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/ulikunitz/xz"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+// ebpfTestdata - returns the btf/testdata directory of the cilium/ebpf module, its vmlinux BTF and CO-RE object files
+// are used as fixtures
+func ebpfTestdata(t *testing.T) string {
+	t.Helper()
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "github.com/cilium/ebpf").Output()
+	if err != nil {
+		t.Skipf("cilium/ebpf module is not available: %v", err)
+	}
+	return filepath.Join(strings.TrimSpace(string(out)), "btf", "testdata")
+}
+
+// vmlinuxBTF - writes the vmlinux BTF fixture to path
+func vmlinuxBTF(t *testing.T, testdata, path string) {
+	t.Helper()
+	f, err := os.Open(filepath.Join(testdata, "vmlinux.btf.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, gz); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindKernelBTF(t *testing.T) {
+	flat := t.TempDir()
+	if err := os.WriteFile(filepath.Join(flat, "5.4.0-1045-aws.btf"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hub := t.TempDir()
+	hubFile := filepath.Join(hub, "ubuntu", "20.04", "x86_64", "5.4.0-1045-aws.btf")
+	if err := os.MkdirAll(filepath.Dir(hubFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hubFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hubArchive := filepath.Join(hub, "centos", "7", "x86_64", "3.10.0-1160.el7.x86_64.btf.tar.xz")
+	if err := os.MkdirAll(filepath.Dir(hubArchive), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hubArchive, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hub, "ubuntu", "20.04", "x86_64", "5.4.0-1045-aws.btf.tar.xz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(flat, "4.19.0-25-amd64.btf.tar.xz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		release string
+		want    string
+		wantErr string
+	}{
+		{name: "Flat", dir: flat, release: "5.4.0-1045-aws", want: filepath.Join(flat, "5.4.0-1045-aws.btf")},
+		{name: "BTFHub", dir: hub, release: "5.4.0-1045-aws", want: hubFile},
+		{name: "FlatArchive", dir: flat, release: "4.19.0-25-amd64", want: filepath.Join(flat, "4.19.0-25-amd64.btf.tar.xz")},
+		{name: "BTFHubArchive", dir: hub, release: "3.10.0-1160.el7.x86_64", want: hubArchive},
+		{name: "OtherRelease", dir: hub, release: "5.4.0-1046-aws", wantErr: "no BTF of kernel 5.4.0-1046-aws found"},
+		{name: "MissingDir", dir: filepath.Join(flat, "btf"), release: "5.4.0-1045-aws", wantErr: "failed to look up"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findKernelBTF(tt.dir, tt.release)
+			if (err == nil) != (len(tt.wantErr) == 0) || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("findKernelBTF() error = %v, want %q", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("findKernelBTF() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKernelTypes(t *testing.T) {
+	testdata := ebpfTestdata(t)
+	btfDir := t.TempDir()
+	vmlinuxBTF(t, testdata, filepath.Join(btfDir, "5.4.0-1045-aws.btf"))
+	release := filepath.Join(t.TempDir(), "osrelease")
+	if err := os.WriteFile(release, []byte("5.4.0-1045-aws\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	osReleaseFile = release
+	defer func() { osReleaseFile = "/proc/sys/kernel/osrelease" }()
+	archiveDir := t.TempDir()
+	btfArchive(t, filepath.Join(btfDir, "5.4.0-1045-aws.btf"), filepath.Join(archiveDir, "5.4.0-1045-aws.btf.tar.xz"))
+
+	tests := []struct {
+		name       string
+		btfFile    string
+		btfDir     string
+		noBTF      bool
+		wantSource string
+		wantSpec   bool
+		wantErr    bool
+	}{
+		{name: "KernelBTF", btfDir: btfDir, wantSource: "the kernel BTF"},
+		{name: "NoBTFDir", noBTF: true, wantSource: "the kernel BTF"},
+		{name: "BTFDir", btfDir: btfDir, noBTF: true, wantSource: filepath.Join(btfDir, "5.4.0-1045-aws.btf"), wantSpec: true},
+		{name: "MissingRelease", btfDir: t.TempDir(), noBTF: true, wantErr: true},
+		{name: "BTFArchive", btfDir: archiveDir, noBTF: true, wantSource: filepath.Join(archiveDir, "5.4.0-1045-aws.btf.tar.xz"), wantSpec: true},
+		{name: "BTFFile", btfFile: "relocs_read_tgt-el.elf", wantSource: "btf_file relocs_read_tgt-el.elf", wantSpec: true},
+		{name: "MissingBTFFile", btfFile: "relocs_read_tgt.btf", wantErr: true},
+		{name: "RelativeBTFFile", btfFile: "../relocs_read_tgt-el.elf", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kernel := newFakeKernel()
+			kernel.noBTF = tt.noBTF
+			b := &BPF{
+				Program:    models.BPFProgram{Name: "relocs", BTFFile: tt.btfFile},
+				FilePath:   testdata,
+				hostConfig: &config.Config{BTFDir: tt.btfDir},
+				backend:    kernel,
+			}
+			spec, source, err := b.kernelTypes()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("kernelTypes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if source != tt.wantSource || (spec != nil) != tt.wantSpec {
+				t.Errorf("kernelTypes() = %v, %q, want spec %v from %q", spec, source, tt.wantSpec, tt.wantSource)
+			}
+		})
+	}
+}
+
+// btfArchive - writes the BTF file src to a BTFHub tar.xz archive at path
+func btfArchive(t *testing.T, src, path string) {
+	t.Helper()
+	buf, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	xzw, err := xz.NewWriter(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(xzw)
+	if err := tw.WriteHeader(&tar.Header{Name: "./" + filepath.Base(src), Mode: 0644, Size: int64(len(buf)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := xzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKernelTypesCache(t *testing.T) {
+	testdata := ebpfTestdata(t)
+	btfDir := t.TempDir()
+	path := filepath.Join(btfDir, "5.4.0-1045-aws.btf")
+	vmlinuxBTF(t, testdata, path)
+	release := filepath.Join(t.TempDir(), "osrelease")
+	if err := os.WriteFile(release, []byte("5.4.0-1045-aws\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	osReleaseFile = release
+	defer func() { osReleaseFile = "/proc/sys/kernel/osrelease" }()
+
+	kernel := newFakeKernel()
+	kernel.noBTF = true
+	b := &BPF{Program: models.BPFProgram{Name: "relocs"}, hostConfig: &config.Config{BTFDir: btfDir}, backend: kernel}
+	first, _, err := b.kernelTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cached BTF of the release is returned without looking it up again
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	second, source, err := b.kernelTypes()
+	if err != nil || second != first || source != path {
+		t.Errorf("kernelTypes() = %p, %q, %v, want the cached %p from %q", second, source, err, first, path)
+	}
+
+	if err := os.WriteFile(release, []byte("5.4.0-1046-aws\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := b.kernelTypes(); err == nil || !strings.Contains(err.Error(), "no BTF of kernel 5.4.0-1046-aws") {
+		t.Errorf("kernelTypes() error = %v, want the other release looked up", err)
+	}
+}
+
+func TestUnresolvedRelocations(t *testing.T) {
+	testdata := ebpfTestdata(t)
+	spec, err := ebpf.LoadCollectionSpec(filepath.Join(testdata, "relocs_read-el.elf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vmlinux := filepath.Join(t.TempDir(), "vmlinux.btf")
+	vmlinuxBTF(t, testdata, vmlinux)
+
+	b := &BPF{Program: models.BPFProgram{BTFFile: "relocs_read_tgt-el.elf"}, FilePath: testdata, backend: newFakeKernel()}
+	target, _, err := b.kernelTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unresolved, err := unresolvedRelocations(spec, target)
+	if err != nil || len(unresolved) != 0 {
+		t.Errorf("unresolvedRelocations() = %q, %v, want the relocations resolved against their target", unresolved, err)
+	}
+
+	b = &BPF{Program: models.BPFProgram{BTFFile: "vmlinux.btf"}, FilePath: filepath.Dir(vmlinux), backend: newFakeKernel()}
+	target, _, err = b.kernelTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unresolved, err = unresolvedRelocations(spec, target)
+	if err != nil || len(unresolved) == 0 {
+		t.Fatalf("unresolvedRelocations() = %q, %v, want the relocations of the types missing in vmlinux", unresolved, err)
+	}
+	for _, relo := range unresolved {
+		if !strings.HasPrefix(relo, "read_subprog: CORERelocation(") && !strings.HasPrefix(relo, "reads: CORERelocation(") {
+			t.Errorf("unresolvedRelocations() = %q, want the program and relocation", relo)
+		}
+	}
+	err = loadError(filepath.Join(testdata, "relocs_read-el.elf"), target, "btf_file vmlinux.btf", os.ErrInvalid)
+	if !strings.Contains(err.Error(), "unresolved CO-RE relocations against btf_file vmlinux.btf: "+unresolved[0]) {
+		t.Errorf("loadError() = %v, want the unresolved relocations", err)
+	}
+}
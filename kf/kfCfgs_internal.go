@@ -9,9 +9,7 @@
 
 package kf
 
-import (
-	"github.com/rs/zerolog/log"
-)
+import ()
 
 func (b *BPF) RunKFConfigs() error {
 	log.Warn().Msg("Implement custom KF specific configs")
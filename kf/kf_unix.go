@@ -19,9 +19,9 @@ import (
 
 	"github.com/l3af-project/l3afd/models"
 
+	"github.com/cilium/ebpf"
 	"github.com/florianl/go-tc"
 	"github.com/florianl/go-tc/core"
-	"github.com/rs/zerolog/log"
 	"github.com/safchain/ethtool"
 	"golang.org/x/sys/unix"
 )
@@ -34,7 +34,7 @@ func DisableLRO(ifaceName string) error {
 	ethHandle, err := ethtool.NewEthtool()
 	if err != nil {
 		err = fmt.Errorf("ethtool failed to get the handle %v", err)
-		log.Error().Err(err).Msg("")
+		log.Error().Err(err).Str("iface", ifaceName).Msg("")
 		return err
 	}
 	defer ethHandle.Close()
@@ -43,7 +43,7 @@ func DisableLRO(ifaceName string) error {
 	config["rx-lro"] = false
 	if err := ethHandle.Change(ifaceName, config); err != nil {
 		err = fmt.Errorf("ethtool failed to disable LRO on %s with err %v", ifaceName, err)
-		log.Error().Err(err).Msg("")
+		log.Error().Err(err).Str("iface", ifaceName).Msg("")
 		return err
 	}
 
@@ -59,14 +59,15 @@ func prLimit(pid int, limit uintptr, rlimit *unix.Rlimit) error {
 		0, 0, 0)
 
 	if errno != 0 {
-		log.Error().Msgf("Failed to set prlimit for process %d and errorno %d", pid, errno)
+		log.Error().Err(errno).Int("pid", pid).Msg("Failed to set prlimit")
 		return errors.New("failed to set prlimit")
 	}
 
 	return nil
 }
 
-// Set process resource limits only non-zero value
+// SetPrLimits - sets the process resource limits of the non-zero values where cgroup v2 is unavailable, the cpu time
+// in cpu seconds. The cpu limit in percent of a cpu can not be applied with prlimit, see prLimitCPUSeconds.
 func (b *BPF) SetPrLimits() error {
 	var rlimit unix.Rlimit
 
@@ -79,21 +80,31 @@ func (b *BPF) SetPrLimits() error {
 		rlimit.Max = uint64(b.Program.Memory)
 
 		if err := prLimit(b.Cmd.Process.Pid, unix.RLIMIT_AS, &rlimit); err != nil {
-			log.Error().Err(err).Msgf("Failed to set Memory limits - %s", b.Program.Name)
+			b.logger("", "").Error().Err(err).Msg("Failed to set Memory limits")
 		}
 	}
 
-	if b.Program.CPU != 0 {
-		rlimit.Cur = uint64(b.Program.CPU)
-		rlimit.Max = uint64(b.Program.CPU)
+	if seconds := b.prLimitCPUSeconds(); seconds != 0 {
+		rlimit.Cur = uint64(seconds)
+		rlimit.Max = uint64(seconds)
 		if err := prLimit(b.Cmd.Process.Pid, unix.RLIMIT_CPU, &rlimit); err != nil {
-			log.Error().Err(err).Msgf("Failed to set CPU limits - %s", b.Program.Name)
+			b.logger("", "").Error().Err(err).Msg("Failed to set CPU limits")
 		}
 	}
 
 	return nil
 }
 
+// prLimitCPUSeconds - returns the RLIMIT_CPU of the program. Before cgroup v2, cpu was the cpu time limit in seconds,
+// configs without cpu_seconds keep getting it applied as such.
+func (b *BPF) prLimitCPUSeconds() int {
+	if b.Program.CPUSeconds != 0 || b.Program.CPU == 0 {
+		return b.Program.CPUSeconds
+	}
+	b.logger("", "").Warn().Int("cpu", b.Program.CPU).Msg("cpu is applied as cpu time limit in seconds without cgroup v2, set cpu_seconds instead")
+	return b.Program.CPU
+}
+
 // ProcessTerminate - Send sigterm to the process
 func (b *BPF) ProcessTerminate() error {
 	if err := b.Cmd.Process.Signal(syscall.SIGTERM); err != nil {
@@ -115,7 +126,7 @@ func VerifyNMountBPFFS() error {
 	}
 
 	if !strings.Contains(string(mnts), dstPath) {
-		log.Warn().Msg("bpf filesystem is not mounted going to mount")
+		log.Warn().Str("path", dstPath).Msg("bpf filesystem is not mounted going to mount")
 		if err = syscall.Mount(srcPath, dstPath, fstype, uintptr(flags), ""); err != nil {
 			return fmt.Errorf("unable to mount %s at %s: %s", srcPath, dstPath, err)
 		}
@@ -137,9 +148,9 @@ func VerifyNMountTraceFS() error {
 	}
 
 	if !strings.Contains(string(mnts), dstPath) {
-		log.Warn().Msgf(" %s filesystem is not mounted going to mount", dstPath)
+		log.Warn().Str("path", dstPath).Msg("trace filesystem is not mounted going to mount")
 		if _, err = os.Stat(dstPath); err != nil {
-			log.Warn().Msgf(" %s directory doesn't exists, creating", dstPath)
+			log.Warn().Str("path", dstPath).Msg("trace filesystem directory doesn't exist, creating")
 			if err := os.Mkdir(dstPath, 0700); err != nil {
 				return fmt.Errorf("unable to create mount point %s : %s", dstPath, err)
 			}
@@ -189,10 +200,10 @@ func IsProcessRunning(pid int, name string) (bool, error) {
 func VerifyNCreateTCDirs() error {
 	path := "/sys/fs/bpf/tc/globals"
 	if _, err := os.Stat(path); err == nil {
-		log.Debug().Msgf(" %s tc directory exists", path)
+		log.Debug().Str("path", path).Msg("tc directory exists")
 		return nil
 	}
-	log.Info().Msgf(" %s tc directory doesn't exists, creating", path)
+	log.Info().Str("path", path).Msg("tc directory doesn't exist, creating")
 	err := os.MkdirAll(path, 0700)
 	if err != nil {
 		return fmt.Errorf("unable to create directories to pin tc maps %s : %s", path, err)
@@ -202,9 +213,8 @@ func VerifyNCreateTCDirs() error {
 
 // LoadTCAttachProgram - Load and attach tc root program filters or any tc program when chaining is disabled
 func (b *BPF) LoadTCAttachProgram(ifaceName, direction string) error {
-	iface, err := net.InterfaceByName(ifaceName)
-	if err != nil {
-		log.Error().Err(err).Msgf("LoadTCAttachProgram - look up network iface %q", ifaceName)
+	if _, err := net.InterfaceByName(ifaceName); err != nil {
+		b.logger(ifaceName, direction).Error().Err(err).Msg("LoadTCAttachProgram - look up network iface failed")
 		return err
 	}
 
@@ -212,22 +222,52 @@ func (b *BPF) LoadTCAttachProgram(ifaceName, direction string) error {
 		return err
 	}
 
+	bpfRootProg := b.ProgMapCollection.Programs[b.Program.EntryFunctionName]
+
+	var err error
+	// Storing Filter handle
+	b.TCFilter, err = b.kernel().AttachTC(bpfRootProg, ifaceName, direction)
+	if err != nil {
+		return fmt.Errorf("could not attach filter to interface %s for eBPF program %s : %v", ifaceName, b.Program.Name, err)
+	}
+
+	if b.hostConfig.BpfChainingEnabled {
+		if err = b.UpdateProgramMap(ifaceName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnloadTCProgram - Remove TC filters
+func (b *BPF) UnloadTCProgram(ifaceName, direction string) error {
+	bpfRootProg := b.ProgMapCollection.Programs[b.Program.EntryFunctionName]
+	return b.kernel().DetachTC(b.TCFilter, bpfRootProg, ifaceName, direction)
+}
+
+// AttachTC - verifies the clsact qdisc exists on the interface and adds a bpf filter running prog
+func (k *ebpfKernel) AttachTC(prog *ebpf.Program, ifaceName, direction string) (*tc.Filter, error) {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return nil, err
+	}
+
 	// verify and add attribute clsact
 	tcgo, err := tc.Open(&tc.Config{})
 	if err != nil {
-		return fmt.Errorf("could not open rtnetlink socket for interface %s : %v", ifaceName, err)
+		return nil, fmt.Errorf("could not open rtnetlink socket for interface %s : %v", ifaceName, err)
 	}
 
 	clsactFound := false
 	// get all the qdiscs from all interfaces
 	qdiscs, err := tcgo.Qdisc().Get()
 	if err != nil {
-		return fmt.Errorf("could not get qdiscs for interface %s : %v", ifaceName, err)
+		return nil, fmt.Errorf("could not get qdiscs for interface %s : %v", ifaceName, err)
 	}
 	for _, qdisc := range qdiscs {
 		iface, err := net.InterfaceByIndex(int(qdisc.Ifindex))
 		if err != nil {
-			return fmt.Errorf("could not get interface %s from id %d: %v", ifaceName, qdisc.Ifindex, err)
+			return nil, fmt.Errorf("could not get interface %s from id %d: %v", ifaceName, qdisc.Ifindex, err)
 		}
 		if iface.Name == ifaceName && qdisc.Kind == "clsact" {
 			clsactFound = true
@@ -249,12 +289,10 @@ func (b *BPF) LoadTCAttachProgram(ifaceName, direction string) error {
 		}
 
 		if err := tcgo.Qdisc().Add(&qdisc); err != nil {
-			log.Info().Msgf("could not assign clsact to %s : %v, its already exists", ifaceName, err)
+			log.Info().Err(err).Str("iface", ifaceName).Msg("could not assign clsact, it already exists")
 		}
 	}
 
-	bpfRootProg := b.ProgMapCollection.Programs[b.Program.EntryFunctionName]
-
 	var parent uint32
 	if direction == models.IngressType {
 		parent = tc.HandleMinIngress
@@ -262,7 +300,7 @@ func (b *BPF) LoadTCAttachProgram(ifaceName, direction string) error {
 		parent = tc.HandleMinEgress
 	}
 
-	progFD := uint32(bpfRootProg.FD())
+	progFD := uint32(prog.FD())
 	// Netlink attribute used in the Linux kernel
 	bpfFlag := uint32(tc.BpfActDirect)
 
@@ -283,33 +321,22 @@ func (b *BPF) LoadTCAttachProgram(ifaceName, direction string) error {
 		},
 	}
 
-	// Storing Filter handle
-	b.TCFilter = tcgo.Filter()
-
+	tcFilter := tcgo.Filter()
 	// Attaching / Adding as filter
-	if err := b.TCFilter.Add(&filter); err != nil {
-		return fmt.Errorf("could not attach filter to interface %s for eBPF program %s : %v", ifaceName, b.Program.Name, err)
+	if err := tcFilter.Add(&filter); err != nil {
+		return nil, err
 	}
-
-	if b.hostConfig.BpfChainingEnabled {
-		if err = b.UpdateProgramMap(ifaceName); err != nil {
-			return err
-		}
-	}
-	return nil
+	return tcFilter, nil
 }
 
-// UnloadTCProgram - Remove TC filters
-func (b *BPF) UnloadTCProgram(ifaceName, direction string) error {
-
+// DetachTC - removes the bpf filter running prog from the interface
+func (k *ebpfKernel) DetachTC(tcFilter *tc.Filter, prog *ebpf.Program, ifaceName, direction string) error {
 	iface, err := net.InterfaceByName(ifaceName)
 	if err != nil {
-		log.Error().Err(err).Msgf("UnloadTCProgram - look up network iface %q", ifaceName)
+		log.Error().Err(err).Str("iface", ifaceName).Str("direction", direction).Msg("UnloadTCProgram - look up network iface failed")
 		return err
 	}
 
-	bpfRootProg := b.ProgMapCollection.Programs[b.Program.EntryFunctionName]
-
 	var parent uint32
 	if direction == models.IngressType {
 		parent = tc.HandleMinIngress
@@ -317,7 +344,7 @@ func (b *BPF) UnloadTCProgram(ifaceName, direction string) error {
 		parent = tc.HandleMinEgress
 	}
 
-	tcfilts, err := b.TCFilter.Get(&tc.Msg{
+	tcfilts, err := tcFilter.Get(&tc.Msg{
 		Family:  unix.AF_UNSPEC,
 		Ifindex: uint32(iface.Index),
 		Handle:  0x0,
@@ -325,11 +352,11 @@ func (b *BPF) UnloadTCProgram(ifaceName, direction string) error {
 	})
 
 	if err != nil {
-		log.Warn().Msgf("Could not get filters for interface \"%s\" direction %s ", ifaceName, direction)
+		log.Warn().Err(err).Str("iface", ifaceName).Str("direction", direction).Msg("Could not get filters for interface")
 		return fmt.Errorf("could not get filters for interface %s : %v", ifaceName, err)
 	}
 
-	progFD := uint32(bpfRootProg.FD())
+	progFD := uint32(prog.FD())
 	// Netlink attribute used in the Linux kernel
 	bpfFlag := uint32(tc.BpfActDirect)
 
@@ -351,9 +378,46 @@ func (b *BPF) UnloadTCProgram(ifaceName, direction string) error {
 	}
 
 	// Detaching / Deleting filter
-	if err := b.TCFilter.Delete(&filter); err != nil {
+	if err := tcFilter.Delete(&filter); err != nil {
 		return fmt.Errorf("could not dettach tc filter for interface %s : %v", ifaceName, err)
 	}
 
 	return nil
 }
+
+func (k *ebpfKernel) TCAttached(ifaceName, direction string, progID ebpf.ProgramID) error {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return err
+	}
+
+	tcgo, err := tc.Open(&tc.Config{})
+	if err != nil {
+		return fmt.Errorf("could not open rtnetlink socket for interface %s : %v", ifaceName, err)
+	}
+	defer tcgo.Close()
+
+	var parent uint32
+	if direction == models.IngressType {
+		parent = tc.HandleMinIngress
+	} else if direction == models.EgressType {
+		parent = tc.HandleMinEgress
+	}
+
+	tcfilts, err := tcgo.Filter().Get(&tc.Msg{
+		Family:  unix.AF_UNSPEC,
+		Ifindex: uint32(iface.Index),
+		Handle:  0x0,
+		Parent:  core.BuildHandle(tc.HandleRoot, parent),
+	})
+	if err != nil {
+		return fmt.Errorf("could not get filters for interface %s : %v", ifaceName, err)
+	}
+
+	for _, filter := range tcfilts {
+		if filter.BPF != nil && filter.BPF.ID != nil && ebpf.ProgramID(*filter.BPF.ID) == progID {
+			return nil
+		}
+	}
+	return fmt.Errorf("no tc filter of program id %d found on interface %s direction %s", progID, ifaceName, direction)
+}
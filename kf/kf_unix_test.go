@@ -0,0 +1,33 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"testing"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestBPF_prLimitCPUSeconds(t *testing.T) {
+	tests := []struct {
+		name    string
+		program models.BPFProgram
+		want    int
+	}{
+		{name: "NoLimit", program: models.BPFProgram{}, want: 0},
+		{name: "CPUSeconds", program: models.BPFProgram{CPU: 50, CPUSeconds: 3600}, want: 3600},
+		{name: "LegacyCPU", program: models.BPFProgram{CPU: 3600}, want: 3600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BPF{Program: tt.program}
+			if got := b.prLimitCPUSeconds(); got != tt.want {
+				t.Errorf("BPF.prLimitCPUSeconds() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
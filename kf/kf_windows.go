@@ -11,6 +11,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+
+	"github.com/cilium/ebpf"
+	tc "github.com/florianl/go-tc"
 )
 
 // DisableLRO - XDP programs are failing when Large Receive Offload is enabled, to fix this we use to manually disable.
@@ -26,6 +29,21 @@ func (b *BPF) SetPrLimits() error {
 	return nil
 }
 
+// SetResourceLimits - cgroups are not supported on windows, it sets the process resource limits
+func (b *BPF) SetResourceLimits(ifaceName, direction string) error {
+	return b.SetPrLimits()
+}
+
+// startInCgroup - cgroups are not supported on windows
+func (b *BPF) startInCgroup(ifaceName, direction string) func(started bool) {
+	return func(bool) {}
+}
+
+// RemoveCgroup - cgroups are not supported on windows
+func (b *BPF) RemoveCgroup() {}
+
+func (b *BPF) updateResourceUsage(ifaceName, direction string) {}
+
 // VerifyNMountBPFFS - Mounting bpf filesystem
 func VerifyNMountBPFFS() error {
 	return nil
@@ -66,3 +84,18 @@ func (b *BPF) LoadTCAttachProgram(ifaceName, direction string) error {
 func (b *BPF) UnloadTCProgram(ifaceName, direction string) error {
 	return fmt.Errorf("UnloadTCProgram - TC programs Unsupported on windows")
 }
+
+// AttachTC - not implemented in windows
+func (k *ebpfKernel) AttachTC(prog *ebpf.Program, ifaceName, direction string) (*tc.Filter, error) {
+	return nil, fmt.Errorf("AttachTC - TC programs Unsupported on windows")
+}
+
+// DetachTC - not implemented in windows
+func (k *ebpfKernel) DetachTC(filter *tc.Filter, prog *ebpf.Program, ifaceName, direction string) error {
+	return fmt.Errorf("DetachTC - TC programs Unsupported on windows")
+}
+
+// TCAttached - not implemented in windows
+func (k *ebpfKernel) TCAttached(ifaceName, direction string, progID ebpf.ProgramID) error {
+	return fmt.Errorf("TCAttached - TC programs Unsupported on windows")
+}
@@ -7,8 +7,6 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
-
-	"github.com/rs/zerolog/log"
 )
 
 var kfcfgs *NFConfigs
@@ -32,6 +30,6 @@ func ViewHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(kfcfgs.KFDetails(iface)); err != nil {
-		log.Err(err).Msgf("unable to serialize json")
+		log.Err(err).Msg("unable to serialize json")
 	}
 }
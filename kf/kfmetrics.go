@@ -9,8 +9,6 @@ import (
 	"time"
 
 	"github.com/l3af-project/l3afd/models"
-
-	"github.com/rs/zerolog/log"
 )
 
 type kfMetrics struct {
@@ -47,7 +45,7 @@ func (c *kfMetrics) kfMetricsWorker(bpfProgs map[string]*list.List, direction st
 					continue
 				}
 				if err := bpf.MonitorMaps(ifaceName, c.Intervals); err != nil {
-					log.Error().Err(err).Msgf("pMonitor monitor maps failed - %s", bpf.Program.Name)
+					bpf.logger(ifaceName, "").Error().Err(err).Msg("pMonitor monitor maps failed")
 				}
 			}
 		}
@@ -0,0 +1,75 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"sync"
+)
+
+// programLocks serializes the changes of the programs between the deploys, the reconciler and the process monitor.
+// The zero value is ready to use.
+type programLocks struct {
+	// lists guards the maps of the bpf lists of the interfaces, it is held for writing while a list is set or removed
+	lists sync.RWMutex
+
+	mu     sync.Mutex
+	ifaces map[string]*sync.Mutex
+}
+
+// iface - returns the lock of the programs of the interface, it is held while they are started, stopped or relinked
+func (l *programLocks) iface(ifaceName string) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ifaces == nil {
+		l.ifaces = make(map[string]*sync.Mutex)
+	}
+	lock, ok := l.ifaces[ifaceName]
+	if !ok {
+		lock = new(sync.Mutex)
+		l.ifaces[ifaceName] = lock
+	}
+	return lock
+}
+
+// snapshot - returns a copy of the bpf lists of the interfaces which have programs
+func (l *programLocks) snapshot(bpfProgs map[string]*list.List) map[string]*list.List {
+	l.lists.RLock()
+	defer l.lists.RUnlock()
+	lists := make(map[string]*list.List, len(bpfProgs))
+	for ifaceName, bpfList := range bpfProgs {
+		if bpfList != nil {
+			lists[ifaceName] = bpfList
+		}
+	}
+	return lists
+}
+
+// current - returns the bpf list of the interface
+func (l *programLocks) current(bpfProgs map[string]*list.List, ifaceName string) *list.List {
+	l.lists.RLock()
+	defer l.lists.RUnlock()
+	return bpfProgs[ifaceName]
+}
+
+// lockIface - locks the programs of the interface and returns the function unlocking them
+func (c *NFConfigs) lockIface(ifaceName string) func() {
+	lock := c.locks.iface(ifaceName)
+	lock.Lock()
+	return lock.Unlock
+}
+
+// setBpfList - sets the bpf list of the interface and direction, nil when no programs are running
+func (c *NFConfigs) setBpfList(direction, ifaceName string, bpfList *list.List) {
+	c.locks.lists.Lock()
+	defer c.locks.lists.Unlock()
+	c.bpfLists(direction)[ifaceName] = bpfList
+}
+
+// deleteBpfList - removes the bpf list of the interface and direction
+func (c *NFConfigs) deleteBpfList(direction, ifaceName string) {
+	c.locks.lists.Lock()
+	defer c.locks.lists.Unlock()
+	delete(c.bpfLists(direction), ifaceName)
+}
@@ -0,0 +1,39 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"github.com/l3af-project/l3afd/logging"
+
+	"github.com/rs/zerolog"
+)
+
+// log - logger of the kf component, its level is set by the component-levels of the [logging] config section
+var log = logging.Component("kf")
+
+// logger - returns the logger of the program carrying its name and program id,
+// iface and direction are added when they are known
+func (b *BPF) logger(ifaceName, direction string) *zerolog.Logger {
+	ctx := log.With().Str("program", b.Program.Name).Uint32("prog_id", uint32(b.ProgID))
+	if len(ifaceName) > 0 {
+		ctx = ctx.Str("iface", ifaceName)
+	}
+	if len(direction) > 0 {
+		ctx = ctx.Str("direction", direction)
+	}
+	logger := ctx.Logger()
+	return &logger
+}
+
+// logger - returns the logger of the map carrying its name and map id, and the fields of the owning program
+func (b *BPFMap) logger() *zerolog.Logger {
+	var ctx zerolog.Context
+	if b.BPFProg != nil {
+		ctx = b.BPFProg.logger("", "").With()
+	} else {
+		ctx = log.With()
+	}
+	logger := ctx.Str("map", b.Name).Uint32("map_id", uint32(b.MapID)).Logger()
+	return &logger
+}
@@ -7,20 +7,19 @@ package kf
 import (
 	"container/list"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net"
-	"os"
 	"reflect"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/l3af-project/l3afd/audit"
 	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/configstore"
 	"github.com/l3af-project/l3afd/models"
-
-	"github.com/rs/zerolog/log"
+	"github.com/l3af-project/l3afd/tracing"
 )
 
 type NFConfigs struct {
@@ -43,6 +42,18 @@ type NFConfigs struct {
 	ifaces map[string]string
 
 	mu *sync.Mutex
+	// locks of the programs of each interface, shared with the process monitor
+	locks programLocks
+
+	// kernel operations, defaults to cilium/ebpf when nil
+	backend kernelBackend
+
+	// configs as accepted by the API and failures to start them
+	desired desiredState
+
+	// persistent store of the configs, created from HostConfig on first use
+	store     *configstore.Store
+	storeOnce sync.Once
 }
 
 var shutdownInterval = 900 * time.Millisecond
@@ -66,12 +77,30 @@ func NewNFConfigs(ctx context.Context, host string, hostConf *config.Config, pMo
 	}
 
 	nfConfigs.processMon = pMon
+	nfConfigs.processMon.locks = &nfConfigs.locks
 	nfConfigs.processMon.pCheckStart(nfConfigs.IngressXDPBpfs, nfConfigs.IngressTCBpfs, nfConfigs.EgressTCBpfs)
 	nfConfigs.kfMetricsMon = metricsMon
 	nfConfigs.kfMetricsMon.kfMetricsStart(nfConfigs.IngressXDPBpfs, nfConfigs.IngressTCBpfs, nfConfigs.EgressTCBpfs)
 	return nfConfigs, nil
 }
 
+// kernel - returns the kernel backend shared by the eBPF programs of this host
+func (c *NFConfigs) kernel() kernelBackend {
+	if c.backend == nil {
+		return defaultKernel
+	}
+	return c.backend
+}
+
+// newBPF - creates run time details of the eBPF program wired to the kernel backend
+func (c *NFConfigs) newBPF(bpfProg *models.BPFProgram, ifaceName string) *BPF {
+	bpf := NewBpfProgram(c.ctx, *bpfProg, c.HostConfig, ifaceName)
+	if bpf != nil {
+		bpf.backend = c.backend
+	}
+	return bpf
+}
+
 // Close stop all the eBPF Programs and delete elements in the list
 func (c *NFConfigs) Close(ctx context.Context) error {
 	ticker := time.NewTicker(shutdownInterval)
@@ -89,10 +118,10 @@ func (c *NFConfigs) Close(ctx context.Context) error {
 	go func() {
 		defer wg.Done()
 		for ifaceName := range c.IngressXDPBpfs {
-			if err := c.StopNRemoveAllBPFPrograms(ifaceName, models.XDPIngressType); err != nil {
-				log.Warn().Err(err).Msg("failed to Close Ingress XDP BPF Program")
+			if err := c.StopNRemoveAllBPFPrograms(ctx, ifaceName, models.XDPIngressType); err != nil {
+				log.Warn().Err(err).Str("iface", ifaceName).Msg("failed to Close Ingress XDP BPF Program")
 			}
-			delete(c.IngressXDPBpfs, ifaceName)
+			c.deleteBpfList(models.XDPIngressType, ifaceName)
 		}
 	}()
 
@@ -100,10 +129,10 @@ func (c *NFConfigs) Close(ctx context.Context) error {
 	go func() {
 		defer wg.Done()
 		for ifaceName := range c.IngressTCBpfs {
-			if err := c.StopNRemoveAllBPFPrograms(ifaceName, models.IngressType); err != nil {
-				log.Warn().Err(err).Msg("failed to Close Ingress TC BPF Program")
+			if err := c.StopNRemoveAllBPFPrograms(ctx, ifaceName, models.IngressType); err != nil {
+				log.Warn().Err(err).Str("iface", ifaceName).Msg("failed to Close Ingress TC BPF Program")
 			}
-			delete(c.IngressTCBpfs, ifaceName)
+			c.deleteBpfList(models.IngressType, ifaceName)
 		}
 	}()
 
@@ -111,10 +140,10 @@ func (c *NFConfigs) Close(ctx context.Context) error {
 	go func() {
 		defer wg.Done()
 		for ifaceName := range c.EgressTCBpfs {
-			if err := c.StopNRemoveAllBPFPrograms(ifaceName, models.EgressType); err != nil {
-				log.Warn().Err(err).Msg("failed to Close Egress TC BPF Program")
+			if err := c.StopNRemoveAllBPFPrograms(ctx, ifaceName, models.EgressType); err != nil {
+				log.Warn().Err(err).Str("iface", ifaceName).Msg("failed to Close Egress TC BPF Program")
 			}
-			delete(c.EgressTCBpfs, ifaceName)
+			c.deleteBpfList(models.EgressType, ifaceName)
 		}
 	}()
 
@@ -133,7 +162,8 @@ func (c *NFConfigs) Close(ctx context.Context) error {
 
 // Check for XDP programs are not loaded then initialise the array
 // Check for XDP root program is running for a interface. if not loaded it
-func (c *NFConfigs) VerifyAndStartXDPRootProgram(ifaceName, direction string) error {
+func (c *NFConfigs) VerifyAndStartXDPRootProgram(ctx context.Context, ifaceName, direction string) (err error) {
+	defer func() { c.observe(ifaceName, direction, "", err) }()
 
 	if err := DisableLRO(ifaceName); err != nil {
 		return fmt.Errorf("failed to disable lro %v", err)
@@ -148,11 +178,11 @@ func (c *NFConfigs) VerifyAndStartXDPRootProgram(ifaceName, direction string) er
 	}
 
 	if c.IngressXDPBpfs[ifaceName].Len() == 0 {
-		rootBpf, err := LoadRootProgram(ifaceName, direction, models.XDPType, c.HostConfig)
+		rootBpf, err := loadRootProgram(ctx, ifaceName, direction, models.XDPType, c.HostConfig, c.kernel())
 		if err != nil {
 			return fmt.Errorf("failed to load %s xdp root program: %v", direction, err)
 		}
-		log.Info().Msg("ingress xdp root program attached")
+		rootBpf.logger(ifaceName, direction).Info().Msg("ingress xdp root program attached")
 		c.IngressXDPBpfs[ifaceName].PushFront(rootBpf)
 	}
 
@@ -160,7 +190,8 @@ func (c *NFConfigs) VerifyAndStartXDPRootProgram(ifaceName, direction string) er
 }
 
 // Check for TC root program is running for a interface. If not start it
-func (c *NFConfigs) VerifyAndStartTCRootProgram(ifaceName, direction string) error {
+func (c *NFConfigs) VerifyAndStartTCRootProgram(ctx context.Context, ifaceName, direction string) (err error) {
+	defer func() { c.observe(ifaceName, direction, "", err) }()
 
 	if err := VerifyNMountBPFFS(); err != nil {
 		return fmt.Errorf("failed to mount bpf file system")
@@ -175,20 +206,20 @@ func (c *NFConfigs) VerifyAndStartTCRootProgram(ifaceName, direction string) err
 
 	if direction == models.IngressType {
 		if c.IngressTCBpfs[ifaceName].Len() == 0 { //Root program is not running start then
-			rootBpf, err := LoadRootProgram(ifaceName, direction, models.TCType, c.HostConfig)
+			rootBpf, err := loadRootProgram(ctx, ifaceName, direction, models.TCType, c.HostConfig, c.kernel())
 			if err != nil {
 				return fmt.Errorf("failed to load %s tc root program: %v", direction, err)
 			}
-			log.Info().Msg("ingress tc root program attached")
+			rootBpf.logger(ifaceName, direction).Info().Msg("ingress tc root program attached")
 			c.IngressTCBpfs[ifaceName].PushFront(rootBpf)
 		}
 	} else {
 		if c.EgressTCBpfs[ifaceName].Len() == 0 { //Root program is not running start then
-			rootBpf, err := LoadRootProgram(ifaceName, direction, models.TCType, c.HostConfig)
+			rootBpf, err := loadRootProgram(ctx, ifaceName, direction, models.TCType, c.HostConfig, c.kernel())
 			if err != nil {
 				return fmt.Errorf("failed to load %s tc root program: %v", direction, err)
 			}
-			log.Info().Msg("egress tc root program attached")
+			rootBpf.logger(ifaceName, direction).Info().Msg("egress tc root program attached")
 			c.EgressTCBpfs[ifaceName].PushFront(rootBpf)
 		}
 	}
@@ -197,10 +228,11 @@ func (c *NFConfigs) VerifyAndStartTCRootProgram(ifaceName, direction string) err
 }
 
 // This method inserts the element at the end of the list
-func (c *NFConfigs) PushBackAndStartBPF(bpfProg *models.BPFProgram, ifaceName, direction string) error {
+func (c *NFConfigs) PushBackAndStartBPF(ctx context.Context, bpfProg *models.BPFProgram, ifaceName, direction string) (err error) {
+	defer func() { c.observe(ifaceName, direction, bpfProg.Name, err) }()
 
-	log.Info().Msgf("PushBackAndStartBPF : iface %s, direction %s", ifaceName, direction)
-	bpf := NewBpfProgram(c.ctx, *bpfProg, c.HostConfig, ifaceName)
+	log.Info().Str("program", bpfProg.Name).Str("iface", ifaceName).Str("direction", direction).Msg("PushBackAndStartBPF")
+	bpf := c.newBPF(bpfProg, ifaceName)
 	var bpfList *list.List
 
 	switch direction {
@@ -214,14 +246,14 @@ func (c *NFConfigs) PushBackAndStartBPF(bpfProg *models.BPFProgram, ifaceName, d
 		return fmt.Errorf("unknown direction type")
 	}
 
-	if err := c.DownloadAndStartBPFProgram(bpfList.PushBack(bpf), ifaceName, direction); err != nil {
+	if err := c.DownloadAndStartBPFProgram(ctx, bpfList.PushBack(bpf), ifaceName, direction); err != nil {
 		return fmt.Errorf("failed to download and start the BPF %s iface %s direction %s", bpfProg.Name, ifaceName, direction)
 	}
 
 	return nil
 }
 
-func (c *NFConfigs) DownloadAndStartBPFProgram(element *list.Element, ifaceName, direction string) error {
+func (c *NFConfigs) DownloadAndStartBPFProgram(ctx context.Context, element *list.Element, ifaceName, direction string) error {
 	if element == nil {
 		return fmt.Errorf("element is nil pointer")
 	}
@@ -232,14 +264,14 @@ func (c *NFConfigs) DownloadAndStartBPFProgram(element *list.Element, ifaceName,
 		prevBPF := element.Prev().Value.(*BPF)
 		bpf.PrevMapNamePath = prevBPF.MapNamePath
 		bpf.PrevProgMapID = prevBPF.ProgMapID
-		log.Info().Msgf("DownloadAndStartBPFProgram : program name %s previous program map name: %s", bpf.Program.Name, bpf.PrevMapNamePath)
+		bpf.logger(ifaceName, direction).Info().Str("path", bpf.PrevMapNamePath).Msg("DownloadAndStartBPFProgram : linking to previous program map")
 	}
 
-	if err := bpf.VerifyAndGetArtifacts(c.HostConfig); err != nil {
+	if err := bpf.VerifyAndGetArtifacts(ctx, c.HostConfig); err != nil {
 		return fmt.Errorf("failed to get artifacts %s with error: %v", bpf.Program.Artifact, err)
 	}
 
-	if err := bpf.Start(ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
+	if err := bpf.Start(ctx, ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
 		return fmt.Errorf("failed to start bpf program %s with error: %v", bpf.Program.Name, err)
 	}
 
@@ -247,32 +279,33 @@ func (c *NFConfigs) DownloadAndStartBPFProgram(element *list.Element, ifaceName,
 }
 
 // Stopping all programs in order
-func (c *NFConfigs) StopNRemoveAllBPFPrograms(ifaceName, direction string) error {
+func (c *NFConfigs) StopNRemoveAllBPFPrograms(ctx context.Context, ifaceName, direction string) error {
+	defer c.lockIface(ifaceName)()
 
 	var bpfList *list.List
 
 	switch direction {
 	case models.XDPIngressType:
 		bpfList = c.IngressXDPBpfs[ifaceName]
-		c.IngressXDPBpfs[ifaceName] = nil
+		c.setBpfList(models.XDPIngressType, ifaceName, nil)
 	case models.IngressType:
 		bpfList = c.IngressTCBpfs[ifaceName]
-		c.IngressTCBpfs[ifaceName] = nil
+		c.setBpfList(models.IngressType, ifaceName, nil)
 	case models.EgressType:
 		bpfList = c.EgressTCBpfs[ifaceName]
-		c.EgressTCBpfs[ifaceName] = nil
+		c.setBpfList(models.EgressType, ifaceName, nil)
 	default: // we should never reach here
 		return fmt.Errorf("unknown direction type %s", direction)
 	}
 
 	if bpfList == nil {
-		log.Warn().Msgf("no %s ebpf programs to stop", direction)
+		log.Warn().Str("iface", ifaceName).Str("direction", direction).Msg("no ebpf programs to stop")
 		return nil
 	}
 
 	for e := bpfList.Front(); e != nil; {
 		data := e.Value.(*BPF)
-		if err := data.Stop(ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
+		if err := data.Stop(ctx, ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
 			return fmt.Errorf("failed to stop program %s direction %s", data.Program.Name, direction)
 		}
 		nextBPF := e.Next()
@@ -291,12 +324,13 @@ func (c *NFConfigs) StopNRemoveAllBPFPrograms(ifaceName, direction string) error
 // 5. BPF Program not running but needs to start.
 // 6. BPF Program running but map args change, will update the map values (i.e. Array and Hash maps only)
 // 7. BPF Program running but update args change, will invoke cmd_update with additional option --cmd=update
-func (c *NFConfigs) VerifyNUpdateBPFProgram(bpfProg *models.BPFProgram, ifaceName, direction string) error {
+func (c *NFConfigs) VerifyNUpdateBPFProgram(ctx context.Context, bpfProg *models.BPFProgram, ifaceName, direction string) (err error) {
 
 	var bpfList *list.List
 	if bpfProg == nil {
 		return nil
 	}
+	defer func() { c.observe(ifaceName, direction, bpfProg.Name, err) }()
 
 	switch direction {
 	case models.XDPIngressType:
@@ -322,9 +356,9 @@ func (c *NFConfigs) VerifyNUpdateBPFProgram(bpfProg *models.BPFProgram, ifaceNam
 
 		// Admin status change - disabled
 		if data.Program.AdminStatus != bpfProg.AdminStatus {
-			log.Info().Msgf("verifyNUpdateBPFProgram :admin_status change detected - disabling the program %s", data.Program.Name)
+			data.logger(ifaceName, direction).Info().Msg("verifyNUpdateBPFProgram : admin_status change detected - disabling the program")
 			data.Program.AdminStatus = bpfProg.AdminStatus
-			if err := data.Stop(ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
+			if err := data.Stop(ctx, ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
 				return fmt.Errorf("failed to stop to on admin_status change BPF %s iface %s direction %s admin_status %s", bpfProg.Name, ifaceName, direction, bpfProg.AdminStatus)
 			}
 			tmpNextBPF := e.Next()
@@ -332,7 +366,7 @@ func (c *NFConfigs) VerifyNUpdateBPFProgram(bpfProg *models.BPFProgram, ifaceNam
 			bpfList.Remove(e)
 			if tmpNextBPF != nil && tmpNextBPF.Prev() != nil { // relink the next element
 				if err := c.LinkBPFPrograms(tmpNextBPF.Prev().Value.(*BPF), tmpNextBPF.Value.(*BPF)); err != nil {
-					log.Error().Err(err).Msg("admin status disabled - failed LinkBPFPrograms")
+					data.logger(ifaceName, direction).Error().Err(err).Msg("admin status disabled - failed LinkBPFPrograms")
 					return fmt.Errorf("admin status disabled - failed LinkBPFPrograms %v", err)
 				}
 			}
@@ -341,11 +375,11 @@ func (c *NFConfigs) VerifyNUpdateBPFProgram(bpfProg *models.BPFProgram, ifaceNam
 			if tmpPreviousBPF == nil && tmpNextBPF == nil {
 				switch direction {
 				case models.XDPIngressType:
-					c.IngressXDPBpfs[ifaceName] = nil
+					c.setBpfList(models.XDPIngressType, ifaceName, nil)
 				case models.IngressType:
-					c.IngressTCBpfs[ifaceName] = nil
+					c.setBpfList(models.IngressType, ifaceName, nil)
 				case models.EgressType:
-					c.EgressTCBpfs[ifaceName] = nil
+					c.setBpfList(models.EgressType, ifaceName, nil)
 				default:
 					return fmt.Errorf("unknown direction type %s", direction)
 				}
@@ -354,9 +388,9 @@ func (c *NFConfigs) VerifyNUpdateBPFProgram(bpfProg *models.BPFProgram, ifaceNam
 
 			// Check if list contains root program only then stop the root program.
 			if tmpPreviousBPF.Prev() == nil && tmpPreviousBPF.Next() == nil {
-				log.Info().Msg("no eBPF Programs are running, stopping root program")
+				log.Info().Str("iface", ifaceName).Str("direction", direction).Msg("no eBPF Programs are running, stopping root program")
 				if c.HostConfig.BpfChainingEnabled {
-					if err := c.StopRootProgram(ifaceName, direction); err != nil {
+					if err := c.StopRootProgram(ctx, ifaceName, direction); err != nil {
 						return fmt.Errorf("failed to stop to root program  %s iface %s direction %s", bpfProg.Name, ifaceName, direction)
 					}
 				}
@@ -366,15 +400,16 @@ func (c *NFConfigs) VerifyNUpdateBPFProgram(bpfProg *models.BPFProgram, ifaceNam
 
 		// Version Change
 		if data.Program.Version != bpfProg.Version || !reflect.DeepEqual(data.Program.StartArgs, bpfProg.StartArgs) {
-			log.Info().Msgf("VerifyNUpdateBPFProgram : version update initiated - current version %s new version %s", data.Program.Version, bpfProg.Version)
+			data.logger(ifaceName, direction).Info().Str("version", data.Program.Version).Str("new_version", bpfProg.Version).Msg("VerifyNUpdateBPFProgram : version update initiated")
 
-			if err := data.Stop(ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
+			if err := data.Stop(ctx, ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
 				return fmt.Errorf("failed to stop older version of network function BPF %s iface %s direction %s version %s", bpfProg.Name, ifaceName, direction, bpfProg.Version)
 			}
 
+			prevVersion := data.Program.Version
 			data.Program = *bpfProg
 
-			if err := c.DownloadAndStartBPFProgram(e, ifaceName, direction); err != nil {
+			if err := c.DownloadAndStartBPFProgram(ctx, e, ifaceName, direction); err != nil {
 				return fmt.Errorf("failed to download and start newer version of network function BPF %s version %s iface %s direction %s", bpfProg.Name, bpfProg.Version, ifaceName, direction)
 			}
 
@@ -383,12 +418,13 @@ func (c *NFConfigs) VerifyNUpdateBPFProgram(bpfProg *models.BPFProgram, ifaceNam
 				data.PutNextProgFDFromID(int(e.Next().Value.(*BPF).ProgID))
 			}
 
+			data.recordEvent(models.EventNormal, models.EventProgramUpgraded, ifaceName, direction, fmt.Sprintf("upgraded from version %s", prevVersion))
 			return nil
 		}
 
 		// monitor maps change
 		if !reflect.DeepEqual(data.Program.MonitorMaps, bpfProg.MonitorMaps) {
-			log.Info().Msgf("monitor map list is mismatch - updated")
+			data.logger(ifaceName, direction).Info().Msg("monitor map list is mismatch - updated")
 			data.Program.MonitorMaps = bpfProg.MonitorMaps
 		}
 
@@ -397,26 +433,33 @@ func (c *NFConfigs) VerifyNUpdateBPFProgram(bpfProg *models.BPFProgram, ifaceNam
 
 		// Seq ID Change
 		if data.Program.SeqID != bpfProg.SeqID {
-			log.Info().Msgf("VerifyNUpdateBPFProgram : seq id change detected %s current seq id %d new seq id %d", data.Program.Name, data.Program.SeqID, bpfProg.SeqID)
+			data.logger(ifaceName, direction).Info().Int("seq_id", data.Program.SeqID).Int("new_seq_id", bpfProg.SeqID).Msg("VerifyNUpdateBPFProgram : seq id change detected")
 
 			// Update seq id
+			prevSeqID := data.Program.SeqID
 			data.Program.SeqID = bpfProg.SeqID
 
 			if err := c.MoveToLocation(e, bpfList); err != nil {
 				return fmt.Errorf("failed to move to new position in the chain BPF %s version %s iface %s direction %s", bpfProg.Name, bpfProg.Version, ifaceName, direction)
 			}
+			data.recordEvent(models.EventNormal, models.EventProgramMoved, ifaceName, direction, fmt.Sprintf("moved from seq_id %d to %d", prevSeqID, bpfProg.SeqID))
 		}
 
 		// map arguments change - basically any config change to ebpf program updating config maps
 		if !reflect.DeepEqual(data.Program.MapArgs, bpfProg.MapArgs) {
-			log.Info().Msg("maps_args are mismatched")
+			data.logger(ifaceName, direction).Info().Msg("maps_args are mismatched")
 			data.Program.MapArgs = bpfProg.MapArgs
-			data.UpdateBPFMaps(ifaceName, direction)
+			if err := data.UpdateBPFMaps(ifaceName, direction); err != nil {
+				data.logger(ifaceName, direction).Warn().Err(err).Msg("failed to update map args")
+				data.recordEvent(models.EventWarning, models.EventMapArgsUpdated, ifaceName, direction, err.Error())
+			} else {
+				data.recordEvent(models.EventNormal, models.EventMapArgsUpdated, ifaceName, direction, "")
+			}
 		}
 
 		// update arguments change - basically any config change to ebpf program config maps using user program
 		if !reflect.DeepEqual(data.Program.UpdateArgs, bpfProg.UpdateArgs) {
-			log.Info().Msg("update_args are mismatched")
+			data.logger(ifaceName, direction).Info().Msg("update_args are mismatched")
 			data.Program.UpdateArgs = bpfProg.UpdateArgs
 			data.UpdateArgs(ifaceName, direction)
 		}
@@ -424,9 +467,9 @@ func (c *NFConfigs) VerifyNUpdateBPFProgram(bpfProg *models.BPFProgram, ifaceNam
 		return nil
 	}
 
-	log.Debug().Msgf("Program is not found in the list name %s", bpfProg.Name)
+	log.Debug().Str("program", bpfProg.Name).Str("iface", ifaceName).Str("direction", direction).Msg("Program is not found in the list")
 	// if not found in the list.
-	if err := c.InsertAndStartBPFProgram(bpfProg, ifaceName, direction); err != nil {
+	if err := c.InsertAndStartBPFProgram(ctx, bpfProg, ifaceName, direction); err != nil {
 		return fmt.Errorf("failed to insert and start BPFProgram to new location BPF %s version %s iface %s direction %s", bpfProg.Name, bpfProg.Version, ifaceName, direction)
 	}
 
@@ -451,12 +494,12 @@ func (c *NFConfigs) MoveToLocation(element *list.Element, bpfList *list.List) er
 		if data.Program.SeqID >= bpf.Program.SeqID && data.Program.Name != bpf.Program.Name {
 			if element.Next() != nil && element.Prev() != nil {
 				if err := c.LinkBPFPrograms(element.Prev().Value.(*BPF), element.Next().Value.(*BPF)); err != nil {
-					log.Error().Err(err).Msg("MoveToLocation - failed LinkBPFPrograms before move")
+					bpf.logger("", "").Error().Err(err).Msg("MoveToLocation - failed LinkBPFPrograms before move")
 					return fmt.Errorf("MoveToLocation - failed LinkBPFPrograms before move %v", err)
 				}
 			} else if element.Next() == nil && element.Prev() != nil {
 				if err := element.Prev().Value.(*BPF).RemoveNextProgFD(); err != nil {
-					log.Error().Err(err).Msg("failed to remove program fd in map")
+					bpf.logger("", "").Error().Err(err).Msg("failed to remove program fd in map")
 					return fmt.Errorf("failed to remove program fd in map %v", err)
 				}
 			}
@@ -464,25 +507,25 @@ func (c *NFConfigs) MoveToLocation(element *list.Element, bpfList *list.List) er
 			bpfList.MoveBefore(element, e)
 
 			if err := c.LinkBPFPrograms(element.Prev().Value.(*BPF), element.Value.(*BPF)); err != nil {
-				log.Error().Err(err).Msg("MoveToLocation - failed LinkBPFPrograms after move element to with prev prog")
+				bpf.logger("", "").Error().Err(err).Msg("MoveToLocation - failed LinkBPFPrograms after move element to with prev prog")
 				return fmt.Errorf("MoveToLocation - failed LinkBPFPrograms after move element to with prev prog %v", err)
 			}
 
 			if element.Next() != nil {
 				if err := c.LinkBPFPrograms(element.Value.(*BPF), element.Next().Value.(*BPF)); err != nil {
-					log.Error().Err(err).Msg("MoveToLocation - failed LinkBPFPrograms after move element to with next prog")
+					bpf.logger("", "").Error().Err(err).Msg("MoveToLocation - failed LinkBPFPrograms after move element to with next prog")
 					return fmt.Errorf("MoveToLocation - failed LinkBPFPrograms after move element to with next prog %v", err)
 				}
 			}
-			log.Info().Msgf("MoveToLocation : Moved - %s", element.Value.(*BPF).Program.Name)
+			bpf.logger("", "").Info().Msg("MoveToLocation : Moved")
 			return nil
 		}
 	}
 
-	log.Info().Msg("element seq id greater than last element in the list move to back of the list")
+	bpf.logger("", "").Info().Msg("element seq id greater than last element in the list move to back of the list")
 	if element.Next() != nil && element.Prev() != nil {
 		if err := c.LinkBPFPrograms(element.Prev().Value.(*BPF), element.Next().Value.(*BPF)); err != nil {
-			log.Error().Err(err).Msg("MoveToLocation - failed LinkBPFPrograms before MoveToBack element to with prev prog")
+			bpf.logger("", "").Error().Err(err).Msg("MoveToLocation - failed LinkBPFPrograms before MoveToBack element to with prev prog")
 			return fmt.Errorf("MoveToLocation - failed LinkBPFPrograms before MoveToBack element to with prev prog %v", err)
 		}
 	}
@@ -490,24 +533,24 @@ func (c *NFConfigs) MoveToLocation(element *list.Element, bpfList *list.List) er
 	bpfList.MoveToBack(element)
 	if element.Prev() != nil {
 		if err := c.LinkBPFPrograms(element.Prev().Value.(*BPF), element.Value.(*BPF)); err != nil {
-			log.Error().Err(err).Msg("MoveToLocation - failed LinkBPFPrograms after MoveToBack element to with prev prog")
+			bpf.logger("", "").Error().Err(err).Msg("MoveToLocation - failed LinkBPFPrograms after MoveToBack element to with prev prog")
 			return fmt.Errorf("MoveToLocation - failed LinkBPFPrograms after MoveToBack element to with prev prog %v", err)
 		}
 	}
 
 	if element.Next() == nil {
 		if err := element.Value.(*BPF).RemoveNextProgFD(); err != nil {
-			log.Error().Err(err).Msg("failed to remove MoveToBack program fd in map")
+			bpf.logger("", "").Error().Err(err).Msg("failed to remove MoveToBack program fd in map")
 			return fmt.Errorf("failed to remove MoveToBack program fd in map %v", err)
 		}
 	}
 
-	log.Info().Msgf("MoveToLocation : MoveToBack Moved - %s", element.Value.(*BPF).Program.Name)
+	bpf.logger("", "").Info().Msg("MoveToLocation : MoveToBack Moved")
 	return nil
 }
 
 // InsertAndStartBPFProgram method for tc programs
-func (c *NFConfigs) InsertAndStartBPFProgram(bpfProg *models.BPFProgram, ifaceName, direction string) error {
+func (c *NFConfigs) InsertAndStartBPFProgram(ctx context.Context, bpfProg *models.BPFProgram, ifaceName, direction string) error {
 
 	var bpfList *list.List
 	if bpfProg == nil {
@@ -518,7 +561,7 @@ func (c *NFConfigs) InsertAndStartBPFProgram(bpfProg *models.BPFProgram, ifaceNa
 		return nil
 	}
 
-	bpf := NewBpfProgram(c.ctx, *bpfProg, c.HostConfig, ifaceName)
+	bpf := c.newBPF(bpfProg, ifaceName)
 
 	switch direction {
 	case models.XDPIngressType:
@@ -532,7 +575,7 @@ func (c *NFConfigs) InsertAndStartBPFProgram(bpfProg *models.BPFProgram, ifaceNa
 	}
 
 	if bpfList == nil {
-		log.Warn().Msgf("%s program list is empty", direction)
+		log.Warn().Str("iface", ifaceName).Str("direction", direction).Msg("program list is empty")
 		return nil
 	}
 
@@ -540,13 +583,13 @@ func (c *NFConfigs) InsertAndStartBPFProgram(bpfProg *models.BPFProgram, ifaceNa
 		data := e.Value.(*BPF)
 		if data.Program.SeqID >= bpfProg.SeqID {
 			tmpBPF := bpfList.InsertBefore(bpf, e)
-			if err := c.DownloadAndStartBPFProgram(tmpBPF, ifaceName, direction); err != nil {
+			if err := c.DownloadAndStartBPFProgram(ctx, tmpBPF, ifaceName, direction); err != nil {
 				return fmt.Errorf("failed to download and start network function %s version %s iface %s direction %s", bpfProg.Name, bpfProg.Version, ifaceName, direction)
 			}
 
 			if tmpBPF.Next() != nil {
 				if err := c.LinkBPFPrograms(tmpBPF.Value.(*BPF), tmpBPF.Next().Value.(*BPF)); err != nil {
-					log.Error().Err(err).Msg("InsertAndStartBPFProgram - failed LinkBPFPrograms after InsertBefore element to with next prog")
+					bpf.logger(ifaceName, direction).Error().Err(err).Msg("InsertAndStartBPFProgram - failed LinkBPFPrograms after InsertBefore element to with next prog")
 					return fmt.Errorf("InsertAndStartBPFProgram - failed LinkBPFPrograms after InsertBefore element to with next prog %v", err)
 				}
 			}
@@ -555,7 +598,7 @@ func (c *NFConfigs) InsertAndStartBPFProgram(bpfProg *models.BPFProgram, ifaceNa
 	}
 
 	// insert at the end
-	if err := c.PushBackAndStartBPF(bpfProg, ifaceName, direction); err != nil {
+	if err := c.PushBackAndStartBPF(ctx, bpfProg, ifaceName, direction); err != nil {
 		return fmt.Errorf("failed to push back and start network function %s version %s iface %s direction %s", bpfProg.Name, bpfProg.Version, ifaceName, direction)
 	}
 
@@ -563,40 +606,43 @@ func (c *NFConfigs) InsertAndStartBPFProgram(bpfProg *models.BPFProgram, ifaceNa
 }
 
 // StopRootProgram -This method stops the root program, removes the root node from the list and reset the list to nil
-func (c *NFConfigs) StopRootProgram(ifaceName, direction string) error {
+func (c *NFConfigs) StopRootProgram(ctx context.Context, ifaceName, direction string) error {
 
 	switch direction {
 	case models.XDPIngressType:
 		if c.IngressXDPBpfs[ifaceName] == nil {
-			log.Warn().Msg("xdp root program is not running")
+			log.Warn().Str("iface", ifaceName).Str("direction", direction).Msg("xdp root program is not running")
 			return nil
 		}
 
-		if err := c.IngressXDPBpfs[ifaceName].Front().Value.(*BPF).Stop(ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
+		if err := c.IngressXDPBpfs[ifaceName].Front().Value.(*BPF).Stop(ctx, ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
 			return fmt.Errorf("failed to stop xdp root program iface %s", ifaceName)
 		}
+		c.IngressXDPBpfs[ifaceName].Front().Value.(*BPF).recordEvent(models.EventNormal, models.EventRootProgramDetached, ifaceName, direction, "")
 		c.IngressXDPBpfs[ifaceName].Remove(c.IngressXDPBpfs[ifaceName].Front())
-		c.IngressXDPBpfs[ifaceName] = nil
+		c.setBpfList(models.XDPIngressType, ifaceName, nil)
 	case models.IngressType:
 		if c.IngressTCBpfs[ifaceName] == nil {
-			log.Warn().Msgf("tc root program %s not running", direction)
+			log.Warn().Str("iface", ifaceName).Str("direction", direction).Msg("tc root program is not running")
 			return nil
 		}
-		if err := c.IngressTCBpfs[ifaceName].Front().Value.(*BPF).Stop(ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
+		if err := c.IngressTCBpfs[ifaceName].Front().Value.(*BPF).Stop(ctx, ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
 			return fmt.Errorf("failed to stop ingress tc root program on interface %s", ifaceName)
 		}
+		c.IngressTCBpfs[ifaceName].Front().Value.(*BPF).recordEvent(models.EventNormal, models.EventRootProgramDetached, ifaceName, direction, "")
 		c.IngressTCBpfs[ifaceName].Remove(c.IngressTCBpfs[ifaceName].Front())
-		c.IngressTCBpfs[ifaceName] = nil
+		c.setBpfList(models.IngressType, ifaceName, nil)
 	case models.EgressType:
 		if c.EgressTCBpfs[ifaceName] == nil {
-			log.Warn().Msgf("tc root program %s not running", direction)
+			log.Warn().Str("iface", ifaceName).Str("direction", direction).Msg("tc root program is not running")
 			return nil
 		}
-		if err := c.EgressTCBpfs[ifaceName].Front().Value.(*BPF).Stop(ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
+		if err := c.EgressTCBpfs[ifaceName].Front().Value.(*BPF).Stop(ctx, ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
 			return fmt.Errorf("failed to stop egress tc root program on interface %s", ifaceName)
 		}
+		c.EgressTCBpfs[ifaceName].Front().Value.(*BPF).recordEvent(models.EventNormal, models.EventRootProgramDetached, ifaceName, direction, "")
 		c.EgressTCBpfs[ifaceName].Remove(c.EgressTCBpfs[ifaceName].Front())
-		c.EgressTCBpfs[ifaceName] = nil
+		c.setBpfList(models.EgressType, ifaceName, nil)
 	default:
 		return fmt.Errorf("unknown direction type")
 	}
@@ -606,16 +652,56 @@ func (c *NFConfigs) StopRootProgram(ifaceName, direction string) error {
 
 // Link BPF programs
 func (c *NFConfigs) LinkBPFPrograms(leftBPF, rightBPF *BPF) error {
-	log.Info().Msgf("LinkBPFPrograms : left BPF Prog %s right BPF Prog %s", leftBPF.Program.Name, rightBPF.Program.Name)
+	return linkBPFPrograms(leftBPF, rightBPF)
+}
+
+// linkBPFPrograms - chains rightBPF after leftBPF through the prog map of leftBPF, earlier versions recorded the
+// previous prog map of leftBPF as the one of rightBPF
+func linkBPFPrograms(leftBPF, rightBPF *BPF) error {
+	rightBPF.logger("", "").Info().Str("prev_program", leftBPF.Program.Name).Msg("LinkBPFPrograms")
 	rightBPF.PrevMapNamePath = leftBPF.MapNamePath
-	rightBPF.PrevProgMapID = leftBPF.PrevProgMapID
+	rightBPF.PrevProgMapID = leftBPF.ProgMapID
 	if err := leftBPF.PutNextProgFDFromID(int(rightBPF.ProgID)); err != nil {
-		log.Error().Err(err).Msgf("LinkBPFPrograms - failed to update program fd in prev prog map before move")
+		rightBPF.logger("", "").Error().Err(err).Str("prev_program", leftBPF.Program.Name).Msg("LinkBPFPrograms - failed to update program fd in prev prog map before move")
 		return fmt.Errorf("LinkBPFPrograms - failed to update program fd in prev prog prog map before move %v", err)
 	}
 	return nil
 }
 
+// MonitorResponsive - reports an error if the process monitor did not complete a poll within timeout
+func (c *NFConfigs) MonitorResponsive(timeout time.Duration) error {
+	if c.processMon == nil {
+		return nil
+	}
+	return c.processMon.responsive(timeout)
+}
+
+// VerifyRootPrograms - reports an error if a root program of the chain is not loaded or no longer attached
+func (c *NFConfigs) VerifyRootPrograms() error {
+	if !c.HostConfig.BpfChainingEnabled {
+		return nil
+	}
+	for direction, bpfProgs := range map[string]map[string]*list.List{
+		models.XDPIngressType: c.IngressXDPBpfs,
+		models.IngressType:    c.IngressTCBpfs,
+		models.EgressType:     c.EgressTCBpfs,
+	} {
+		for ifaceName, bpfList := range bpfProgs {
+			if bpfList == nil || bpfList.Front() == nil {
+				continue
+			}
+			root := bpfList.Front().Value.(*BPF)
+			if !root.IsLoaded() {
+				return fmt.Errorf("root program %s of iface %s direction %s is not loaded", root.Program.Name, ifaceName, direction)
+			}
+			if check, ok := root.checkAttach(ifaceName, direction); ok && !check.Healthy {
+				return fmt.Errorf("root program %s of iface %s direction %s is not attached: %s", root.Program.Name, ifaceName, direction, check.Message)
+			}
+		}
+	}
+	return nil
+}
+
 // KFDetails - Method provides dump of KFs for debug purpose
 func (c *NFConfigs) KFDetails(iface string) []*BPF {
 	arrBPFDetails := make([]*BPF, 0)
@@ -640,7 +726,9 @@ func (c *NFConfigs) KFDetails(iface string) []*BPF {
 	return arrBPFDetails
 }
 
-func (c *NFConfigs) Deploy(ifaceName, HostName string, bpfProgs *models.BPFPrograms) error {
+func (c *NFConfigs) Deploy(ctx context.Context, ifaceName, HostName string, bpfProgs *models.BPFPrograms) (err error) {
+	ctx, span := tracing.Start(ctx, "NFConfigs.Deploy", tracing.IfaceKey.String(ifaceName))
+	defer func() { tracing.End(span, err) }()
 
 	if HostName != c.HostName {
 		errOut := fmt.Errorf("provided bpf programs do not belong to this host")
@@ -662,21 +750,22 @@ func (c *NFConfigs) Deploy(ifaceName, HostName string, bpfProgs *models.BPFProgr
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	defer c.lockIface(ifaceName)()
 
 	for _, bpfProg := range bpfProgs.XDPIngress {
 		if c.IngressXDPBpfs[ifaceName] == nil {
 			if bpfProg.AdminStatus == models.Enabled {
-				c.IngressXDPBpfs[ifaceName] = list.New()
-				if err := c.VerifyAndStartXDPRootProgram(ifaceName, models.XDPIngressType); err != nil {
-					c.IngressXDPBpfs[ifaceName] = nil
+				c.setBpfList(models.XDPIngressType, ifaceName, list.New())
+				if err := c.VerifyAndStartXDPRootProgram(ctx, ifaceName, models.XDPIngressType); err != nil {
+					c.setBpfList(models.XDPIngressType, ifaceName, nil)
 					return fmt.Errorf("failed to chain XDP BPF programs: %v", err)
 				}
-				log.Info().Msgf("Push Back and Start XDP program : %s seq_id : %d", bpfProg.Name, bpfProg.SeqID)
-				if err := c.PushBackAndStartBPF(bpfProg, ifaceName, models.XDPIngressType); err != nil {
+				log.Info().Str("program", bpfProg.Name).Str("iface", ifaceName).Int("seq_id", bpfProg.SeqID).Msg("Push Back and Start XDP program")
+				if err := c.PushBackAndStartBPF(ctx, bpfProg, ifaceName, models.XDPIngressType); err != nil {
 					return fmt.Errorf("failed to update BPF Program: %v", err)
 				}
 			}
-		} else if err := c.VerifyNUpdateBPFProgram(bpfProg, ifaceName, models.XDPIngressType); err != nil {
+		} else if err := c.VerifyNUpdateBPFProgram(ctx, bpfProg, ifaceName, models.XDPIngressType); err != nil {
 			return fmt.Errorf("failed to update xdp BPF Program: %v", err)
 		}
 	}
@@ -684,16 +773,16 @@ func (c *NFConfigs) Deploy(ifaceName, HostName string, bpfProgs *models.BPFProgr
 	for _, bpfProg := range bpfProgs.TCIngress {
 		if c.IngressTCBpfs[ifaceName] == nil {
 			if bpfProg.AdminStatus == models.Enabled {
-				c.IngressTCBpfs[ifaceName] = list.New()
-				if err := c.VerifyAndStartTCRootProgram(ifaceName, models.IngressType); err != nil {
-					c.IngressTCBpfs[ifaceName] = nil
+				c.setBpfList(models.IngressType, ifaceName, list.New())
+				if err := c.VerifyAndStartTCRootProgram(ctx, ifaceName, models.IngressType); err != nil {
+					c.setBpfList(models.IngressType, ifaceName, nil)
 					return fmt.Errorf("failed to chain ingress tc bpf programs: %v", err)
 				}
-				if err := c.PushBackAndStartBPF(bpfProg, ifaceName, models.IngressType); err != nil {
+				if err := c.PushBackAndStartBPF(ctx, bpfProg, ifaceName, models.IngressType); err != nil {
 					return fmt.Errorf("failed to update BPF Program: %v", err)
 				}
 			}
-		} else if err := c.VerifyNUpdateBPFProgram(bpfProg, ifaceName, models.IngressType); err != nil {
+		} else if err := c.VerifyNUpdateBPFProgram(ctx, bpfProg, ifaceName, models.IngressType); err != nil {
 			return fmt.Errorf("failed to update BPF Program: %v", err)
 		}
 	}
@@ -701,16 +790,16 @@ func (c *NFConfigs) Deploy(ifaceName, HostName string, bpfProgs *models.BPFProgr
 	for _, bpfProg := range bpfProgs.TCEgress {
 		if c.EgressTCBpfs[ifaceName] == nil {
 			if bpfProg.AdminStatus == models.Enabled {
-				c.EgressTCBpfs[ifaceName] = list.New()
-				if err := c.VerifyAndStartTCRootProgram(ifaceName, models.EgressType); err != nil {
-					c.EgressTCBpfs[ifaceName] = nil
+				c.setBpfList(models.EgressType, ifaceName, list.New())
+				if err := c.VerifyAndStartTCRootProgram(ctx, ifaceName, models.EgressType); err != nil {
+					c.setBpfList(models.EgressType, ifaceName, nil)
 					return fmt.Errorf("failed to chain ingress tc bpf programs: %v", err)
 				}
-				if err := c.PushBackAndStartBPF(bpfProg, ifaceName, models.EgressType); err != nil {
+				if err := c.PushBackAndStartBPF(ctx, bpfProg, ifaceName, models.EgressType); err != nil {
 					return fmt.Errorf("failed to update BPF Program: %v", err)
 				}
 			}
-		} else if err := c.VerifyNUpdateBPFProgram(bpfProg, ifaceName, models.EgressType); err != nil {
+		} else if err := c.VerifyNUpdateBPFProgram(ctx, bpfProg, ifaceName, models.EgressType); err != nil {
 			return fmt.Errorf("failed to update BPF Program: %v", err)
 		}
 	}
@@ -718,11 +807,18 @@ func (c *NFConfigs) Deploy(ifaceName, HostName string, bpfProgs *models.BPFProgr
 	return nil
 }
 
-// DeployeBPFPrograms - Starts eBPF programs on the node if they are not running
-func (c *NFConfigs) DeployeBPFPrograms(bpfProgs []models.L3afBPFPrograms) error {
+// DeployeBPFPrograms - Starts eBPF programs on the node if they are not running, the configs replace the desired ones.
+// Invalid configs are rejected before anything is changed, the problems are returned as schema.Errors.
+func (c *NFConfigs) DeployeBPFPrograms(ctx context.Context, bpfProgs []models.L3afBPFPrograms) error {
+	if err := c.ValidatePrograms(bpfProgs); err != nil {
+		return err
+	}
+	audit.RecordChanges(ctx, c.setDesired(bpfProgs))
 	for _, bpfProg := range bpfProgs {
-		if err := c.Deploy(bpfProg.Iface, bpfProg.HostName, bpfProg.BpfPrograms); err != nil {
-			if err := c.SaveConfigsToConfigStore(); err != nil {
+		err := c.Deploy(ctx, bpfProg.Iface, bpfProg.HostName, bpfProg.BpfPrograms)
+		c.observe(bpfProg.Iface, "", "", err)
+		if err != nil {
+			if err := c.SaveConfigsToConfigStore(ctx); err != nil {
 				return fmt.Errorf("deploy eBPF Programs failed to save configs %v", err)
 			}
 			return fmt.Errorf("failed to deploy BPF program on iface %s with error: %v", bpfProg.Iface, err)
@@ -730,35 +826,35 @@ func (c *NFConfigs) DeployeBPFPrograms(bpfProgs []models.L3afBPFPrograms) error
 		c.ifaces = map[string]string{bpfProg.Iface: bpfProg.Iface}
 	}
 
-	if err := c.RemoveMissingNetIfacesNBPFProgsInConfig(bpfProgs); err != nil {
-		log.Warn().Err(err).Msgf("Remove missing interfaces and BPF programs in the config failed with error ")
+	if err := c.RemoveMissingNetIfacesNBPFProgsInConfig(ctx, bpfProgs); err != nil {
+		log.Warn().Err(err).Msg("Remove missing interfaces and BPF programs in the config failed")
 	}
-	if err := c.SaveConfigsToConfigStore(); err != nil {
+	if err := c.SaveConfigsToConfigStore(ctx); err != nil {
 		return fmt.Errorf("deploy eBPF Programs failed to save configs %v", err)
 	}
 	return nil
 }
 
-// SaveConfigsToConfigStore - Writes configs to persistent store
-func (c *NFConfigs) SaveConfigsToConfigStore() error {
-
-	var bpfProgs []models.L3afBPFPrograms
+// ConfigStore - returns the persistent store of the configs
+func (c *NFConfigs) ConfigStore() *configstore.Store {
+	c.storeOnce.Do(func() {
+		c.store = configstore.New(c.HostConfig.L3afConfigStoreFileName, c.HostConfig.L3afConfigStoreHistoryDir, c.HostConfig.L3afConfigStoreHistorySize)
+	})
+	return c.store
+}
 
-	for _, iface := range c.ifaces {
-		log.Info().Msgf("SaveConfigsToConfigStore - %s", iface)
-		bpfPrograms := c.EBPFPrograms(iface)
-		bpfProgs = append(bpfProgs, bpfPrograms)
-	}
+// SaveConfigsToConfigStore - Writes the desired configs to persistent store, recording a revision on behalf of the author of ctx.
+// Programs failing to start are kept, they are deployed again after a restart.
+func (c *NFConfigs) SaveConfigsToConfigStore(ctx context.Context) error {
 
-	file, err := json.MarshalIndent(bpfProgs, "", " ")
-	if err != nil {
-		log.Error().Err(err).Msgf("failed to marshal configs to save")
-		return fmt.Errorf("failed to marshal configs %v", err)
+	bpfProgs := c.DesiredPrograms()
+	for _, bpfProg := range bpfProgs {
+		log.Info().Str("iface", bpfProg.Iface).Msg("SaveConfigsToConfigStore")
 	}
 
-	if err = os.WriteFile(c.HostConfig.L3afConfigStoreFileName, file, 0644); err != nil {
-		log.Error().Err(err).Msgf("failed write to file operation")
-		return fmt.Errorf("failed to save configs %v", err)
+	if err := c.ConfigStore().Save(ctx, bpfProgs); err != nil {
+		log.Error().Err(err).Str("path", c.HostConfig.L3afConfigStoreFileName).Msg("failed write to file operation")
+		return err
 	}
 
 	return nil
@@ -819,7 +915,7 @@ func (c *NFConfigs) EBPFProgramsAll() []models.L3afBPFPrograms {
 }
 
 // RemoveMissingNetIfacesNBPFProgsInConfig - Stops running eBPF programs which are missing in the config
-func (c *NFConfigs) RemoveMissingNetIfacesNBPFProgsInConfig(bpfProgCfgs []models.L3afBPFPrograms) error {
+func (c *NFConfigs) RemoveMissingNetIfacesNBPFProgsInConfig(ctx context.Context, bpfProgCfgs []models.L3afBPFPrograms) error {
 
 	tempIfaces := map[string]bool{}
 	wg := sync.WaitGroup{}
@@ -831,8 +927,8 @@ func (c *NFConfigs) RemoveMissingNetIfacesNBPFProgsInConfig(bpfProgCfgs []models
 				wg.Add(1)
 				go func(bpfProg models.L3afBPFPrograms) {
 					defer wg.Done()
-					if err := c.RemoveMissingBPFProgramsInConfig(bpfProg, ifaceName, models.XDPIngressType); err != nil {
-						log.Error().Err(err).Msgf("Failed to stop missing program for network interface %s direction Ingress", ifaceName)
+					if err := c.RemoveMissingBPFProgramsInConfig(ctx, bpfProg, ifaceName, models.XDPIngressType); err != nil {
+						log.Error().Err(err).Str("iface", ifaceName).Str("direction", models.XDPIngressType).Msg("Failed to stop missing program")
 					}
 				}(bpfProg)
 			}
@@ -841,8 +937,8 @@ func (c *NFConfigs) RemoveMissingNetIfacesNBPFProgsInConfig(bpfProgCfgs []models
 				wg.Add(1)
 				go func(bpfProg models.L3afBPFPrograms) {
 					defer wg.Done()
-					if err := c.RemoveMissingBPFProgramsInConfig(bpfProg, ifaceName, models.IngressType); err != nil {
-						log.Error().Err(err).Msgf("Failed to stop missing program for network interface %s direction Ingress", ifaceName)
+					if err := c.RemoveMissingBPFProgramsInConfig(ctx, bpfProg, ifaceName, models.IngressType); err != nil {
+						log.Error().Err(err).Str("iface", ifaceName).Str("direction", models.IngressType).Msg("Failed to stop missing program")
 					}
 				}(bpfProg)
 			}
@@ -851,8 +947,8 @@ func (c *NFConfigs) RemoveMissingNetIfacesNBPFProgsInConfig(bpfProgCfgs []models
 				wg.Add(1)
 				go func(bpfProg models.L3afBPFPrograms) {
 					defer wg.Done()
-					if err := c.RemoveMissingBPFProgramsInConfig(bpfProg, ifaceName, models.EgressType); err != nil {
-						log.Error().Err(err).Msgf("Failed to stop missing program for network interface %s direction Ingress", ifaceName)
+					if err := c.RemoveMissingBPFProgramsInConfig(ctx, bpfProg, ifaceName, models.EgressType); err != nil {
+						log.Error().Err(err).Str("iface", ifaceName).Str("direction", models.EgressType).Msg("Failed to stop missing program")
 					}
 				}(bpfProg)
 			}
@@ -862,15 +958,15 @@ func (c *NFConfigs) RemoveMissingNetIfacesNBPFProgsInConfig(bpfProgCfgs []models
 
 	for _, ifaceName := range c.ifaces {
 		if _, ok := tempIfaces[ifaceName]; !ok {
-			log.Info().Msgf("Missing Network Interface %s in the configs, stopping", ifaceName)
-			if err := c.StopNRemoveAllBPFPrograms(ifaceName, models.XDPIngressType); err != nil {
-				log.Error().Err(err).Msgf("Failed to stop all the program in the direction xdp ingress for interface %s", ifaceName)
+			log.Info().Str("iface", ifaceName).Msg("Missing Network Interface in the configs, stopping")
+			if err := c.StopNRemoveAllBPFPrograms(ctx, ifaceName, models.XDPIngressType); err != nil {
+				log.Error().Err(err).Str("iface", ifaceName).Str("direction", models.XDPIngressType).Msg("Failed to stop all the programs")
 			}
-			if err := c.StopNRemoveAllBPFPrograms(ifaceName, models.IngressType); err != nil {
-				log.Error().Err(err).Msgf("Failed to stop all the program in the direction tc ingress for interface %s", ifaceName)
+			if err := c.StopNRemoveAllBPFPrograms(ctx, ifaceName, models.IngressType); err != nil {
+				log.Error().Err(err).Str("iface", ifaceName).Str("direction", models.IngressType).Msg("Failed to stop all the programs")
 			}
-			if err := c.StopNRemoveAllBPFPrograms(ifaceName, models.EgressType); err != nil {
-				log.Error().Err(err).Msgf("Failed to stop all the program in the direction tc egress for interface %s", ifaceName)
+			if err := c.StopNRemoveAllBPFPrograms(ctx, ifaceName, models.EgressType); err != nil {
+				log.Error().Err(err).Str("iface", ifaceName).Str("direction", models.EgressType).Msg("Failed to stop all the programs")
 			}
 			delete(c.ifaces, ifaceName)
 		}
@@ -880,7 +976,8 @@ func (c *NFConfigs) RemoveMissingNetIfacesNBPFProgsInConfig(bpfProgCfgs []models
 }
 
 // RemoveMissingBPFProgramsInConfig - This method to stop the eBPF programs which are not listed in the config.
-func (c *NFConfigs) RemoveMissingBPFProgramsInConfig(bpfProg models.L3afBPFPrograms, ifaceName, direction string) error {
+func (c *NFConfigs) RemoveMissingBPFProgramsInConfig(ctx context.Context, bpfProg models.L3afBPFPrograms, ifaceName, direction string) error {
+	defer c.lockIface(ifaceName)()
 
 	var bpfProgArr []*models.BPFProgram
 	var bpfList *list.List
@@ -917,9 +1014,9 @@ func (c *NFConfigs) RemoveMissingBPFProgramsInConfig(bpfProg models.L3afBPFProgr
 			}
 		}
 		if !Found {
-			log.Info().Msgf("eBPF Program not found in config stopping - %s direction %s", prog.Program.Name, direction)
+			prog.logger(ifaceName, direction).Info().Msg("eBPF Program not found in config, stopping")
 			prog.Program.AdminStatus = models.Disabled
-			if err := prog.Stop(ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
+			if err := prog.Stop(ctx, ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
 				return fmt.Errorf("failed to stop to on removed config BPF %s iface %s direction %s", prog.Program.Name, ifaceName, models.XDPIngressType)
 			}
 			tmpNextBPF := e.Next()
@@ -927,15 +1024,15 @@ func (c *NFConfigs) RemoveMissingBPFProgramsInConfig(bpfProg models.L3afBPFProgr
 			bpfList.Remove(e)
 			if tmpNextBPF != nil && tmpNextBPF.Prev() != nil { // relink the next element
 				if err := c.LinkBPFPrograms(tmpNextBPF.Prev().Value.(*BPF), tmpNextBPF.Value.(*BPF)); err != nil {
-					log.Error().Err(err).Msgf("missing config - failed LinkBPFPrograms")
+					prog.logger(ifaceName, direction).Error().Err(err).Msg("missing config - failed LinkBPFPrograms")
 					return fmt.Errorf("missing config - failed LinkBPFPrograms %v", err)
 				}
 			}
 			// Check if list contains root program only then stop the root program.
 			if tmpPreviousBPF.Prev() == nil && tmpPreviousBPF.Next() == nil {
-				log.Info().Msgf("no eBPF Programs are running, stopping root program")
+				log.Info().Str("iface", ifaceName).Str("direction", direction).Msg("no eBPF Programs are running, stopping root program")
 
-				if err := c.StopRootProgram(ifaceName, direction); err != nil {
+				if err := c.StopRootProgram(ctx, ifaceName, direction); err != nil {
 					return fmt.Errorf("failed to stop to root program of iface %s direction XDP Ingress", ifaceName)
 				}
 			}
@@ -961,11 +1058,12 @@ func getHostInterfaces() (map[string]bool, error) {
 	return hostIfaces, nil
 }
 
-func (c *NFConfigs) AddAndStartBPF(bpfProg *models.BPFProgram, ifaceName string, direction string) error {
+func (c *NFConfigs) AddAndStartBPF(ctx context.Context, bpfProg *models.BPFProgram, ifaceName string, direction string) (err error) {
 	var bpfList *list.List
 	if bpfProg == nil {
 		return fmt.Errorf("AddAndStartBPF - bpf program is nil")
 	}
+	defer func() { c.observe(ifaceName, direction, bpfProg.Name, err) }()
 
 	if bpfProg.AdminStatus == models.Disabled {
 		return nil
@@ -985,27 +1083,27 @@ func (c *NFConfigs) AddAndStartBPF(bpfProg *models.BPFProgram, ifaceName string,
 	for e := bpfList.Front(); e != nil; e = e.Next() {
 		data := e.Value.(*BPF)
 		if data.Program.Name == bpfProg.Name {
-			log.Warn().Msgf("%v is already running on %v iface and in %v direction ", data.Program.Name, ifaceName, direction)
+			data.logger(ifaceName, direction).Warn().Msg("program is already running")
 			return nil
 		}
 
 		if data.Program.SeqID == bpfProg.SeqID {
-			log.Warn().Msgf("duplicate seq Id detected for %v in direction %v", data.Program.Name, direction)
+			data.logger(ifaceName, direction).Warn().Int("seq_id", bpfProg.SeqID).Str("new_program", bpfProg.Name).Msg("duplicate seq id detected")
 			return nil
 		}
 	}
 	for e := bpfList.Front(); e != nil; e = e.Next() {
 		data := e.Value.(*BPF)
 		if data.Program.SeqID > bpfProg.SeqID {
-			bpf := NewBpfProgram(c.ctx, *bpfProg, c.HostConfig, ifaceName)
+			bpf := c.newBPF(bpfProg, ifaceName)
 			tmpBPF := bpfList.InsertBefore(bpf, e)
-			if err := c.DownloadAndStartBPFProgram(tmpBPF, ifaceName, direction); err != nil {
+			if err := c.DownloadAndStartBPFProgram(ctx, tmpBPF, ifaceName, direction); err != nil {
 				return fmt.Errorf("failed to download and start eBPF program %s version %s iface %s direction %s", bpfProg.Name, bpfProg.Version, ifaceName, direction)
 			}
 
 			if tmpBPF.Next() != nil {
 				if err := c.LinkBPFPrograms(tmpBPF.Value.(*BPF), tmpBPF.Next().Value.(*BPF)); err != nil {
-					log.Error().Err(err).Msg("AddAndStartBPF - failed LinkBPFPrograms after InsertBefore element to with next prog")
+					bpf.logger(ifaceName, direction).Error().Err(err).Msg("AddAndStartBPF - failed LinkBPFPrograms after InsertBefore element to with next prog")
 					return fmt.Errorf("AddAndStartBPFProg - failed LinkBPFPrograms after InsertBefore element to with next prog %v", err)
 				}
 			}
@@ -1014,7 +1112,7 @@ func (c *NFConfigs) AddAndStartBPF(bpfProg *models.BPFProgram, ifaceName string,
 	}
 
 	// insert at the end
-	if err := c.PushBackAndStartBPF(bpfProg, ifaceName, direction); err != nil {
+	if err := c.PushBackAndStartBPF(ctx, bpfProg, ifaceName, direction); err != nil {
 		return fmt.Errorf("failed to push back and start eBPF Program %s version %s iface %s direction %s", bpfProg.Name, bpfProg.Version, ifaceName, direction)
 	}
 
@@ -1022,7 +1120,7 @@ func (c *NFConfigs) AddAndStartBPF(bpfProg *models.BPFProgram, ifaceName string,
 }
 
 // AddProgramWithoutChaining : add eBPF program on given interface when chaining is not enabled
-func (c *NFConfigs) AddProgramWithoutChaining(ifaceName string, bpfProgs *models.BPFPrograms) error {
+func (c *NFConfigs) AddProgramWithoutChaining(ctx context.Context, ifaceName string, bpfProgs *models.BPFPrograms) error {
 	if c.HostConfig.BpfChainingEnabled {
 		return nil
 	}
@@ -1035,8 +1133,8 @@ func (c *NFConfigs) AddProgramWithoutChaining(ifaceName string, bpfProgs *models
 		bpfProg := bpfProgs.XDPIngress[0]
 		if bpfProg.AdminStatus == models.Enabled {
 			if c.IngressXDPBpfs[ifaceName] == nil {
-				c.IngressXDPBpfs[ifaceName] = list.New()
-				if err := c.PushBackAndStartBPF(bpfProg, ifaceName, models.XDPIngressType); err != nil {
+				c.setBpfList(models.XDPIngressType, ifaceName, list.New())
+				if err := c.PushBackAndStartBPF(ctx, bpfProg, ifaceName, models.XDPIngressType); err != nil {
 					return fmt.Errorf("failed to PushBackAndStartBPF BPF Program: %v", err)
 				}
 			} else {
@@ -1050,8 +1148,8 @@ func (c *NFConfigs) AddProgramWithoutChaining(ifaceName string, bpfProgs *models
 		bpfProg := bpfProgs.TCIngress[0]
 		if bpfProg.AdminStatus == models.Enabled {
 			if c.IngressTCBpfs[ifaceName] == nil {
-				c.IngressTCBpfs[ifaceName] = list.New()
-				if err := c.PushBackAndStartBPF(bpfProg, ifaceName, models.IngressType); err != nil {
+				c.setBpfList(models.IngressType, ifaceName, list.New())
+				if err := c.PushBackAndStartBPF(ctx, bpfProg, ifaceName, models.IngressType); err != nil {
 					return fmt.Errorf("failed to PushBackAndStartBPF BPF Program: %v", err)
 				}
 			} else {
@@ -1065,8 +1163,8 @@ func (c *NFConfigs) AddProgramWithoutChaining(ifaceName string, bpfProgs *models
 		bpfProg := bpfProgs.TCEgress[0]
 		if bpfProg.AdminStatus == models.Enabled {
 			if c.EgressTCBpfs[ifaceName] == nil {
-				c.EgressTCBpfs[ifaceName] = list.New()
-				if err := c.PushBackAndStartBPF(bpfProg, ifaceName, models.EgressType); err != nil {
+				c.setBpfList(models.EgressType, ifaceName, list.New())
+				if err := c.PushBackAndStartBPF(ctx, bpfProg, ifaceName, models.EgressType); err != nil {
 					return fmt.Errorf("failed to PushBackAndStartBPF BPF Program: %v", err)
 				}
 			} else {
@@ -1079,7 +1177,9 @@ func (c *NFConfigs) AddProgramWithoutChaining(ifaceName string, bpfProgs *models
 }
 
 // AddProgramsOnInterface: AddProgramsOnInterface will add given ebpf programs on given interface
-func (c *NFConfigs) AddProgramsOnInterface(ifaceName, HostName string, bpfProgs *models.BPFPrograms) error {
+func (c *NFConfigs) AddProgramsOnInterface(ctx context.Context, ifaceName, HostName string, bpfProgs *models.BPFPrograms) (err error) {
+	ctx, span := tracing.Start(ctx, "NFConfigs.AddProgramsOnInterface", tracing.IfaceKey.String(ifaceName))
+	defer func() { tracing.End(span, err) }()
 
 	if HostName != c.HostName {
 		errOut := fmt.Errorf("provided bpf programs do not belong to this host")
@@ -1101,9 +1201,10 @@ func (c *NFConfigs) AddProgramsOnInterface(ifaceName, HostName string, bpfProgs
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	defer c.lockIface(ifaceName)()
 
 	if !c.HostConfig.BpfChainingEnabled {
-		errout := c.AddProgramWithoutChaining(ifaceName, bpfProgs)
+		errout := c.AddProgramWithoutChaining(ctx, ifaceName, bpfProgs)
 		if errout != nil {
 			return errout
 		}
@@ -1113,18 +1214,18 @@ func (c *NFConfigs) AddProgramsOnInterface(ifaceName, HostName string, bpfProgs
 	for _, bpfProg := range bpfProgs.XDPIngress {
 		if c.IngressXDPBpfs[ifaceName] == nil {
 			if bpfProg.AdminStatus == models.Enabled {
-				c.IngressXDPBpfs[ifaceName] = list.New()
-				if err := c.VerifyAndStartXDPRootProgram(ifaceName, models.XDPIngressType); err != nil {
-					c.IngressXDPBpfs[ifaceName] = nil
+				c.setBpfList(models.XDPIngressType, ifaceName, list.New())
+				if err := c.VerifyAndStartXDPRootProgram(ctx, ifaceName, models.XDPIngressType); err != nil {
+					c.setBpfList(models.XDPIngressType, ifaceName, nil)
 					return fmt.Errorf("failed to chain XDP BPF programs: %v", err)
 				}
 
-				log.Info().Msgf("Push Back and Start XDP program : %s seq_id : %d", bpfProg.Name, bpfProg.SeqID)
-				if err := c.PushBackAndStartBPF(bpfProg, ifaceName, models.XDPIngressType); err != nil {
+				log.Info().Str("program", bpfProg.Name).Str("iface", ifaceName).Int("seq_id", bpfProg.SeqID).Msg("Push Back and Start XDP program")
+				if err := c.PushBackAndStartBPF(ctx, bpfProg, ifaceName, models.XDPIngressType); err != nil {
 					return fmt.Errorf("failed to PushBackAndStartBPF BPF Program: %v", err)
 				}
 			}
-		} else if err := c.AddAndStartBPF(bpfProg, ifaceName, models.XDPIngressType); err != nil {
+		} else if err := c.AddAndStartBPF(ctx, bpfProg, ifaceName, models.XDPIngressType); err != nil {
 			return fmt.Errorf("failed to AddAndStartBPF xdp BPF Program: %v", err)
 		}
 	}
@@ -1132,17 +1233,17 @@ func (c *NFConfigs) AddProgramsOnInterface(ifaceName, HostName string, bpfProgs
 	for _, bpfProg := range bpfProgs.TCIngress {
 		if c.IngressTCBpfs[ifaceName] == nil {
 			if bpfProg.AdminStatus == models.Enabled {
-				c.IngressTCBpfs[ifaceName] = list.New()
-				if err := c.VerifyAndStartTCRootProgram(ifaceName, models.IngressType); err != nil {
-					c.IngressTCBpfs[ifaceName] = nil
+				c.setBpfList(models.IngressType, ifaceName, list.New())
+				if err := c.VerifyAndStartTCRootProgram(ctx, ifaceName, models.IngressType); err != nil {
+					c.setBpfList(models.IngressType, ifaceName, nil)
 					return fmt.Errorf("failed to chain ingress tc bpf programs: %v", err)
 				}
 
-				if err := c.PushBackAndStartBPF(bpfProg, ifaceName, models.IngressType); err != nil {
+				if err := c.PushBackAndStartBPF(ctx, bpfProg, ifaceName, models.IngressType); err != nil {
 					return fmt.Errorf("failed to PushBackAndStartBPF BPF Program: %v", err)
 				}
 			}
-		} else if err := c.AddAndStartBPF(bpfProg, ifaceName, models.IngressType); err != nil {
+		} else if err := c.AddAndStartBPF(ctx, bpfProg, ifaceName, models.IngressType); err != nil {
 			return fmt.Errorf("failed to AddAndStartBPF tcingress BPF Program: %v", err)
 		}
 	}
@@ -1150,16 +1251,16 @@ func (c *NFConfigs) AddProgramsOnInterface(ifaceName, HostName string, bpfProgs
 	for _, bpfProg := range bpfProgs.TCEgress {
 		if c.EgressTCBpfs[ifaceName] == nil {
 			if bpfProg.AdminStatus == models.Enabled {
-				c.EgressTCBpfs[ifaceName] = list.New()
-				if err := c.VerifyAndStartTCRootProgram(ifaceName, models.EgressType); err != nil {
-					c.EgressTCBpfs[ifaceName] = nil
+				c.setBpfList(models.EgressType, ifaceName, list.New())
+				if err := c.VerifyAndStartTCRootProgram(ctx, ifaceName, models.EgressType); err != nil {
+					c.setBpfList(models.EgressType, ifaceName, nil)
 					return fmt.Errorf("failed to chain ingress tc bpf programs: %v", err)
 				}
-				if err := c.PushBackAndStartBPF(bpfProg, ifaceName, models.EgressType); err != nil {
+				if err := c.PushBackAndStartBPF(ctx, bpfProg, ifaceName, models.EgressType); err != nil {
 					return fmt.Errorf("failed to PushBackAndStartBPF BPF Program: %v", err)
 				}
 			}
-		} else if err := c.AddAndStartBPF(bpfProg, ifaceName, models.EgressType); err != nil {
+		} else if err := c.AddAndStartBPF(ctx, bpfProg, ifaceName, models.EgressType); err != nil {
 			return fmt.Errorf("failed to AddAndStartBPF tcegress BPF Program: %v", err)
 		}
 	}
@@ -1167,25 +1268,34 @@ func (c *NFConfigs) AddProgramsOnInterface(ifaceName, HostName string, bpfProgs
 	return nil
 }
 
-// AddeBPFPrograms - Starts eBPF programs on the node if they are not running
-func (c *NFConfigs) AddeBPFPrograms(bpfProgs []models.L3afBPFPrograms) error {
+// AddeBPFPrograms - Starts eBPF programs on the node if they are not running, the programs are added to the desired configs.
+// Invalid programs are rejected before anything is changed, the problems are returned as schema.Errors.
+func (c *NFConfigs) AddeBPFPrograms(ctx context.Context, bpfProgs []models.L3afBPFPrograms) error {
+	if err := c.validateAddedPrograms(bpfProgs); err != nil {
+		return err
+	}
+	audit.RecordChanges(ctx, c.addDesired(bpfProgs))
 	for _, bpfProg := range bpfProgs {
-		if err := c.AddProgramsOnInterface(bpfProg.Iface, bpfProg.HostName, bpfProg.BpfPrograms); err != nil {
-			if err := c.SaveConfigsToConfigStore(); err != nil {
+		err := c.AddProgramsOnInterface(ctx, bpfProg.Iface, bpfProg.HostName, bpfProg.BpfPrograms)
+		c.observe(bpfProg.Iface, "", "", err)
+		if err != nil {
+			if err := c.SaveConfigsToConfigStore(ctx); err != nil {
 				return fmt.Errorf("add eBPF Programs failed to save configs %v", err)
 			}
 			return fmt.Errorf("failed to Add BPF program on iface %s with error: %v", bpfProg.Iface, err)
 		}
 		c.ifaces = map[string]string{bpfProg.Iface: bpfProg.Iface}
 	}
-	if err := c.SaveConfigsToConfigStore(); err != nil {
+	if err := c.SaveConfigsToConfigStore(ctx); err != nil {
 		return fmt.Errorf("AddeBPFPrograms failed to save configs %v", err)
 	}
 	return nil
 }
 
 // DeleteProgramsOnInterface : It will delete ebpf Programs on the given interface
-func (c *NFConfigs) DeleteProgramsOnInterface(ifaceName, HostName string, bpfProgs *models.BPFProgramNames) error {
+func (c *NFConfigs) DeleteProgramsOnInterface(ctx context.Context, ifaceName, HostName string, bpfProgs *models.BPFProgramNames) (err error) {
+	ctx, span := tracing.Start(ctx, "NFConfigs.DeleteProgramsOnInterface", tracing.IfaceKey.String(ifaceName))
+	defer func() { tracing.End(span, err) }()
 	if HostName != c.HostName {
 		errOut := fmt.Errorf("provided bpf programs do not belong to this host")
 		log.Error().Err(errOut)
@@ -1206,6 +1316,7 @@ func (c *NFConfigs) DeleteProgramsOnInterface(ifaceName, HostName string, bpfPro
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	defer c.lockIface(ifaceName)()
 
 	sort.Strings(bpfProgs.XDPIngress)
 	if c.IngressXDPBpfs[ifaceName] != nil {
@@ -1214,7 +1325,7 @@ func (c *NFConfigs) DeleteProgramsOnInterface(ifaceName, HostName string, bpfPro
 			next := e.Next()
 			data := e.Value.(*BPF)
 			if BinarySearch(bpfProgs.XDPIngress, data.Program.Name) {
-				err := c.DeleteProgramsOnInterfaceHelper(e, ifaceName, models.XDPIngressType, bpfList)
+				err := c.DeleteProgramsOnInterfaceHelper(ctx, e, ifaceName, models.XDPIngressType, bpfList)
 				if err != nil {
 					return fmt.Errorf("DeleteProgramsOnInterfaceHelper function failed : %v", err)
 				}
@@ -1222,7 +1333,7 @@ func (c *NFConfigs) DeleteProgramsOnInterface(ifaceName, HostName string, bpfPro
 			e = next
 		}
 		if bpfList.Len() == 0 {
-			c.IngressXDPBpfs[ifaceName] = nil
+			c.setBpfList(models.XDPIngressType, ifaceName, nil)
 		}
 	}
 	sort.Strings(bpfProgs.TCIngress)
@@ -1232,7 +1343,7 @@ func (c *NFConfigs) DeleteProgramsOnInterface(ifaceName, HostName string, bpfPro
 			next := e.Next()
 			data := e.Value.(*BPF)
 			if BinarySearch(bpfProgs.TCIngress, data.Program.Name) {
-				err := c.DeleteProgramsOnInterfaceHelper(e, ifaceName, models.IngressType, bpfList)
+				err := c.DeleteProgramsOnInterfaceHelper(ctx, e, ifaceName, models.IngressType, bpfList)
 				if err != nil {
 					return fmt.Errorf("DeleteProgramsOnInterfaceHelper function failed : %v", err)
 				}
@@ -1240,7 +1351,7 @@ func (c *NFConfigs) DeleteProgramsOnInterface(ifaceName, HostName string, bpfPro
 			e = next
 		}
 		if bpfList.Len() == 0 {
-			c.IngressTCBpfs[ifaceName] = nil
+			c.setBpfList(models.IngressType, ifaceName, nil)
 		}
 	}
 
@@ -1251,7 +1362,7 @@ func (c *NFConfigs) DeleteProgramsOnInterface(ifaceName, HostName string, bpfPro
 			next := e.Next()
 			data := e.Value.(*BPF)
 			if BinarySearch(bpfProgs.TCEgress, data.Program.Name) {
-				err := c.DeleteProgramsOnInterfaceHelper(e, ifaceName, models.EgressType, bpfList)
+				err := c.DeleteProgramsOnInterfaceHelper(ctx, e, ifaceName, models.EgressType, bpfList)
 				if err != nil {
 					return fmt.Errorf("DeleteProgramsOnInterfaceHelper function failed : %v", err)
 				}
@@ -1259,20 +1370,20 @@ func (c *NFConfigs) DeleteProgramsOnInterface(ifaceName, HostName string, bpfPro
 			e = next
 		}
 		if bpfList.Len() == 0 {
-			c.EgressTCBpfs[ifaceName] = nil
+			c.setBpfList(models.EgressType, ifaceName, nil)
 		}
 	}
 	return nil
 }
 
 // DeleteProgramsOnInterfaceHelper : helper function for DeleteProgramsOnInterface function
-func (c *NFConfigs) DeleteProgramsOnInterfaceHelper(e *list.Element, ifaceName string, direction string, bpfList *list.List) error {
+func (c *NFConfigs) DeleteProgramsOnInterfaceHelper(ctx context.Context, e *list.Element, ifaceName string, direction string, bpfList *list.List) error {
 	if e == nil {
 		return nil
 	}
 	prog := e.Value.(*BPF)
 	prog.Program.AdminStatus = models.Disabled
-	if err := prog.Stop(ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
+	if err := prog.Stop(ctx, ifaceName, direction, c.HostConfig.BpfChainingEnabled); err != nil {
 		return fmt.Errorf("failed to stop %s iface %s direction %s", prog.Program.Name, ifaceName, direction)
 	}
 	tmpNextBPF := e.Next()
@@ -1284,33 +1395,34 @@ func (c *NFConfigs) DeleteProgramsOnInterfaceHelper(e *list.Element, ifaceName s
 	}
 	if tmpNextBPF != nil && tmpNextBPF.Prev() != nil { // relink the next element
 		if err := c.LinkBPFPrograms(tmpNextBPF.Prev().Value.(*BPF), tmpNextBPF.Value.(*BPF)); err != nil {
-			log.Error().Err(err).Msgf("DeleteProgramsOnInterfaceHelper - failed LinkBPFPrograms")
+			prog.logger(ifaceName, direction).Error().Err(err).Msg("DeleteProgramsOnInterfaceHelper - failed LinkBPFPrograms")
 			return fmt.Errorf("DeleteProgramsOnInterfaceHelper - failed LinkBPFPrograms %v", err)
 		}
 	}
 	// Check if list contains root program only then stop the root program.
 	if tmpPreviousBPF.Prev() == nil && tmpPreviousBPF.Next() == nil {
-		log.Info().Msgf("no ebpf programs are running, stopping root program")
+		log.Info().Str("iface", ifaceName).Str("direction", direction).Msg("no ebpf programs are running, stopping root program")
 
-		if err := c.StopRootProgram(ifaceName, direction); err != nil {
+		if err := c.StopRootProgram(ctx, ifaceName, direction); err != nil {
 			return fmt.Errorf("failed to stop to root program of iface %s direction %v", ifaceName, direction)
 		}
 	}
 	return nil
 }
 
-// DeleteEbpfPrograms - Delete eBPF programs on the node if they are running
-func (c *NFConfigs) DeleteEbpfPrograms(bpfProgs []models.L3afBPFProgramNames) error {
+// DeleteEbpfPrograms - Delete eBPF programs on the node if they are running, the programs are removed from the desired configs
+func (c *NFConfigs) DeleteEbpfPrograms(ctx context.Context, bpfProgs []models.L3afBPFProgramNames) error {
+	audit.RecordChanges(ctx, c.deleteDesired(bpfProgs))
 	for _, bpfProg := range bpfProgs {
-		if err := c.DeleteProgramsOnInterface(bpfProg.Iface, bpfProg.HostName, bpfProg.BpfProgramNames); err != nil {
-			if err := c.SaveConfigsToConfigStore(); err != nil {
+		if err := c.DeleteProgramsOnInterface(ctx, bpfProg.Iface, bpfProg.HostName, bpfProg.BpfProgramNames); err != nil {
+			if err := c.SaveConfigsToConfigStore(ctx); err != nil {
 				return fmt.Errorf("SaveConfigsToConfigStore failed to save configs %v", err)
 			}
 			return fmt.Errorf("failed to Remove eBPF program on iface %s with error: %v", bpfProg.Iface, err)
 		}
 		c.ifaces = map[string]string{bpfProg.Iface: bpfProg.Iface}
 	}
-	if err := c.SaveConfigsToConfigStore(); err != nil {
+	if err := c.SaveConfigsToConfigStore(ctx); err != nil {
 		return fmt.Errorf("DeleteEbpfPrograms failed to save configs %v", err)
 	}
 	return nil
@@ -15,8 +15,6 @@ import (
 
 	"github.com/l3af-project/l3afd/config"
 	"github.com/l3af-project/l3afd/models"
-
-	"github.com/rs/zerolog/log"
 )
 
 var (
@@ -350,7 +348,7 @@ func TestNFConfigs_Deploy(t *testing.T) {
 				processMon:     tt.fields.processMon,
 				mu:             new(sync.Mutex),
 			}
-			if err := cfg.Deploy(tt.args.iface, tt.args.hostName, tt.args.bpfProgs); (err != nil) != tt.wantErr {
+			if err := cfg.Deploy(context.Background(), tt.args.iface, tt.args.hostName, tt.args.bpfProgs); (err != nil) != tt.wantErr {
 				t.Errorf("NFConfigs.Deploy() error = %#v, wantErr %#v", err, tt.wantErr)
 			}
 		})
@@ -554,7 +552,7 @@ func Test_AddProgramsOnInterface(t *testing.T) {
 				hostInterfaces: tt.field.hostInterfaces,
 				mu:             tt.field.mu,
 			}
-			err := cfg.AddProgramsOnInterface(tt.arg.iface, tt.arg.hostName, tt.arg.bpfProgs)
+			err := cfg.AddProgramsOnInterface(context.Background(), tt.arg.iface, tt.arg.hostName, tt.arg.bpfProgs)
 			if (err != nil) != tt.wanterr {
 				t.Errorf("AddProgramsOnInterface: %v", err)
 			}
@@ -697,7 +695,7 @@ func TestAddeBPFPrograms(t *testing.T) {
 				hostInterfaces: tt.field.hostInterfaces,
 				mu:             tt.field.mu,
 			}
-			err := cfg.AddeBPFPrograms(tt.arg)
+			err := cfg.AddeBPFPrograms(context.Background(), tt.arg)
 			if (err != nil) != tt.wanterr {
 				t.Errorf("AddeBPFPrograms failed: %v", err)
 			}
@@ -793,7 +791,7 @@ func TestDeleteProgramsOnInterface(t *testing.T) {
 				hostInterfaces: tt.field.hostInterfaces,
 				mu:             tt.field.mu,
 			}
-			err := cfg.DeleteProgramsOnInterface(tt.arg.iface, tt.arg.hostName, tt.arg.bpfProgs)
+			err := cfg.DeleteProgramsOnInterface(context.Background(), tt.arg.iface, tt.arg.hostName, tt.arg.bpfProgs)
 			if (err != nil) != tt.wanterr {
 				t.Errorf("DeleteProgramsOnInterface failed: %v", err)
 			}
@@ -925,7 +923,7 @@ func TestDeleteEbpfPrograms(t *testing.T) {
 				hostInterfaces: tt.field.hostInterfaces,
 				mu:             tt.field.mu,
 			}
-			err := cfg.DeleteEbpfPrograms(tt.arg)
+			err := cfg.DeleteEbpfPrograms(context.Background(), tt.arg)
 			if (err != nil) != tt.wanterr {
 				t.Errorf("DeleteEbpfPrograms failed: %v", err)
 			}
@@ -979,7 +977,7 @@ func TestAddAndStartBPF(t *testing.T) {
 				ctx:        tt.fields.ctx,
 				HostConfig: tt.fields.hostConfig,
 			}
-			e := cfg.AddAndStartBPF(tt.args.bpfProg, tt.args.iface, tt.args.direction)
+			e := cfg.AddAndStartBPF(context.Background(), tt.args.bpfProg, tt.args.iface, tt.args.direction)
 			if (e != nil) != tt.wanterr {
 				t.Errorf("AddAndStartBPF failed : %v", e)
 			}
@@ -1068,7 +1066,7 @@ func TestAddProgramWithoutChaining(t *testing.T) {
 				EgressTCBpfs:   tt.field.egressTCBpfs,
 				IngressTCBpfs:  tt.field.ingressTCBpfs,
 			}
-			e := cfg.AddProgramWithoutChaining(tt.arg.iface, tt.arg.bpfProgs)
+			e := cfg.AddProgramWithoutChaining(context.Background(), tt.arg.iface, tt.arg.bpfProgs)
 			if (e != nil) != tt.wanterr {
 				t.Errorf(" AddProgramWithoutChaining failed : %v", e)
 			}
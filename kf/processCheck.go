@@ -6,18 +6,37 @@ package kf
 
 import (
 	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
 	"time"
 
 	"github.com/l3af-project/l3afd/models"
 	"github.com/l3af-project/l3afd/stats"
-
-	"github.com/rs/zerolog/log"
+	"github.com/l3af-project/l3afd/tracing"
 )
 
+// crashLoopLogLines - number of lines of the captured user program output logged when it is crash looping
+const crashLoopLogLines = 20
+
 type pCheck struct {
 	MaxRetryCount     int
 	Chain             bool
 	retryMonitorDelay time.Duration
+
+	// restart policy
+	backoffInitial     time.Duration
+	backoffMax         time.Duration
+	stableDuration     time.Duration
+	unlinkCrashLooping bool
+
+	// last completed poll of the monitor workers, direction is the key
+	lastPoll map[string]*atomic.Int64
+
+	// locks of the programs, shared with the deploys and the reconciler changing them
+	locks *programLocks
 }
 
 func NewpCheck(rc int, chain bool, interval time.Duration) *pCheck {
@@ -29,60 +48,258 @@ func NewpCheck(rc int, chain bool, interval time.Duration) *pCheck {
 	return c
 }
 
+// SetRestartPolicy - configures the backoff between restart attempts, the duration after which
+// the restart count of a running program is reset and whether crash looping programs are unlinked from the chain.
+func (c *pCheck) SetRestartPolicy(backoffInitial, backoffMax, stableDuration time.Duration, unlinkCrashLooping bool) {
+	c.backoffInitial = backoffInitial
+	c.backoffMax = backoffMax
+	c.stableDuration = stableDuration
+	c.unlinkCrashLooping = unlinkCrashLooping
+}
+
 func (c *pCheck) pCheckStart(xdpProgs, ingressTCProgs, egressTCProgs map[string]*list.List) {
+	if c.locks == nil {
+		c.locks = new(programLocks)
+	}
+	c.lastPoll = make(map[string]*atomic.Int64)
+	for _, direction := range []string{models.XDPIngressType, models.IngressType, models.EgressType} {
+		c.lastPoll[direction] = new(atomic.Int64)
+		c.lastPoll[direction].Store(time.Now().UnixNano())
+	}
 	go c.pMonitorWorker(xdpProgs, models.XDPIngressType)
 	go c.pMonitorWorker(ingressTCProgs, models.IngressType)
 	go c.pMonitorWorker(egressTCProgs, models.EgressType)
 }
 
 func (c *pCheck) pMonitorWorker(bpfProgs map[string]*list.List, direction string) {
-	for range time.NewTicker(c.retryMonitorDelay).C {
-		for ifaceName, bpfList := range bpfProgs {
-			if bpfList == nil { // no bpf programs are running
-				continue
+	for now := range time.NewTicker(c.retryMonitorDelay).C {
+		c.poll(bpfProgs, direction, now)
+		c.lastPoll[direction].Store(time.Now().UnixNano())
+	}
+}
+
+// poll - verifies the programs of every interface, holding the lock of the programs of the interface so that a
+// program is never restarted by the monitor and changed by a deploy or the reconciler at once. An interface whose
+// programs are locked is skipped, the monitor does not wait for deploys and checks them on the next poll.
+func (c *pCheck) poll(bpfProgs map[string]*list.List, direction string, now time.Time) {
+	for ifaceName, bpfList := range c.locks.snapshot(bpfProgs) {
+		lock := c.locks.iface(ifaceName)
+		if !lock.TryLock() {
+			log.Debug().Str("iface", ifaceName).Str("direction", direction).Msg("pMonitor programs are being changed, skipping")
+			continue
+		}
+		// the list is replaced when all its programs were stopped meanwhile
+		if c.locks.current(bpfProgs, ifaceName) == bpfList {
+			c.pMonitorList(bpfList, ifaceName, direction, now)
+		}
+		lock.Unlock()
+	}
+}
+
+// responsive - reports an error if a monitor worker did not complete a poll within timeout
+func (c *pCheck) responsive(timeout time.Duration) error {
+	for direction, lastPoll := range c.lastPoll {
+		if age := time.Since(time.Unix(0, lastPoll.Load())); age > timeout {
+			return fmt.Errorf("%s process monitor did not complete a poll for %s", direction, age.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// pMonitorList - verifies the programs of the list are running and restarts them otherwise
+func (c *pCheck) pMonitorList(bpfList *list.List, ifaceName, direction string, now time.Time) {
+	for e := bpfList.Front(); e != nil; e = e.Next() {
+		bpf := e.Value.(*BPF)
+		if c.Chain && bpf.Program.SeqID == 0 { // do not monitor root program
+			checkHealth(e, ifaceName, direction, c.Chain, true, bpf.IsLoaded(), now)
+			continue
+		}
+		if bpf.Program.AdminStatus == models.Disabled {
+			continue
+		}
+		userProgram, bpfProgram, _ := bpf.isRunning()
+		checkHealth(e, ifaceName, direction, c.Chain, userProgram, bpfProgram, now)
+		if userProgram && bpfProgram {
+			stats.SetWithVersion(1.0, stats.NFRunning, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+			bpf.updateResourceUsage(ifaceName, direction)
+			if bpf.RestartCount > 0 && c.stableDuration > 0 && now.Sub(bpf.LastRestartTime) >= c.stableDuration {
+				c.resetRestartCount(e, ifaceName, direction)
 			}
-			for e := bpfList.Front(); e != nil; e = e.Next() {
-				bpf := e.Value.(*BPF)
-				if c.Chain && bpf.Program.SeqID == 0 { // do not monitor root program
-					continue
-				}
-				if bpf.Program.AdminStatus == models.Disabled {
-					continue
-				}
-				userProgram, bpfProgram, _ := bpf.isRunning()
-				if userProgram && bpfProgram {
-					stats.SetWithVersion(1.0, stats.NFRunning, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
-					continue
-				}
-				// Not running trying to restart
-				if bpf.RestartCount < c.MaxRetryCount && bpf.Program.AdminStatus == models.Enabled {
-					bpf.RestartCount++
-					log.Warn().Msgf("pMonitor BPF Program is not running. Restart attempt: %d, program name: %s, iface: %s",
-						bpf.RestartCount, bpf.Program.Name, ifaceName)
-					//  User program is a daemon and not running, but the BPF program is loaded
-					if !userProgram && bpfProgram {
-						if err := bpf.StartUserProgram(ifaceName, direction, c.Chain); err != nil {
-							log.Error().Err(err).Msgf("pMonitorWorker: BPF Program start user program failed for program %s", bpf.Program.Name)
-						}
-					}
-					// BPF program is not loaded.
-					// if user program is daemon then stop it and restart both the programs
-					if !bpfProgram {
-						log.Warn().Msgf("%s BPF program is not loaded, %s program reloading ...", bpf.Program.EntryFunctionName, bpf.Program.Name)
-						// User program is a daemon and running, stop before reloading the BPF program
-						if bpf.Program.UserProgramDaemon && userProgram {
-							if err := bpf.Stop(ifaceName, direction, c.Chain); err != nil {
-								log.Error().Err(err).Msgf("pMonitorWorker: BPF Program stop failed for program %s", bpf.Program.Name)
-							}
-						}
-						if err := bpf.Start(ifaceName, direction, c.Chain); err != nil {
-							log.Error().Err(err).Msgf("pMonitorWorker: BPF Program start failed for program %s", bpf.Program.Name)
-						}
-					}
-				} else {
-					stats.SetWithVersion(0.0, stats.NFRunning, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+			continue
+		}
+		// crash looping programs keep being restarted at the maximum backoff, they are reset once running stable
+		if !bpf.CrashLooping && (bpf.RestartCount >= c.MaxRetryCount || bpf.Program.AdminStatus != models.Enabled) {
+			stats.SetWithVersion(0.0, stats.NFRunning, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+			if bpf.Program.AdminStatus == models.Enabled {
+				c.crashLooping(e, ifaceName, direction, now)
+			}
+			continue
+		}
+		if now.Before(bpf.NextRestartTime) {
+			bpf.logger(ifaceName, direction).Debug().Time("next_restart", bpf.NextRestartTime).Msg("pMonitor BPF Program restart is backed off")
+			continue
+		}
+		// Not running trying to restart
+		bpf.RestartCount++
+		bpf.LastRestartTime = now
+		if bpf.CrashLooping {
+			bpf.NextRestartTime = now.Add(c.crashLoopBackoff(bpf.RestartCount))
+		} else {
+			bpf.NextRestartTime = now.Add(c.backoff(bpf.RestartCount))
+		}
+		bpf.logger(ifaceName, direction).Warn().Int("restart_count", bpf.RestartCount).Msg("pMonitor BPF Program is not running, restarting")
+		// every restart is traced on its own, no API request is involved
+		ctx, span := bpf.startSpan(context.Background(), "pCheck.restart", ifaceName, direction)
+		var restartErr error
+		//  User program is a daemon and not running, but the BPF program is loaded
+		if !userProgram && bpfProgram {
+			if restartErr = bpf.StartUserProgram(ctx, ifaceName, direction, c.Chain); restartErr != nil {
+				bpf.logger(ifaceName, direction).Error().Err(restartErr).Msg("pMonitorWorker: BPF Program start user program failed")
+			}
+		}
+		// BPF program is not loaded.
+		// if user program is daemon then stop it and restart both the programs
+		if !bpfProgram {
+			bpf.logger(ifaceName, direction).Warn().Str("entry_function", bpf.Program.EntryFunctionName).Msg("BPF program is not loaded, reloading")
+			// User program is a daemon and running, stop before reloading the BPF program
+			if bpf.Program.UserProgramDaemon && userProgram {
+				if err := bpf.Stop(ctx, ifaceName, direction, c.Chain); err != nil {
+					bpf.logger(ifaceName, direction).Error().Err(err).Msg("pMonitorWorker: BPF Program stop failed")
 				}
 			}
+			if restartErr = bpf.Start(ctx, ifaceName, direction, c.Chain); restartErr != nil {
+				bpf.logger(ifaceName, direction).Error().Err(restartErr).Msg("pMonitorWorker: BPF Program start failed")
+			}
+		}
+		if restartErr != nil {
+			bpf.recordEvent(models.EventWarning, models.EventProgramRestartFailed, ifaceName, direction, restartErr.Error())
+		} else {
+			bpf.recordEvent(models.EventNormal, models.EventProgramRestarted, ifaceName, direction, fmt.Sprintf("restart attempt %d", bpf.RestartCount))
+		}
+		tracing.End(span, restartErr)
+	}
+}
+
+// backoff - returns the delay before the next restart attempt
+func (c *pCheck) backoff(attempt int) time.Duration {
+	return backoffDelay(c.backoffInitial, c.backoffMax, attempt)
+}
+
+// crashLoopBackoff - returns the delay before the next restart attempt of a crash looping program, the maximum
+// backoff or the growing backoff when it is not capped
+func (c *pCheck) crashLoopBackoff(attempt int) time.Duration {
+	if c.backoffMax > 0 {
+		return backoffDelay(c.backoffMax, c.backoffMax, 1)
+	}
+	return c.backoff(attempt + 1)
+}
+
+// backoffDelay - returns the delay before the next attempt, doubling with every attempt from initial up to max.
+// Half of the delay is randomized so programs failing together spread their attempts.
+func backoffDelay(initial, max time.Duration, attempt int) time.Duration {
+	if initial <= 0 {
+		return 0
+	}
+	delay := initial
+	for i := 1; i < attempt && (max <= 0 || delay < max) && delay <= math.MaxInt64/2; i++ {
+		delay <<= 1
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// crashLooping - marks the program as crash looping once its restart attempts are exhausted, from now on it is
+// restarted at the maximum backoff, and unlinks it from the chain if configured.
+func (c *pCheck) crashLooping(e *list.Element, ifaceName, direction string, now time.Time) {
+	bpf := e.Value.(*BPF)
+	bpf.CrashLooping = true
+	bpf.NextRestartTime = now.Add(c.crashLoopBackoff(bpf.RestartCount))
+	stats.SetWithVersion(1.0, stats.NFCrashLooping, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+	bpf.logger(ifaceName, direction).Error().Int("restart_count", bpf.RestartCount).Time("next_restart", bpf.NextRestartTime).Msg("pMonitor BPF Program is crash looping")
+	bpf.recordEvent(models.EventWarning, models.EventRestartBudgetExhausted, ifaceName, direction, fmt.Sprintf("restart budget exhausted after %d attempts, retrying at the maximum backoff", bpf.RestartCount))
+	if bpf.hostConfig != nil && bpf.hostConfig.UserProgramLogEnabled {
+		if lines, err := bpf.UserProgramLogs(ifaceName, direction, crashLoopLogLines); err == nil && len(lines) > 0 {
+			bpf.logger(ifaceName, direction).Error().Strs("output", lines).Msg("pMonitor BPF Program last output")
+		}
+	}
+
+	if !c.Chain || !c.unlinkCrashLooping {
+		return
+	}
+	prevBPF := linkedPrev(e)
+	if prevBPF == nil {
+		return
+	}
+	if nextBPF := linkedNext(e); nextBPF != nil {
+		if err := linkBPFPrograms(prevBPF, nextBPF); err != nil {
+			bpf.logger(ifaceName, direction).Error().Err(err).Msg("pMonitor failed to unlink crash looping BPF Program")
+			return
+		}
+	} else if err := prevBPF.RemoveNextProgFD(); err != nil {
+		bpf.logger(ifaceName, direction).Error().Err(err).Msg("pMonitor failed to unlink crash looping BPF Program")
+		return
+	}
+	bpf.Unlinked = true
+	bpf.logger(ifaceName, direction).Warn().Msg("pMonitor crash looping BPF Program is unlinked from the chain")
+}
+
+// resetRestartCount - resets the restart state of a program running stable since its last restart
+// and links it back into the chain if it was unlinked.
+func (c *pCheck) resetRestartCount(e *list.Element, ifaceName, direction string) {
+	bpf := e.Value.(*BPF)
+	bpf.logger(ifaceName, direction).Info().Int("restart_count", bpf.RestartCount).Msg("pMonitor BPF Program is running stable, resetting restart count")
+	bpf.RestartCount = 0
+	bpf.NextRestartTime = time.Time{}
+	if bpf.CrashLooping {
+		bpf.CrashLooping = false
+		stats.SetWithVersion(0.0, stats.NFCrashLooping, bpf.Program.Name, bpf.Program.Version, direction, ifaceName)
+	}
+	if !bpf.Unlinked {
+		return
+	}
+	// the neighbours may have been unlinked meanwhile, the program is linked between the nearest linked ones
+	var err error
+	if nextBPF := linkedNext(e); nextBPF != nil {
+		err = linkBPFPrograms(bpf, nextBPF)
+	} else {
+		err = bpf.RemoveNextProgFD()
+	}
+	if err != nil {
+		bpf.logger(ifaceName, direction).Error().Err(err).Msg("pMonitor failed to link back BPF Program")
+		return
+	}
+	if prevBPF := linkedPrev(e); prevBPF != nil {
+		if err := linkBPFPrograms(prevBPF, bpf); err != nil {
+			bpf.logger(ifaceName, direction).Error().Err(err).Msg("pMonitor failed to link back BPF Program")
+			return
+		}
+	}
+	bpf.Unlinked = false
+	if err := bpf.removeUnlinkedMap(); err != nil {
+		bpf.logger(ifaceName, direction).Warn().Err(err).Msg("pMonitor failed to remove prog map of unlinked BPF Program")
+	}
+	bpf.logger(ifaceName, direction).Info().Msg("pMonitor BPF Program is linked back into the chain")
+}
+
+// linkedPrev - returns the nearest previous program of the chain which is linked, nil when there is none
+func linkedPrev(e *list.Element) *BPF {
+	for p := e.Prev(); p != nil; p = p.Prev() {
+		if bpf := p.Value.(*BPF); !bpf.Unlinked && !bpf.CrashLooping {
+			return bpf
+		}
+	}
+	return nil
+}
+
+// linkedNext - returns the nearest next program of the chain which is linked, nil when there is none
+func linkedNext(e *list.Element) *BPF {
+	for n := e.Next(); n != nil; n = n.Next() {
+		if bpf := n.Value.(*BPF); !bpf.Unlinked && !bpf.CrashLooping {
+			return bpf
 		}
 	}
+	return nil
 }
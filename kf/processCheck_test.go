@@ -5,9 +5,16 @@ package kf
 
 import (
 	"container/list"
+	"context"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/cilium/ebpf"
+
+	"github.com/l3af-project/l3afd/models"
 )
 
 func TestNewpCheck(t *testing.T) {
@@ -83,3 +90,198 @@ func Test_pCheck_pCheckStart(t *testing.T) {
 		})
 	}
 }
+
+func Test_pCheck_backoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial time.Duration
+		max     time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{name: "disabled", initial: 0, max: time.Minute, attempt: 3, want: 0},
+		{name: "first", initial: 10 * time.Second, max: time.Minute, attempt: 1, want: 10 * time.Second},
+		{name: "third", initial: 10 * time.Second, max: time.Minute, attempt: 3, want: 40 * time.Second},
+		{name: "capped", initial: 10 * time.Second, max: time.Minute, attempt: 10, want: time.Minute},
+		{name: "uncapped", initial: time.Second, max: 0, attempt: 4, want: 8 * time.Second},
+		{name: "overflow", initial: time.Second, max: 0, attempt: 100, want: time.Second << 33},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &pCheck{backoffInitial: tt.initial, backoffMax: tt.max}
+			for i := 0; i < 20; i++ {
+				got := c.backoff(tt.attempt)
+				if got < tt.want/2 || got > tt.want {
+					t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.attempt, got, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_pCheck_pMonitorList(t *testing.T) {
+	c := newChainTest(t)
+	for _, p := range []struct {
+		name   string
+		seqID  int
+		progID ebpf.ProgramID
+		mapID  ebpf.MapID
+	}{
+		{name: "a", seqID: 1, progID: 11, mapID: 101},
+		{name: "b", seqID: 2, progID: 12, mapID: 102},
+		{name: "c", seqID: 3, progID: 13, mapID: 103},
+	} {
+		prog := c.program(p.name, p.seqID, p.progID, p.mapID)
+		if err := c.cfg.InsertAndStartBPFProgram(context.Background(), prog, chainTestIface, models.XDPIngressType); err != nil {
+			t.Fatalf("InsertAndStartBPFProgram(%s) error = %v", p.name, err)
+		}
+	}
+
+	pMon := NewpCheck(2, true, time.Second)
+	pMon.SetRestartPolicy(10*time.Second, time.Minute, 5*time.Minute, true)
+
+	// b is unloaded and fails to restart, its user program is missing
+	b := c.element("b").Value.(*BPF)
+	b.Program.CmdStart = "b_missing_start"
+	delete(c.kernel.progs, 12)
+
+	now := time.Now()
+	steps := []struct {
+		after        time.Duration
+		restartCount int
+		crashLooping bool
+	}{
+		{after: 0, restartCount: 1},
+		{after: time.Second, restartCount: 1},
+		{after: 10 * time.Second, restartCount: 2},
+		{after: 30 * time.Second, restartCount: 2, crashLooping: true},
+		{after: 31 * time.Second, restartCount: 2, crashLooping: true},
+		// crash looping programs are retried at the maximum backoff
+		{after: time.Hour, restartCount: 3, crashLooping: true},
+	}
+	for _, step := range steps {
+		pMon.pMonitorList(c.bpfList, chainTestIface, models.XDPIngressType, now.Add(step.after))
+		if b.RestartCount != step.restartCount || b.CrashLooping != step.crashLooping {
+			t.Fatalf("after %v: RestartCount = %d CrashLooping = %t, want %d %t",
+				step.after, b.RestartCount, b.CrashLooping, step.restartCount, step.crashLooping)
+		}
+	}
+	if !b.Unlinked {
+		t.Errorf("crash looping program is not unlinked")
+	}
+	// the failed restart of the unlinked program keeps the bypass of a to c
+	if next := b.NextRestartTime.Sub(now.Add(time.Hour)); next < 30*time.Second || next > time.Minute {
+		t.Errorf("next restart of crash looping program in %v, want the maximum backoff", next)
+	}
+	want := map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 13, 102: 13, 103: 0}
+	if !reflect.DeepEqual(c.kernel.progArrays, want) {
+		t.Errorf("prog arrays after unlink = %v, want %v", c.kernel.progArrays, want)
+	}
+
+	// c crash loops too, a is the nearest linked program before it
+	cBPF := c.element("c").Value.(*BPF)
+	cBPF.FilePath = ""
+	delete(c.kernel.progs, 13)
+	for _, after := range []time.Duration{0, 10 * time.Second, 30 * time.Second} {
+		pMon.pMonitorList(c.bpfList, chainTestIface, models.XDPIngressType, now.Add(2*time.Hour+after))
+	}
+	if !cBPF.CrashLooping || !cBPF.Unlinked {
+		t.Fatalf("CrashLooping = %t Unlinked = %t of c, want unlinked", cBPF.CrashLooping, cBPF.Unlinked)
+	}
+	want = map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 0, 102: 13, 103: 0}
+	if !reflect.DeepEqual(c.kernel.progArrays, want) {
+		t.Errorf("prog arrays after unlinking c = %v, want %v", c.kernel.progArrays, want)
+	}
+
+	// c recovers first and is linked after a, skipping b
+	c.kernel.progs[13] = true
+	cBPF.ProgID = 13
+	pMon.pMonitorList(c.bpfList, chainTestIface, models.XDPIngressType, cBPF.LastRestartTime.Add(5*time.Minute))
+	if cBPF.RestartCount != 0 || cBPF.CrashLooping || cBPF.Unlinked {
+		t.Errorf("RestartCount = %d CrashLooping = %t Unlinked = %t of c, want reset", cBPF.RestartCount, cBPF.CrashLooping, cBPF.Unlinked)
+	}
+	want = map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 13, 102: 13, 103: 0}
+	if !reflect.DeepEqual(c.kernel.progArrays, want) {
+		t.Errorf("prog arrays after linking back c = %v, want %v", c.kernel.progArrays, want)
+	}
+
+	// b restarts while unlinked, its user program links it into a map of its own instead of the map of a
+	b.Program.CmdStart = "b_unlinked_start"
+	if err := os.WriteFile(filepath.Join(b.FilePath, b.Program.CmdStart), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c.kernel.progs[22] = true
+	c.kernel.pending = []ebpf.ProgramID{22}
+	pMon.pMonitorList(c.bpfList, chainTestIface, models.XDPIngressType, b.NextRestartTime)
+	if b.ProgID != 22 || !b.Unlinked {
+		t.Fatalf("ProgID = %d Unlinked = %t after restart, want 22 unlinked", b.ProgID, b.Unlinked)
+	}
+	want = map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 13, 102: 13, 103: 0, 1000: 22}
+	if !reflect.DeepEqual(c.kernel.progArrays, want) {
+		t.Errorf("prog arrays after restart of unlinked b = %v, want %v", c.kernel.progArrays, want)
+	}
+
+	// b runs stable and is linked back between a and c
+	pMon.pMonitorList(c.bpfList, chainTestIface, models.XDPIngressType, b.LastRestartTime.Add(5*time.Minute))
+	if b.RestartCount != 0 || b.CrashLooping || b.Unlinked {
+		t.Errorf("RestartCount = %d CrashLooping = %t Unlinked = %t, want reset", b.RestartCount, b.CrashLooping, b.Unlinked)
+	}
+	want = map[ebpf.MapID]ebpf.ProgramID{100: 11, 101: 22, 102: 13, 103: 0, 1000: 22}
+	if !reflect.DeepEqual(c.kernel.progArrays, want) {
+		t.Errorf("prog arrays after link back = %v, want %v", c.kernel.progArrays, want)
+	}
+	if _, err := os.Stat(b.unlinkedMapPath()); !os.IsNotExist(err) {
+		t.Errorf("prog map of unlinked b is not removed: %v", err)
+	}
+}
+
+func Test_pCheck_poll(t *testing.T) {
+	c := newChainTest(t)
+	prog := c.program("a", 1, 11, 101)
+	if err := c.cfg.InsertAndStartBPFProgram(context.Background(), prog, chainTestIface, models.XDPIngressType); err != nil {
+		t.Fatalf("InsertAndStartBPFProgram() error = %v", err)
+	}
+	a := c.element("a").Value.(*BPF)
+	delete(c.kernel.progs, 11)
+
+	pMon := NewpCheck(3, true, time.Second)
+	pMon.locks = &c.cfg.locks
+	bpfProgs := map[string]*list.List{chainTestIface: c.bpfList}
+
+	// a deploy of the interface holds the lock, the monitor skips the interface instead of waiting for it
+	unlock := c.cfg.lockIface(chainTestIface)
+	done := make(chan struct{})
+	go func() {
+		pMon.poll(bpfProgs, models.XDPIngressType, time.Now())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("poll() waited for the programs locked by a deploy")
+	}
+	if a.RestartCount != 0 {
+		t.Errorf("RestartCount = %d, want the program changed by the lock holder left alone", a.RestartCount)
+	}
+	unlock()
+
+	pMon.poll(bpfProgs, models.XDPIngressType, time.Now())
+	if a.RestartCount != 1 {
+		t.Errorf("RestartCount = %d, want the program restarted once the interface is unlocked", a.RestartCount)
+	}
+}
+
+func Test_pCheck_responsive(t *testing.T) {
+	c := NewpCheck(3, true, time.Second)
+	if err := c.responsive(time.Minute); err != nil {
+		t.Errorf("responsive() before start error = %v", err)
+	}
+	c.pCheckStart(map[string]*list.List{}, map[string]*list.List{}, map[string]*list.List{})
+	if err := c.responsive(time.Minute); err != nil {
+		t.Errorf("responsive() after start error = %v", err)
+	}
+	c.lastPoll[models.EgressType].Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	if err := c.responsive(time.Minute); err == nil {
+		t.Errorf("responsive() of stalled monitor did not fail")
+	}
+}
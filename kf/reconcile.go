@@ -0,0 +1,407 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/stats"
+	"github.com/l3af-project/l3afd/tracing"
+)
+
+// Kinds of drift between the desired configs and the programs running in the kernel
+const (
+	driftMissing    = "missing"     // desired program is not running
+	driftOutdated   = "outdated"    // running program differs from the desired version or admin status
+	driftUnwanted   = "unwanted"    // running program is not desired
+	driftUnlinked   = "unlinked"    // prog map of the previous program in the chain does not point to the program
+	driftMapMissing = "map-missing" // pinned prog map of the program is missing
+	driftDetached   = "detached"    // program attached by l3afd is no longer attached to the interface
+)
+
+// Results of the corrections
+const (
+	reconcileSucceeded = "succeeded"
+	reconcileFailed    = "failed"
+)
+
+// driftKey identifies a drift of a program, name is empty for drifts of the whole interface
+type driftKey struct {
+	iface, direction, name, kind string
+}
+
+// drift defines a difference between the desired configs and the programs running in the kernel
+type drift struct {
+	driftKey
+	version string
+	message string
+}
+
+// action - returns the key of the correction, missing and outdated programs of an interface are
+// corrected together by deploying its desired config
+func (d drift) action() driftKey {
+	if d.kind == driftMissing || d.kind == driftOutdated {
+		return driftKey{iface: d.iface, kind: "deploy"}
+	}
+	return d.driftKey
+}
+
+// record - records an event of the drift in the event journal of this host
+func (d drift) record(eventType, reason, message string) {
+	journal.Load().Record(models.L3afEvent{
+		Type:      eventType,
+		Reason:    reason,
+		Program:   d.name,
+		Version:   d.version,
+		Iface:     d.iface,
+		Direction: d.direction,
+		Message:   message,
+	})
+}
+
+// correctionAttempt - corrections of a drift tried so far and the time of the next one
+type correctionAttempt struct {
+	count int
+	next  time.Time
+}
+
+// reconciler converges the programs running in the kernel to the desired configs
+type reconciler struct {
+	interval       time.Duration
+	backoffInitial time.Duration
+	backoffMax     time.Duration
+	maxActions     int
+
+	// serializes the passes
+	mu sync.Mutex
+	// drifts found by the last pass
+	drifts map[driftKey]drift
+	// corrections of the drifts, the action of the drift is the key
+	attempts map[driftKey]*correctionAttempt
+}
+
+func newReconciler(conf *config.Config) *reconciler {
+	return &reconciler{
+		interval:       conf.ReconcileInterval,
+		backoffInitial: conf.ReconcileBackoffInitial,
+		backoffMax:     conf.ReconcileBackoffMax,
+		maxActions:     conf.ReconcileMaxActions,
+		drifts:         make(map[driftKey]drift),
+		attempts:       make(map[driftKey]*correctionAttempt),
+	}
+}
+
+// StartReconciler - converges the programs running in the kernel to the desired configs every reconcile interval
+// and whenever a warning event is recorded, until ctx is done
+func (c *NFConfigs) StartReconciler(ctx context.Context) {
+	if !c.HostConfig.ReconcileEnabled || c.HostConfig.ReconcileInterval <= 0 {
+		log.Info().Msg("reconciler is disabled")
+		return
+	}
+	go c.reconcileLoop(ctx, newReconciler(c.HostConfig))
+}
+
+func (c *NFConfigs) reconcileLoop(ctx context.Context, r *reconciler) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	_, watcher := Events().Watch(EventFilter{Since: time.Now()})
+	defer func() { watcher.Stop() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.reconcile(ctx, r, now)
+		case e, ok := <-watcher.Events():
+			if !ok {
+				// fell behind while reconciling, the next pass covers the missed events
+				_, watcher = Events().Watch(EventFilter{Since: time.Now()})
+				continue
+			}
+			if e.Type != models.EventWarning || e.Reason == models.EventDriftDetected || e.Reason == models.EventDriftCorrectionFailed {
+				continue
+			}
+			log.Debug().Str("reason", e.Reason).Str("program", e.Program).Msg("reconciling on event")
+			c.reconcile(ctx, r, time.Now())
+		}
+	}
+}
+
+// reconcile - detects the drifts and corrects them, at most maxActions per pass. Corrections of a drift
+// are retried with exponential backoff until the drift is gone.
+func (c *NFConfigs) reconcile(ctx context.Context, r *reconciler, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	drifts := c.detectDrift()
+	current := make(map[driftKey]drift, len(drifts))
+	actions := make(map[driftKey]bool, len(drifts))
+	for _, d := range drifts {
+		current[d.driftKey] = d
+		actions[d.action()] = true
+		if _, ok := r.drifts[d.driftKey]; ok {
+			continue
+		}
+		log.Warn().Str("iface", d.iface).Str("direction", d.direction).Str("program", d.name).Str("drift", d.kind).Msg(d.message)
+		stats.SetDriftValue(1.0, stats.NFDrift, d.name, d.direction, d.iface, d.kind)
+		d.record(models.EventWarning, models.EventDriftDetected, fmt.Sprintf("%s: %s", d.kind, d.message))
+	}
+	for key, d := range r.drifts {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		log.Info().Str("iface", d.iface).Str("direction", d.direction).Str("program", d.name).Str("drift", d.kind).Msg("drift is corrected")
+		stats.SetDriftValue(0.0, stats.NFDrift, d.name, d.direction, d.iface, d.kind)
+		d.record(models.EventNormal, models.EventDriftCorrected, d.kind)
+	}
+	r.drifts = current
+	for key := range r.attempts {
+		if !actions[key] {
+			delete(r.attempts, key)
+		}
+	}
+
+	taken := 0
+	done := make(map[driftKey]bool, len(drifts))
+	for _, d := range drifts {
+		key := d.action()
+		if done[key] {
+			continue
+		}
+		done[key] = true
+		attempt, ok := r.attempts[key]
+		if !ok {
+			attempt = &correctionAttempt{}
+			r.attempts[key] = attempt
+		}
+		if now.Before(attempt.next) {
+			continue
+		}
+		if r.maxActions > 0 && taken >= r.maxActions {
+			log.Info().Int("max_actions", r.maxActions).Msg("reconcile action limit reached, remaining drifts are corrected in the next pass")
+			return
+		}
+		taken++
+		attempt.count++
+		attempt.next = now.Add(backoffDelay(r.backoffInitial, r.backoffMax, attempt.count))
+
+		result := reconcileSucceeded
+		if err := c.correct(ctx, d); err != nil {
+			result = reconcileFailed
+			log.Error().Err(err).Str("iface", d.iface).Str("direction", d.direction).Str("program", d.name).Str("drift", d.kind).
+				Int("attempt", attempt.count).Time("next_attempt", attempt.next).Msg("failed to correct drift")
+			d.record(models.EventWarning, models.EventDriftCorrectionFailed, fmt.Sprintf("%s: attempt %d: %v", d.kind, attempt.count, err))
+		} else {
+			log.Info().Str("iface", d.iface).Str("direction", d.direction).Str("program", d.name).Str("drift", d.kind).
+				Int("attempt", attempt.count).Msg("drift correction applied")
+		}
+		stats.IncrReconcile(stats.NFReconcileCount, d.name, d.direction, d.iface, d.kind, result)
+	}
+}
+
+// detectDrift - compares the desired configs with the running programs and their state in the kernel
+func (c *NFConfigs) detectDrift() []drift {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	drifts := make([]drift, 0)
+	desired := make(map[string]models.L3afBPFPrograms)
+	for _, cfg := range c.DesiredPrograms() {
+		desired[cfg.Iface] = cfg
+		for _, direction := range directions {
+			for _, prog := range *programsOf(cfg.BpfPrograms, direction) {
+				d := drift{driftKey: driftKey{iface: cfg.Iface, direction: direction, name: prog.Name}, version: prog.Version}
+				b := c.runningBPF(cfg.Iface, direction, prog.Name)
+				switch {
+				case b == nil && prog.AdminStatus == models.Enabled:
+					d.kind, d.message = driftMissing, "desired program is not running"
+				case b == nil:
+					continue
+				case b.Program.AdminStatus != prog.AdminStatus:
+					d.kind, d.message = driftOutdated, fmt.Sprintf("admin status is %s instead of %s", b.Program.AdminStatus, prog.AdminStatus)
+				case b.Program.Version != prog.Version:
+					d.kind, d.message = driftOutdated, fmt.Sprintf("running version %s instead of %s", b.Program.Version, prog.Version)
+				default:
+					continue
+				}
+				drifts = append(drifts, d)
+			}
+		}
+	}
+
+	chain := c.HostConfig.BpfChainingEnabled
+	for _, direction := range directions {
+		for iface, bpfList := range c.bpfLists(direction) {
+			if bpfList == nil {
+				continue
+			}
+			var progs []*models.BPFProgram
+			if cfg, ok := desired[iface]; ok {
+				progs = *programsOf(cfg.BpfPrograms, direction)
+			}
+			unlock := c.lockIface(iface)
+			drifts = append(drifts, listDrift(bpfList, progs, iface, direction, chain)...)
+			unlock()
+		}
+	}
+	return drifts
+}
+
+// listDrift - returns the drifts of the running programs of the list from the desired programs and the kernel
+func listDrift(bpfList *list.List, progs []*models.BPFProgram, iface, direction string, chain bool) []drift {
+	drifts := make([]drift, 0)
+	prevMapMissing := false
+	for e := bpfList.Front(); e != nil; e = e.Next() {
+		b := e.Value.(*BPF)
+		root := chain && e.Prev() == nil
+		d := drift{driftKey: driftKey{iface: iface, direction: direction, name: b.Program.Name}, version: b.Program.Version}
+		if !root && !desiredProgram(progs, b.Program.Name) {
+			d.kind, d.message = driftUnwanted, "running program is not in the desired config"
+			drifts = append(drifts, d)
+			prevMapMissing = false
+			continue
+		}
+		// programs not running are restarted by the process monitor
+		if b.CrashLooping || b.Program.AdminStatus != models.Enabled {
+			prevMapMissing = false
+			continue
+		}
+
+		mapMissing := false
+		if chain && len(b.Program.MapName) > 0 {
+			if _, err := b.kernel().PinnedMapID(b.MapNamePath); err != nil {
+				mapMissing = true
+				d.kind, d.message = driftMapMissing, fmt.Sprintf("pinned prog map %s is missing: %v", b.MapNamePath, err)
+				drifts = append(drifts, d)
+			}
+		}
+		if check, ok := b.checkAttach(iface, direction); ok && !check.Healthy {
+			d.kind, d.message = driftDetached, check.Message
+			drifts = append(drifts, d)
+		}
+		// the link of a program behind a missing prog map is restored with the map
+		if !prevMapMissing && b.ProgID != 0 {
+			if check, ok := b.checkLinkage(e, chain); ok && !check.Healthy && !b.Unlinked {
+				d.kind, d.message = driftUnlinked, check.Message
+				drifts = append(drifts, d)
+			}
+		}
+		prevMapMissing = mapMissing
+	}
+	return drifts
+}
+
+func desiredProgram(progs []*models.BPFProgram, name string) bool {
+	for _, prog := range progs {
+		if prog.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// correct - takes the action correcting the drift
+func (c *NFConfigs) correct(ctx context.Context, d drift) (err error) {
+	ctx, span := tracing.Start(ctx, "NFConfigs.reconcile", tracing.IfaceKey.String(d.iface), tracing.DirectionKey.String(d.direction), tracing.ProgramKey.String(d.name))
+	defer func() { tracing.End(span, err) }()
+
+	if d.kind == driftMissing || d.kind == driftOutdated {
+		cfg := c.DesiredProgramsOf(d.iface)
+		c.refreshHostInterface(d.iface)
+		err = c.Deploy(ctx, d.iface, cfg.HostName, cfg.BpfPrograms)
+		c.observe(d.iface, "", "", err)
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.lockIface(d.iface)()
+	bpfList := c.bpfList(d.iface, d.direction)
+	var e *list.Element
+	if bpfList != nil {
+		for e = bpfList.Front(); e != nil && e.Value.(*BPF).Program.Name != d.name; e = e.Next() {
+		}
+	}
+	if e == nil {
+		// removed since the drift was detected
+		return nil
+	}
+
+	switch d.kind {
+	case driftUnwanted:
+		if err := c.DeleteProgramsOnInterfaceHelper(ctx, e, d.iface, d.direction, bpfList); err != nil {
+			return err
+		}
+		if bpfList.Len() == 0 {
+			c.setBpfList(d.direction, d.iface, nil)
+		}
+		return nil
+	case driftUnlinked:
+		return linkBPFPrograms(e.Prev().Value.(*BPF), e.Value.(*BPF))
+	default:
+		return c.restartBPF(ctx, e, d.iface, d.direction)
+	}
+}
+
+// refreshHostInterface - adds the interface to the host interfaces once it exists, it may be created after l3afd started
+func (c *NFConfigs) refreshHostInterface(ifaceName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hostInterfaces[ifaceName] {
+		return
+	}
+	ifaces, err := getHostInterfaces()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get network interfaces")
+		return
+	}
+	if ifaces[ifaceName] {
+		if c.hostInterfaces == nil {
+			c.hostInterfaces = make(map[string]bool)
+		}
+		c.hostInterfaces[ifaceName] = true
+	}
+}
+
+// restartBPF - reloads the program at element e, re-creating its pinned maps and attachment, and links it back into the chain
+func (c *NFConfigs) restartBPF(ctx context.Context, e *list.Element, ifaceName, direction string) error {
+	chain := c.HostConfig.BpfChainingEnabled
+	bpf := e.Value.(*BPF)
+	if err := bpf.Stop(ctx, ifaceName, direction, chain); err != nil {
+		bpf.logger(ifaceName, direction).Warn().Err(err).Msg("reconcile failed to stop BPF program, starting it again anyway")
+	}
+
+	if chain && e.Prev() == nil {
+		root, err := loadRootProgram(ctx, ifaceName, direction, bpf.Program.ProgType, c.HostConfig, c.kernel())
+		if err != nil {
+			return fmt.Errorf("failed to reload root program %s: %v", bpf.Program.Name, err)
+		}
+		e.Value = root
+		bpf = root
+	} else if err := bpf.Start(ctx, ifaceName, direction, chain); err != nil {
+		return fmt.Errorf("failed to restart BPF program %s: %v", bpf.Program.Name, err)
+	}
+
+	if !chain {
+		return nil
+	}
+	if e.Prev() != nil {
+		if err := linkBPFPrograms(e.Prev().Value.(*BPF), bpf); err != nil {
+			return err
+		}
+	}
+	if e.Next() != nil {
+		if err := linkBPFPrograms(bpf, e.Next().Value.(*BPF)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
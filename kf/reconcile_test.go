@@ -0,0 +1,165 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	tc "github.com/florianl/go-tc"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+// newReconcileTest - returns a chain of the programs a, b and c behind the xdp root program, desired in version 1.0
+func newReconcileTest(t *testing.T) *chainTest {
+	c := newChainTest(t)
+	c.cfg.HostName = "l3af-local-test"
+	c.cfg.mu = new(sync.Mutex)
+	c.cfg.hostInterfaces = map[string]bool{}
+	progs := make([]*models.BPFProgram, 0)
+	for i, name := range []string{"a", "b", "c"} {
+		prog := c.program(name, i+1, ebpf.ProgramID(11+i), ebpf.MapID(101+i))
+		if err := c.cfg.InsertAndStartBPFProgram(context.Background(), prog, chainTestIface, models.XDPIngressType); err != nil {
+			t.Fatalf("InsertAndStartBPFProgram(%s) error = %v", name, err)
+		}
+		copied := *prog
+		progs = append(progs, &copied)
+	}
+	c.cfg.setDesired([]models.L3afBPFPrograms{desiredConfig(chainTestIface, progs...)})
+	return c
+}
+
+// withJournal - records the events of the test in a journal of its own
+func withJournal(t *testing.T) *EventJournal {
+	j := NewEventJournal(100)
+	previous := journal.Swap(j)
+	t.Cleanup(func() { journal.Store(previous) })
+	return j
+}
+
+func eventCount(j *EventJournal, reason string) int {
+	count := 0
+	for _, e := range j.List(EventFilter{}) {
+		if e.Reason == reason {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDetectDrift(t *testing.T) {
+	c := newReconcileTest(t)
+	desired := c.cfg.DesiredProgramsOf(chainTestIface).BpfPrograms.XDPIngress
+	desired[1].Version = "2.0"
+	desired = append(desired[:2],
+		&models.BPFProgram{Name: "d", Version: "1.0", AdminStatus: models.Enabled},
+		&models.BPFProgram{Name: "e", Version: "1.0", AdminStatus: models.Disabled})
+	c.cfg.setDesired([]models.L3afBPFPrograms{desiredConfig(chainTestIface, desired...)})
+
+	// the root program does not point to a anymore and the prog map of b is gone
+	c.kernel.progArrays[chainTestRootMapID] = 0
+	delete(c.kernel.pinned, c.element("b").Value.(*BPF).MapNamePath)
+	// the tc root program is detached
+	egress := list.New()
+	egress.PushBack(&BPF{Program: models.BPFProgram{Name: "tc-root", AdminStatus: models.Enabled, ProgType: models.TCType}, TCFilter: &tc.Filter{}, ProgID: 20, backend: c.kernel})
+	c.cfg.EgressTCBpfs[chainTestIface] = egress
+
+	got := make([]string, 0)
+	for _, d := range c.cfg.detectDrift() {
+		got = append(got, d.direction+"/"+d.name+"/"+d.kind)
+	}
+	sort.Strings(got)
+	want := []string{
+		"egress/tc-root/detached",
+		"xdpingress/a/unlinked",
+		"xdpingress/b/map-missing",
+		"xdpingress/b/outdated",
+		"xdpingress/c/unwanted",
+		"xdpingress/d/missing",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("detectDrift() = %v, want %v", got, want)
+	}
+}
+
+func TestReconcileCorrectsDrift(t *testing.T) {
+	j := withJournal(t)
+	c := newReconcileTest(t)
+	r := newReconciler(&config.Config{ReconcileBackoffInitial: time.Minute})
+	now := time.Now()
+
+	c.cfg.reconcile(context.Background(), r, now)
+	if len(r.drifts) != 0 || eventCount(j, models.EventDriftDetected) != 0 {
+		t.Fatalf("reconcile() of converged programs found drifts %v", r.drifts)
+	}
+
+	// the root program does not point to a anymore, the link is restored
+	c.kernel.progArrays[chainTestRootMapID] = 0
+	c.cfg.reconcile(context.Background(), r, now.Add(time.Second))
+	if got := c.kernel.progArrays[chainTestRootMapID]; got != 11 {
+		t.Errorf("prog map of the root program points to %d after reconcile, want 11", got)
+	}
+	if eventCount(j, models.EventDriftDetected) != 1 {
+		t.Errorf("events %v, want one %s", j.List(EventFilter{}), models.EventDriftDetected)
+	}
+
+	// the correction is verified by the next pass
+	c.cfg.reconcile(context.Background(), r, now.Add(2*time.Second))
+	if len(r.drifts) != 0 || len(r.attempts) != 0 || eventCount(j, models.EventDriftCorrected) != 1 {
+		t.Errorf("drifts %v, attempts %v and events %v after the correction, want one %s event", r.drifts, r.attempts, j.List(EventFilter{}), models.EventDriftCorrected)
+	}
+}
+
+func TestReconcileBackoff(t *testing.T) {
+	j := withJournal(t)
+	c := &NFConfigs{
+		HostName:       "l3af-local-test",
+		HostConfig:     &config.Config{},
+		IngressXDPBpfs: make(map[string]*list.List),
+		IngressTCBpfs:  make(map[string]*list.List),
+		EgressTCBpfs:   make(map[string]*list.List),
+		hostInterfaces: map[string]bool{},
+		mu:             new(sync.Mutex),
+	}
+	// the interfaces do not exist, every deploy fails
+	c.setDesired([]models.L3afBPFPrograms{
+		desiredConfig("fakeif0", &models.BPFProgram{Name: "foo", Version: "1.0", AdminStatus: models.Enabled}),
+		desiredConfig("fakeif1", &models.BPFProgram{Name: "foo", Version: "1.0", AdminStatus: models.Enabled}),
+	})
+	r := newReconciler(&config.Config{ReconcileBackoffInitial: time.Minute, ReconcileBackoffMax: time.Hour, ReconcileMaxActions: 1})
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		at         time.Duration
+		wantFailed int
+	}{
+		{name: "FirstInterface", at: 0, wantFailed: 1},
+		{name: "SecondInterfaceAfterActionLimit", at: time.Second, wantFailed: 2},
+		{name: "BackedOff", at: 2 * time.Second, wantFailed: 2},
+		{name: "RetriedAfterBackoff", at: 2 * time.Minute, wantFailed: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.reconcile(context.Background(), r, now.Add(tt.at))
+			if got := eventCount(j, models.EventDriftCorrectionFailed); got != tt.wantFailed {
+				t.Errorf("%s events = %d, want %d", models.EventDriftCorrectionFailed, got, tt.wantFailed)
+			}
+		})
+	}
+	if got := eventCount(j, models.EventDriftDetected); got != 2 {
+		t.Errorf("%s events = %d, want one per interface", models.EventDriftDetected, got)
+	}
+	if s := c.ProgramStatus("fakeif0").Programs[0]; s.State != models.ProgramFailed {
+		t.Errorf("status after failed corrections = %+v, want Failed", s)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+
+	"github.com/l3af-project/l3afd/sandbox"
+)
+
+// scrubbedPath - PATH of user programs started with a scrubbed environment
+const scrubbedPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// sandboxCommand - returns the command starting the user program with the security settings of the program
+func (b *BPF) sandboxCommand(cmd string, args []string) (*exec.Cmd, error) {
+	security := b.Program.Security
+	spec := sandbox.Spec{
+		Path:          cmd,
+		Args:          args,
+		UID:           security.RunAsUser,
+		GID:           security.RunAsGroup,
+		Groups:        security.SupplementaryGroups,
+		Capabilities:  security.Capabilities,
+		NoNewPrivs:    security.NoNewPrivs,
+		ReadOnlyRoot:  security.ReadOnlyRootFS,
+		WritablePaths: append([]string{b.hostConfig.BpfMapDefaultPath}, security.WritablePaths...),
+	}
+	if len(b.hostConfig.BPFLogDir) > 1 {
+		spec.WritablePaths = append(spec.WritablePaths, b.hostConfig.BPFLogDir)
+	}
+
+	if len(security.SeccompProfile) > 0 {
+		profile, err := ValidatePath(security.SeccompProfile, b.FilePath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seccomp profile %s: %v", security.SeccompProfile, err)
+		}
+		spec.SeccompProfile = profile
+	}
+
+	if security.ScrubEnv {
+		spec.Env = []string{scrubbedPath}
+	} else {
+		spec.Env = os.Environ()
+	}
+	keys := make([]string, 0, len(security.Env))
+	for k := range security.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		spec.Env = append(spec.Env, k+"="+security.Env[k])
+	}
+
+	return sandbox.Command(spec)
+}
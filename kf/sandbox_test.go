@@ -0,0 +1,62 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package kf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestBPF_sandboxCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		security models.L3afDNFSecurity
+		wantEnv  []string
+		wantErr  bool
+	}{
+		{
+			name:     "ScrubEnv",
+			security: models.L3afDNFSecurity{ScrubEnv: true, Env: map[string]string{"B": "2", "A": "1"}},
+			wantEnv:  []string{scrubbedPath, "A=1", "B=2"},
+		},
+		{
+			name:     "SeccompProfileOutsidePackage",
+			security: models.L3afDNFSecurity{SeccompProfile: "../profile.bpf"},
+			wantErr:  true,
+		},
+		{
+			name:     "UnknownCapability",
+			security: models.L3afDNFSecurity{Capabilities: []string{"CAP_FOO"}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			security := tt.security
+			b := &BPF{
+				Program:    models.BPFProgram{Name: "foo", Security: &security},
+				FilePath:   "/dev/shm/foo",
+				hostConfig: &config.Config{BpfMapDefaultPath: "/sys/fs/bpf"},
+			}
+			cmd, err := b.sandboxCommand("/dev/shm/foo/foo", []string{"--iface=fakeif0"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sandboxCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			// the last variable passes the spec to the shim
+			env := cmd.Env[:len(cmd.Env)-1]
+			if strings.Join(env, " ") != strings.Join(tt.wantEnv, " ") {
+				t.Errorf("sandboxCommand() env = %v, want %v", env, tt.wantEnv)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/l3af-project/l3afd/audit"
+	"github.com/l3af-project/l3afd/models"
+)
+
+// failureKey identifies the program, direction or interface a failure is recorded for, the narrower
+// fields are empty for failures of the whole direction or interface
+type failureKey struct {
+	iface, direction, name string
+}
+
+// desiredState holds the configs as accepted by the API, independent of what is running,
+// and the last failures to start them
+type desiredState struct {
+	mu       sync.Mutex
+	ifaces   map[string]models.L3afBPFPrograms
+	failures map[failureKey]string
+}
+
+// copyPrograms - returns a deep copy, the accepted configs are not changed by later updates of the running programs
+func copyPrograms(progs *models.BPFPrograms) *models.BPFPrograms {
+	copied := &models.BPFPrograms{}
+	if progs == nil {
+		return copied
+	}
+	buf, err := json.Marshal(progs)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to copy desired programs")
+		return copied
+	}
+	if err := json.Unmarshal(buf, copied); err != nil {
+		log.Error().Err(err).Msg("failed to copy desired programs")
+	}
+	return copied
+}
+
+// programsOf - returns the programs of the direction
+func programsOf(progs *models.BPFPrograms, direction string) *[]*models.BPFProgram {
+	switch direction {
+	case models.XDPIngressType:
+		return &progs.XDPIngress
+	case models.IngressType:
+		return &progs.TCIngress
+	default:
+		return &progs.TCEgress
+	}
+}
+
+var directions = []string{models.XDPIngressType, models.IngressType, models.EgressType}
+
+// setDesired - replaces the desired configs with the ones of an update call, returning the changes
+func (c *NFConfigs) setDesired(cfgs []models.L3afBPFPrograms) []audit.Change {
+	c.desired.mu.Lock()
+	defer c.desired.mu.Unlock()
+	before := c.desiredPrograms()
+	c.desired.ifaces = make(map[string]models.L3afBPFPrograms, len(cfgs))
+	for _, cfg := range cfgs {
+		c.desired.ifaces[cfg.Iface] = models.L3afBPFPrograms{HostName: cfg.HostName, Iface: cfg.Iface, BpfPrograms: copyPrograms(cfg.BpfPrograms)}
+	}
+	return audit.Diff(before, c.desiredPrograms())
+}
+
+// addDesired - adds the programs of an add call to the desired configs, replacing the ones with the same name,
+// returning the changes
+func (c *NFConfigs) addDesired(cfgs []models.L3afBPFPrograms) []audit.Change {
+	c.desired.mu.Lock()
+	defer c.desired.mu.Unlock()
+	before := c.desiredPrograms()
+	if c.desired.ifaces == nil {
+		c.desired.ifaces = make(map[string]models.L3afBPFPrograms)
+	}
+	for _, cfg := range cfgs {
+		current, ok := c.desired.ifaces[cfg.Iface]
+		if !ok {
+			current = models.L3afBPFPrograms{HostName: cfg.HostName, Iface: cfg.Iface, BpfPrograms: &models.BPFPrograms{}}
+		}
+		added := copyPrograms(cfg.BpfPrograms)
+		for _, direction := range directions {
+			progs := programsOf(current.BpfPrograms, direction)
+		next:
+			for _, prog := range *programsOf(added, direction) {
+				for i, p := range *progs {
+					if p.Name == prog.Name {
+						(*progs)[i] = prog
+						continue next
+					}
+				}
+				*progs = append(*progs, prog)
+			}
+		}
+		c.desired.ifaces[cfg.Iface] = current
+	}
+	return audit.Diff(before, c.desiredPrograms())
+}
+
+// deleteDesired - removes the programs of a delete call from the desired configs, returning the changes
+func (c *NFConfigs) deleteDesired(names []models.L3afBPFProgramNames) []audit.Change {
+	c.desired.mu.Lock()
+	defer c.desired.mu.Unlock()
+	before := c.desiredPrograms()
+	for _, n := range names {
+		current, ok := c.desired.ifaces[n.Iface]
+		if !ok || n.BpfProgramNames == nil {
+			continue
+		}
+		for direction, removed := range map[string][]string{
+			models.XDPIngressType: n.BpfProgramNames.XDPIngress,
+			models.IngressType:    n.BpfProgramNames.TCIngress,
+			models.EgressType:     n.BpfProgramNames.TCEgress,
+		} {
+			progs := programsOf(current.BpfPrograms, direction)
+			kept := make([]*models.BPFProgram, 0, len(*progs))
+			for _, prog := range *progs {
+				if !slices.Contains(removed, prog.Name) {
+					kept = append(kept, prog)
+				}
+			}
+			*progs = kept
+		}
+	}
+	return audit.Diff(before, c.desiredPrograms())
+}
+
+// DesiredPrograms - returns the desired configs of all interfaces, sorted by interface
+func (c *NFConfigs) DesiredPrograms() []models.L3afBPFPrograms {
+	c.desired.mu.Lock()
+	defer c.desired.mu.Unlock()
+	return c.desiredPrograms()
+}
+
+// desiredPrograms - returns a copy of the desired configs, the caller holds c.desired.mu
+func (c *NFConfigs) desiredPrograms() []models.L3afBPFPrograms {
+	cfgs := make([]models.L3afBPFPrograms, 0, len(c.desired.ifaces))
+	for _, cfg := range c.desired.ifaces {
+		cfgs = append(cfgs, models.L3afBPFPrograms{HostName: cfg.HostName, Iface: cfg.Iface, BpfPrograms: copyPrograms(cfg.BpfPrograms)})
+	}
+	sort.Slice(cfgs, func(i, j int) bool { return cfgs[i].Iface < cfgs[j].Iface })
+	return cfgs
+}
+
+// DesiredProgramsOf - returns the desired config of the interface, without programs when it has none
+func (c *NFConfigs) DesiredProgramsOf(iface string) models.L3afBPFPrograms {
+	c.desired.mu.Lock()
+	defer c.desired.mu.Unlock()
+	cfg, ok := c.desired.ifaces[iface]
+	if !ok {
+		return models.L3afBPFPrograms{HostName: c.HostName, Iface: iface, BpfPrograms: &models.BPFPrograms{}}
+	}
+	return models.L3afBPFPrograms{HostName: cfg.HostName, Iface: cfg.Iface, BpfPrograms: copyPrograms(cfg.BpfPrograms)}
+}
+
+// observe - records the failure of the program, direction or interface, a nil error clears it
+func (c *NFConfigs) observe(iface, direction, name string, err error) {
+	c.desired.mu.Lock()
+	defer c.desired.mu.Unlock()
+	key := failureKey{iface: iface, direction: direction, name: name}
+	if err == nil {
+		delete(c.desired.failures, key)
+		return
+	}
+	if c.desired.failures == nil {
+		c.desired.failures = make(map[failureKey]string)
+	}
+	c.desired.failures[key] = err.Error()
+}
+
+// failure - returns the failure of the program, or else of its direction or interface
+func (c *NFConfigs) failure(iface, direction, name string) string {
+	c.desired.mu.Lock()
+	defer c.desired.mu.Unlock()
+	for _, key := range []failureKey{{iface, direction, name}, {iface, direction, ""}, {iface, "", ""}} {
+		if reason, ok := c.desired.failures[key]; ok {
+			return reason
+		}
+	}
+	return ""
+}
+
+// bpfLists - returns the running programs of the direction by interface
+func (c *NFConfigs) bpfLists(direction string) map[string]*list.List {
+	switch direction {
+	case models.XDPIngressType:
+		return c.IngressXDPBpfs
+	case models.IngressType:
+		return c.IngressTCBpfs
+	default:
+		return c.EgressTCBpfs
+	}
+}
+
+// bpfList - returns the running programs of the direction
+func (c *NFConfigs) bpfList(iface, direction string) *list.List {
+	return c.bpfLists(direction)[iface]
+}
+
+// runningBPF - returns the running program with the name, nil when it is not running
+func (c *NFConfigs) runningBPF(iface, direction, name string) *BPF {
+	bpfList := c.bpfList(iface, direction)
+	if bpfList == nil {
+		return nil
+	}
+	for e := bpfList.Front(); e != nil; e = e.Next() {
+		if b := e.Value.(*BPF); b.Program.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// attachMode - returns how the running program is attached to the interface
+func (c *NFConfigs) attachMode(b *BPF) string {
+	switch {
+	case b.Unlinked:
+		return models.AttachUnlinked
+	case b.XDPLink != nil:
+		return models.AttachXDPLink
+	case b.TCFilter != nil:
+		return models.AttachTCFilter
+	case c.HostConfig != nil && c.HostConfig.BpfChainingEnabled && len(b.PrevMapNamePath) > 0:
+		return models.AttachChained
+	default:
+		return models.AttachUserSpace
+	}
+}
+
+// ProgramStatus - returns the observed status of the desired programs of the interface
+func (c *NFConfigs) ProgramStatus(iface string) models.L3afBPFProgramsStatus {
+	spec := c.DesiredProgramsOf(iface)
+	status := models.L3afBPFProgramsStatus{Iface: iface, Programs: make([]models.BPFProgramStatus, 0)}
+	for _, direction := range directions {
+		for _, prog := range *programsOf(spec.BpfPrograms, direction) {
+			s := models.BPFProgramStatus{Name: prog.Name, Direction: direction}
+			b := c.runningBPF(iface, direction, prog.Name)
+			switch {
+			case b != nil:
+				s.Version, s.Restarts, s.ProgID, s.AttachMode = b.Program.Version, b.RestartCount, uint32(b.ProgID), c.attachMode(b)
+				s.State = models.ProgramRunning
+				if b.CrashLooping {
+					s.State, s.Reason = models.ProgramCrashLooping, "restart attempts are exhausted"
+				} else if b.Program.Version != prog.Version {
+					s.Reason = fmt.Sprintf("running version %s instead of %s", b.Program.Version, prog.Version)
+					if failure := c.failure(iface, direction, prog.Name); len(failure) > 0 {
+						s.Reason += ": " + failure
+					}
+				}
+			case prog.AdminStatus == models.Disabled:
+				s.State = models.ProgramDisabled
+			default:
+				s.State, s.Reason = models.ProgramPending, c.failure(iface, direction, prog.Name)
+				if len(s.Reason) > 0 {
+					s.State = models.ProgramFailed
+				}
+			}
+			status.Programs = append(status.Programs, s)
+		}
+	}
+	return status
+}
+
+// ProgramState - returns the desired config of the interface and its observed status
+func (c *NFConfigs) ProgramState(iface string) models.L3afBPFProgramsState {
+	return models.L3afBPFProgramsState{Spec: c.DesiredProgramsOf(iface), Status: c.ProgramStatus(iface)}
+}
+
+// ProgramStateAll - returns the desired configs of all interfaces and their observed status
+func (c *NFConfigs) ProgramStateAll() []models.L3afBPFProgramsState {
+	cfgs := c.DesiredPrograms()
+	states := make([]models.L3afBPFProgramsState, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		states = append(states, models.L3afBPFProgramsState{Spec: cfg, Status: c.ProgramStatus(cfg.Iface)})
+	}
+	return states
+}
@@ -0,0 +1,141 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/l3af-project/l3afd/audit"
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func desiredConfig(iface string, progs ...*models.BPFProgram) models.L3afBPFPrograms {
+	return models.L3afBPFPrograms{HostName: "l3af-local-test", Iface: iface, BpfPrograms: &models.BPFPrograms{XDPIngress: progs}}
+}
+
+func desiredNames(c *NFConfigs, iface string) []string {
+	names := make([]string, 0)
+	for _, prog := range c.DesiredProgramsOf(iface).BpfPrograms.XDPIngress {
+		names = append(names, prog.Name+"@"+prog.Version)
+	}
+	return names
+}
+
+func TestDesiredState(t *testing.T) {
+	c := &NFConfigs{HostName: "l3af-local-test"}
+
+	update := []models.L3afBPFPrograms{desiredConfig("fakeif0", &models.BPFProgram{Name: "foo", Version: "1.0"}, &models.BPFProgram{Name: "bar", Version: "1.0"})}
+	c.setDesired(update)
+	// the accepted configs are copied
+	update[0].BpfPrograms.XDPIngress[0].Version = "9.9"
+	if got, want := desiredNames(c, "fakeif0"), []string{"foo@1.0", "bar@1.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("desired after update = %v, want %v", got, want)
+	}
+
+	changes := c.addDesired([]models.L3afBPFPrograms{
+		desiredConfig("fakeif0", &models.BPFProgram{Name: "bar", Version: "1.1"}, &models.BPFProgram{Name: "baz", Version: "1.0"}),
+		desiredConfig("fakeif1", &models.BPFProgram{Name: "foo", Version: "1.0"}),
+	})
+	want := []audit.Change{
+		{Iface: "fakeif0", Direction: models.XDPIngressType, Program: "bar", Action: audit.ActionChanged, OldVersion: "1.0", NewVersion: "1.1", Fields: []string{"version"}},
+		{Iface: "fakeif0", Direction: models.XDPIngressType, Program: "baz", Action: audit.ActionAdded, NewVersion: "1.0"},
+		{Iface: "fakeif1", Direction: models.XDPIngressType, Program: "foo", Action: audit.ActionAdded, NewVersion: "1.0"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes of add = %+v, want %+v", changes, want)
+	}
+	if got, want := desiredNames(c, "fakeif0"), []string{"foo@1.0", "bar@1.1", "baz@1.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("desired after add = %v, want %v", got, want)
+	}
+
+	changes = c.deleteDesired([]models.L3afBPFProgramNames{{Iface: "fakeif0", BpfProgramNames: &models.BPFProgramNames{XDPIngress: []string{"foo", "baz"}}}})
+	if len(changes) != 2 || changes[0].Action != audit.ActionRemoved || changes[1].Action != audit.ActionRemoved {
+		t.Errorf("changes of delete = %+v, want foo and baz removed", changes)
+	}
+	if got, want := desiredNames(c, "fakeif0"), []string{"bar@1.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("desired after delete = %v, want %v", got, want)
+	}
+	if cfgs := c.DesiredPrograms(); len(cfgs) != 2 || cfgs[0].Iface != "fakeif0" || cfgs[1].Iface != "fakeif1" {
+		t.Errorf("DesiredPrograms() = %v, want fakeif0 and fakeif1", cfgs)
+	}
+}
+
+func TestProgramStatus(t *testing.T) {
+	running := list.New()
+	running.PushBack(&BPF{Program: models.BPFProgram{Name: "running", Version: "1.0"}, ProgID: 42, RestartCount: 2, PrevMapNamePath: "/sys/fs/bpf/fakeif0/root"})
+	running.PushBack(&BPF{Program: models.BPFProgram{Name: "crashing", Version: "1.0"}, CrashLooping: true, Unlinked: true})
+	running.PushBack(&BPF{Program: models.BPFProgram{Name: "upgrading", Version: "1.0"}})
+	c := &NFConfigs{
+		HostName:       "l3af-local-test",
+		HostConfig:     &config.Config{BpfChainingEnabled: true},
+		IngressXDPBpfs: map[string]*list.List{"fakeif0": running},
+	}
+	c.setDesired([]models.L3afBPFPrograms{desiredConfig("fakeif0",
+		&models.BPFProgram{Name: "running", Version: "1.0", AdminStatus: models.Enabled},
+		&models.BPFProgram{Name: "crashing", Version: "1.0", AdminStatus: models.Enabled},
+		&models.BPFProgram{Name: "upgrading", Version: "1.1", AdminStatus: models.Enabled},
+		&models.BPFProgram{Name: "failed", Version: "1.0", AdminStatus: models.Enabled},
+		&models.BPFProgram{Name: "pending", Version: "1.0", AdminStatus: models.Enabled},
+		&models.BPFProgram{Name: "disabled", Version: "1.0", AdminStatus: models.Disabled},
+	)})
+	c.observe("fakeif0", models.XDPIngressType, "failed", errors.New("artifact not found"))
+	c.observe("fakeif0", models.XDPIngressType, "upgrading", errors.New("download failed"))
+
+	want := []models.BPFProgramStatus{
+		{Name: "running", Version: "1.0", Direction: models.XDPIngressType, State: models.ProgramRunning, Restarts: 2, ProgID: 42, AttachMode: models.AttachChained},
+		{Name: "crashing", Version: "1.0", Direction: models.XDPIngressType, State: models.ProgramCrashLooping, Reason: "restart attempts are exhausted", AttachMode: models.AttachUnlinked},
+		{Name: "upgrading", Version: "1.0", Direction: models.XDPIngressType, State: models.ProgramRunning, Reason: "running version 1.0 instead of 1.1: download failed", AttachMode: models.AttachUserSpace},
+		{Name: "failed", Direction: models.XDPIngressType, State: models.ProgramFailed, Reason: "artifact not found"},
+		{Name: "pending", Direction: models.XDPIngressType, State: models.ProgramPending},
+		{Name: "disabled", Direction: models.XDPIngressType, State: models.ProgramDisabled},
+	}
+	status := c.ProgramStatus("fakeif0")
+	if len(status.Programs) != len(want) {
+		t.Fatalf("ProgramStatus() = %+v, want %d programs", status, len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(status.Programs[i], want[i]) {
+			t.Errorf("status of %s = %+v, want %+v", want[i].Name, status.Programs[i], want[i])
+		}
+	}
+
+	c.observe("fakeif0", models.XDPIngressType, "failed", nil)
+	if s := c.ProgramStatus("fakeif0").Programs[3]; s.State != models.ProgramPending {
+		t.Errorf("status after the failure is cleared = %+v, want Pending", s)
+	}
+}
+
+func TestSaveDesiredOnFailedDeploy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "l3af-config.json")
+	c := &NFConfigs{
+		HostName:       "l3af-local-test",
+		HostConfig:     &config.Config{L3afConfigStoreFileName: file},
+		hostInterfaces: map[string]bool{},
+	}
+
+	cfgs := []models.L3afBPFPrograms{desiredConfig("fakeif0", &models.BPFProgram{Name: "foo", Version: "1.0", AdminStatus: models.Enabled})}
+	if err := c.DeployeBPFPrograms(context.Background(), cfgs); err == nil {
+		t.Fatalf("DeployeBPFPrograms() on a missing interface succeeded")
+	}
+
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("configs not saved: %v", err)
+	}
+	var saved []models.L3afBPFPrograms
+	if err := json.Unmarshal(buf, &saved); err != nil || len(saved) != 1 || saved[0].BpfPrograms.XDPIngress[0].Name != "foo" {
+		t.Errorf("saved configs %s, want the desired program foo: %v", buf, err)
+	}
+	if s := c.ProgramStatus("fakeif0").Programs[0]; s.State != models.ProgramFailed || len(s.Reason) == 0 {
+		t.Errorf("status of foo = %+v, want Failed with the deploy error", s)
+	}
+}
@@ -0,0 +1,17 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"context"
+
+	"github.com/l3af-project/l3afd/tracing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan - starts the span of the program operation name, carrying program, version, iface and direction
+func (b *BPF) startSpan(ctx context.Context, name, ifaceName, direction string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name, tracing.Program(b.Program.Name, b.Program.Version, ifaceName, direction)...)
+}
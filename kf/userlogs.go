@@ -0,0 +1,178 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/l3af-project/l3afd/logfile"
+	"github.com/l3af-project/l3afd/models"
+)
+
+// maxPartialLine - a line longer than this is written without waiting for its end
+const maxPartialLine = 64 * 1024
+
+// lineWriter prefixes every line written by a user program with time, program name, iface, direction and stream
+type lineWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func newLineWriter(out io.Writer, name, ifaceName, direction, stream string) *lineWriter {
+	return &lineWriter{
+		out:    out,
+		prefix: fmt.Sprintf("%s %s %s %s: ", name, ifaceName, direction, stream),
+	}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			if len(l.buf) < maxPartialLine {
+				return len(p), nil
+			}
+			i = len(l.buf) - 1
+		}
+		if err := l.writeLine(l.buf[:i+1]); err != nil {
+			return len(p), err
+		}
+		l.buf = l.buf[i+1:]
+	}
+}
+
+func (l *lineWriter) writeLine(line []byte) error {
+	var b bytes.Buffer
+	b.WriteString(time.Now().Format(time.RFC3339Nano))
+	b.WriteByte(' ')
+	b.WriteString(l.prefix)
+	b.Write(bytes.TrimRight(line, "\n"))
+	b.WriteByte('\n')
+	_, err := l.out.Write(b.Bytes())
+	return err
+}
+
+// Flush - writes the unterminated last line
+func (l *lineWriter) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buf) == 0 {
+		return nil
+	}
+	err := l.writeLine(l.buf)
+	l.buf = nil
+	return err
+}
+
+// userProgramLogPath - returns the file capturing the output of the user program
+func (b *BPF) userProgramLogPath(ifaceName, direction string) (string, error) {
+	name := b.Program.Name + "-" + ifaceName + "-" + direction + ".log"
+	if strings.ContainsAny(name, "/\\") || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid log file name %s", name)
+	}
+	return filepath.Join(b.hostConfig.UserProgramLogDir, name), nil
+}
+
+// captureOutput - wires stdout and stderr of the user program command into its log file
+func (b *BPF) captureOutput(ifaceName, direction string) {
+	if !b.hostConfig.UserProgramLogEnabled || b.Cmd == nil {
+		return
+	}
+	if b.logWriter == nil {
+		path, err := b.userProgramLogPath(ifaceName, direction)
+		if err != nil {
+			b.logger(ifaceName, direction).Warn().Err(err).Msg("user program output is not captured")
+			return
+		}
+		w, err := logfile.NewWriter(path, int64(b.hostConfig.UserProgramLogMaxSizeMB)*1024*1024, b.hostConfig.UserProgramLogMaxBackups)
+		if err != nil {
+			b.logger(ifaceName, direction).Warn().Err(err).Msg("user program output is not captured")
+			return
+		}
+		b.logWriter = w
+	}
+	b.stdout = newLineWriter(b.logWriter, b.Program.Name, ifaceName, direction, "stdout")
+	b.stderr = newLineWriter(b.logWriter, b.Program.Name, ifaceName, direction, "stderr")
+	b.Cmd.Stdout = b.stdout
+	b.Cmd.Stderr = b.stderr
+	// do not block on grand children holding the output pipes open
+	b.Cmd.WaitDelay = time.Second
+}
+
+// closeOutput - flushes the captured output of the stopped user program and closes its log file
+func (b *BPF) closeOutput() {
+	for _, l := range []*lineWriter{b.stdout, b.stderr} {
+		if l == nil {
+			continue
+		}
+		if err := l.Flush(); err != nil {
+			b.logger("", "").Warn().Err(err).Msg("failed to flush user program output")
+		}
+	}
+	b.stdout, b.stderr = nil, nil
+	if b.logWriter == nil {
+		return
+	}
+	if err := b.logWriter.Close(); err != nil {
+		b.logger("", "").Warn().Err(err).Msg("failed to close user program log file")
+	}
+	b.logWriter = nil
+}
+
+// UserProgramLogs - returns the last lines of the captured output of the user program
+func (b *BPF) UserProgramLogs(ifaceName, direction string, tail int) ([]string, error) {
+	path, err := b.userProgramLogPath(ifaceName, direction)
+	if err != nil {
+		return nil, err
+	}
+	return logfile.Tail(path, tail)
+}
+
+// UserProgramLogPath - returns the log file of the user program with name on iface and direction
+func (c *NFConfigs) UserProgramLogPath(ifaceName, direction, name string) (string, error) {
+	bpf, err := c.findProgram(ifaceName, direction, name)
+	if err != nil {
+		return "", err
+	}
+	return bpf.userProgramLogPath(ifaceName, direction)
+}
+
+// findProgram - returns the program with name on iface and direction
+func (c *NFConfigs) findProgram(ifaceName, direction, name string) (*BPF, error) {
+	var bpfProgs map[string]*list.List
+	switch direction {
+	case models.XDPIngressType:
+		bpfProgs = c.IngressXDPBpfs
+	case models.IngressType:
+		bpfProgs = c.IngressTCBpfs
+	case models.EgressType:
+		bpfProgs = c.EgressTCBpfs
+	default:
+		return nil, fmt.Errorf("unknown direction %s", direction)
+	}
+	bpfList := bpfProgs[ifaceName]
+	if bpfList == nil {
+		return nil, fmt.Errorf("no eBPF programs on iface %s direction %s", ifaceName, direction)
+	}
+	for e := bpfList.Front(); e != nil; e = e.Next() {
+		if bpf := e.Value.(*BPF); bpf.Program.Name == name {
+			return bpf, nil
+		}
+	}
+	return nil, fmt.Errorf("eBPF program %s not found on iface %s direction %s", name, ifaceName, direction)
+}
@@ -0,0 +1,77 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"bytes"
+	"container/list"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+)
+
+func Test_lineWriter(t *testing.T) {
+	var out bytes.Buffer
+	l := newLineWriter(&out, "foo", "fakeif0", models.XDPIngressType, "stdout")
+	for _, p := range []string{"first", " line\nsecond line\n", "partial"} {
+		if _, err := l.Write([]byte(p)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	want := []string{"first line", "second line", "partial"}
+	if len(lines) != len(want) {
+		t.Fatalf("lineWriter wrote %d lines, want %d: %q", len(lines), len(want), out.String())
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, " foo fakeif0 xdpingress stdout: "+want[i]) {
+			t.Errorf("line %d = %q, want suffix %q", i, line, want[i])
+		}
+	}
+}
+
+func TestBPF_captureOutput(t *testing.T) {
+	b := &BPF{
+		Program: models.BPFProgram{Name: "foo"},
+		hostConfig: &config.Config{
+			UserProgramLogEnabled:    true,
+			UserProgramLogDir:        t.TempDir(),
+			UserProgramLogMaxSizeMB:  1,
+			UserProgramLogMaxBackups: 1,
+		},
+	}
+	b.Cmd = exec.Command("sh", "-c", "echo running; echo failed >&2")
+	b.captureOutput("fakeif0", models.IngressType)
+	if err := b.Cmd.Run(); err != nil {
+		t.Fatalf("failed to run command: %v", err)
+	}
+	b.closeOutput()
+
+	lines, err := b.UserProgramLogs("fakeif0", models.IngressType, 10)
+	if err != nil {
+		t.Fatalf("UserProgramLogs() error = %v", err)
+	}
+	got := strings.Join(lines, "\n")
+	for _, want := range []string{"foo fakeif0 ingress stdout: running", "foo fakeif0 ingress stderr: failed"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("UserProgramLogs() = %q, missing %q", got, want)
+		}
+	}
+
+	c := &NFConfigs{IngressTCBpfs: map[string]*list.List{"fakeif0": list.New()}}
+	c.IngressTCBpfs["fakeif0"].PushBack(b)
+	if _, err := c.UserProgramLogPath("fakeif0", models.IngressType, "foo"); err != nil {
+		t.Errorf("UserProgramLogPath() error = %v", err)
+	}
+	if _, err := c.UserProgramLogPath("fakeif0", models.EgressType, "foo"); err == nil {
+		t.Errorf("UserProgramLogPath() of unknown program did not fail")
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/cilium/ebpf"
+
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/schema"
+)
+
+// aggregators - aggregation functions supported by the metrics maps
+var aggregators = map[string]bool{"scalar": true, "max-rate": true, "avg": true}
+
+// chainField - returns the payload field of the programs of the direction
+func chainField(direction string) string {
+	switch direction {
+	case models.XDPIngressType:
+		return "xdp_ingress"
+	case models.IngressType:
+		return "tc_ingress"
+	default:
+		return "tc_egress"
+	}
+}
+
+// progTypeOf - returns the program type expected by the direction
+func progTypeOf(direction string) string {
+	if direction == models.XDPIngressType {
+		return models.XDPType
+	}
+	return models.TCType
+}
+
+// ValidatePrograms - checks the program definitions of an update call before they are accepted, all the
+// problems are returned at once as schema.Errors
+func (c *NFConfigs) ValidatePrograms(cfgs []models.L3afBPFPrograms) error {
+	return c.validatePrograms(cfgs, nil)
+}
+
+// validateAddedPrograms - checks the program definitions of an add call against the desired programs they are added to
+func (c *NFConfigs) validateAddedPrograms(cfgs []models.L3afBPFPrograms) error {
+	return c.validatePrograms(cfgs, func(iface, direction string) []*models.BPFProgram {
+		return *programsOf(c.DesiredProgramsOf(iface).BpfPrograms, direction)
+	})
+}
+
+// validatePrograms - checks the program definitions, existing returns the programs the definitions are
+// added to, nil for an update replacing them
+func (c *NFConfigs) validatePrograms(cfgs []models.L3afBPFPrograms, existing func(iface, direction string) []*models.BPFProgram) error {
+	chaining := c.HostConfig != nil && c.HostConfig.BpfChainingEnabled
+	featureCheck := c.HostConfig != nil && c.HostConfig.KernelFeatureCheck
+	var errs schema.Errors
+	ifaces := make(map[string]int)
+	for i, cfg := range cfgs {
+		path := "[" + strconv.Itoa(i) + "]"
+		if len(cfg.Iface) == 0 {
+			errs = append(errs, schema.FieldError{Path: path + ".iface", Message: "iface is required"})
+		} else if first, ok := ifaces[cfg.Iface]; ok {
+			errs = append(errs, schema.FieldError{Path: path + ".iface", Message: fmt.Sprintf("iface %s is defined at [%d] already", cfg.Iface, first)})
+		} else {
+			ifaces[cfg.Iface] = i
+		}
+		if cfg.BpfPrograms == nil {
+			errs = append(errs, schema.FieldError{Path: path + ".bpf_programs", Message: "bpf_programs is required"})
+			continue
+		}
+		for _, direction := range directions {
+			var current []*models.BPFProgram
+			if existing != nil {
+				current = existing(cfg.Iface, direction)
+			}
+			progs := *programsOf(cfg.BpfPrograms, direction)
+			chainPath := path + ".bpf_programs." + chainField(direction)
+			errs = append(errs, validateChain(progs, current, direction, chainPath, chaining)...)
+			if featureCheck {
+				errs = append(errs, c.featureErrors(progs, direction, chainPath, chaining)...)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateChain - checks the programs of a direction, the names and sequence ids are unique in the chain including
+// the current programs not replaced by them
+func validateChain(progs, current []*models.BPFProgram, direction, path string, chaining bool) schema.Errors {
+	var errs schema.Errors
+	defined := make(map[string]bool)
+	for _, prog := range progs {
+		if prog != nil {
+			defined[prog.Name] = true
+		}
+	}
+	seqIDs := make(map[int]string)
+	if chaining {
+		for _, prog := range current {
+			if !defined[prog.Name] {
+				seqIDs[prog.SeqID] = "program " + prog.Name
+			}
+		}
+	}
+
+	names := make(map[string]string)
+	for j, prog := range progs {
+		progPath := path + "[" + strconv.Itoa(j) + "]"
+		if prog == nil {
+			errs = append(errs, schema.FieldError{Path: progPath, Message: "program is required"})
+			continue
+		}
+		errs = append(errs, validateProgram(prog, direction, progPath)...)
+		if first, ok := names[prog.Name]; ok && len(prog.Name) > 0 {
+			errs = append(errs, schema.FieldError{Path: progPath + ".name", Message: fmt.Sprintf("program %s is defined at %s already", prog.Name, first)})
+		} else {
+			names[prog.Name] = progPath
+		}
+		if !chaining {
+			continue
+		}
+		if first, ok := seqIDs[prog.SeqID]; ok {
+			errs = append(errs, schema.FieldError{Path: progPath + ".seq_id", Message: fmt.Sprintf("seq_id %d is used by %s already", prog.SeqID, first)})
+		} else {
+			seqIDs[prog.SeqID] = progPath
+		}
+	}
+	return errs
+}
+
+// validateProgram - checks the fields of a program definition
+func validateProgram(prog *models.BPFProgram, direction, path string) schema.Errors {
+	var errs schema.Errors
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, schema.FieldError{Path: path + field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(prog.Name) == 0 {
+		add(".name", "name is required")
+	}
+	if len(prog.Version) == 0 {
+		add(".version", "version is required")
+	}
+	if prog.SeqID < 0 {
+		add(".seq_id", "seq_id %d is negative", prog.SeqID)
+	}
+	if len(prog.AdminStatus) > 0 && prog.AdminStatus != models.Enabled && prog.AdminStatus != models.Disabled {
+		add(".admin_status", "admin_status %q is not %s or %s", prog.AdminStatus, models.Enabled, models.Disabled)
+	}
+	if want := progTypeOf(direction); len(prog.ProgType) > 0 && prog.ProgType != want {
+		add(".prog_type", "prog_type %q does not match the chain, want %s", prog.ProgType, want)
+	} else if len(prog.ProgType) == 0 && len(prog.MapName) > 0 {
+		add(".prog_type", "prog_type is required with map_name")
+	}
+	if len(prog.ObjectFile) > 0 && len(prog.EntryFunctionName) == 0 {
+		add(".entry_function_name", "entry_function_name is required with object_file")
+	}
+	if len(prog.BTFFile) > 0 && len(prog.ObjectFile) == 0 {
+		add(".object_file", "object_file is required with btf_file")
+	}
+	if prog.CPU < 0 {
+		add(".cpu", "cpu %d is negative", prog.CPU)
+	}
+	if prog.CPUSeconds < 0 {
+		add(".cpu_seconds", "cpu_seconds %d is negative", prog.CPUSeconds)
+	}
+	if prog.Memory < 0 {
+		add(".memory", "memory %d is negative", prog.Memory)
+	}
+
+	keys := make([]string, 0, len(prog.MapArgs))
+	for k := range prog.MapArgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, ok := prog.MapArgs[k].(string); !ok {
+			add(".map_args."+k, "map_args values must be strings, got %T", prog.MapArgs[k])
+		}
+	}
+
+	for k, m := range prog.MonitorMaps {
+		mapPath := ".monitor_maps[" + strconv.Itoa(k) + "]"
+		if len(m.Name) == 0 {
+			add(mapPath+".name", "name is required")
+		}
+		if m.Key < 0 {
+			add(mapPath+".key", "key %d is negative", m.Key)
+		}
+		if !aggregators[m.Aggregator] {
+			add(mapPath+".aggregator", "aggregator %q is not scalar, max-rate or avg", m.Aggregator)
+		}
+	}
+
+	if len(prog.EPRURL) > 0 {
+		if u, err := url.Parse(prog.EPRURL); err != nil {
+			add(".ebpf_package_repo_url", "invalid url: %v", err)
+		} else if u.Scheme != httpScheme && u.Scheme != httpsScheme && u.Scheme != fileScheme {
+			add(".ebpf_package_repo_url", "scheme %q is not %s, %s or %s", u.Scheme, httpScheme, httpsScheme, fileScheme)
+		}
+	}
+
+	if probe := prog.LivenessProbe; probe != nil {
+		if (len(probe.HTTPGet) > 0) == (len(probe.Exec) > 0) {
+			add(".liveness_probe", "exactly one of http_get or exec is required")
+		}
+		if len(probe.HTTPGet) > 0 {
+			if u, err := url.Parse(probe.HTTPGet); err != nil {
+				add(".liveness_probe.http_get", "invalid url: %v", err)
+			} else if u.Scheme != httpScheme && u.Scheme != httpsScheme {
+				add(".liveness_probe.http_get", "scheme %q is not %s or %s", u.Scheme, httpScheme, httpsScheme)
+			}
+		}
+		if probe.TimeoutSeconds < 0 {
+			add(".liveness_probe.timeout_seconds", "timeout_seconds %d is negative", probe.TimeoutSeconds)
+		}
+	}
+	return errs
+}
+
+// checkObjectSpec - checks that the object file of the program contains its entry function and the maps it references
+func checkObjectSpec(prog *models.BPFProgram, spec *ebpf.CollectionSpec) error {
+	var errs schema.Errors
+	if _, ok := spec.Programs[prog.EntryFunctionName]; !ok {
+		errs = append(errs, schema.FieldError{Path: "entry_function_name", Message: fmt.Sprintf("function %s is not found in %s", prog.EntryFunctionName, prog.ObjectFile)})
+	}
+	missingMap := func(path, name string) {
+		if _, ok := spec.Maps[name]; !ok {
+			errs = append(errs, schema.FieldError{Path: path, Message: fmt.Sprintf("map %s is not found in %s", name, prog.ObjectFile)})
+		}
+	}
+	if len(prog.MapName) > 0 {
+		missingMap("map_name", prog.MapName)
+	}
+	keys := make([]string, 0, len(prog.MapArgs))
+	for k := range prog.MapArgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		missingMap("map_args."+k, k)
+	}
+	for k, m := range prog.MonitorMaps {
+		missingMap("monitor_maps["+strconv.Itoa(k)+"].name", m.Name)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
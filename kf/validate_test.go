@@ -0,0 +1,185 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package kf
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+
+	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/schema"
+)
+
+func fieldErrors(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var fieldErrs schema.Errors
+	if !errors.As(err, &fieldErrs) {
+		t.Fatalf("error = %v, want field errors", err)
+	}
+	return strings.Split(fieldErrs.Error(), "; ")
+}
+
+func TestValidatePrograms(t *testing.T) {
+	prog := func(name string, seqID int) *models.BPFProgram {
+		return &models.BPFProgram{Name: name, Version: "1.0", SeqID: seqID, AdminStatus: models.Enabled}
+	}
+	tests := []struct {
+		name     string
+		chaining bool
+		cfgs     []models.L3afBPFPrograms
+		want     []string
+	}{
+		{
+			name:     "Valid",
+			chaining: true,
+			cfgs: []models.L3afBPFPrograms{{Iface: "fakeif0", BpfPrograms: &models.BPFPrograms{
+				XDPIngress: []*models.BPFProgram{{Name: "ratelimiting", Version: "1.0", SeqID: 1, ProgType: models.XDPType, MapName: "xdp_rl_ingress_next_prog",
+					MapArgs: models.L3afDNFArgs{"rl_ports_map": "80,443"}, MonitorMaps: []models.L3afDNFMetricsMap{{Name: "rl_drop_count_map", Aggregator: "scalar"}},
+					EPRURL: "file:///srv/l3af", LivenessProbe: &models.L3afDNFProbe{HTTPGet: "http://localhost:8080/healthz"}}},
+				TCIngress: []*models.BPFProgram{prog("ratelimiting", 1)},
+			}}},
+		},
+		{
+			name:     "Duplicates",
+			chaining: true,
+			cfgs: []models.L3afBPFPrograms{
+				{Iface: "fakeif0", BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{prog("a", 1), prog("b", 1), prog("a", 2)}}},
+				{Iface: "fakeif0", BpfPrograms: &models.BPFPrograms{}},
+			},
+			want: []string{
+				"[0].bpf_programs.xdp_ingress[1].seq_id: seq_id 1 is used by [0].bpf_programs.xdp_ingress[0] already",
+				"[0].bpf_programs.xdp_ingress[2].name: program a is defined at [0].bpf_programs.xdp_ingress[0] already",
+				"[1].iface: iface fakeif0 is defined at [0] already",
+			},
+		},
+		{
+			name: "SeqIDsWithoutChaining",
+			cfgs: []models.L3afBPFPrograms{{Iface: "fakeif0", BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{prog("a", 0), prog("b", 0)}}}},
+		},
+		{
+			name: "InvalidFields",
+			cfgs: []models.L3afBPFPrograms{
+				{BpfPrograms: &models.BPFPrograms{TCEgress: []*models.BPFProgram{{Name: "a", SeqID: -1, AdminStatus: "on", ProgType: models.XDPType, CPU: -1,
+					MapArgs:       models.L3afDNFArgs{"rl_ports_map": 80},
+					MonitorMaps:   []models.L3afDNFMetricsMap{{Key: -1, Aggregator: "sum"}},
+					EPRURL:        "ftp://example.com/l3af",
+					ObjectFile:    "a.bpf.o",
+					LivenessProbe: &models.L3afDNFProbe{HTTPGet: "tcp://localhost:8080", Exec: "check"}}}}},
+				{Iface: "fakeif1"},
+			},
+			want: []string{
+				"[0].iface: iface is required",
+				"[0].bpf_programs.tc_egress[0].version: version is required",
+				"[0].bpf_programs.tc_egress[0].seq_id: seq_id -1 is negative",
+				`[0].bpf_programs.tc_egress[0].admin_status: admin_status "on" is not enabled or disabled`,
+				`[0].bpf_programs.tc_egress[0].prog_type: prog_type "xdp" does not match the chain, want tc`,
+				"[0].bpf_programs.tc_egress[0].entry_function_name: entry_function_name is required with object_file",
+				"[0].bpf_programs.tc_egress[0].cpu: cpu -1 is negative",
+				"[0].bpf_programs.tc_egress[0].map_args.rl_ports_map: map_args values must be strings, got int",
+				"[0].bpf_programs.tc_egress[0].monitor_maps[0].name: name is required",
+				"[0].bpf_programs.tc_egress[0].monitor_maps[0].key: key -1 is negative",
+				`[0].bpf_programs.tc_egress[0].monitor_maps[0].aggregator: aggregator "sum" is not scalar, max-rate or avg`,
+				`[0].bpf_programs.tc_egress[0].ebpf_package_repo_url: scheme "ftp" is not http, https or file`,
+				"[0].bpf_programs.tc_egress[0].liveness_probe: exactly one of http_get or exec is required",
+				`[0].bpf_programs.tc_egress[0].liveness_probe.http_get: scheme "tcp" is not http or https`,
+				"[1].bpf_programs: bpf_programs is required",
+			},
+		},
+		{
+			name: "MapNameWithoutProgType",
+			cfgs: []models.L3afBPFPrograms{{Iface: "fakeif0", BpfPrograms: &models.BPFPrograms{TCIngress: []*models.BPFProgram{{Name: "a", Version: "1.0", MapName: "next_prog", BTFFile: "a.btf"}, nil}}}},
+			want: []string{
+				"[0].bpf_programs.tc_ingress[0].prog_type: prog_type is required with map_name",
+				"[0].bpf_programs.tc_ingress[0].object_file: object_file is required with btf_file",
+				"[0].bpf_programs.tc_ingress[1]: program is required",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &NFConfigs{HostConfig: &config.Config{BpfChainingEnabled: tt.chaining}}
+			if got := fieldErrors(t, c.ValidatePrograms(tt.cfgs)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidatePrograms() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAddedPrograms(t *testing.T) {
+	c := &NFConfigs{HostConfig: &config.Config{BpfChainingEnabled: true}}
+	c.setDesired([]models.L3afBPFPrograms{{Iface: "fakeif0", BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{
+		{Name: "a", Version: "1.0", SeqID: 1}, {Name: "b", Version: "1.0", SeqID: 2},
+	}}}})
+
+	tests := []struct {
+		name string
+		prog *models.BPFProgram
+		want []string
+	}{
+		{name: "NewSeqID", prog: &models.BPFProgram{Name: "c", Version: "1.0", SeqID: 3}},
+		{name: "ReplacedProgram", prog: &models.BPFProgram{Name: "b", Version: "2.0", SeqID: 2}},
+		{name: "UsedSeqID", prog: &models.BPFProgram{Name: "c", Version: "1.0", SeqID: 1}, want: []string{"[0].bpf_programs.xdp_ingress[0].seq_id: seq_id 1 is used by program a already"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgs := []models.L3afBPFPrograms{{Iface: "fakeif0", BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{tt.prog}}}}
+			if got := fieldErrors(t, c.validateAddedPrograms(cfgs)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateAddedPrograms() = %q, want %q", got, tt.want)
+			}
+			if tt.want == nil {
+				return
+			}
+			if err := c.AddeBPFPrograms(context.Background(), cfgs); err == nil {
+				t.Fatalf("AddeBPFPrograms() accepted the invalid programs")
+			}
+			if progs := c.DesiredProgramsOf("fakeif0").BpfPrograms.XDPIngress; len(progs) != 2 {
+				t.Errorf("rejected programs changed the desired programs: %d programs", len(progs))
+			}
+		})
+	}
+}
+
+func TestCheckObjectSpec(t *testing.T) {
+	spec := &ebpf.CollectionSpec{
+		Programs: map[string]*ebpf.ProgramSpec{"_xdp_ratelimiting": {}},
+		Maps:     map[string]*ebpf.MapSpec{"xdp_rl_ingress_next_prog": {}, "rl_ports_map": {}, "rl_drop_count_map": {}},
+	}
+	tests := []struct {
+		name string
+		prog models.BPFProgram
+		want []string
+	}{
+		{
+			name: "Complete",
+			prog: models.BPFProgram{ObjectFile: "ratelimiting.bpf.o", EntryFunctionName: "_xdp_ratelimiting", MapName: "xdp_rl_ingress_next_prog",
+				MapArgs: models.L3afDNFArgs{"rl_ports_map": "80"}, MonitorMaps: []models.L3afDNFMetricsMap{{Name: "rl_drop_count_map", Aggregator: "scalar"}}},
+		},
+		{
+			name: "Missing",
+			prog: models.BPFProgram{ObjectFile: "ratelimiting.bpf.o", EntryFunctionName: "xdp_ratelimiting", MapName: "xdp_rl_ingress_next_prog",
+				MapArgs: models.L3afDNFArgs{"rl_config_map": "1", "rl_ports_map": "80"}, MonitorMaps: []models.L3afDNFMetricsMap{{Name: "rl_recv_count_map", Aggregator: "scalar"}}},
+			want: []string{
+				"entry_function_name: function xdp_ratelimiting is not found in ratelimiting.bpf.o",
+				"map_args.rl_config_map: map rl_config_map is not found in ratelimiting.bpf.o",
+				"monitor_maps[0].name: map rl_recv_count_map is not found in ratelimiting.bpf.o",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fieldErrors(t, checkObjectSpec(&tt.prog, spec)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkObjectSpec() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package logfile provides a log file writer with size based rotation and helpers to read the last lines of it.
+package logfile
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Writer is an io.WriteCloser appending to a file, which is rotated once it exceeds maxSize.
+// Rotated files are renamed to <path>.1 ... <path>.<maxBackups>, older files are removed.
+type Writer struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewWriter - opens or creates the log file at path, maxSize <= 0 disables rotation
+func NewWriter(path string, maxSize int64, maxBackups int) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create log directory of %s: %v", path, err)
+	}
+	w := &Writer{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %v", w.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file %s: %v", w.path, err)
+	}
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+// Write - appends p to the log file, rotating it first if p does not fit
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file %s: %v", w.path, err)
+	}
+	w.file = nil
+
+	if w.maxBackups <= 0 {
+		if err := os.Remove(w.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove log file %s: %v", w.path, err)
+		}
+		return w.open()
+	}
+	if err := os.Remove(backupPath(w.path, w.maxBackups)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove log file %s: %v", backupPath(w.path, w.maxBackups), err)
+	}
+	for i := w.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(backupPath(w.path, i), backupPath(w.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to rotate log file %s: %v", backupPath(w.path, i), err)
+		}
+	}
+	if err := os.Rename(w.path, backupPath(w.path, 1)); err != nil {
+		return fmt.Errorf("failed to rotate log file %s: %v", w.path, err)
+	}
+	return w.open()
+}
+
+// Close - closes the log file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// Path - returns the path of the log file
+func (w *Writer) Path() string {
+	return w.path
+}
+
+func backupPath(path string, i int) string {
+	return path + "." + strconv.Itoa(i)
+}
+
+// Tail - returns the last n lines of the log file at path, including the rotated files if needed
+func Tail(path string, n int) ([]string, error) {
+	if n <= 0 {
+		return []string{}, nil
+	}
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; len(lines) < n; i++ {
+		older, err := readLines(backupPath(path, i))
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		lines = append(older, lines...)
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// Follow - writes lines appended to the log file at path to out until ctx is done,
+// the file is reopened when it is rotated.
+func Follow(ctx context.Context, path string, interval time.Duration, out func(line string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { file.Close() }()
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	partial := ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err == nil {
+			if err := out(partial + line[:len(line)-1]); err != nil {
+				return err
+			}
+			partial = ""
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		partial += line
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		rotated, err := isRotated(file, path)
+		if err != nil || !rotated {
+			continue
+		}
+		newFile, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		file.Close()
+		file = newFile
+		reader = bufio.NewReader(file)
+	}
+}
+
+// isRotated - reports whether path no longer refers to the open file
+func isRotated(file *os.File, path string) (bool, error) {
+	current, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return !os.SameFile(current, info), nil
+}
@@ -0,0 +1,129 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package logfile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriterRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foo.log")
+	w, err := NewWriter(path, 16, 2)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := fmt.Fprintf(w, "line %d abcdef\n", i); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "line 4 abcdef\n",
+		path + ".1": "line 3 abcdef\n",
+		path + ".2": "line 2 abcdef\n",
+	}
+	for p, content := range want {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", p, err)
+		}
+		if string(data) != content {
+			t.Errorf("%s = %q, want %q", p, data, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists beyond max backups", path)
+	}
+}
+
+func TestTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foo.log")
+	w, err := NewWriter(path, 20, 3)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	defer w.Close()
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+
+	tests := []struct {
+		name string
+		n    int
+		want []string
+	}{
+		{name: "Zero", n: 0, want: []string{}},
+		{name: "CurrentFile", n: 2, want: []string{"line 4", "line 5"}},
+		{name: "RotatedFiles", n: 5, want: []string{"line 1", "line 2", "line 3", "line 4", "line 5"}},
+		{name: "MoreThanAvailable", n: 100, want: []string{"line 0", "line 1", "line 2", "line 3", "line 4", "line 5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Tail(path, tt.n)
+			if err != nil {
+				t.Fatalf("Tail() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tail() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Tail(filepath.Join(t.TempDir(), "missing.log"), 10); !os.IsNotExist(err) {
+		t.Errorf("Tail() of missing file error = %v", err)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foo.log")
+	w, err := NewWriter(path, 16, 1)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	defer w.Close()
+	fmt.Fprintln(w, "before follow")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lines := make(chan string, 10)
+	done := make(chan error)
+	go func() {
+		done <- Follow(ctx, path, 10*time.Millisecond, func(line string) error {
+			lines <- line
+			return nil
+		})
+	}()
+
+	// wait for Follow to open the file at its end
+	time.Sleep(100 * time.Millisecond)
+	want := []string{"first line", "second line", "after rotate"}
+	for _, line := range want {
+		fmt.Fprintln(w, line)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for _, line := range want {
+		select {
+		case got := <-lines:
+			if got != line {
+				t.Errorf("Follow() line = %q, want %q", got, line)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Follow() did not return line %q", line)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Follow() error = %v", err)
+	}
+}
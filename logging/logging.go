@@ -0,0 +1,410 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package logging configures the output of l3afd logs and provides component loggers with their own level.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/l3af-project/l3afd/logfile"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Log formats
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// Log outputs
+const (
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+	OutputSyslog = "syslog"
+)
+
+// Config defines the output and levels of the logs
+type Config struct {
+	Level          string
+	Format         string
+	Output         string
+	FileName       string
+	FileMaxSizeMB  int
+	FileMaxBackups int
+	SyslogNetwork  string
+	SyslogAddr     string
+	SyslogTag      string
+	// ComponentLevels overrides the level of components, entries are component=level
+	ComponentLevels []string
+}
+
+// Logger is the logger of a component, it follows the output and level changes of the logging configuration
+type Logger struct {
+	name   string
+	logger atomic.Pointer[zerolog.Logger]
+}
+
+var (
+	mu         sync.Mutex
+	base       = zerolog.New(os.Stderr).With().Timestamp().Logger()
+	rootLevel  = zerolog.InfoLevel
+	overrides  = map[string]zerolog.Level{}
+	components = map[string]*Logger{}
+	closer     io.Closer
+	onChange   func()
+
+	// levels saved while debug is temporarily enabled
+	debugTimer     *time.Timer
+	debugUntil     time.Time
+	savedRoot      zerolog.Level
+	savedOverrides map[string]zerolog.Level
+)
+
+// Component - returns the logger of the component name
+func Component(name string) *Logger {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if l, ok := components[name]; ok {
+		return l
+	}
+	l := &Logger{name: name}
+	l.update()
+	components[name] = l
+	return l
+}
+
+// update - rebuilds the logger from the base logger and the component level, mu must be held
+func (l *Logger) update() {
+	level, ok := overrides[l.name]
+	if !ok {
+		level = rootLevel
+	}
+	logger := base.With().Str("component", l.name).Logger().Level(level)
+	l.logger.Store(&logger)
+}
+
+// Setup - configures the output, format and levels of the logs
+func Setup(cfg Config) error {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	levels, err := parseComponentLevels(cfg.ComponentLevels)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer
+	var outCloser io.Closer
+	switch cfg.Output {
+	case "", OutputStderr:
+		out = os.Stderr
+	case OutputFile:
+		w, err := logfile.NewWriter(cfg.FileName, int64(cfg.FileMaxSizeMB)*1024*1024, cfg.FileMaxBackups)
+		if err != nil {
+			return err
+		}
+		out, outCloser = w, w
+	case OutputSyslog:
+		w, err := newSyslogWriter(cfg.SyslogNetwork, cfg.SyslogAddr, cfg.SyslogTag)
+		if err != nil {
+			return err
+		}
+		out, outCloser = w, w
+	default:
+		return fmt.Errorf("unknown log output %s", cfg.Output)
+	}
+
+	switch cfg.Format {
+	case "", FormatConsole:
+		if cfg.Output == OutputSyslog {
+			return fmt.Errorf("log format %s is not supported with syslog output", cfg.Format)
+		}
+		out = zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339Nano, NoColor: cfg.Output == OutputFile}
+	case FormatJSON:
+	default:
+		return fmt.Errorf("unknown log format %s", cfg.Format)
+	}
+
+	mu.Lock()
+	base = zerolog.New(out).With().Timestamp().Logger()
+	rootLevel = level
+	overrides = levels
+	if closer != nil {
+		closer.Close()
+	}
+	closer = outCloser
+	stopDebug()
+	apply()
+	mu.Unlock()
+	notify()
+	return nil
+}
+
+// SetLevels - sets the root level unless it is empty and the levels of components.
+// An empty component level removes its override, the component follows the root level again.
+// Nothing is changed if any level is invalid. A temporary debug level enabled by ToggleDebug
+// is ended without reverting the levels.
+func SetLevels(root string, componentLevels map[string]string) error {
+	var level zerolog.Level
+	if len(root) > 0 {
+		var err error
+		if level, err = parseLevel(root); err != nil {
+			return err
+		}
+	}
+	parsed := make(map[string]zerolog.Level, len(componentLevels))
+	for name, s := range componentLevels {
+		if len(s) == 0 {
+			continue
+		}
+		l, err := parseLevel(s)
+		if err != nil {
+			return err
+		}
+		parsed[name] = l
+	}
+
+	mu.Lock()
+	for name := range componentLevels {
+		if _, ok := components[name]; !ok {
+			mu.Unlock()
+			return fmt.Errorf("unknown log component %s", name)
+		}
+	}
+	stopDebug()
+	levels := make(map[string]zerolog.Level, len(overrides))
+	for name, l := range overrides {
+		levels[name] = l
+	}
+	for name := range componentLevels {
+		if l, ok := parsed[name]; ok {
+			levels[name] = l
+		} else {
+			delete(levels, name)
+		}
+	}
+	if len(root) > 0 {
+		rootLevel = level
+	}
+	overrides = levels
+	apply()
+	mu.Unlock()
+	notify()
+	return nil
+}
+
+// ToggleDebug - enables the debug level on all components until timeout, the previous levels are restored afterwards.
+// Calling it while debug is enabled restores the previous levels immediately. It returns whether debug is enabled.
+func ToggleDebug(timeout time.Duration) bool {
+	mu.Lock()
+	enabled := debugTimer == nil
+	if enabled {
+		savedRoot, savedOverrides = rootLevel, overrides
+		rootLevel = minLevel(rootLevel, zerolog.DebugLevel)
+		levels := make(map[string]zerolog.Level, len(overrides))
+		for name, level := range overrides {
+			levels[name] = minLevel(level, zerolog.DebugLevel)
+		}
+		overrides = levels
+		debugUntil = time.Now().Add(timeout)
+		var t *time.Timer
+		t = time.AfterFunc(timeout, func() {
+			mu.Lock()
+			if debugTimer != t {
+				// ended by another level change
+				mu.Unlock()
+				return
+			}
+			revertDebug()
+			apply()
+			mu.Unlock()
+			log.Info().Msg("temporary debug log level expired, log levels are restored")
+			notify()
+		})
+		debugTimer = t
+	} else {
+		revertDebug()
+	}
+	apply()
+	mu.Unlock()
+	notify()
+	return enabled
+}
+
+// DebugUntil - returns until when debug is temporarily enabled by ToggleDebug, zero time when it is not
+func DebugUntil() time.Time {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if debugTimer == nil {
+		return time.Time{}
+	}
+	return debugUntil
+}
+
+// OnChange - registers fn to be called after the levels changed
+func OnChange(fn func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	onChange = fn
+}
+
+func notify() {
+	mu.Lock()
+	fn := onChange
+	mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// revertDebug - restores the levels saved by ToggleDebug, mu must be held
+func revertDebug() {
+	rootLevel, overrides = savedRoot, savedOverrides
+	stopDebug()
+}
+
+// stopDebug - ends the temporary debug level keeping the current levels, mu must be held
+func stopDebug() {
+	if debugTimer != nil {
+		debugTimer.Stop()
+	}
+	debugTimer = nil
+	debugUntil = time.Time{}
+	savedOverrides = nil
+}
+
+func minLevel(a, b zerolog.Level) zerolog.Level {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// apply - updates the global and component loggers after a configuration change, mu must be held
+func apply() {
+	log.Logger = base.Level(rootLevel)
+	// the global level has to allow the most verbose component
+	global := rootLevel
+	for _, level := range overrides {
+		if level < global {
+			global = level
+		}
+	}
+	zerolog.SetGlobalLevel(global)
+	for _, l := range components {
+		l.update()
+	}
+}
+
+func parseLevel(s string) (zerolog.Level, error) {
+	if len(s) == 0 {
+		return zerolog.InfoLevel, nil
+	}
+	level, err := zerolog.ParseLevel(strings.ToLower(s))
+	if err != nil {
+		return zerolog.NoLevel, fmt.Errorf("invalid log level %s: %v", s, err)
+	}
+	return level, nil
+}
+
+func parseComponentLevels(entries []string) (map[string]zerolog.Level, error) {
+	levels := make(map[string]zerolog.Level, len(entries))
+	for _, entry := range entries {
+		name, s, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || len(name) == 0 {
+			return nil, fmt.Errorf("invalid component log level %s, expected component=level", entry)
+		}
+		level, err := parseLevel(s)
+		if err != nil {
+			return nil, err
+		}
+		levels[name] = level
+	}
+	return levels, nil
+}
+
+// Levels - returns the root level and the levels of the components
+func Levels() (zerolog.Level, map[string]zerolog.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	levels := make(map[string]zerolog.Level, len(components))
+	for name := range components {
+		level, ok := overrides[name]
+		if !ok {
+			level = rootLevel
+		}
+		levels[name] = level
+	}
+	return rootLevel, levels
+}
+
+// ComponentNames - returns the names of the registered components
+func ComponentNames() []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (l *Logger) get() *zerolog.Logger {
+	return l.logger.Load()
+}
+
+// With - creates a child logger of the component with fields added to its context
+func (l *Logger) With() zerolog.Context {
+	return l.get().With()
+}
+
+// Trace - starts a new message with trace level
+func (l *Logger) Trace() *zerolog.Event {
+	return l.get().Trace()
+}
+
+// Debug - starts a new message with debug level
+func (l *Logger) Debug() *zerolog.Event {
+	return l.get().Debug()
+}
+
+// Info - starts a new message with info level
+func (l *Logger) Info() *zerolog.Event {
+	return l.get().Info()
+}
+
+// Warn - starts a new message with warn level
+func (l *Logger) Warn() *zerolog.Event {
+	return l.get().Warn()
+}
+
+// Error - starts a new message with error level
+func (l *Logger) Error() *zerolog.Event {
+	return l.get().Error()
+}
+
+// Err - starts a new message with error level if err is not nil, info level otherwise
+func (l *Logger) Err(err error) *zerolog.Event {
+	return l.get().Err(err)
+}
+
+// Fatal - starts a new message with fatal level, the process exits after the message is sent
+func (l *Logger) Fatal() *zerolog.Event {
+	return l.get().Fatal()
+}
@@ -0,0 +1,229 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func readJSONLines(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("log line %q is not json: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestSetupComponentLevels(t *testing.T) {
+	t.Cleanup(func() { Setup(Config{}) })
+
+	path := filepath.Join(t.TempDir(), "l3afd.log")
+	kf := Component("kf")
+	apis := Component("apis")
+	err := Setup(Config{
+		Level:           "info",
+		Format:          FormatJSON,
+		Output:          OutputFile,
+		FileName:        path,
+		FileMaxSizeMB:   1,
+		FileMaxBackups:  1,
+		ComponentLevels: []string{"kf=debug"},
+	})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	kf.Debug().Str("program", "ratelimiting").Msg("kf debug")
+	apis.Debug().Msg("apis debug")
+	apis.Info().Msg("apis info")
+	log.Debug().Msg("global debug")
+	log.Info().Msg("global info")
+
+	lines := readJSONLines(t, path)
+	want := []struct {
+		message   string
+		component string
+	}{
+		{"kf debug", "kf"},
+		{"apis info", "apis"},
+		{"global info", ""},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d log lines %v, want %d", len(lines), lines, len(want))
+	}
+	for i, w := range want {
+		if lines[i]["message"] != w.message {
+			t.Errorf("line %d message = %v, want %s", i, lines[i]["message"], w.message)
+		}
+		if component, _ := lines[i]["component"].(string); component != w.component {
+			t.Errorf("line %d component = %s, want %s", i, component, w.component)
+		}
+	}
+	if lines[0]["program"] != "ratelimiting" {
+		t.Errorf("line 0 program = %v, want ratelimiting", lines[0]["program"])
+	}
+
+	root, levels := Levels()
+	if root != zerolog.InfoLevel || levels["kf"] != zerolog.DebugLevel || levels["apis"] != zerolog.InfoLevel {
+		t.Errorf("Levels() = %v %v, want info, kf debug and apis info", root, levels)
+	}
+}
+
+func TestSetupInvalid(t *testing.T) {
+	t.Cleanup(func() { Setup(Config{}) })
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "InvalidLevel", cfg: Config{Level: "loud"}},
+		{name: "InvalidComponentLevel", cfg: Config{ComponentLevels: []string{"kf=loud"}}},
+		{name: "MissingComponentName", cfg: Config{ComponentLevels: []string{"=debug"}}},
+		{name: "MissingComponentLevel", cfg: Config{ComponentLevels: []string{"kf"}}},
+		{name: "UnknownFormat", cfg: Config{Format: "xml"}},
+		{name: "UnknownOutput", cfg: Config{Output: "kafka"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Setup(tt.cfg); err == nil {
+				t.Errorf("Setup() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestSetLevels(t *testing.T) {
+	t.Cleanup(func() { Setup(Config{}) })
+	Component("kf")
+	Component("apis")
+	if err := Setup(Config{Level: "info"}); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		root       string
+		components map[string]string
+		wantErr    bool
+		wantRoot   zerolog.Level
+		wantKF     zerolog.Level
+		wantAPIs   zerolog.Level
+	}{
+		{
+			name:     "Root",
+			root:     "warn",
+			wantRoot: zerolog.WarnLevel,
+			wantKF:   zerolog.WarnLevel,
+			wantAPIs: zerolog.WarnLevel,
+		},
+		{
+			name:       "Component",
+			components: map[string]string{"kf": "debug"},
+			wantRoot:   zerolog.WarnLevel,
+			wantKF:     zerolog.DebugLevel,
+			wantAPIs:   zerolog.WarnLevel,
+		},
+		{
+			name:       "InvalidComponentLevel",
+			root:       "error",
+			components: map[string]string{"apis": "loud"},
+			wantErr:    true,
+			wantRoot:   zerolog.WarnLevel,
+			wantKF:     zerolog.DebugLevel,
+			wantAPIs:   zerolog.WarnLevel,
+		},
+		{
+			name:       "UnknownComponent",
+			components: map[string]string{"foo": "debug"},
+			wantErr:    true,
+			wantRoot:   zerolog.WarnLevel,
+			wantKF:     zerolog.DebugLevel,
+			wantAPIs:   zerolog.WarnLevel,
+		},
+		{
+			name:       "RemoveOverride",
+			root:       "info",
+			components: map[string]string{"kf": ""},
+			wantRoot:   zerolog.InfoLevel,
+			wantKF:     zerolog.InfoLevel,
+			wantAPIs:   zerolog.InfoLevel,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetLevels(tt.root, tt.components); (err != nil) != tt.wantErr {
+				t.Errorf("SetLevels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			root, levels := Levels()
+			if root != tt.wantRoot || levels["kf"] != tt.wantKF || levels["apis"] != tt.wantAPIs {
+				t.Errorf("Levels() = %v %v, want %v kf %v apis %v", root, levels, tt.wantRoot, tt.wantKF, tt.wantAPIs)
+			}
+		})
+	}
+}
+
+func TestToggleDebug(t *testing.T) {
+	t.Cleanup(func() { Setup(Config{}) })
+	Component("kf")
+	if err := Setup(Config{Level: "warn", ComponentLevels: []string{"kf=error"}}); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	changed := make(chan struct{}, 10)
+	OnChange(func() { changed <- struct{}{} })
+	t.Cleanup(func() { OnChange(nil) })
+
+	if !ToggleDebug(time.Hour) {
+		t.Fatalf("ToggleDebug() = false, want debug enabled")
+	}
+	root, levels := Levels()
+	if root != zerolog.DebugLevel || levels["kf"] != zerolog.DebugLevel {
+		t.Errorf("Levels() = %v %v after enabling debug, want debug", root, levels)
+	}
+	if DebugUntil().IsZero() {
+		t.Errorf("DebugUntil() is zero while debug is enabled")
+	}
+	if ToggleDebug(time.Hour) {
+		t.Fatalf("ToggleDebug() = true, want debug disabled")
+	}
+	root, levels = Levels()
+	if root != zerolog.WarnLevel || levels["kf"] != zerolog.ErrorLevel {
+		t.Errorf("Levels() = %v %v after disabling debug, want warn and kf error", root, levels)
+	}
+
+	// expiry restores the previous levels
+	for len(changed) > 0 {
+		<-changed
+	}
+	ToggleDebug(10 * time.Millisecond)
+	<-changed
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("temporary debug level did not expire")
+	}
+	root, levels = Levels()
+	if root != zerolog.WarnLevel || levels["kf"] != zerolog.ErrorLevel || !DebugUntil().IsZero() {
+		t.Errorf("Levels() = %v %v after expiry, want warn and kf error", root, levels)
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+
+	"github.com/rs/zerolog"
+)
+
+type syslogWriter struct {
+	zerolog.LevelWriter
+	io.Closer
+}
+
+// newSyslogWriter - returns a writer sending the logs to syslog with their level as severity,
+// an empty network and addr connect to the local syslog server
+func newSyslogWriter(network, addr, tag string) (*syslogWriter, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog %s %s: %v", network, addr, err)
+	}
+	return &syslogWriter{LevelWriter: zerolog.SyslogLevelWriter(w), Closer: w}, nil
+}
@@ -0,0 +1,17 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build WINDOWS
+// +build WINDOWS
+
+package logging
+
+import (
+	"errors"
+	"io"
+)
+
+// newSyslogWriter - syslog is not supported on windows
+func newSyslogWriter(network, addr, tag string) (io.WriteCloser, error) {
+	return nil, errors.New("syslog log output is not supported on windows")
+}
@@ -5,12 +5,10 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
@@ -18,11 +16,19 @@ import (
 
 	"github.com/l3af-project/l3afd/apis"
 	"github.com/l3af-project/l3afd/apis/handlers"
+	"github.com/l3af-project/l3afd/audit"
+	"github.com/l3af-project/l3afd/authz"
 	"github.com/l3af-project/l3afd/config"
 	"github.com/l3af-project/l3afd/kf"
-	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/logging"
+	"github.com/l3af-project/l3afd/manifest"
 	"github.com/l3af-project/l3afd/pidfile"
+	"github.com/l3af-project/l3afd/probes"
+	"github.com/l3af-project/l3afd/remoteconfig"
+	"github.com/l3af-project/l3afd/sandbox"
+	"github.com/l3af-project/l3afd/signals"
 	"github.com/l3af-project/l3afd/stats"
+	"github.com/l3af-project/l3afd/tracing"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -30,35 +36,48 @@ import (
 
 const daemonName = "l3afd"
 
-func setupLogging() {
-	const logLevelEnvName = "L3AF_LOG_LEVEL"
-
-	// If this is removed, zerolog will do structured logging. For now,
-	// we set zerolog to do human-readable logging just to keep the same
-	// behavior as the closed-source logging package that we replaced with
-	// zerolog.
-	log.Logger = log.Output(zerolog.ConsoleWriter{
-		Out: os.Stderr, TimeFormat: time.RFC3339Nano})
+const logLevelEnvName = "L3AF_LOG_LEVEL"
 
+// setupLogging - logs are written to stderr in human-readable format until the config is read,
+// to keep the same behavior as the closed-source logging package that we replaced with zerolog.
+func setupLogging() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 
-	// Set the default
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-
 	logLevelStr := os.Getenv(logLevelEnvName)
-	if logLevelStr == "" {
-		return
-	}
-	logLevel, err := zerolog.ParseLevel(logLevelStr)
-	if err != nil {
+	if err := logging.Setup(logging.Config{Level: logLevelStr}); err != nil {
 		log.Error().Err(err).Msg("Invalid L3AF_LOG_LEVEL")
 		return
 	}
-	zerolog.SetGlobalLevel(logLevel)
-	log.Debug().Msgf("Log level set to %q", logLevel)
+	if logLevelStr != "" {
+		log.Debug().Msgf("Log level set to %q", logLevelStr)
+	}
+}
+
+// configureLogging - applies the [logging] config section, L3AF_LOG_LEVEL overrides the configured level
+func configureLogging(conf *config.Config) error {
+	level := conf.LogLevel
+	if logLevelStr := os.Getenv(logLevelEnvName); logLevelStr != "" {
+		level = logLevelStr
+	}
+	return logging.Setup(logging.Config{
+		Level:           level,
+		Format:          conf.LogFormat,
+		Output:          conf.LogOutput,
+		FileName:        conf.LogFileName,
+		FileMaxSizeMB:   conf.LogFileMaxSizeMB,
+		FileMaxBackups:  conf.LogFileMaxBackups,
+		SyslogNetwork:   conf.LogSyslogNetwork,
+		SyslogAddr:      conf.LogSyslogAddr,
+		SyslogTag:       conf.LogSyslogTag,
+		ComponentLevels: conf.LogComponentLevels,
+	})
 }
 
 func main() {
+	if sandbox.IsShim() {
+		// started by l3afd to execute a user program with reduced privileges
+		sandbox.Run()
+	}
 	setupLogging()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -73,6 +92,31 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Unable to parse config %q", confPath)
 	}
+	if err = configureLogging(conf); err != nil {
+		log.Fatal().Err(err).Msg("Invalid logging config")
+	}
+	if err = audit.Setup(audit.Config{
+		Enabled:       conf.AuditEnabled,
+		FileName:      conf.AuditFileName,
+		MaxSizeMB:     conf.AuditMaxSizeMB,
+		MaxBackups:    conf.AuditMaxBackups,
+		Syslog:        conf.AuditSyslog,
+		SyslogNetwork: conf.AuditSyslogNetwork,
+		SyslogAddr:    conf.AuditSyslogAddr,
+		SyslogTag:     conf.AuditSyslogTag,
+	}); err != nil {
+		log.Fatal().Err(err).Msg("Invalid audit config")
+	}
+	if err = authz.Setup(conf.AuthzPolicyFile); err != nil {
+		log.Fatal().Err(err).Msg("Invalid authorization policy")
+	}
+	go authz.Watch(ctx, conf.AuthzReloadInterval)
+	setupPolicyReload()
+	shutdownTracing, err := setupTracing(ctx, conf)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid tracing config")
+	}
+	defer shutdownTracing(context.Background())
 
 	if err = pidfile.CheckPIDConflict(conf.PIDFilename); err != nil {
 		log.Fatal().Err(err).Msgf("The PID file: %s, is in an unacceptable state", conf.PIDFilename)
@@ -85,27 +129,60 @@ func main() {
 		if err = checkKernelVersion(conf); err != nil {
 			log.Fatal().Err(err).Msg("The unsupported kernel version please upgrade")
 		}
+		if conf.KernelFeatureCheck {
+			if err = kf.CheckKernelFeatures(conf); err != nil {
+				log.Fatal().Err(err).Msg("The kernel lacks eBPF features required by l3afd")
+			}
+		}
 	}
 
 	if err = registerL3afD(conf); err != nil {
 		log.Error().Err(err).Msg("L3afd registration failed")
 	}
 
+	var configStoreLoaded, deployed probes.Flag
+	p := setupProbes(conf, &configStoreLoaded, &deployed)
+
+	if err = kf.SetupEventJournal(conf); err != nil {
+		log.Fatal().Err(err).Msg("L3afd failed to setup the event journal")
+	}
 	ebpfConfigs, err := SetupNFConfigs(ctx, conf)
 	if err != nil {
 		log.Fatal().Err(err).Msg("L3afd failed to start")
 	}
+	p.AddLivenessCheck("process-monitor", func() error {
+		return ebpfConfigs.MonitorResponsive(conf.ProbesMonitorStallTimeout)
+	})
+	p.AddReadinessCheck("root-programs", ebpfConfigs.VerifyRootPrograms)
+
+	logging.OnChange(publishLogLevels)
+	publishLogLevels()
+	if runtime.GOOS == "linux" && conf.KernelFeatureCheck {
+		// publishes the KernelFeature metrics
+		ebpfConfigs.Capabilities()
+	}
+	setupDebugToggle(conf.LogDebugToggleTimeout)
 
-	t, err := ReadConfigsFromConfigStore(conf)
+	t, err := ebpfConfigs.ConfigStore().Load()
 	if err != nil {
 		log.Error().Err(err).Msg("L3afd failed to read configs from store")
 	}
+	configStoreLoaded.Set(err)
 
 	if t != nil {
-		if err := ebpfConfigs.DeployeBPFPrograms(t); err != nil {
+		if err := ebpfConfigs.DeployeBPFPrograms(ctx, t); err != nil {
 			log.Error().Err(err).Msg("L3afd failed to deploy persistent configs from store")
 		}
 	}
+	// Failures of individual programs are reported by the health API, l3afd is ready to accept new configs
+	deployed.Set(nil)
+	ebpfConfigs.StartReconciler(ctx)
+	if err := setupRemoteConfig(ctx, conf, ebpfConfigs); err != nil {
+		log.Fatal().Err(err).Msg("Invalid remote config")
+	}
+	if err := setupManifests(ctx, conf, ebpfConfigs); err != nil {
+		log.Fatal().Err(err).Msg("Invalid manifests config")
+	}
 
 	if err := handlers.InitConfigs(ebpfConfigs); err != nil {
 		log.Fatal().Err(err).Msg("L3afd failed to initialise configs")
@@ -117,6 +194,142 @@ func main() {
 	select {}
 }
 
+// setupTracing - exports the spans of API requests and eBPF program operations when tracing is enabled
+func setupTracing(ctx context.Context, conf *config.Config) (func(context.Context) error, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not get hostname from OS")
+	}
+	return tracing.Setup(ctx, tracing.Config{
+		Enabled:     conf.TracingEnabled,
+		Endpoint:    conf.TracingEndpoint,
+		Insecure:    conf.TracingInsecure,
+		ServiceName: conf.TracingServiceName,
+		HostName:    hostname,
+		Version:     Version,
+		SampleRatio: conf.TracingSampleRatio,
+	})
+}
+
+// setupProbes - registers the checks of the l3afd liveness and readiness endpoints and starts serving them
+func setupProbes(conf *config.Config, configStoreLoaded, deployed *probes.Flag) *probes.Probes {
+	p := probes.NewProbes()
+	p.AddLivenessCheck("watchdog", probes.Watchdog(time.Second).Check)
+	p.AddReadinessCheck("config-store", configStoreLoaded.Check)
+	p.AddReadinessCheck("deploy", deployed.Check)
+	p.AddReadinessCheck("metrics", probes.TCPCheck(conf.MetricsAddr))
+	if conf.ProbesEnabled {
+		p.Start(conf.ProbesAddr)
+	}
+	return p
+}
+
+// publishLogLevels - reports the log level of every component in the LogLevel gauge
+func publishLogLevels() {
+	root, levels := logging.Levels()
+	stats.SetComponentValue(float64(root), stats.LogLevel, daemonName)
+	for name, level := range levels {
+		stats.SetComponentValue(float64(level), stats.LogLevel, name)
+	}
+}
+
+// setupDebugToggle - enables the debug log level for timeout on the debug toggle signal,
+// the signal received again restores the previous levels
+func setupDebugToggle(timeout time.Duration) {
+	if len(signals.DebugToggleSignals) == 0 {
+		return
+	}
+	toggle := make(chan os.Signal, 1)
+	signal.Notify(toggle, signals.DebugToggleSignals...)
+	go func() {
+		for range toggle {
+			if logging.ToggleDebug(timeout) {
+				log.Info().Dur("timeout", timeout).Msg("debug log level enabled temporarily")
+			} else {
+				log.Info().Msg("temporary debug log level disabled, log levels are restored")
+			}
+		}
+	}()
+}
+
+// setupPolicyReload - reloads the authorization policy on SIGHUP
+func setupPolicyReload() {
+	if len(signals.ReloadSignals) == 0 {
+		return
+	}
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, signals.ReloadSignals...)
+	go func() {
+		for range reload {
+			if err := authz.Reload(); err != nil {
+				log.Error().Err(err).Msg("failed to reload authorization policy, keeping the previous one")
+			}
+		}
+	}()
+}
+
+// remoteConfig - returns the config service of this host
+func remoteConfig(conf *config.Config, hostname string) remoteconfig.Config {
+	return remoteconfig.Config{
+		URL:             conf.RemoteConfigURL,
+		RegisterURL:     conf.RemoteConfigRegisterURL,
+		HostName:        hostname,
+		DataCenter:      conf.DataCenter,
+		Interval:        conf.RemoteConfigInterval,
+		Timeout:         conf.RemoteConfigTimeout,
+		PublicKeyFile:   conf.RemoteConfigPublicKeyFile,
+		SignatureHeader: conf.RemoteConfigSignatureHeader,
+		AllowUnsigned:   conf.RemoteConfigAllowUnsigned,
+		StateFile:       conf.L3afConfigStoreFileName + ".remote-config",
+		CACertFile:      conf.RemoteConfigCACertFile,
+		ClientCertFile:  conf.RemoteConfigClientCertFile,
+		ClientKeyFile:   conf.RemoteConfigClientKeyFile,
+	}
+}
+
+// setupRemoteConfig - pulls the desired configs from the config service when enabled
+func setupRemoteConfig(ctx context.Context, conf *config.Config, nfConfigs *kf.NFConfigs) error {
+	if !conf.RemoteConfigEnabled {
+		return nil
+	}
+	if len(conf.RemoteConfigURL) == 0 || conf.RemoteConfigInterval <= 0 {
+		return fmt.Errorf("remote config url and interval are required")
+	}
+	// pulled configs replace the whole desired state, they would remove the interfaces of the manifests
+	if conf.ManifestsEnabled {
+		return fmt.Errorf("remote config and manifests can not be enabled together")
+	}
+	client, err := remoteconfig.New(remoteConfig(conf, nfConfigs.HostName))
+	if err != nil {
+		return err
+	}
+	log.Info().Str("url", conf.RemoteConfigURL).Dur("interval", conf.RemoteConfigInterval).Msg("pulling configs from the config service")
+	go client.Run(ctx, nfConfigs.DeployeBPFPrograms)
+	return nil
+}
+
+// setupManifests - deploys the manifests of the manifest directory on change when enabled
+func setupManifests(ctx context.Context, conf *config.Config, nfConfigs *kf.NFConfigs) error {
+	if !conf.ManifestsEnabled {
+		return nil
+	}
+	if conf.ManifestsResyncInterval <= 0 {
+		return fmt.Errorf("manifests resync interval is required")
+	}
+	w, err := manifest.New(manifest.Config{
+		Dir:            conf.ManifestsDir,
+		HostName:       nfConfigs.HostName,
+		Debounce:       conf.ManifestsDebounce,
+		ResyncInterval: conf.ManifestsResyncInterval,
+	}, nfConfigs)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("dir", conf.ManifestsDir).Msg("watching manifests")
+	go w.Run(ctx)
+	return nil
+}
+
 func SetupNFConfigs(ctx context.Context, conf *config.Config) (*kf.NFConfigs, error) {
 	// Get Hostname
 	machineHostname, err := os.Hostname()
@@ -128,6 +341,7 @@ func SetupNFConfigs(ctx context.Context, conf *config.Config) (*kf.NFConfigs, er
 	stats.SetupMetrics(machineHostname, daemonName, conf.MetricsAddr)
 
 	pMon := kf.NewpCheck(conf.MaxEBPFReStartCount, conf.BpfChainingEnabled, conf.EBPFPollInterval)
+	pMon.SetRestartPolicy(conf.EBPFReStartBackoffInitial, conf.EBPFReStartBackoffMax, conf.EBPFReStartStableDuration, conf.EBPFCrashLoopUnlink)
 	kfM := kf.NewpKFMetrics(conf.BpfChainingEnabled, conf.NMetricSamples)
 
 	nfConfigs, err := kf.NewNFConfigs(ctx, machineHostname, conf, pMon, kfM)
@@ -187,34 +401,3 @@ func getKernelVersion() (string, error) {
 
 	return kernelVersion, nil
 }
-
-func ReadConfigsFromConfigStore(conf *config.Config) ([]models.L3afBPFPrograms, error) {
-
-	// check for persistent file
-	if _, err := os.Stat(conf.L3afConfigStoreFileName); errors.Is(err, os.ErrNotExist) {
-		log.Warn().Msgf("no persistent config exists")
-		return nil, nil
-	}
-
-	file, err := os.OpenFile(conf.L3afConfigStoreFileName, os.O_RDONLY, os.ModePerm)
-	defer func() {
-		_ = file.Close()
-	}()
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to open persistent file (%s): %v", conf.L3afConfigStoreFileName, err)
-	}
-
-	byteValue, err := io.ReadAll(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read persistent file (%s): %v", conf.L3afConfigStoreFileName, err)
-	}
-
-	var t []models.L3afBPFPrograms
-	if err = json.Unmarshal(byteValue, &t); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal persistent config json: %v", err)
-
-	}
-
-	return t, nil
-}
@@ -0,0 +1,520 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package manifest deploys the eBPF program configs declared by the manifests of a local directory.
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/l3af-project/l3afd/configstore"
+	"github.com/l3af-project/l3afd/logging"
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/schema"
+)
+
+// log - logger of the manifest component
+var log = logging.Component("manifest")
+
+// Author - author of the config revisions deployed from the manifests
+const Author = "manifest"
+
+// statusSuffix - suffix of the status file written next to each manifest
+const statusSuffix = ".status"
+
+// stateFile - hidden file of the manifest directory keeping the last good configs of the manifests across restarts
+const stateFile = ".l3afd-manifests.state"
+
+const (
+	StateApplied = "applied" // Programs of the manifest are deployed
+	StateFailed  = "failed"  // Manifest is invalid or its programs failed to deploy, see the reason
+)
+
+// Config defines the manifest directory of this host
+type Config struct {
+	Dir      string
+	HostName string
+	// Debounce delays the deploy after a change, so that several files written together are deployed at once
+	Debounce time.Duration
+	// ResyncInterval rescans the directory in case a change was missed, it is the poll interval where inotify is not available
+	ResyncInterval time.Duration
+}
+
+// Deployer deploys the merged configs and reports the observed status of the programs
+type Deployer interface {
+	DeployeBPFPrograms(ctx context.Context, bpfProgs []models.L3afBPFPrograms) error
+	ValidatePrograms(bpfProgs []models.L3afBPFPrograms) error
+	DesiredPrograms() []models.L3afBPFPrograms
+	ProgramStatus(iface string) models.L3afBPFProgramsStatus
+}
+
+// Status defines the content of the status file of a manifest
+type Status struct {
+	Manifest  string    `json:"manifest"`
+	Digest    string    `json:"digest"` // sha256 of the manifest the status refers to
+	State     string    `json:"state"`  // applied or failed
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// manifest defines a manifest file and the configs declared by it
+type manifest struct {
+	name   string
+	digest string
+	cfgs   []models.L3afBPFPrograms
+	err    error
+	// cfgs are the last good configs of the manifest, it is invalid now
+	stale bool
+}
+
+// state defines the state file, the last good configs of the manifests and the interfaces they were deployed to
+type state struct {
+	LastGood map[string][]models.L3afBPFPrograms `json:"last_good"`
+	Ifaces   []string                            `json:"ifaces"`
+}
+
+// Watcher deploys the manifests of the directory on change
+type Watcher struct {
+	conf     Config
+	deployer Deployer
+
+	digests  map[string]string                   // digests of the manifests of the last deploy
+	statuses map[string]Status                   // last written status files
+	lastGood map[string][]models.L3afBPFPrograms // last good configs of the manifests, deployed while a manifest is invalid
+	owned    map[string]bool                     // interfaces of the last deployed manifests
+	deployed bool                                // manifests were deployed since the start
+}
+
+// New - returns the watcher of the manifest directory
+func New(conf Config, deployer Deployer) (*Watcher, error) {
+	info, err := os.Stat(conf.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("manifest directory %s: %v", conf.Dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("manifest directory %s is not a directory", conf.Dir)
+	}
+	w := &Watcher{
+		conf:     conf,
+		deployer: deployer,
+		digests:  make(map[string]string),
+		statuses: make(map[string]Status),
+		lastGood: make(map[string][]models.L3afBPFPrograms),
+		owned:    make(map[string]bool),
+	}
+	w.loadState()
+	return w, nil
+}
+
+// loadState - restores the last good configs and owned interfaces of the previous run, they are empty without a state file
+func (w *Watcher) loadState() {
+	buf, err := os.ReadFile(filepath.Join(w.conf.Dir, stateFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn().Err(err).Msg("failed to read manifests state")
+		}
+		return
+	}
+	var s state
+	if err := json.Unmarshal(buf, &s); err != nil {
+		log.Warn().Err(err).Msg("invalid manifests state, ignored")
+		return
+	}
+	for name, cfgs := range s.LastGood {
+		w.lastGood[name] = cfgs
+	}
+	for _, iface := range s.Ifaces {
+		w.owned[iface] = true
+	}
+}
+
+// saveState - writes the last good configs and owned interfaces, it is written to a hidden file first and synced
+func (w *Watcher) saveState() error {
+	s := state{LastGood: w.lastGood, Ifaces: make([]string, 0, len(w.owned))}
+	for iface := range w.owned {
+		s.Ifaces = append(s.Ifaces, iface)
+	}
+	sort.Strings(s.Ifaces)
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifests state: %v", err)
+	}
+	return configstore.WriteFileAtomic(filepath.Join(w.conf.Dir, stateFile), append(buf, '\n'), 0644)
+}
+
+// Run - deploys the manifests and redeploys them on every change of the directory until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	w.scan(ctx)
+
+	changes, err := notify(ctx, w.conf.Dir)
+	if err != nil {
+		log.Warn().Err(err).Str("dir", w.conf.Dir).Msg("failed to watch manifest directory, falling back to resync")
+	}
+	resync := time.NewTicker(w.conf.ResyncInterval)
+	defer resync.Stop()
+	debounce := time.NewTimer(w.conf.Debounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+			debounce.Reset(w.conf.Debounce)
+		case <-debounce.C:
+			w.scan(ctx)
+		case <-resync.C:
+			w.scan(ctx)
+		}
+	}
+}
+
+// isManifest - reports whether the file of the directory is a manifest, hidden files are skipped
+func isManifest(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// scan - reads the manifests and deploys them when one of them changed, the status files are updated either way.
+// An invalid manifest keeps its last good configs deployed, only its status is failed.
+func (w *Watcher) scan(ctx context.Context) {
+	manifests, err := w.read()
+	if err != nil {
+		log.Error().Err(err).Str("dir", w.conf.Dir).Msg("failed to read manifests")
+		return
+	}
+	digests := make(map[string]string, len(manifests))
+	for _, m := range manifests {
+		digests[m.name] = m.digest
+	}
+
+	// conflicts between the manifests are found by the merge, it is done on every scan to report them
+	cfgs := merge(manifests, w.conf.HostName)
+	var deployErr error
+	// the interfaces of manifests removed while l3afd was stopped are removed on the first scan
+	if !equal(digests, w.digests) || (!w.deployed && len(w.owned) > 0) {
+		log.Info().Int("manifests", len(manifests)).Int("ifaces", len(cfgs)).Msg("deploying manifests")
+		// the manifests become the desired configs even when some programs fail to start, the reconciler retries them
+		deployErr = w.deployer.DeployeBPFPrograms(configstore.WithAuthor(ctx, Author), w.desired(cfgs))
+		var rejected schema.Errors
+		switch {
+		case errors.As(deployErr, &rejected):
+			// nothing is deployed, the manifests are deployed again on the next scan
+			log.Error().Err(deployErr).Msg("manifests are rejected")
+		default:
+			if deployErr != nil {
+				log.Error().Err(deployErr).Msg("failed to deploy manifests")
+			}
+			w.digests = digests
+			w.commit(manifests, cfgs)
+		}
+	}
+	w.writeStatuses(manifests, deployErr)
+}
+
+// desired - returns the desired configs with the interfaces of the manifests replaced by cfgs, the interfaces
+// configured by other sources, the REST API or remote config, are kept
+func (w *Watcher) desired(cfgs []models.L3afBPFPrograms) []models.L3afBPFPrograms {
+	ifaces := make(map[string]bool, len(cfgs))
+	for _, cfg := range cfgs {
+		ifaces[cfg.Iface] = true
+	}
+	desired := make([]models.L3afBPFPrograms, 0, len(cfgs))
+	for _, cfg := range w.deployer.DesiredPrograms() {
+		// interfaces of removed manifests are dropped
+		if !w.owned[cfg.Iface] && !ifaces[cfg.Iface] {
+			desired = append(desired, cfg)
+		}
+	}
+	desired = append(desired, cfgs...)
+	sort.Slice(desired, func(i, j int) bool { return desired[i].Iface < desired[j].Iface })
+	return desired
+}
+
+// commit - records the deployed manifests, their configs are the last good ones and their interfaces are owned
+func (w *Watcher) commit(manifests []*manifest, cfgs []models.L3afBPFPrograms) {
+	lastGood := make(map[string][]models.L3afBPFPrograms, len(manifests))
+	for _, m := range manifests {
+		if m.err == nil || m.stale {
+			lastGood[m.name] = m.cfgs
+		}
+	}
+	w.lastGood = lastGood
+	w.deployed = true
+	w.owned = make(map[string]bool, len(cfgs))
+	for _, cfg := range cfgs {
+		w.owned[cfg.Iface] = true
+	}
+	if err := w.saveState(); err != nil {
+		log.Error().Err(err).Msg("failed to write manifests state")
+	}
+}
+
+// read - returns the manifests of the directory in name order
+func (w *Watcher) read() ([]*manifest, error) {
+	entries, err := os.ReadDir(w.conf.Dir)
+	if err != nil {
+		return nil, err
+	}
+	manifests := make([]*manifest, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !isManifest(entry.Name()) {
+			continue
+		}
+		buf, err := os.ReadFile(filepath.Join(w.conf.Dir, entry.Name()))
+		if err != nil {
+			// removed since the directory was read
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		sum := sha256.Sum256(buf)
+		m := &manifest{name: entry.Name(), digest: hex.EncodeToString(sum[:])}
+		if m.cfgs, m.err = decode(entry.Name(), buf); m.err == nil {
+			m.err = validate(m.cfgs, w.conf.HostName)
+		}
+		if m.err == nil {
+			m.err = w.deployer.ValidatePrograms(m.cfgs)
+		}
+		if m.err != nil {
+			m.cfgs = nil
+			if cfgs, ok := w.lastGood[m.name]; ok {
+				m.cfgs, m.stale = cfgs, true
+			}
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+// decode - returns the configs of a JSON or YAML manifest, holding a config or a list of them.
+// Manifests are decoded strictly against the schema of the configs like the payloads of the REST API.
+func decode(name string, buf []byte) ([]models.L3afBPFPrograms, error) {
+	format := schema.JSON
+	if ext := filepath.Ext(name); ext == ".yaml" || ext == ".yml" {
+		format = schema.YAML
+	}
+	buf, err := schema.ToJSON(buf, format)
+	if err != nil {
+		return nil, err
+	}
+	buf = bytes.TrimSpace(buf)
+	if len(buf) == 0 || bytes.Equal(buf, []byte("null")) {
+		return nil, fmt.Errorf("manifest is empty")
+	}
+	if buf[0] == '[' {
+		var cfgs []models.L3afBPFPrograms
+		if err := schema.Decode(buf, schema.JSON, &cfgs); err != nil {
+			return nil, err
+		}
+		return cfgs, nil
+	}
+	var cfg models.L3afBPFPrograms
+	if err := schema.Decode(buf, schema.JSON, &cfg); err != nil {
+		return nil, err
+	}
+	return []models.L3afBPFPrograms{cfg}, nil
+}
+
+// directions - returns the programs of the config by direction
+func directions(progs *models.BPFPrograms) map[string][]*models.BPFProgram {
+	return map[string][]*models.BPFProgram{
+		models.XDPIngressType: progs.XDPIngress,
+		models.IngressType:    progs.TCIngress,
+		models.EgressType:     progs.TCEgress,
+	}
+}
+
+// validate - checks that the configs belong to this host and their programs are named and versioned,
+// a missing host name defaults to this host
+func validate(cfgs []models.L3afBPFPrograms, hostName string) error {
+	seen := make(map[string]bool)
+	for i := range cfgs {
+		cfg := &cfgs[i]
+		if len(cfg.HostName) == 0 {
+			cfg.HostName = hostName
+		} else if cfg.HostName != hostName {
+			return fmt.Errorf("config of iface %s belongs to host %s", cfg.Iface, cfg.HostName)
+		}
+		if len(cfg.Iface) == 0 {
+			return fmt.Errorf("iface is missing")
+		}
+		if cfg.BpfPrograms == nil {
+			return fmt.Errorf("config of iface %s has no bpf_programs", cfg.Iface)
+		}
+		for direction, progs := range directions(cfg.BpfPrograms) {
+			for _, prog := range progs {
+				if prog == nil || len(prog.Name) == 0 {
+					return fmt.Errorf("program without name on iface %s %s", cfg.Iface, direction)
+				}
+				if len(prog.Version) == 0 {
+					return fmt.Errorf("program %s on iface %s %s has no version", prog.Name, cfg.Iface, direction)
+				}
+				key := cfg.Iface + "/" + direction + "/" + prog.Name
+				if seen[key] {
+					return fmt.Errorf("program %s is defined twice on iface %s %s", prog.Name, cfg.Iface, direction)
+				}
+				seen[key] = true
+			}
+		}
+	}
+	return nil
+}
+
+// merge - returns the configs of the valid manifests, and the last good configs of the invalid ones, by interface.
+// A manifest defining a program of an earlier manifest again is rejected as a whole.
+func merge(manifests []*manifest, hostName string) []models.L3afBPFPrograms {
+	merged := make(map[string]*models.L3afBPFPrograms)
+	owners := make(map[string]string)
+	for _, m := range manifests {
+		if m.err != nil && !m.stale {
+			continue
+		}
+		conflict := false
+		for _, cfg := range m.cfgs {
+			for direction, progs := range directions(cfg.BpfPrograms) {
+				for _, prog := range progs {
+					if owner, ok := owners[cfg.Iface+"/"+direction+"/"+prog.Name]; ok {
+						m.err = fmt.Errorf("program %s on iface %s %s is defined by %s already", prog.Name, cfg.Iface, direction, owner)
+						conflict = true
+					}
+				}
+			}
+		}
+		if conflict {
+			m.cfgs, m.stale = nil, false
+			continue
+		}
+		for _, cfg := range m.cfgs {
+			target, ok := merged[cfg.Iface]
+			if !ok {
+				target = &models.L3afBPFPrograms{HostName: hostName, Iface: cfg.Iface, BpfPrograms: &models.BPFPrograms{}}
+				merged[cfg.Iface] = target
+			}
+			target.BpfPrograms.XDPIngress = append(target.BpfPrograms.XDPIngress, cfg.BpfPrograms.XDPIngress...)
+			target.BpfPrograms.TCIngress = append(target.BpfPrograms.TCIngress, cfg.BpfPrograms.TCIngress...)
+			target.BpfPrograms.TCEgress = append(target.BpfPrograms.TCEgress, cfg.BpfPrograms.TCEgress...)
+			for direction, progs := range directions(cfg.BpfPrograms) {
+				for _, prog := range progs {
+					owners[cfg.Iface+"/"+direction+"/"+prog.Name] = m.name
+				}
+			}
+		}
+	}
+
+	cfgs := make([]models.L3afBPFPrograms, 0, len(merged))
+	for _, cfg := range merged {
+		cfgs = append(cfgs, *cfg)
+	}
+	sort.Slice(cfgs, func(i, j int) bool { return cfgs[i].Iface < cfgs[j].Iface })
+	return cfgs
+}
+
+// status - returns the status of the manifest from the observed status of its programs
+func (w *Watcher) status(m *manifest, deployErr error) Status {
+	s := Status{Manifest: m.name, Digest: m.digest, State: StateApplied}
+	if m.err != nil {
+		s.State, s.Reason = StateFailed, m.err.Error()
+		return s
+	}
+	reasons := make([]string, 0)
+	for _, cfg := range m.cfgs {
+		observed := w.deployer.ProgramStatus(cfg.Iface)
+		for direction, progs := range directions(cfg.BpfPrograms) {
+			for _, prog := range progs {
+				found := false
+				for _, p := range observed.Programs {
+					if p.Name != prog.Name || p.Direction != direction {
+						continue
+					}
+					found = true
+					switch {
+					case len(p.Reason) > 0:
+						reasons = append(reasons, fmt.Sprintf("%s on iface %s %s: %s", p.Name, cfg.Iface, direction, p.Reason))
+					case p.State == models.ProgramPending && deployErr != nil:
+						reasons = append(reasons, fmt.Sprintf("%s on iface %s %s: %v", p.Name, cfg.Iface, direction, deployErr))
+					}
+				}
+				// the deploy was rejected before the program was accepted
+				if !found && deployErr != nil {
+					reasons = append(reasons, fmt.Sprintf("%s on iface %s %s: %v", prog.Name, cfg.Iface, direction, deployErr))
+				}
+			}
+		}
+	}
+	if len(reasons) > 0 {
+		sort.Strings(reasons)
+		s.State, s.Reason = StateFailed, strings.Join(reasons, "; ")
+	}
+	return s
+}
+
+// writeStatuses - writes the status file of every manifest whose status changed and removes the ones of removed manifests
+func (w *Watcher) writeStatuses(manifests []*manifest, deployErr error) {
+	current := make(map[string]bool, len(manifests))
+	for _, m := range manifests {
+		current[m.name] = true
+		s := w.status(m, deployErr)
+		if prev, ok := w.statuses[m.name]; ok && prev.Digest == s.Digest && prev.State == s.State && prev.Reason == s.Reason {
+			continue
+		}
+		s.UpdatedAt = time.Now()
+		if err := w.writeStatus(s); err != nil {
+			log.Error().Err(err).Str("manifest", m.name).Msg("failed to write manifest status")
+			continue
+		}
+		w.statuses[m.name] = s
+		if s.State == StateFailed {
+			log.Warn().Str("manifest", m.name).Str("reason", s.Reason).Msg("manifest failed")
+		}
+	}
+	for name := range w.statuses {
+		if current[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(w.conf.Dir, name+statusSuffix)); err != nil && !os.IsNotExist(err) {
+			log.Error().Err(err).Str("manifest", name).Msg("failed to remove manifest status")
+			continue
+		}
+		delete(w.statuses, name)
+	}
+}
+
+// writeStatus - replaces the status file of the manifest, it is written to a hidden file first and synced
+func (w *Watcher) writeStatus(s Status) error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %v", err)
+	}
+	file := filepath.Join(w.conf.Dir, s.Manifest+statusSuffix)
+	return configstore.WriteFileAtomic(file, append(buf, '\n'), 0644)
+}
+
+func equal(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,295 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/l3af-project/l3afd/configstore"
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/schema"
+)
+
+const testHost = "l3af-local-test"
+
+// fakeDeployer records the deployed configs, programs named broken fail to start
+type fakeDeployer struct {
+	deployed [][]models.L3afBPFPrograms
+	desired  map[string]models.L3afBPFPrograms
+	author   string
+	// rejects the deploy like a failed validation of the merged configs
+	reject bool
+}
+
+func (d *fakeDeployer) DeployeBPFPrograms(ctx context.Context, cfgs []models.L3afBPFPrograms) error {
+	d.deployed = append(d.deployed, cfgs)
+	if d.reject {
+		return schema.Errors{{Path: "[0].iface", Message: "rejected"}}
+	}
+	d.author = configstore.Author(ctx)
+	d.desired = make(map[string]models.L3afBPFPrograms)
+	for _, cfg := range cfgs {
+		d.desired[cfg.Iface] = cfg
+	}
+	return nil
+}
+
+func (d *fakeDeployer) ValidatePrograms(cfgs []models.L3afBPFPrograms) error {
+	for _, cfg := range cfgs {
+		for _, prog := range cfg.BpfPrograms.XDPIngress {
+			if len(prog.ProgType) > 0 && prog.ProgType != models.XDPType {
+				return fmt.Errorf("prog_type %s of %s does not match the chain", prog.ProgType, prog.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *fakeDeployer) DesiredPrograms() []models.L3afBPFPrograms {
+	cfgs := make([]models.L3afBPFPrograms, 0, len(d.desired))
+	for _, cfg := range d.desired {
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs
+}
+
+func (d *fakeDeployer) ProgramStatus(iface string) models.L3afBPFProgramsStatus {
+	status := models.L3afBPFProgramsStatus{Iface: iface}
+	if cfg, ok := d.desired[iface]; ok {
+		for _, prog := range cfg.BpfPrograms.XDPIngress {
+			s := models.BPFProgramStatus{Name: prog.Name, Direction: models.XDPIngressType, State: models.ProgramRunning}
+			if prog.Name == "broken" {
+				s.State, s.Reason = models.ProgramFailed, "artifact not found"
+			}
+			status.Programs = append(status.Programs, s)
+		}
+	}
+	return status
+}
+
+func writeManifest(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write manifest %s: %v", name, err)
+	}
+}
+
+func readStatus(t *testing.T, dir, name string) Status {
+	t.Helper()
+	buf, err := os.ReadFile(filepath.Join(dir, name+statusSuffix))
+	if err != nil {
+		t.Fatalf("status of %s not written: %v", name, err)
+	}
+	var s Status
+	if err := json.Unmarshal(buf, &s); err != nil {
+		t.Fatalf("invalid status of %s: %v", name, err)
+	}
+	return s
+}
+
+func names(cfgs []models.L3afBPFPrograms) []string {
+	got := make([]string, 0)
+	for _, cfg := range cfgs {
+		for _, prog := range cfg.BpfPrograms.XDPIngress {
+			got = append(got, cfg.Iface+"/"+prog.Name)
+		}
+	}
+	return got
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "JSON",
+			file:    "eth0.json",
+			content: `{"iface": "eth0", "bpf_programs": {"xdp_ingress": [{"name": "ratelimiting", "version": "1.0"}]}}`,
+			want:    []string{"eth0/ratelimiting"},
+		},
+		{
+			name:    "JSONList",
+			file:    "all.json",
+			content: `[{"iface": "eth0", "bpf_programs": {"xdp_ingress": [{"name": "a", "version": "1.0"}]}}, {"iface": "eth1", "bpf_programs": {"xdp_ingress": [{"name": "b", "version": "1.0"}]}}]`,
+			want:    []string{"eth0/a", "eth1/b"},
+		},
+		{
+			name: "YAML",
+			file: "ratelimiting.yaml",
+			content: `iface: eth0
+bpf_programs:
+  xdp_ingress:
+    - name: ratelimiting
+      version: "1.0"
+      seq_id: 1
+      map_args:
+        rl_ports_map: "80,443"
+`,
+			want: []string{"eth0/ratelimiting"},
+		},
+		{name: "Empty", file: "empty.yml", content: "\n", wantErr: true},
+		{name: "InvalidYAML", file: "invalid.yaml", content: "iface: [eth0", wantErr: true},
+		{name: "InvalidJSON", file: "invalid.json", content: `{"iface": 1}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgs, err := decode(tt.file, []byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(names(cfgs), tt.want) {
+				t.Errorf("decode() = %v, want %v", names(cfgs), tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	prog := func(name, version string) *models.BPFProgram { return &models.BPFProgram{Name: name, Version: version} }
+	tests := []struct {
+		name    string
+		cfg     models.L3afBPFPrograms
+		wantErr string
+	}{
+		{name: "Valid", cfg: models.L3afBPFPrograms{Iface: "eth0", BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{prog("a", "1.0")}}}},
+		{name: "OtherHost", cfg: models.L3afBPFPrograms{HostName: "other", Iface: "eth0", BpfPrograms: &models.BPFPrograms{}}, wantErr: "belongs to host other"},
+		{name: "NoIface", cfg: models.L3afBPFPrograms{BpfPrograms: &models.BPFPrograms{}}, wantErr: "iface is missing"},
+		{name: "NoPrograms", cfg: models.L3afBPFPrograms{Iface: "eth0"}, wantErr: "has no bpf_programs"},
+		{name: "NoVersion", cfg: models.L3afBPFPrograms{Iface: "eth0", BpfPrograms: &models.BPFPrograms{TCEgress: []*models.BPFProgram{prog("a", "")}}}, wantErr: "has no version"},
+		{name: "Duplicate", cfg: models.L3afBPFPrograms{Iface: "eth0", BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{prog("a", "1.0"), prog("a", "2.0")}}}, wantErr: "defined twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgs := []models.L3afBPFPrograms{tt.cfg}
+			err := validate(cfgs, testHost)
+			if len(tt.wantErr) == 0 {
+				if err != nil || cfgs[0].HostName != testHost {
+					t.Errorf("validate() error = %v, host %s, want host %s", err, cfgs[0].HostName, testHost)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	// eth9 is configured through the REST API, the manifests do not replace it
+	rest := models.L3afBPFPrograms{Iface: "eth9", BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{{Name: "rest", Version: "1.0"}}}}
+	d := &fakeDeployer{desired: map[string]models.L3afBPFPrograms{"eth9": rest}}
+	w, err := New(Config{Dir: dir, HostName: testHost}, d)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// an empty directory does not remove the configs deployed from the store
+	w.scan(context.Background())
+	if len(d.deployed) != 0 {
+		t.Fatalf("scan() of an empty directory deployed %v", d.deployed)
+	}
+
+	writeManifest(t, dir, "a.json", `{"iface": "eth0", "bpf_programs": {"xdp_ingress": [{"name": "a", "version": "1.0"}]}}`)
+	writeManifest(t, dir, "b.yaml", "iface: eth0\nbpf_programs:\n  xdp_ingress:\n    - name: b\n      version: \"1.0\"\n")
+	writeManifest(t, dir, "broken.yaml", "iface: eth1\nbpf_programs:\n  xdp_ingress:\n    - name: broken\n      version: \"1.0\"\n")
+	writeManifest(t, dir, "conflict.json", `{"iface": "eth0", "bpf_programs": {"xdp_ingress": [{"name": "a", "version": "2.0"}]}}`)
+	writeManifest(t, dir, "invalid.yml", "iface: eth2\n")
+	writeManifest(t, dir, "mismatch.json", `{"iface": "eth3", "bpf_programs": {"xdp_ingress": [{"name": "c", "version": "1.0", "prog_type": "tc"}]}}`)
+	writeManifest(t, dir, "README.md", "not a manifest")
+	w.scan(context.Background())
+
+	if len(d.deployed) != 1 || d.author != Author {
+		t.Fatalf("deployed %d times by %s, want once by %s", len(d.deployed), d.author, Author)
+	}
+	if got, want := names(d.deployed[0]), []string{"eth0/a", "eth0/b", "eth1/broken", "eth9/rest"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deployed %v, want %v", got, want)
+	}
+	for name, want := range map[string]string{"a.json": StateApplied, "b.yaml": StateApplied, "broken.yaml": StateFailed, "conflict.json": StateFailed, "invalid.yml": StateFailed, "mismatch.json": StateFailed} {
+		if s := readStatus(t, dir, name); s.State != want || (want == StateFailed) != (len(s.Reason) > 0) {
+			t.Errorf("status of %s = %+v, want %s", name, s, want)
+		}
+	}
+	if s := readStatus(t, dir, "conflict.json"); !strings.Contains(s.Reason, "defined by a.json") {
+		t.Errorf("status of conflict.json = %+v, want the conflict with a.json", s)
+	}
+
+	// unchanged manifests are not deployed again and keep their status
+	w.scan(context.Background())
+	if len(d.deployed) != 1 {
+		t.Errorf("unchanged manifests deployed again")
+	}
+	if s := readStatus(t, dir, "conflict.json"); s.State != StateFailed {
+		t.Errorf("status of conflict.json after a rescan = %+v, want %s", s, StateFailed)
+	}
+
+	// a removed manifest removes its programs and its status file
+	if err := os.Remove(filepath.Join(dir, "broken.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	w.scan(context.Background())
+	if len(d.deployed) != 2 || !reflect.DeepEqual(names(d.deployed[1]), []string{"eth0/a", "eth0/b", "eth9/rest"}) {
+		t.Errorf("deployed %v after the removal, want eth0/a, eth0/b and eth9/rest", d.deployed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "broken.yaml"+statusSuffix)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("status of the removed manifest exists: %v", err)
+	}
+
+	// a typo keeps the last good configs of the manifest deployed
+	writeManifest(t, dir, "a.json", `{"iface": "eth0", "bpf_programs": {"xdp_ingress": [{"name": "a", "verison": "1.1"}]}}`)
+	w.scan(context.Background())
+	if len(d.deployed) != 3 || !reflect.DeepEqual(names(d.deployed[2]), []string{"eth0/a", "eth0/b", "eth9/rest"}) {
+		t.Errorf("deployed %v after a typo, want eth0/a kept", d.deployed)
+	}
+	if s := readStatus(t, dir, "a.json"); s.State != StateFailed || !strings.Contains(s.Reason, "verison") {
+		t.Errorf("status of a.json with a typo = %+v, want %s", s, StateFailed)
+	}
+
+	// the last good configs are kept across restarts
+	d.deployed = nil
+	w, err = New(Config{Dir: dir, HostName: testHost}, d)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	w.scan(context.Background())
+	if len(d.deployed) != 1 || !reflect.DeepEqual(names(d.deployed[0]), []string{"eth0/a", "eth0/b", "eth9/rest"}) {
+		t.Errorf("deployed %v after a restart, want eth0/a kept", d.deployed)
+	}
+
+	// a rejected deploy is retried on the next scan, without a.json the program a of conflict.json is valid
+	d.reject = true
+	if err := os.Remove(filepath.Join(dir, "a.json")); err != nil {
+		t.Fatal(err)
+	}
+	w.scan(context.Background())
+	d.reject = false
+	w.scan(context.Background())
+	if len(d.deployed) != 3 || !reflect.DeepEqual(names(d.deployed[2]), []string{"eth0/b", "eth0/a", "eth9/rest"}) {
+		t.Errorf("deployed %v after a rejected deploy, want it retried", d.deployed)
+	}
+
+	// removing all the manifests removes their interfaces only
+	for _, name := range []string{"b.yaml", "conflict.json", "invalid.yml", "mismatch.json"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.scan(context.Background())
+	if len(d.deployed) != 4 || !reflect.DeepEqual(names(d.deployed[3]), []string{"eth9/rest"}) {
+		t.Errorf("deployed %v after removing the manifests, want eth9/rest", d.deployed)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package manifest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := notify(ctx, dir)
+	if err != nil {
+		t.Skipf("inotify is not available: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		changed bool
+	}{
+		{name: "StatusFile", file: "eth0.yaml" + statusSuffix, changed: false},
+		{name: "HiddenFile", file: ".eth0.yaml.swp", changed: false},
+		{name: "OtherFile", file: "README.md", changed: false},
+		{name: "Manifest", file: "eth0.yaml", changed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(dir, tt.file), []byte("iface: eth0\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-changes:
+				if !tt.changed {
+					t.Errorf("writing %s reported a change", tt.file)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tt.changed {
+					t.Errorf("writing %s reported no change", tt.file)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build WINDOWS
+// +build WINDOWS
+
+package manifest
+
+import (
+	"context"
+)
+
+// notify - changes are not watched on windows, the directory is rescanned every resync interval
+func notify(ctx context.Context, dir string) (<-chan struct{}, error) {
+	return nil, nil
+}
@@ -3,6 +3,8 @@
 
 package models
 
+import "time"
+
 // l3afd constants
 const (
 	Enabled  = "enabled"
@@ -19,43 +21,73 @@ const (
 	EgressType     = "egress"
 	XDPIngressType = "xdpingress"
 	TCMapPinPath   = "tc/globals"
+
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+	HealthUnknown   = "unknown"
 )
 
 type L3afDNFArgs map[string]interface{}
 
 // BPFProgram defines BPF Program for specific host
 type BPFProgram struct {
-	ID                int                 `json:"id"`                    // Program id
-	Name              string              `json:"name"`                  // Name of the BPF program package
-	SeqID             int                 `json:"seq_id"`                // Sequence position in the chain
-	Artifact          string              `json:"artifact"`              // Artifact file name
-	MapName           string              `json:"map_name"`              // BPF map to store next program fd
-	CmdStart          string              `json:"cmd_start"`             // Program start command
-	CmdStop           string              `json:"cmd_stop"`              // Program stop command
-	CmdStatus         string              `json:"cmd_status"`            // Program status command
-	CmdConfig         string              `json:"cmd_config"`            // Program config providing command
-	CmdUpdate         string              `json:"cmd_update"`            // Program update config command
-	Version           string              `json:"version"`               // Program version
-	UserProgramDaemon bool                `json:"user_program_daemon"`   // User program daemon or not
-	IsPlugin          bool                `json:"is_plugin"`             // User program is plugin or not
-	CPU               int                 `json:"cpu"`                   // User program cpu limits
-	Memory            int                 `json:"memory"`                // User program memory limits
-	AdminStatus       string              `json:"admin_status"`          // Program admin status enabled or disabled
-	ProgType          string              `json:"prog_type"`             // Program type XDP or TC
-	RulesFile         string              `json:"rules_file"`            // Config rules file name
-	Rules             string              `json:"rules"`                 // Config rules
-	ConfigFilePath    string              `json:"config_file_path"`      // Config file location
-	CfgVersion        int                 `json:"cfg_version"`           // Config version
-	StartArgs         L3afDNFArgs         `json:"start_args"`            // Map of arguments to start command
-	StopArgs          L3afDNFArgs         `json:"stop_args"`             // Map of arguments to stop command
-	StatusArgs        L3afDNFArgs         `json:"status_args"`           // Map of arguments to status command
-	UpdateArgs        L3afDNFArgs         `json:"update_args"`           // Map of arguments to update command
-	MapArgs           L3afDNFArgs         `json:"map_args"`              // Config BPF Map of arguments
-	ConfigArgs        L3afDNFArgs         `json:"config_args"`           // Map of arguments to config command
-	MonitorMaps       []L3afDNFMetricsMap `json:"monitor_maps"`          // Metrics BPF maps
-	EPRURL            string              `json:"ebpf_package_repo_url"` // Download url for Program
-	ObjectFile        string              `json:"object_file"`           // Object file contains kernel code
-	EntryFunctionName string              `json:"entry_function_name"`   // BPF entry function name to load
+	ID                int                 `json:"id"`                       // Program id
+	Name              string              `json:"name"`                     // Name of the BPF program package
+	SeqID             int                 `json:"seq_id"`                   // Sequence position in the chain
+	Artifact          string              `json:"artifact"`                 // Artifact file name
+	MapName           string              `json:"map_name"`                 // BPF map to store next program fd
+	CmdStart          string              `json:"cmd_start"`                // Program start command
+	CmdStop           string              `json:"cmd_stop"`                 // Program stop command
+	CmdStatus         string              `json:"cmd_status"`               // Program status command
+	CmdConfig         string              `json:"cmd_config"`               // Program config providing command
+	CmdUpdate         string              `json:"cmd_update"`               // Program update config command
+	Version           string              `json:"version"`                  // Program version
+	UserProgramDaemon bool                `json:"user_program_daemon"`      // User program daemon or not
+	IsPlugin          bool                `json:"is_plugin"`                // User program is plugin or not
+	CPU               int                 `json:"cpu"`                      // User program cpu limit in percent of a cpu, applied with cgroup v2, in seconds with prlimit when CPUSeconds is unset
+	CPUSeconds        int                 `json:"cpu_seconds"`              // User program cpu time limit in seconds, applied with prlimit where cgroup v2 is unavailable
+	Memory            int                 `json:"memory"`                   // User program memory limit in bytes
+	AdminStatus       string              `json:"admin_status"`             // Program admin status enabled or disabled
+	ProgType          string              `json:"prog_type"`                // Program type XDP or TC
+	RulesFile         string              `json:"rules_file"`               // Config rules file name
+	Rules             string              `json:"rules"`                    // Config rules
+	ConfigFilePath    string              `json:"config_file_path"`         // Config file location
+	CfgVersion        int                 `json:"cfg_version"`              // Config version
+	StartArgs         L3afDNFArgs         `json:"start_args"`               // Map of arguments to start command
+	StopArgs          L3afDNFArgs         `json:"stop_args"`                // Map of arguments to stop command
+	StatusArgs        L3afDNFArgs         `json:"status_args"`              // Map of arguments to status command
+	UpdateArgs        L3afDNFArgs         `json:"update_args"`              // Map of arguments to update command
+	MapArgs           L3afDNFArgs         `json:"map_args"`                 // Config BPF Map of arguments
+	ConfigArgs        L3afDNFArgs         `json:"config_args"`              // Map of arguments to config command
+	MonitorMaps       []L3afDNFMetricsMap `json:"monitor_maps"`             // Metrics BPF maps
+	EPRURL            string              `json:"ebpf_package_repo_url"`    // Download url for Program
+	ObjectFile        string              `json:"object_file"`              // Object file contains kernel code
+	BTFFile           string              `json:"btf_file,omitempty"`       // Optional BTF of the kernel types the CO-RE relocations of the object file are resolved against
+	EntryFunctionName string              `json:"entry_function_name"`      // BPF entry function name to load
+	LivenessProbe     *L3afDNFProbe       `json:"liveness_probe,omitempty"` // Optional liveness probe of the user program
+	Security          *L3afDNFSecurity    `json:"security,omitempty"`       // Optional privilege restrictions of the user program
+}
+
+// L3afDNFProbe defines liveness probe of a BPF program, either HTTPGet or Exec is set
+type L3afDNFProbe struct {
+	HTTPGet        string      `json:"http_get"`        // URL expected to respond with 2xx or 3xx status code
+	Exec           string      `json:"exec"`            // Command in the package expected to exit with status 0
+	ExecArgs       L3afDNFArgs `json:"exec_args"`       // Map of arguments to exec command
+	TimeoutSeconds int         `json:"timeout_seconds"` // Probe timeout, defaults to 5 seconds
+}
+
+// L3afDNFSecurity defines privilege restrictions of a user program, unset fields keep the privileges of l3afd
+type L3afDNFSecurity struct {
+	RunAsUser           *uint32           `json:"run_as_user,omitempty"`          // User id the program runs as
+	RunAsGroup          *uint32           `json:"run_as_group,omitempty"`         // Group id the program runs as
+	SupplementaryGroups []uint32          `json:"supplementary_groups,omitempty"` // Supplementary group ids, set with run_as_group
+	Capabilities        []string          `json:"capabilities"`                   // Capability set e.g. CAP_BPF, null keeps all, empty drops all
+	NoNewPrivs          bool              `json:"no_new_privs,omitempty"`         // Set no_new_privs, implied by seccomp_profile
+	SeccompProfile      string            `json:"seccomp_profile,omitempty"`      // Seccomp filter in binary BPF format in the package
+	ReadOnlyRootFS      bool              `json:"read_only_root_fs,omitempty"`    // Mount filesystems read-only except the writable paths
+	WritablePaths       []string          `json:"writable_paths,omitempty"`       // Writable paths in addition to log dir and bpf map path
+	ScrubEnv            bool              `json:"scrub_env,omitempty"`            // Start the program with an environment containing only PATH and env
+	Env                 map[string]string `json:"env,omitempty"`                  // Environment variables of the program
 }
 
 // L3afDNFMetricsMap defines BPF map
@@ -92,3 +124,205 @@ type BPFProgramNames struct {
 	TCIngress  []string `json:"tc_ingress"`  // names of the TC ingress eBPF programs
 	TCEgress   []string `json:"tc_egress"`   // names of the TC egress eBPF programs
 }
+
+// L3afHealthCheck defines the result of a single health check of a BPF program
+type L3afHealthCheck struct {
+	Name    string `json:"name"`              // Check name - running, linkage, attach or liveness
+	Healthy bool   `json:"healthy"`           // Check passed or not
+	Message string `json:"message,omitempty"` // Reason of the failure
+}
+
+// L3afBPFProgramHealth defines health of a BPF program
+type L3afBPFProgramHealth struct {
+	Iface        string            `json:"iface"`         // Interface name
+	Direction    string            `json:"direction"`     // xdpingress, ingress or egress
+	Name         string            `json:"name"`          // Name of the BPF program package
+	Version      string            `json:"version"`       // Program version
+	SeqID        int               `json:"seq_id"`        // Sequence position in the chain
+	Status       string            `json:"status"`        // healthy, unhealthy or unknown
+	CrashLooping bool              `json:"crash_looping"` // Restart attempts are exhausted
+	CheckedAt    time.Time         `json:"checked_at"`    // Time of the last health evaluation
+	Checks       []L3afHealthCheck `json:"checks"`        // Individual check results
+}
+
+// L3afHealth defines aggregated health of the BPF programs on a node
+type L3afHealth struct {
+	HostName string                 `json:"host_name"` // Host name or pod name
+	Status   string                 `json:"status"`    // healthy, unhealthy or unknown
+	Programs []L3afBPFProgramHealth `json:"programs"`  // Health of the BPF programs
+}
+
+// L3afLogLevels defines the log levels of l3afd
+type L3afLogLevels struct {
+	Level      string            `json:"level,omitempty"`       // Root log level, followed by components without their own level
+	Components map[string]string `json:"components,omitempty"`  // Log level per component, an empty level follows the root level
+	DebugUntil *time.Time        `json:"debug_until,omitempty"` // Debug is temporarily enabled until this time
+}
+
+// Event types
+const (
+	EventNormal  = "Normal"
+	EventWarning = "Warning"
+)
+
+// Event reasons of the lifecycle transitions of BPF programs
+const (
+	EventProgramStarted         = "ProgramStarted"
+	EventProgramStopped         = "ProgramStopped"
+	EventProgramRestarted       = "ProgramRestarted"
+	EventProgramRestartFailed   = "ProgramRestartFailed"
+	EventProgramUpgraded        = "ProgramUpgraded"
+	EventProgramMoved           = "ProgramMoved"
+	EventMapArgsUpdated         = "MapArgsUpdated"
+	EventRootProgramAttached    = "RootProgramAttached"
+	EventRootProgramDetached    = "RootProgramDetached"
+	EventRestartBudgetExhausted = "RestartBudgetExhausted"
+	EventArtifactDownloaded     = "ArtifactDownloaded"
+	EventArtifactVerified       = "ArtifactVerified"
+	EventDriftDetected          = "DriftDetected"
+	EventDriftCorrected         = "DriftCorrected"
+	EventDriftCorrectionFailed  = "DriftCorrectionFailed"
+)
+
+// L3afEvent defines a lifecycle transition of a BPF program
+type L3afEvent struct {
+	Seq       uint64    `json:"seq"`                 // Sequence number, increases with every event
+	Time      time.Time `json:"time"`                // Time of the transition
+	Type      string    `json:"type"`                // Normal or Warning
+	Reason    string    `json:"reason"`              // Kind of the transition, e.g. ProgramStarted
+	Program   string    `json:"program,omitempty"`   // Name of the BPF program
+	Version   string    `json:"version,omitempty"`   // Program version
+	Iface     string    `json:"iface,omitempty"`     // Interface name
+	Direction string    `json:"direction,omitempty"` // xdpingress, ingress or egress
+	Message   string    `json:"message,omitempty"`   // Details of the transition
+}
+
+// Observed states of a BPF program
+const (
+	ProgramRunning      = "Running"      // Program is loaded and its user program is running
+	ProgramCrashLooping = "CrashLooping" // Restart attempts of the program are exhausted
+	ProgramFailed       = "Failed"       // Program failed to start, see the reason
+	ProgramPending      = "Pending"      // Program is not started yet
+	ProgramDisabled     = "Disabled"     // Admin status of the program is disabled
+)
+
+// Attach modes of a BPF program
+const (
+	AttachChained   = "chained"   // Tail called by the previous program of the chain
+	AttachUnlinked  = "unlinked"  // Removed from the chain while crash looping
+	AttachXDPLink   = "xdp-link"  // Attached directly to the interface with an xdp link
+	AttachTCFilter  = "tc-filter" // Attached directly to the interface with a tc filter
+	AttachUserSpace = "user"      // Loaded and attached by its user program
+)
+
+// BPFProgramStatus defines the observed status of a BPF program of the desired config
+type BPFProgramStatus struct {
+	Name       string `json:"name"`                  // Name of the BPF program package
+	Version    string `json:"version,omitempty"`     // Running version, empty when it is not running
+	Direction  string `json:"direction"`             // xdpingress, ingress or egress
+	State      string `json:"state"`                 // Running, CrashLooping, Failed, Pending or Disabled
+	Reason     string `json:"reason,omitempty"`      // Why the program is not running as desired
+	Restarts   int    `json:"restarts"`              // Restarts of the user program
+	ProgID     uint32 `json:"prog_id,omitempty"`     // eBPF program ID
+	AttachMode string `json:"attach_mode,omitempty"` // chained, unlinked, xdp-link, tc-filter or user
+}
+
+// L3afBPFProgramsStatus defines the observed status of the BPF programs of an interface
+type L3afBPFProgramsStatus struct {
+	Iface    string             `json:"iface"`    // Interface name
+	Programs []BPFProgramStatus `json:"programs"` // Status of the desired programs, in config order
+}
+
+// L3afBPFProgramsState defines the desired config of an interface as accepted by the API and its observed status
+type L3afBPFProgramsState struct {
+	Spec   L3afBPFPrograms       `json:"spec"`
+	Status L3afBPFProgramsStatus `json:"status"`
+}
+
+// L3afPackage defines an eBPF package to inspect, the artifact is downloaded like the one of a BPFProgram
+type L3afPackage struct {
+	Name       string `json:"name"`                  // Name of the BPF program package
+	Version    string `json:"version"`               // Package version
+	Artifact   string `json:"artifact"`              // Artifact file name
+	EPRURL     string `json:"ebpf_package_repo_url"` // Download url, the default repo when it is empty
+	ObjectFile string `json:"object_file"`           // Object file to inspect, all of the package when it is empty
+	MapName    string `json:"map_name"`              // BPF map expected to store the next program fd
+}
+
+// L3afPackageInfo defines the content of an eBPF package
+type L3afPackageInfo struct {
+	Name     string           `json:"name"`
+	Version  string           `json:"version"`
+	Artifact string           `json:"artifact"`
+	Objects  []L3afObjectInfo `json:"objects"` // Object files of the package, sorted by file
+}
+
+// L3afObjectInfo defines the programs and maps of an object file
+type L3afObjectInfo struct {
+	File             string              `json:"file"`               // Path in the package
+	Error            string              `json:"error,omitempty"`    // Why the object file could not be parsed
+	BTF              bool                `json:"btf"`                // Object file carries BTF type information
+	License          string              `json:"license,omitempty"`  // License of the programs
+	Programs         []L3afObjectProgram `json:"programs"`           // Sorted by name
+	Maps             []L3afObjectMap     `json:"maps"`               // Sorted by name
+	RequiredFeatures L3afKernelFeatures  `json:"required_features"`  // Kernel features used by the programs and maps
+	MapName          *L3afObjectMapName  `json:"map_name,omitempty"` // Check of the map_name of the request
+}
+
+// L3afObjectProgram defines a program of an object file
+type L3afObjectProgram struct {
+	Name         string `json:"name"`                  // Function name, the entry_function_name of a BPFProgram
+	Section      string `json:"section"`               // ELF section, e.g. xdp or classifier
+	Type         string `json:"type"`                  // Program type, e.g. XDP or SchedCLS
+	AttachType   string `json:"attach_type,omitempty"` // Expected attach type
+	Instructions int    `json:"instructions"`          // Number of instructions
+}
+
+// L3afObjectMap defines a map of an object file
+type L3afObjectMap struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"` // Map type, e.g. Hash or ProgramArray
+	KeySize    uint32 `json:"key_size"`
+	ValueSize  uint32 `json:"value_size"`
+	MaxEntries uint32 `json:"max_entries"`
+	Flags      uint32 `json:"flags"`
+	Pinning    string `json:"pinning"` // PinNone or PinByName
+}
+
+// L3afKernelFeatures defines kernel features used by eBPF programs
+type L3afKernelFeatures struct {
+	ProgramTypes []string `json:"program_types"` // Sorted program types
+	MapTypes     []string `json:"map_types"`     // Sorted map types
+	Helpers      []string `json:"helpers"`       // Sorted helper functions called by the programs
+}
+
+// L3afObjectMapName defines whether the map_name of a BPFProgram is a prog array of the object file
+type L3afObjectMapName struct {
+	Name      string `json:"name"`
+	Exists    bool   `json:"exists"`
+	ProgArray bool   `json:"prog_array"`
+}
+
+// L3afCapability defines whether the kernel supports an eBPF feature
+type L3afCapability struct {
+	Name      string `json:"name"`
+	Supported bool   `json:"supported"`
+	Reason    string `json:"reason,omitempty"` // Why the feature is not supported or could not be probed
+}
+
+// L3afHelperSupport defines the helper functions the kernel supports for a program type
+type L3afHelperSupport struct {
+	ProgramType string   `json:"program_type"`
+	Helpers     []string `json:"helpers"`          // Sorted supported helper functions
+	Reason      string   `json:"reason,omitempty"` // Why the helpers could not be probed
+}
+
+// L3afHostCapabilities defines the eBPF features of the kernel probed by l3afd
+type L3afHostCapabilities struct {
+	KernelVersion string              `json:"kernel_version,omitempty"` // Version reported by the kernel, e.g. 5.15.0
+	BTF           L3afCapability      `json:"btf"`                      // Kernel BTF type information
+	Links         []L3afCapability    `json:"links"`                    // xdp and tcx bpf_link attachments
+	ProgramTypes  []L3afCapability    `json:"program_types"`
+	MapTypes      []L3afCapability    `json:"map_types"`
+	Helpers       []L3afHelperSupport `json:"helpers"` // Helpers of the program types attached by l3afd
+}
@@ -0,0 +1,223 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package probes provides liveness (/healthz) and readiness (/readyz) endpoints of l3afd.
+package probes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/l3af-project/l3afd/routes"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	statusOK     = "ok"
+	statusFailed = "failed"
+)
+
+// Check reports an error when the probed condition is not met
+type Check func() error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// CheckResult defines the result of a single check
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Result defines the response of a probe endpoint
+type Result struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Probes holds the liveness and readiness checks of l3afd
+type Probes struct {
+	mu        sync.RWMutex
+	liveness  []namedCheck
+	readiness []namedCheck
+}
+
+func NewProbes() *Probes {
+	return &Probes{}
+}
+
+// AddLivenessCheck - registers a check served by /healthz
+func (p *Probes) AddLivenessCheck(name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.liveness = append(p.liveness, namedCheck{name: name, check: check})
+}
+
+// AddReadinessCheck - registers a check served by /readyz
+func (p *Probes) AddReadinessCheck(name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readiness = append(p.readiness, namedCheck{name: name, check: check})
+}
+
+// Liveness - runs the liveness checks
+func (p *Probes) Liveness() Result {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return run(p.liveness)
+}
+
+// Readiness - runs the readiness checks
+func (p *Probes) Readiness() Result {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return run(p.readiness)
+}
+
+func run(checks []namedCheck) Result {
+	result := Result{Status: statusOK, Checks: make([]CheckResult, 0, len(checks))}
+	for _, c := range checks {
+		checkResult := CheckResult{Name: c.name, Status: statusOK}
+		if err := c.check(); err != nil {
+			checkResult.Status = statusFailed
+			checkResult.Message = err.Error()
+			result.Status = statusFailed
+		}
+		result.Checks = append(result.Checks, checkResult)
+	}
+	return result
+}
+
+func (p *Probes) routes() []routes.Route {
+	return []routes.Route{
+		{
+			Method:      "GET",
+			Path:        "/healthz",
+			HandlerFunc: probeHandler(p.Liveness),
+		},
+		{
+			Method:      "GET",
+			Path:        "/readyz",
+			HandlerFunc: probeHandler(p.Readiness),
+		},
+	}
+}
+
+func probeHandler(probe func() Result) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result := probe()
+		statusCode := http.StatusOK
+		if result.Status != statusOK {
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		resp, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			log.Error().Msgf("failed to marshal response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		if _, err := w.Write(resp); err != nil {
+			log.Warn().Msgf("Failed to write response bytes: %v", err)
+		}
+	}
+}
+
+// Start - serves /healthz and /readyz on addr without TLS so kubelet and other local agents can probe l3afd
+func (p *Probes) Start(addr string) {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: routes.NewRouter(p.routes()),
+	}
+	go func() {
+		log.Info().Msgf("l3afd probes server listening - %s ", addr)
+		if err := server.ListenAndServe(); err != nil {
+			log.Fatal().Err(err).Msgf("failed to start l3afd probes server")
+		}
+	}()
+}
+
+// Flag is a readiness condition which is met once the startup step it tracks completed
+type Flag struct {
+	mu   sync.Mutex
+	done bool
+	err  error
+}
+
+// Set - marks the step completed, a non nil err keeps the condition failing
+func (f *Flag) Set(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.done = true
+	f.err = err
+}
+
+// Check - reports an error until the step completed successfully
+func (f *Flag) Check() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.done {
+		return errors.New("not completed")
+	}
+	return f.err
+}
+
+// Heartbeat is a liveness condition which fails when Beat is not called within maxAge
+type Heartbeat struct {
+	last   atomic.Int64
+	maxAge time.Duration
+}
+
+func NewHeartbeat(maxAge time.Duration) *Heartbeat {
+	h := &Heartbeat{maxAge: maxAge}
+	h.Beat()
+	return h
+}
+
+// Beat - records the goroutine is responsive
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+// Check - reports an error if the last beat is older than maxAge
+func (h *Heartbeat) Check() error {
+	if age := time.Since(time.Unix(0, h.last.Load())); age > h.maxAge {
+		return fmt.Errorf("no heartbeat for %s", age.Round(time.Second))
+	}
+	return nil
+}
+
+// Watchdog - returns a heartbeat beaten every interval by its own goroutine,
+// it fails when the runtime is unable to schedule goroutines
+func Watchdog(interval time.Duration) *Heartbeat {
+	h := NewHeartbeat(interval * 5)
+	go func() {
+		for range time.NewTicker(interval).C {
+			h.Beat()
+		}
+	}()
+	return h
+}
+
+// TCPCheck - returns a check which verifies a server is accepting connections on addr
+func TCPCheck(addr string) Check {
+	return func() error {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package probes
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_probeHandler(t *testing.T) {
+	var pending, failed, done Flag
+	failed.Set(errors.New("failed to read"))
+	done.Set(nil)
+
+	tests := []struct {
+		name   string
+		checks map[string]Check
+		status int
+		failed []string
+	}{
+		{
+			name:   "NoChecks",
+			status: http.StatusOK,
+		},
+		{
+			name:   "AllPassed",
+			checks: map[string]Check{"done": done.Check},
+			status: http.StatusOK,
+		},
+		{
+			name:   "Pending",
+			checks: map[string]Check{"done": done.Check, "pending": pending.Check},
+			status: http.StatusServiceUnavailable,
+			failed: []string{"pending"},
+		},
+		{
+			name:   "Failed",
+			checks: map[string]Check{"failed": failed.Check},
+			status: http.StatusServiceUnavailable,
+			failed: []string{"failed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProbes()
+			for name, check := range tt.checks {
+				p.AddReadinessCheck(name, check)
+			}
+			req, _ := http.NewRequest("GET", "/readyz", nil)
+			rr := httptest.NewRecorder()
+			probeHandler(p.Readiness).ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("probeHandler() status = %d, want %d", rr.Code, tt.status)
+			}
+
+			var result Result
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if len(result.Checks) != len(tt.checks) {
+				t.Errorf("probeHandler() returned %d checks, want %d", len(result.Checks), len(tt.checks))
+			}
+			var failed []string
+			for _, c := range result.Checks {
+				if c.Status == statusFailed {
+					if c.Message == "" {
+						t.Errorf("failed check %s has no message", c.Name)
+					}
+					failed = append(failed, c.Name)
+				}
+			}
+			if len(failed) != len(tt.failed) || (len(failed) > 0 && failed[0] != tt.failed[0]) {
+				t.Errorf("probeHandler() failed checks = %v, want %v", failed, tt.failed)
+			}
+		})
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	h := NewHeartbeat(time.Minute)
+	if err := h.Check(); err != nil {
+		t.Errorf("Check() after beat error = %v", err)
+	}
+	h.last.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	if err := h.Check(); err == nil {
+		t.Errorf("Check() of stale heartbeat did not fail")
+	}
+	h.Beat()
+	if err := h.Check(); err != nil {
+		t.Errorf("Check() after beat error = %v", err)
+	}
+}
+
+func TestTCPCheck(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := l.Addr().String()
+	if err := TCPCheck(addr)(); err != nil {
+		t.Errorf("TCPCheck() error = %v", err)
+	}
+	l.Close()
+	if err := TCPCheck(addr)(); err == nil {
+		t.Errorf("TCPCheck() of closed listener did not fail")
+	}
+}
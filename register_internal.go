@@ -10,12 +10,36 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+
 	"github.com/l3af-project/l3afd/config"
+	"github.com/l3af-project/l3afd/remoteconfig"
 
 	"github.com/rs/zerolog/log"
 )
 
+// registerL3afD - registers this host with the config service when a register URL is configured
 func registerL3afD(conf *config.Config) error {
-	log.Warn().Msg("Implement custom registration with management server")
-	return nil
+	if len(conf.RemoteConfigRegisterURL) == 0 {
+		log.Warn().Msg("Implement custom registration with management server")
+		return nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get hostname: %v", err)
+	}
+	client, err := remoteconfig.New(remoteConfig(conf, hostname))
+	if err != nil {
+		return err
+	}
+	// the request is bounded by the timeout of the client
+	return client.Register(context.Background(), remoteconfig.Registration{
+		HostName:    hostname,
+		DataCenter:  conf.DataCenter,
+		Environment: conf.Environment,
+		Version:     Version,
+		APIAddr:     conf.L3afConfigsRestAPIAddr,
+	})
 }
@@ -0,0 +1,439 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package remoteconfig pulls the desired eBPF program configs of l3afd from a remote config service.
+package remoteconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/l3af-project/l3afd/configstore"
+	"github.com/l3af-project/l3afd/logging"
+	"github.com/l3af-project/l3afd/models"
+	"github.com/l3af-project/l3afd/schema"
+)
+
+// log - logger of the remoteconfig component
+var log = logging.Component("remoteconfig")
+
+// DefaultSignatureHeader - response header holding the base64 encoded signature of the revision and the configs
+const DefaultSignatureHeader = "X-L3af-Signature"
+
+// RevisionHeader - response header holding the revision of the configs, it increases with every change of them
+const RevisionHeader = "X-L3af-Config-Revision"
+
+// Author - author of the config revisions deployed from the config service
+const Author = "remote-config"
+
+// maxConfigSize - limit of the configs read from the config service
+const maxConfigSize = 16 * 1024 * 1024
+
+// Config defines the config service of this host
+type Config struct {
+	// URL of the configs, the host and datacenter query parameters select the configs of this host
+	URL string
+	// RegisterURL receives the Registration of this host, no registration is done when it is empty
+	RegisterURL string
+	HostName    string
+	DataCenter  string
+	Interval    time.Duration
+	Timeout     time.Duration
+	// PublicKeyFile holds the PEM encoded ed25519, ECDSA or RSA key verifying the signature of the configs
+	PublicKeyFile   string
+	SignatureHeader string
+	// AllowUnsigned accepts configs without a signature when no public key is set
+	AllowUnsigned bool
+	// StateFile keeps the revision and digest of the last accepted configs across restarts, they are only kept in
+	// memory when it is empty
+	StateFile string
+	// CA bundle of the config service and the client certificate of this host, system roots are used without a CA bundle
+	CACertFile     string
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// Registration defines the details of this host sent to the register URL
+type Registration struct {
+	HostName    string `json:"host_name"`
+	DataCenter  string `json:"datacenter"`
+	Environment string `json:"environment,omitempty"`
+	Version     string `json:"version,omitempty"`
+	APIAddr     string `json:"api_addr,omitempty"` // address of the REST API of l3afd
+}
+
+// Client fetches the configs of this host from the config service
+type Client struct {
+	conf      Config
+	http      *http.Client
+	publicKey crypto.PublicKey
+
+	// ETag, revision and digest of the last accepted configs
+	etag     string
+	revision uint64
+	digest   [sha256.Size]byte
+}
+
+// Pulled defines configs fetched from the config service, they are accepted once deployed
+type Pulled struct {
+	Configs  []models.L3afBPFPrograms
+	Revision uint64
+	// Changed tells whether the configs differ from the last accepted ones
+	Changed bool
+
+	etag   string
+	digest [sha256.Size]byte
+}
+
+// state defines the last accepted configs kept in the state file
+type state struct {
+	Revision uint64 `json:"revision"`
+	Digest   string `json:"digest"`
+}
+
+// New - returns the client of the config service
+func New(conf Config) (*Client, error) {
+	if len(conf.SignatureHeader) == 0 {
+		conf.SignatureHeader = DefaultSignatureHeader
+	}
+	c := &Client{conf: conf}
+
+	if len(conf.PublicKeyFile) > 0 {
+		key, err := loadPublicKey(conf.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.publicKey = key
+	} else if !conf.AllowUnsigned && len(conf.URL) > 0 {
+		return nil, fmt.Errorf("a signature public key is required to pull configs, or unsigned configs have to be allowed")
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(conf.CACertFile) > 0 {
+		buf, err := os.ReadFile(conf.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate %s: %v", conf.CACertFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("no certificates found in %s", conf.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(conf.ClientCertFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(conf.ClientCertFile, conf.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate %s: %v", conf.ClientCertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	c.http = &http.Client{Transport: transport, Timeout: conf.Timeout}
+
+	if err := c.loadState(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadState - restores the revision and digest of the last accepted configs, so that older configs replayed after a
+// restart are rejected
+func (c *Client) loadState() error {
+	if len(c.conf.StateFile) == 0 {
+		return nil
+	}
+	buf, err := os.ReadFile(c.conf.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read remote config state %s: %v", c.conf.StateFile, err)
+	}
+	var s state
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return fmt.Errorf("failed to unmarshal remote config state %s: %v", c.conf.StateFile, err)
+	}
+	digest, err := hex.DecodeString(s.Digest)
+	if err != nil || len(digest) != sha256.Size {
+		return fmt.Errorf("invalid digest %q in remote config state %s", s.Digest, c.conf.StateFile)
+	}
+	c.revision = s.Revision
+	copy(c.digest[:], digest)
+	return nil
+}
+
+// saveState - persists the revision and digest of the last accepted configs
+func (c *Client) saveState() error {
+	if len(c.conf.StateFile) == 0 {
+		return nil
+	}
+	buf, err := json.Marshal(state{Revision: c.revision, Digest: hex.EncodeToString(c.digest[:])})
+	if err != nil {
+		return fmt.Errorf("failed to marshal remote config state: %v", err)
+	}
+	if err := configstore.WriteFileAtomic(c.conf.StateFile, buf, 0600); err != nil {
+		return fmt.Errorf("failed to save remote config state: %v", err)
+	}
+	return nil
+}
+
+// loadPublicKey - reads the PEM encoded PKIX public key
+func loadPublicKey(file string) (crypto.PublicKey, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key %s: %v", file, err)
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded public key found in %s", file)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %v", file, err)
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T in %s", key, file)
+	}
+}
+
+// SignedMessage - returns the message the config service signs, the revision and the configs separated by a newline,
+// so that a signed response can not be replayed with another revision
+func SignedMessage(revision string, body []byte) []byte {
+	msg := make([]byte, 0, len(revision)+1+len(body))
+	msg = append(msg, revision...)
+	msg = append(msg, '\n')
+	return append(msg, body...)
+}
+
+// verify - checks the base64 encoded signature of the revision and the body
+func (c *Client) verify(revision string, body []byte, signature string) error {
+	if c.publicKey == nil {
+		return nil
+	}
+	if len(signature) == 0 {
+		return fmt.Errorf("configs are not signed, %s header is missing", c.conf.SignatureHeader)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %v", err)
+	}
+	msg := SignedMessage(revision, body)
+	digest := sha256.Sum256(msg)
+	valid := false
+	switch key := c.publicKey.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, msg, sig)
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, digest[:], sig)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !valid {
+		return errors.New("invalid signature of the configs")
+	}
+	return nil
+}
+
+// configURL - returns the URL of the configs of this host
+func (c *Client) configURL() (string, error) {
+	u, err := url.Parse(c.conf.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid config URL %s: %v", c.conf.URL, err)
+	}
+	q := u.Query()
+	q.Set("host", c.conf.HostName)
+	q.Set("datacenter", c.conf.DataCenter)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// parseRevision - returns the revision of the configs, it is required with signed configs
+func (c *Client) parseRevision(revision string) (uint64, error) {
+	if len(revision) == 0 {
+		if c.publicKey != nil {
+			return 0, fmt.Errorf("configs have no revision, %s header is missing", RevisionHeader)
+		}
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(revision, 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid revision %q of the configs", revision)
+	}
+	return n, nil
+}
+
+// Fetch - returns the configs of this host, nil when they are not modified since the last accepted ones.
+// Configs are valid when the signature of their revision and body is verified by the public key, their revision is
+// not older than the last accepted one and they all belong to this host. They are accepted with Accept.
+func (c *Client) Fetch(ctx context.Context) (*Pulled, error) {
+	rawURL, err := c.configURL()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if len(c.etag) > 0 {
+		req.Header.Set("If-None-Match", c.etag)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch configs: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch configs: config service returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxConfigSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configs: %v", err)
+	}
+	if len(body) > maxConfigSize {
+		return nil, fmt.Errorf("configs exceed %d bytes", maxConfigSize)
+	}
+
+	revisionHeader := resp.Header.Get(RevisionHeader)
+	if err := c.verify(revisionHeader, body, resp.Header.Get(c.conf.SignatureHeader)); err != nil {
+		return nil, err
+	}
+	revision, err := c.parseRevision(revisionHeader)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(body)
+	if revision > 0 {
+		// replayed or downgraded configs are rejected
+		if revision < c.revision {
+			return nil, fmt.Errorf("revision %d of the configs is older than the accepted revision %d", revision, c.revision)
+		}
+		if revision == c.revision && digest != c.digest {
+			return nil, fmt.Errorf("revision %d of the configs was accepted with other configs", revision)
+		}
+	}
+	// the configs are checked against the schema like the payloads of the API
+	var cfgs []models.L3afBPFPrograms
+	if err := schema.Decode(body, schema.JSON, &cfgs); err != nil {
+		return nil, fmt.Errorf("invalid configs: %v", err)
+	}
+	for _, cfg := range cfgs {
+		if cfg.HostName != c.conf.HostName {
+			return nil, fmt.Errorf("configs of iface %s belong to host %s", cfg.Iface, cfg.HostName)
+		}
+	}
+	return &Pulled{Configs: cfgs, Revision: revision, Changed: digest != c.digest, etag: resp.Header.Get("ETag"), digest: digest}, nil
+}
+
+// Accept - records the pulled configs as the last accepted ones, their ETag is sent with the next fetch and older
+// revisions are rejected from now on
+func (c *Client) Accept(p *Pulled) error {
+	c.etag = p.etag
+	if p.digest == c.digest && p.Revision == c.revision {
+		return nil
+	}
+	c.digest = p.digest
+	if p.Revision > 0 {
+		c.revision = p.Revision
+	}
+	return c.saveState()
+}
+
+// Register - sends the registration of this host to the register URL
+func (c *Client) Register(ctx context.Context, reg Registration) error {
+	if len(c.conf.RegisterURL) == 0 {
+		return nil
+	}
+	buf, err := json.Marshal(reg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal registration: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.conf.RegisterURL, bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to register: %v", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to register: config service returned %s", resp.Status)
+	}
+	log.Info().Str("url", c.conf.RegisterURL).Msg("registered with the config service")
+	return nil
+}
+
+// Run - pulls the configs every interval until ctx is done and deploys them when they changed. The pulled configs
+// replace the whole desired state of this host, like POST /l3af/configs/v1/update.
+func (c *Client) Run(ctx context.Context, deploy func(context.Context, []models.L3afBPFPrograms) error) {
+	ticker := time.NewTicker(c.conf.Interval)
+	defer ticker.Stop()
+	for {
+		c.pull(ctx, deploy)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pull - fetches the configs once and deploys them when they changed, they are accepted only once deployed so that
+// a failed deploy is retried with the next pull
+func (c *Client) pull(ctx context.Context, deploy func(context.Context, []models.L3afBPFPrograms) error) {
+	p, err := c.Fetch(ctx)
+	if err != nil {
+		log.Error().Err(err).Str("url", c.conf.URL).Msg("failed to pull configs, keeping the current ones")
+		return
+	}
+	if p == nil || !p.Changed {
+		log.Debug().Str("url", c.conf.URL).Msg("pulled configs are unchanged")
+		if p != nil {
+			c.accept(p)
+		}
+		return
+	}
+	log.Info().Str("url", c.conf.URL).Str("etag", p.etag).Uint64("revision", p.Revision).Int("ifaces", len(p.Configs)).Msg("deploying pulled configs")
+	if err := deploy(configstore.WithAuthor(ctx, Author), p.Configs); err != nil {
+		log.Error().Err(err).Uint64("revision", p.Revision).Msg("failed to deploy pulled configs, retrying with the next pull")
+		return
+	}
+	c.accept(p)
+}
+
+// accept - accepts the pulled configs, a state which can not be saved is logged as the configs are deployed
+func (c *Client) accept(p *Pulled) {
+	if err := c.Accept(p); err != nil {
+		log.Error().Err(err).Str("path", c.conf.StateFile).Msg("failed to save the accepted revision")
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package remoteconfig
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/l3af-project/l3afd/configstore"
+	"github.com/l3af-project/l3afd/models"
+)
+
+const testHost = "l3af-local-test"
+
+// writePublicKey - writes the PEM encoded public key of the signer to a file
+func writePublicKey(t *testing.T, signer crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "config-service.pub")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("failed to write public key: %v", err)
+	}
+	return file
+}
+
+// sign - returns the base64 encoded signature of the revision and the body
+func sign(t *testing.T, signer crypto.Signer, revision string, body []byte) string {
+	t.Helper()
+	msg := SignedMessage(revision, body)
+	digest, opts := msg, crypto.SignerOpts(crypto.Hash(0))
+	if _, ok := signer.(*ecdsa.PrivateKey); ok {
+		sum := sha256.Sum256(msg)
+		digest, opts = sum[:], crypto.SHA256
+	}
+	sig, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		t.Fatalf("failed to sign configs: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// configService serves the configs of the test host with an ETag and their revision
+type configService struct {
+	mu        sync.Mutex
+	body      []byte
+	etag      string
+	revision  string
+	signature string
+	requests  []*http.Request
+}
+
+func (s *configService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+	if r.URL.Query().Get("host") != testHost {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if len(s.etag) > 0 && r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if len(s.etag) > 0 {
+		w.Header().Set("ETag", s.etag)
+	}
+	if len(s.revision) > 0 {
+		w.Header().Set(RevisionHeader, s.revision)
+	}
+	if len(s.signature) > 0 {
+		w.Header().Set(DefaultSignatureHeader, s.signature)
+	}
+	w.Write(s.body)
+}
+
+func (s *configService) set(body []byte, etag, revision, signature string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.etag, s.revision, s.signature = body, etag, revision, signature
+}
+
+func testConfigs(t *testing.T, host, version string) []byte {
+	t.Helper()
+	buf, err := json.Marshal([]models.L3afBPFPrograms{{
+		HostName:    host,
+		Iface:       "fakeif0",
+		BpfPrograms: &models.BPFPrograms{XDPIngress: []*models.BPFProgram{{Name: "ratelimiting", Version: version, AdminStatus: models.Enabled}}},
+	}})
+	if err != nil {
+		t.Fatalf("failed to marshal configs: %v", err)
+	}
+	return buf
+}
+
+func TestFetch(t *testing.T) {
+	_, edSigner, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	ecSigner, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	valid, otherHost := testConfigs(t, testHost, "1.0"), testConfigs(t, "other-host", "1.0")
+	tests := []struct {
+		name      string
+		signer    crypto.Signer
+		body      []byte
+		revision  string
+		signature func(body []byte) string
+		unsigned  bool
+		wantErr   bool
+	}{
+		{name: "Ed25519", signer: edSigner, body: valid, revision: "1"},
+		{name: "ECDSA", signer: ecSigner, body: valid, revision: "1"},
+		{name: "Unsigned", signer: edSigner, body: valid, revision: "1", signature: func([]byte) string { return "" }, wantErr: true},
+		{name: "TamperedBody", signer: edSigner, body: valid, revision: "1", signature: func(body []byte) string { return sign(t, edSigner, "1", append([]byte(" "), body...)) }, wantErr: true},
+		{name: "TamperedRevision", signer: edSigner, body: valid, revision: "2", signature: func(body []byte) string { return sign(t, edSigner, "1", body) }, wantErr: true},
+		{name: "NoRevision", signer: edSigner, body: valid, wantErr: true},
+		{name: "InvalidRevision", signer: edSigner, body: valid, revision: "0", wantErr: true},
+		{name: "OtherHost", signer: edSigner, body: otherHost, revision: "1", wantErr: true},
+		{name: "InvalidJSON", signer: edSigner, body: []byte("{"), revision: "1", wantErr: true},
+		{name: "UnknownField", signer: edSigner, body: []byte(`[{"host_name":"` + testHost + `","iface":"fakeif0","bpf_programs":{"xdp_ingress":[{"name":"ratelimiting","seqid":1}]}}]`), revision: "1", wantErr: true},
+		{name: "SchemaMismatch", signer: edSigner, body: []byte(`[{"host_name":"` + testHost + `","iface":"fakeif0","bpf_programs":{"xdp_ingress":[{"name":"ratelimiting","cpu":"50"}]}}]`), revision: "1", wantErr: true},
+		{name: "UnsignedAllowed", body: valid, signature: func([]byte) string { return "" }, unsigned: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature := ""
+			if tt.signature != nil {
+				signature = tt.signature(tt.body)
+			} else {
+				signature = sign(t, tt.signer, tt.revision, tt.body)
+			}
+			service := &configService{}
+			service.set(tt.body, "", tt.revision, signature)
+			server := httptest.NewServer(service)
+			defer server.Close()
+
+			conf := Config{URL: server.URL + "/configs", HostName: testHost, DataCenter: "dc1", Timeout: time.Second, AllowUnsigned: tt.unsigned}
+			if tt.signer != nil {
+				conf.PublicKeyFile = writePublicKey(t, tt.signer)
+			}
+			c, err := New(conf)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			p, err := c.Fetch(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (!p.Changed || len(p.Configs) != 1 || p.Configs[0].BpfPrograms.XDPIngress[0].Name != "ratelimiting") {
+				t.Errorf("Fetch() = %+v, want the ratelimiting config", p)
+			}
+			if q := service.requests[0].URL.Query(); q.Get("datacenter") != "dc1" {
+				t.Errorf("request query = %v, want host and datacenter", q)
+			}
+		})
+	}
+}
+
+func TestNewRequiresPublicKey(t *testing.T) {
+	if _, err := New(Config{URL: "https://config.l3af.io/configs"}); err == nil {
+		t.Errorf("New() without public key succeeded, want an error unless unsigned configs are allowed")
+	}
+	if _, err := New(Config{RegisterURL: "https://config.l3af.io/register"}); err != nil {
+		t.Errorf("New() of a registration client error = %v", err)
+	}
+}
+
+func TestRunDeploysChangedConfigs(t *testing.T) {
+	_, signer, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	service := &configService{}
+	body := testConfigs(t, testHost, "1.0")
+	service.set(body, `"v1"`, "1", sign(t, signer, "1", body))
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	c, err := New(Config{URL: server.URL, HostName: testHost, PublicKeyFile: writePublicKey(t, signer), Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	deployed := make([]string, 0)
+	deploy := func(ctx context.Context, cfgs []models.L3afBPFPrograms) error {
+		if author := configstore.Author(ctx); author != Author {
+			t.Errorf("deployed on behalf of %s, want %s", author, Author)
+		}
+		deployed = append(deployed, cfgs[0].BpfPrograms.XDPIngress[0].Version)
+		return nil
+	}
+
+	c.pull(context.Background(), deploy)
+	c.pull(context.Background(), deploy)
+	if got := service.requests[1].Header.Get("If-None-Match"); got != `"v1"` {
+		t.Errorf("If-None-Match = %q, want the ETag of the accepted configs", got)
+	}
+	// a new ETag with the same configs is not deployed again
+	service.set(body, `"v1-again"`, "1", sign(t, signer, "1", body))
+	c.pull(context.Background(), deploy)
+	// an invalid signature keeps the current configs
+	service.set(testConfigs(t, testHost, "2.0"), `"v2"`, "2", sign(t, signer, "2", body))
+	c.pull(context.Background(), deploy)
+	body = testConfigs(t, testHost, "2.0")
+	service.set(body, `"v2"`, "2", sign(t, signer, "2", body))
+	c.pull(context.Background(), deploy)
+
+	if len(deployed) != 2 || deployed[0] != "1.0" || deployed[1] != "2.0" {
+		t.Errorf("deployed versions %v, want 1.0 and 2.0", deployed)
+	}
+}
+
+func TestPullRetriesFailedDeploy(t *testing.T) {
+	_, signer, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	service := &configService{}
+	body := testConfigs(t, testHost, "1.0")
+	service.set(body, `"v1"`, "1", sign(t, signer, "1", body))
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	c, err := New(Config{URL: server.URL, HostName: testHost, PublicKeyFile: writePublicKey(t, signer), Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	attempts := 0
+	deploy := func(ctx context.Context, cfgs []models.L3afBPFPrograms) error {
+		attempts++
+		if attempts == 1 {
+			return os.ErrDeadlineExceeded
+		}
+		return nil
+	}
+
+	c.pull(context.Background(), deploy)
+	// the failed configs are not accepted, their ETag is not sent and they are deployed again
+	c.pull(context.Background(), deploy)
+	if got := service.requests[1].Header.Get("If-None-Match"); len(got) > 0 {
+		t.Errorf("If-None-Match = %q after a failed deploy, want none", got)
+	}
+	c.pull(context.Background(), deploy)
+	if attempts != 2 || c.revision != 1 {
+		t.Errorf("deploy attempts = %d, accepted revision %d, want 2 attempts and revision 1", attempts, c.revision)
+	}
+}
+
+func TestFetchRejectsOlderRevisions(t *testing.T) {
+	_, signer, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	service := &configService{}
+	server := httptest.NewServer(service)
+	defer server.Close()
+	conf := Config{
+		URL:           server.URL,
+		HostName:      testHost,
+		PublicKeyFile: writePublicKey(t, signer),
+		Timeout:       time.Second,
+		StateFile:     filepath.Join(t.TempDir(), "l3af-config.json.remote-config"),
+	}
+	c, err := New(conf)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	old, current := testConfigs(t, testHost, "1.0"), testConfigs(t, testHost, "2.0")
+	service.set(current, "", "5", sign(t, signer, "5", current))
+	c.pull(context.Background(), func(context.Context, []models.L3afBPFPrograms) error { return nil })
+
+	// the accepted revision is kept across restarts
+	c, err = New(conf)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		name     string
+		body     []byte
+		revision string
+		wantErr  string
+	}{
+		{name: "Replayed", body: old, revision: "4", wantErr: "older than the accepted revision 5"},
+		{name: "SameRevisionOtherConfigs", body: old, revision: "5", wantErr: "revision 5 of the configs was accepted with other configs"},
+		{name: "SameRevision", body: current, revision: "5"},
+		{name: "Newer", body: old, revision: "6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service.set(tt.body, "", tt.revision, sign(t, signer, tt.revision, tt.body))
+			p, err := c.Fetch(context.Background())
+			if (err == nil) != (len(tt.wantErr) == 0) || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Fetch() error = %v, want %q", err, tt.wantErr)
+			}
+			if err == nil && p.Changed != (tt.revision != "5") {
+				t.Errorf("Fetch() changed = %v with revision %s", p.Changed, tt.revision)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var got Registration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	c, err := New(Config{RegisterURL: server.URL, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	reg := Registration{HostName: testHost, DataCenter: "dc1", Version: "2.0.0", APIAddr: "localhost:7080"}
+	if err := c.Register(context.Background(), reg); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if got != reg {
+		t.Errorf("registration = %+v, want %+v", got, reg)
+	}
+}
@@ -4,13 +4,16 @@
 package routes
 
 import (
+	"net/http"
+
 	chi "github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
 )
 
-// NewRouter returns a router handle loaded with all the supported routes
-func NewRouter(routes []Route) *chi.Mux {
+// NewRouter returns a router handle loaded with all the supported routes, the middlewares wrap every route
+func NewRouter(routes []Route, middlewares ...func(http.Handler) http.Handler) *chi.Mux {
 	r := chi.NewRouter()
+	r.Use(middlewares...)
 
 	for _, route := range routes {
 		r.Method(route.Method, route.Path, route.HandlerFunc)
@@ -0,0 +1,80 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sandbox starts user programs with reduced privileges.
+//
+// Credentials, capabilities, no_new_privs, seccomp and a read-only root can not all be applied
+// between fork and exec by the Go runtime, so the program is started through a shim: l3afd
+// re-executes itself with ShimName as argv[0], the shim applies the Spec on its own thread and
+// executes the user program in place.
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	// ShimName - argv[0] of l3afd started as sandbox shim
+	ShimName = "l3afd-sandbox"
+	// specEnv - environment variable passing the Spec to the shim
+	specEnv = "L3AFD_SANDBOX_SPEC"
+)
+
+// Spec describes the program to start and the restrictions applied to it
+type Spec struct {
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	// Env is the environment of the program
+	Env []string `json:"env"`
+	// UID and GID switch the user and group when set
+	UID    *uint32  `json:"uid,omitempty"`
+	GID    *uint32  `json:"gid,omitempty"`
+	Groups []uint32 `json:"groups,omitempty"`
+	// Capabilities is the capability set of the program, nil keeps the capabilities of l3afd
+	Capabilities []string `json:"capabilities"`
+	NoNewPrivs   bool     `json:"no_new_privs,omitempty"`
+	// SeccompProfile is the path of a seccomp filter in binary BPF format
+	SeccompProfile string `json:"seccomp_profile,omitempty"`
+	// ReadOnlyRoot remounts all filesystems read-only in a private mount namespace except WritablePaths
+	ReadOnlyRoot  bool     `json:"read_only_root,omitempty"`
+	WritablePaths []string `json:"writable_paths,omitempty"`
+}
+
+// IsShim - reports whether the process is started as sandbox shim
+func IsShim() bool {
+	return len(os.Args) > 0 && os.Args[0] == ShimName
+}
+
+// readSpec - reads the Spec passed to the shim and removes it from the environment
+func readSpec() (*Spec, error) {
+	data := os.Getenv(specEnv)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s is not set", specEnv)
+	}
+	os.Unsetenv(specEnv)
+
+	var spec Spec
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sandbox spec: %v", err)
+	}
+	if len(spec.Path) == 0 {
+		return nil, fmt.Errorf("sandbox spec has no program path")
+	}
+	return &spec, nil
+}
+
+func (s *Spec) encode() (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal sandbox spec: %v", err)
+	}
+	return string(data), nil
+}
+
+// fail - reports the error of the shim on stderr, which is captured into the program log, and exits
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", ShimName, err)
+	os.Exit(127)
+}
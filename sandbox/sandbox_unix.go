@@ -0,0 +1,382 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package sandbox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// selfExe - l3afd binary started as shim
+const selfExe = "/proc/self/exe"
+
+var capabilities = map[string]uintptr{
+	"CAP_CHOWN":              unix.CAP_CHOWN,
+	"CAP_DAC_OVERRIDE":       unix.CAP_DAC_OVERRIDE,
+	"CAP_DAC_READ_SEARCH":    unix.CAP_DAC_READ_SEARCH,
+	"CAP_FOWNER":             unix.CAP_FOWNER,
+	"CAP_FSETID":             unix.CAP_FSETID,
+	"CAP_KILL":               unix.CAP_KILL,
+	"CAP_SETGID":             unix.CAP_SETGID,
+	"CAP_SETUID":             unix.CAP_SETUID,
+	"CAP_SETPCAP":            unix.CAP_SETPCAP,
+	"CAP_LINUX_IMMUTABLE":    unix.CAP_LINUX_IMMUTABLE,
+	"CAP_NET_BIND_SERVICE":   unix.CAP_NET_BIND_SERVICE,
+	"CAP_NET_BROADCAST":      unix.CAP_NET_BROADCAST,
+	"CAP_NET_ADMIN":          unix.CAP_NET_ADMIN,
+	"CAP_NET_RAW":            unix.CAP_NET_RAW,
+	"CAP_IPC_LOCK":           unix.CAP_IPC_LOCK,
+	"CAP_IPC_OWNER":          unix.CAP_IPC_OWNER,
+	"CAP_SYS_MODULE":         unix.CAP_SYS_MODULE,
+	"CAP_SYS_RAWIO":          unix.CAP_SYS_RAWIO,
+	"CAP_SYS_CHROOT":         unix.CAP_SYS_CHROOT,
+	"CAP_SYS_PTRACE":         unix.CAP_SYS_PTRACE,
+	"CAP_SYS_PACCT":          unix.CAP_SYS_PACCT,
+	"CAP_SYS_ADMIN":          unix.CAP_SYS_ADMIN,
+	"CAP_SYS_BOOT":           unix.CAP_SYS_BOOT,
+	"CAP_SYS_NICE":           unix.CAP_SYS_NICE,
+	"CAP_SYS_RESOURCE":       unix.CAP_SYS_RESOURCE,
+	"CAP_SYS_TIME":           unix.CAP_SYS_TIME,
+	"CAP_SYS_TTY_CONFIG":     unix.CAP_SYS_TTY_CONFIG,
+	"CAP_MKNOD":              unix.CAP_MKNOD,
+	"CAP_LEASE":              unix.CAP_LEASE,
+	"CAP_AUDIT_WRITE":        unix.CAP_AUDIT_WRITE,
+	"CAP_AUDIT_CONTROL":      unix.CAP_AUDIT_CONTROL,
+	"CAP_SETFCAP":            unix.CAP_SETFCAP,
+	"CAP_MAC_OVERRIDE":       unix.CAP_MAC_OVERRIDE,
+	"CAP_MAC_ADMIN":          unix.CAP_MAC_ADMIN,
+	"CAP_SYSLOG":             unix.CAP_SYSLOG,
+	"CAP_WAKE_ALARM":         unix.CAP_WAKE_ALARM,
+	"CAP_BLOCK_SUSPEND":      unix.CAP_BLOCK_SUSPEND,
+	"CAP_AUDIT_READ":         unix.CAP_AUDIT_READ,
+	"CAP_PERFMON":            unix.CAP_PERFMON,
+	"CAP_BPF":                unix.CAP_BPF,
+	"CAP_CHECKPOINT_RESTORE": unix.CAP_CHECKPOINT_RESTORE,
+}
+
+// Command - returns the command starting the program of spec through the sandbox shim
+func Command(spec Spec) (*exec.Cmd, error) {
+	if _, err := capabilitySet(spec.Capabilities); err != nil {
+		return nil, err
+	}
+	for _, path := range spec.WritablePaths {
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("writable path %s is not absolute", path)
+		}
+	}
+	encoded, err := spec.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(selfExe)
+	cmd.Args = []string{ShimName}
+	cmd.Env = append(append([]string{}, spec.Env...), specEnv+"="+encoded)
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if spec.ReadOnlyRoot {
+		cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWNS
+	}
+	return cmd, nil
+}
+
+// capabilitySet - returns the capability numbers of names
+func capabilitySet(names []string) ([]uintptr, error) {
+	caps := make([]uintptr, 0, len(names))
+	for _, name := range names {
+		c, ok := capabilities[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown capability %s", name)
+		}
+		caps = append(caps, c)
+	}
+	return caps, nil
+}
+
+// Run - applies the Spec passed to the shim and executes the program, it does not return
+func Run() {
+	// credentials, capabilities and seccomp filters are per thread, they are applied to the thread executing the program
+	runtime.LockOSThread()
+
+	spec, err := readSpec()
+	if err != nil {
+		fail(err)
+	}
+	if spec.ReadOnlyRoot {
+		if err := readOnlyRoot(spec.WritablePaths); err != nil {
+			fail(err)
+		}
+	}
+	var caps []uintptr
+	if spec.Capabilities != nil {
+		if caps, err = capabilitySet(spec.Capabilities); err != nil {
+			fail(err)
+		}
+		if err := dropBoundingSet(caps); err != nil {
+			fail(err)
+		}
+	}
+	if err := setCredentials(spec, caps != nil); err != nil {
+		fail(err)
+	}
+	if caps != nil {
+		if err := setCapabilities(caps); err != nil {
+			fail(err)
+		}
+	}
+	if spec.NoNewPrivs || len(spec.SeccompProfile) > 0 {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			fail(fmt.Errorf("failed to set no_new_privs: %v", err))
+		}
+	}
+	if len(spec.SeccompProfile) > 0 {
+		if err := loadSeccompProfile(spec.SeccompProfile); err != nil {
+			fail(err)
+		}
+	}
+
+	args := append([]string{spec.Path}, spec.Args...)
+	if err := unix.Exec(spec.Path, args, spec.Env); err != nil {
+		fail(fmt.Errorf("failed to execute %s: %v", spec.Path, err))
+	}
+}
+
+// readOnlyRoot - remounts all filesystems read-only except writable paths, the shim runs in its own mount namespace
+func readOnlyRoot(writablePaths []string) error {
+	if err := unix.Mount("none", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %v", err)
+	}
+	writable := make([]string, 0, len(writablePaths))
+	for _, path := range writablePaths {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		// a bind mount keeps the path writable when its filesystem is remounted read-only
+		if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("failed to bind mount writable path %s: %v", path, err)
+		}
+		writable = append(writable, filepath.Clean(path))
+	}
+
+	mounts, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		if isUnder(m.path, writable) {
+			continue
+		}
+		flags := uintptr(unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY) | m.flags
+		if err := unix.Mount("none", m.path, "", flags, ""); err != nil {
+			if m.path == "/" {
+				return fmt.Errorf("failed to remount root read-only: %v", err)
+			}
+			fmt.Fprintf(os.Stderr, "%s: failed to remount %s read-only: %v\n", ShimName, m.path, err)
+		}
+	}
+	return nil
+}
+
+type mountPoint struct {
+	path  string
+	flags uintptr
+}
+
+var mountFlags = map[string]uintptr{
+	"nosuid":     unix.MS_NOSUID,
+	"nodev":      unix.MS_NODEV,
+	"noexec":     unix.MS_NOEXEC,
+	"noatime":    unix.MS_NOATIME,
+	"nodiratime": unix.MS_NODIRATIME,
+	"relatime":   unix.MS_RELATIME,
+}
+
+// mountPoints - returns the mount points of the mount namespace with the flags to keep on remount
+func mountPoints() ([]mountPoint, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mountinfo: %v", err)
+	}
+	defer f.Close()
+
+	mounts := make([]mountPoint, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m, ok := parseMountInfo(scanner.Text())
+		if ok {
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts, scanner.Err()
+}
+
+// parseMountInfo - parses a line of /proc/self/mountinfo, see proc(5)
+func parseMountInfo(line string) (mountPoint, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 6 {
+		return mountPoint{}, false
+	}
+	m := mountPoint{path: unescapeMountPath(fields[4])}
+	for _, option := range strings.Split(fields[5], ",") {
+		m.flags |= mountFlags[option]
+	}
+	return m, true
+}
+
+// unescapeMountPath - decodes the octal escapes of space, tab, newline and backslash
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if v, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+func isUnder(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// lastCap - returns the highest capability supported by the kernel
+func lastCap() uintptr {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err == nil {
+		if v, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			return uintptr(v)
+		}
+	}
+	return unix.CAP_LAST_CAP
+}
+
+func dropBoundingSet(caps []uintptr) error {
+	keep := make(map[uintptr]bool, len(caps))
+	for _, c := range caps {
+		keep[c] = true
+	}
+	for c := uintptr(0); c <= lastCap(); c++ {
+		if keep[c] {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, c, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to drop capability %d from bounding set: %v", c, err)
+		}
+	}
+	return nil
+}
+
+// setCredentials - switches the groups, group and user of the thread, keepCaps retains the permitted capabilities
+func setCredentials(spec *Spec, keepCaps bool) error {
+	if spec.UID == nil && spec.GID == nil {
+		return nil
+	}
+	if keepCaps {
+		if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to set keepcaps: %v", err)
+		}
+	}
+	if spec.GID != nil {
+		groups := spec.Groups
+		var ptr unsafe.Pointer
+		if len(groups) > 0 {
+			ptr = unsafe.Pointer(&groups[0])
+		}
+		if _, _, errno := unix.RawSyscall(unix.SYS_SETGROUPS, uintptr(len(groups)), uintptr(ptr), 0); errno != 0 {
+			return fmt.Errorf("failed to set groups %v: %v", groups, errno)
+		}
+		gid := uintptr(*spec.GID)
+		if _, _, errno := unix.RawSyscall(unix.SYS_SETRESGID, gid, gid, gid); errno != 0 {
+			return fmt.Errorf("failed to set gid %d: %v", *spec.GID, errno)
+		}
+	}
+	if spec.UID != nil {
+		uid := uintptr(*spec.UID)
+		if _, _, errno := unix.RawSyscall(unix.SYS_SETRESUID, uid, uid, uid); errno != 0 {
+			return fmt.Errorf("failed to set uid %d: %v", *spec.UID, errno)
+		}
+	}
+	return nil
+}
+
+// setCapabilities - sets the effective, permitted, inheritable and ambient capabilities of the thread to caps,
+// ambient capabilities keep them across exec of a program run as non root user
+func setCapabilities(caps []uintptr) error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	for _, c := range caps {
+		data[c/32].Effective |= 1 << (c % 32)
+		data[c/32].Permitted |= 1 << (c % 32)
+		data[c/32].Inheritable |= 1 << (c % 32)
+	}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to set capabilities: %v", err)
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to clear ambient capabilities: %v", err)
+	}
+	for _, c := range caps {
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, c, 0, 0); err != nil {
+			return fmt.Errorf("failed to raise ambient capability %d: %v", c, err)
+		}
+	}
+	return nil
+}
+
+// loadSeccompProfile - loads a seccomp filter in binary BPF format, as exported by seccomp_export_bpf(3).
+// The filter has to allow execve of the program.
+func loadSeccompProfile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read seccomp profile %s: %v", path, err)
+	}
+	filter, err := parseSeccompFilter(data)
+	if err != nil {
+		return fmt.Errorf("invalid seccomp profile %s: %v", path, err)
+	}
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("failed to load seccomp profile %s: %v", path, err)
+	}
+	return nil
+}
+
+// parseSeccompFilter - decodes the sock_filter instructions in native byte order
+func parseSeccompFilter(data []byte) ([]unix.SockFilter, error) {
+	const size = int(unsafe.Sizeof(unix.SockFilter{}))
+	if len(data) == 0 || len(data)%size != 0 {
+		return nil, fmt.Errorf("size %d is not a multiple of %d", len(data), size)
+	}
+	if len(data)/size > unix.BPF_MAXINSNS {
+		return nil, fmt.Errorf("more than %d instructions", unix.BPF_MAXINSNS)
+	}
+	filter := make([]unix.SockFilter, len(data)/size)
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&filter[0])), len(data)), data)
+	return filter, nil
+}
@@ -0,0 +1,156 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build !WINDOWS
+// +build !WINDOWS
+
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain - the test binary is started as shim by Command
+func TestMain(m *testing.M) {
+	if IsShim() {
+		Run()
+	}
+	os.Exit(m.Run())
+}
+
+func Test_parseMountInfo(t *testing.T) {
+	tests := []struct {
+		line string
+		want mountPoint
+		ok   bool
+	}{
+		{
+			line: "22 1 259:1 / / rw,relatime shared:1 - ext4 /dev/root rw",
+			want: mountPoint{path: "/", flags: mountFlags["relatime"]},
+			ok:   true,
+		},
+		{
+			line: `35 22 0:30 / /mnt/with\040space rw,nosuid,nodev,noexec shared:12 - tmpfs tmpfs rw`,
+			want: mountPoint{path: "/mnt/with space", flags: mountFlags["nosuid"] | mountFlags["nodev"] | mountFlags["noexec"]},
+			ok:   true,
+		},
+		{
+			line: "invalid",
+		},
+	}
+	for _, tt := range tests {
+		got, ok := parseMountInfo(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseMountInfo(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func Test_isUnder(t *testing.T) {
+	dirs := []string{"/sys/fs/bpf", "/var/log/"}
+	for path, want := range map[string]bool{
+		"/sys/fs/bpf":       true,
+		"/sys/fs/bpf/tc":    true,
+		"/sys/fs/bpfx":      false,
+		"/var/log/l3afd":    true,
+		"/":                 false,
+		"/sys/fs/cgroup/v2": false,
+	} {
+		if got := isUnder(path, dirs); got != want {
+			t.Errorf("isUnder(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func Test_parseSeccompFilter(t *testing.T) {
+	if _, err := parseSeccompFilter(nil); err == nil {
+		t.Errorf("parseSeccompFilter() of empty profile did not fail")
+	}
+	if _, err := parseSeccompFilter(make([]byte, 12)); err == nil {
+		t.Errorf("parseSeccompFilter() of truncated profile did not fail")
+	}
+	// BPF_RET | BPF_K, SECCOMP_RET_ALLOW
+	filter, err := parseSeccompFilter([]byte{0x06, 0, 0, 0, 0, 0, 0xff, 0x7f})
+	if err != nil || len(filter) != 1 || filter[0].Code != 0x06 || filter[0].K != 0x7fff0000 {
+		t.Errorf("parseSeccompFilter() = %+v, %v", filter, err)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("sandbox requires root")
+	}
+	nobody := uint32(65534)
+	writable := t.TempDir()
+	allowAll := filepath.Join(t.TempDir(), "allow.bpf")
+	if err := os.WriteFile(allowAll, []byte{0x06, 0, 0, 0, 0, 0, 0xff, 0x7f}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		spec   Spec
+		script string
+		want   []string
+	}{
+		{
+			name:   "DefaultKeepsPrivileges",
+			spec:   Spec{Env: []string{"FOO=bar"}},
+			script: "id -u; echo $FOO",
+			want:   []string{"0", "bar"},
+		},
+		{
+			name:   "RunAsUserWithCapabilities",
+			spec:   Spec{UID: &nobody, GID: &nobody, Capabilities: []string{"CAP_NET_ADMIN", "cap_bpf"}, NoNewPrivs: true},
+			script: "id -u; id -g; grep -E '^(CapEff|CapBnd|NoNewPrivs)' /proc/self/status",
+			want:   []string{"65534", "65534", "CapEff:\t0000008000001000", "CapBnd:\t0000008000001000", "NoNewPrivs:\t1"},
+		},
+		{
+			name:   "DropAllCapabilities",
+			spec:   Spec{Capabilities: []string{}},
+			script: "grep CapEff /proc/self/status",
+			want:   []string{"CapEff:\t0000000000000000"},
+		},
+		{
+			name:   "SeccompProfile",
+			spec:   Spec{SeccompProfile: allowAll},
+			script: "grep -E '^(NoNewPrivs|Seccomp):' /proc/self/status",
+			want:   []string{"NoNewPrivs:\t1", "Seccomp:\t2"},
+		},
+		{
+			name:   "ReadOnlyRoot",
+			spec:   Spec{ReadOnlyRoot: true, WritablePaths: []string{writable}},
+			script: "touch " + filepath.Join(writable, "ok") + " && echo writable; touch /l3afd-sandbox-test 2>/dev/null || echo read-only",
+			want:   []string{"writable", "read-only"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := tt.spec
+			spec.Path = "/bin/sh"
+			spec.Args = []string{"-c", tt.script}
+			spec.Env = append(spec.Env, "PATH=/usr/sbin:/usr/bin:/sbin:/bin")
+			cmd, err := Command(spec)
+			if err != nil {
+				t.Fatalf("Command() error = %v", err)
+			}
+			out, err := cmd.CombinedOutput()
+			if strings.Contains(string(out), "operation not permitted") {
+				t.Skipf("sandbox is not permitted in this environment: %s", out)
+			}
+			if err != nil {
+				t.Fatalf("sandboxed command failed: %v %s", err, out)
+			}
+			got := strings.Split(strings.TrimSpace(string(out)), "\n")
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("sandboxed command output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Command(Spec{Path: "/bin/true", Capabilities: []string{"CAP_UNKNOWN"}}); err == nil {
+		t.Errorf("Command() with unknown capability did not fail")
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+//
+//go:build WINDOWS
+// +build WINDOWS
+
+package sandbox
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Command - sandboxing is not supported on windows
+func Command(spec Spec) (*exec.Cmd, error) {
+	return nil, errors.New("sandboxing user programs is not supported on windows")
+}
+
+// Run - sandboxing is not supported on windows
+func Run() {
+	fail(errors.New("sandboxing user programs is not supported on windows"))
+}
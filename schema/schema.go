@@ -0,0 +1,396 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package schema generates the JSON Schema of the l3afd payloads from the models and decodes payloads strictly against it.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Draft - JSON Schema dialect of the generated schemas
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Format of a payload
+type Format string
+
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+	TOML Format = "toml"
+)
+
+// TOMLItems - key of the array of tables holding the items of array payloads in TOML, which has no top-level arrays
+const TOMLItems = "items"
+
+// mediaTypes - formats of the payload media types
+var mediaTypes = map[string]Format{
+	"application/json":   JSON,
+	"application/yaml":   YAML,
+	"application/x-yaml": YAML,
+	"text/yaml":          YAML,
+	"text/x-yaml":        YAML,
+	"application/toml":   TOML,
+}
+
+// MediaFormat - returns the format of the media type, empty when it is not a payload format
+func MediaFormat(mediaType string) Format {
+	if strings.HasSuffix(mediaType, "+json") {
+		return JSON
+	}
+	return mediaTypes[mediaType]
+}
+
+// ContentFormat - returns the format of a payload by its content type, JSON when it is not set
+func ContentFormat(contentType string) (Format, error) {
+	if len(contentType) == 0 {
+		return JSON, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type %q: %v", contentType, err)
+	}
+	if format := MediaFormat(mediaType); len(format) > 0 {
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported content type %q, use application/json, application/yaml or application/toml", mediaType)
+}
+
+// Types lists the JSON types of a value, a single type is marshalled as a string
+type Types []string
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// Schema defines the subset of JSON Schema generated from the models
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 Types              `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *uint64            `json:"maximum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"` // false or the schema of the values
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+var cache sync.Map
+
+// For - returns the schema of the type of v, pointers are dereferenced
+func For(v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if s, ok := cache.Load(t); ok {
+		return s.(*Schema)
+	}
+	defs := make(map[string]*Schema)
+	root := generate(t, defs)
+	root.Schema = Draft
+	if len(defs) > 0 {
+		root.Defs = defs
+	}
+	s, _ := cache.LoadOrStore(t, root)
+	return s.(*Schema)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// generate - returns the schema of t, named structs are added to defs and referenced
+func generate(t reflect.Type, defs map[string]*Schema) *Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(generate(t.Elem(), defs))
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		min, max := int64(math.MinInt64)>>(64-t.Bits()), uint64(math.MaxInt64)>>(64-t.Bits())
+		return &Schema{Type: Types{"integer"}, Minimum: &min, Maximum: &max}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		min, max := int64(0), uint64(math.MaxUint64)>>(64-t.Bits())
+		return &Schema{Type: Types{"integer"}, Minimum: &min, Maximum: &max}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Slice, reflect.Array:
+		// nil slices are marshalled as null
+		return &Schema{Type: Types{"array", "null"}, Items: generate(t.Elem(), defs)}
+	case reflect.Map:
+		return &Schema{Type: Types{"object", "null"}, AdditionalProperties: generate(t.Elem(), defs)}
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: Types{"string"}, Format: "date-time"}
+		}
+		if len(t.Name()) == 0 {
+			return object(t, defs)
+		}
+		if _, ok := defs[t.Name()]; !ok {
+			// placeholder for recursive types
+			defs[t.Name()] = &Schema{}
+			*defs[t.Name()] = *object(t, defs)
+		}
+		return &Schema{Ref: "#/$defs/" + t.Name()}
+	default:
+		// interface values are not constrained
+		return &Schema{}
+	}
+}
+
+// object - returns the schema of the struct, its properties are named by the json tags and other properties are rejected
+func object(t reflect.Type, defs map[string]*Schema) *Schema {
+	s := &Schema{Title: t.Name(), Type: Types{"object"}, Properties: make(map[string]*Schema), AdditionalProperties: false}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		s.Properties[name] = generate(f.Type, defs)
+	}
+	return s
+}
+
+// nullable - adds null to the types of s, a reference is combined with null by anyOf
+func nullable(s *Schema) *Schema {
+	if len(s.Ref) > 0 {
+		return &Schema{AnyOf: []*Schema{s, {Type: Types{"null"}}}}
+	}
+	if len(s.Type) == 0 {
+		return s
+	}
+	for _, t := range s.Type {
+		if t == "null" {
+			return s
+		}
+	}
+	s.Type = append(append(Types{}, s.Type...), "null")
+	return s
+}
+
+// FieldError defines a value of a payload not matching the schema
+type FieldError struct {
+	Path    string `json:"path"` // e.g. [0].bpf_programs.xdp_ingress[1].seq_id
+	Message string `json:"message"`
+}
+
+// Errors lists the values of a payload not matching the schema
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, f := range e {
+		msgs = append(msgs, f.Path+": "+f.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate - checks the document decoded with json.Decoder.UseNumber against the schema
+func (s *Schema) Validate(doc interface{}) error {
+	var errs Errors
+	s.validate(s, doc, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) validate(root *Schema, doc interface{}, path string, errs *Errors) {
+	if len(s.AnyOf) > 0 {
+		// the alternatives are a type and null, the errors of the type are reported
+		var first Errors
+		for i, alternative := range s.AnyOf {
+			var alternativeErrs Errors
+			alternative.validate(root, doc, path, &alternativeErrs)
+			if len(alternativeErrs) == 0 {
+				return
+			}
+			if i == 0 {
+				first = alternativeErrs
+			}
+		}
+		*errs = append(*errs, first...)
+		return
+	}
+	if len(s.Ref) > 0 {
+		def, ok := root.Defs[strings.TrimPrefix(s.Ref, "#/$defs/")]
+		if !ok {
+			*errs = append(*errs, FieldError{Path: pathOf(path), Message: "unresolved reference " + s.Ref})
+			return
+		}
+		def.validate(root, doc, path, errs)
+		return
+	}
+	if len(s.Type) == 0 {
+		return
+	}
+	typ := typeOf(doc)
+	if !s.allows(typ) && !(typ == "integer" && s.allows("number")) {
+		*errs = append(*errs, FieldError{Path: pathOf(path), Message: fmt.Sprintf("expected %s, got %s", strings.Join(s.Type, " or "), typ)})
+		return
+	}
+	switch v := doc.(type) {
+	case json.Number:
+		if typ == "integer" {
+			s.validateRange(v, path, errs)
+		}
+	case []interface{}:
+		for i, item := range v {
+			s.Items.validate(root, item, path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := s.Properties[k]; ok {
+				prop.validate(root, v[k], path+"."+k, errs)
+				continue
+			}
+			switch additional := s.AdditionalProperties.(type) {
+			case *Schema:
+				additional.validate(root, v[k], path+"."+k, errs)
+			case bool:
+				if !additional {
+					*errs = append(*errs, FieldError{Path: pathOf(path + "." + k), Message: "unknown field"})
+				}
+			}
+		}
+	}
+}
+
+func (s *Schema) validateRange(n json.Number, path string, errs *Errors) {
+	if s.Minimum != nil && *s.Minimum == 0 {
+		if v, err := strconv.ParseUint(n.String(), 10, 64); err != nil || (s.Maximum != nil && v > *s.Maximum) {
+			*errs = append(*errs, FieldError{Path: pathOf(path), Message: fmt.Sprintf("%s is out of range [0, %d]", n, *s.Maximum)})
+		}
+		return
+	}
+	v, err := strconv.ParseInt(n.String(), 10, 64)
+	if err != nil || (s.Minimum != nil && v < *s.Minimum) || (s.Maximum != nil && v >= 0 && uint64(v) > *s.Maximum) {
+		*errs = append(*errs, FieldError{Path: pathOf(path), Message: fmt.Sprintf("%s is out of range [%d, %d]", n, *s.Minimum, *s.Maximum)})
+	}
+}
+
+func (s *Schema) allows(typ string) bool {
+	for _, t := range s.Type {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf - returns the JSON type of a decoded value, numbers without fraction and exponent are integers
+func typeOf(doc interface{}) string {
+	switch v := doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func pathOf(path string) string {
+	if len(path) == 0 {
+		return "$"
+	}
+	return strings.TrimPrefix(path, ".")
+}
+
+// ToJSON - returns the payload as JSON, YAML and TOML are converted. A TOML document holding only the array of
+// tables TOMLItems is the array of its items.
+func ToJSON(buf []byte, format Format) ([]byte, error) {
+	var doc interface{}
+	switch format {
+	case YAML:
+		if err := yaml.Unmarshal(buf, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %v", err)
+		}
+	case TOML:
+		var table map[string]interface{}
+		if err := toml.Unmarshal(buf, &table); err != nil {
+			return nil, fmt.Errorf("failed to parse TOML: %v", err)
+		}
+		doc = table
+		if items, ok := table[TOMLItems].([]map[string]interface{}); ok && len(table) == 1 {
+			doc = items
+		}
+	default:
+		return buf, nil
+	}
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s: %v", strings.ToUpper(string(format)), err)
+	}
+	return buf, nil
+}
+
+// Decode - parses the JSON, YAML or TOML payload, validates it against the schema of v and decodes it into v rejecting unknown fields
+func Decode(buf []byte, format Format, v interface{}) error {
+	buf, err := ToJSON(buf, format)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	if dec.More() {
+		return fmt.Errorf("failed to parse JSON: unexpected data after the payload")
+	}
+	if err := For(v).Validate(doc); err != nil {
+		return err
+	}
+
+	dec = json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %v", err)
+	}
+	return nil
+}
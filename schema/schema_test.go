@@ -0,0 +1,161 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/l3af-project/l3afd/models"
+)
+
+func TestFor(t *testing.T) {
+	s := For([]models.L3afBPFPrograms{})
+	if s.Schema != Draft || !reflect.DeepEqual(s.Type, Types{"array", "null"}) || s.Items.Ref != "#/$defs/L3afBPFPrograms" {
+		t.Fatalf("For() = %+v, want an array of L3afBPFPrograms", s)
+	}
+	prog := s.Defs["BPFProgram"]
+	if prog == nil || prog.AdditionalProperties != false {
+		t.Fatalf("BPFProgram definition = %+v, want an object rejecting unknown fields", prog)
+	}
+	if seqID := prog.Properties["seq_id"]; seqID == nil || seqID.Type[0] != "integer" {
+		t.Errorf("seq_id = %+v, want an integer", seqID)
+	}
+	if probe := prog.Properties["liveness_probe"]; probe == nil || len(probe.AnyOf) != 2 || probe.AnyOf[0].Ref != "#/$defs/L3afDNFProbe" {
+		t.Errorf("liveness_probe = %+v, want L3afDNFProbe or null", probe)
+	}
+	runAsUser := s.Defs["L3afDNFSecurity"].Properties["run_as_user"]
+	if runAsUser == nil || *runAsUser.Minimum != 0 || *runAsUser.Maximum != 1<<32-1 {
+		t.Errorf("run_as_user = %+v, want an uint32 range", runAsUser)
+	}
+	if _, err := json.Marshal(s); err != nil {
+		t.Errorf("failed to marshal schema: %v", err)
+	}
+	if For(&[]models.L3afBPFPrograms{}) != s {
+		t.Errorf("For() of a pointer returned another schema")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		payload  string
+		want     []string
+		wantPath []string
+	}{
+		{
+			name:    "JSON",
+			format:  JSON,
+			payload: `[{"host_name": "l3af-local-test", "iface": "eth0", "bpf_programs": {"xdp_ingress": [{"name": "ratelimiting", "seq_id": 1, "start_args": {"rate": 2}, "security": null}]}}]`,
+			want:    []string{"eth0/ratelimiting"},
+		},
+		{
+			name:    "YAML",
+			format:  YAML,
+			payload: "- iface: eth0\n  bpf_programs:\n    xdp_ingress:\n      - name: ratelimiting\n        seq_id: 1\n        liveness_probe:\n          http_get: http://localhost:8080\n",
+			want:    []string{"eth0/ratelimiting"},
+		},
+		{
+			name:    "TOML",
+			format:  TOML,
+			payload: "[[items]]\niface = \"eth0\"\n[[items.bpf_programs.xdp_ingress]]\nname = \"ratelimiting\"\nseq_id = 1\nstart_args = { rate = 2 }\n",
+			want:    []string{"eth0/ratelimiting"},
+		},
+		{
+			name:     "TOMLUnknownField",
+			format:   TOML,
+			payload:  "[[items]]\niface = \"eth0\"\n[[items.bpf_programs.xdp_ingress]]\nname = \"a\"\nseqid = 1\n",
+			wantPath: []string{"[0].bpf_programs.xdp_ingress[0].seqid: unknown field"},
+		},
+		{
+			name:     "TOMLNotAList",
+			format:   TOML,
+			payload:  "iface = \"eth0\"\n",
+			wantPath: []string{"$: expected array or null, got object"},
+		},
+		{
+			name:     "UnknownField",
+			format:   JSON,
+			payload:  `[{"iface": "eth0", "bpf_programs": {"xdp_ingress": [{"name": "a"}, {"name": "b", "seqid": 1}]}}]`,
+			wantPath: []string{"[0].bpf_programs.xdp_ingress[1].seqid: unknown field"},
+		},
+		{
+			name:     "WrongTypes",
+			format:   YAML,
+			payload:  "- iface: 1\n  bpf_programs:\n    tc_egress:\n      - name: a\n        seq_id: \"1\"\n        cpu: 1.5\n        security:\n          run_as_user: -1\n",
+			wantPath: []string{"[0].bpf_programs.tc_egress[0].cpu: expected integer, got number", "[0].bpf_programs.tc_egress[0].security.run_as_user: -1 is out of range [0, 4294967295]", "[0].bpf_programs.tc_egress[0].seq_id: expected integer, got string", "[0].iface: expected string, got integer"},
+		},
+		{
+			name:     "NotAList",
+			format:   JSON,
+			payload:  `{"iface": "eth0"}`,
+			wantPath: []string{"$: expected array or null, got object"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfgs []models.L3afBPFPrograms
+			err := Decode([]byte(tt.payload), tt.format, &cfgs)
+			if len(tt.wantPath) > 0 {
+				var fieldErrs Errors
+				if !errors.As(err, &fieldErrs) {
+					t.Fatalf("Decode() error = %v, want field errors", err)
+				}
+				if got := strings.Split(fieldErrs.Error(), "; "); !reflect.DeepEqual(got, tt.wantPath) {
+					t.Errorf("Decode() errors = %q, want %q", got, tt.wantPath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			got := make([]string, 0)
+			for _, cfg := range cfgs {
+				for _, prog := range cfg.BpfPrograms.XDPIngress {
+					got = append(got, cfg.Iface+"/"+prog.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentFormat(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        Format
+		wantErr     bool
+	}{
+		{contentType: "", want: JSON},
+		{contentType: "application/json; charset=utf-8", want: JSON},
+		{contentType: "application/merge-patch+json", want: JSON},
+		{contentType: "application/x-yaml", want: YAML},
+		{contentType: "application/toml", want: TOML},
+		{contentType: "text/plain", wantErr: true},
+		{contentType: "application/", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ContentFormat(tt.contentType)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ContentFormat(%q) = %q, %v, want %q", tt.contentType, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeSyntaxError(t *testing.T) {
+	var cfgs []models.L3afBPFPrograms
+	for _, payload := range []string{`[{"iface": "eth0"}`, `[] []`} {
+		err := Decode([]byte(payload), JSON, &cfgs)
+		var fieldErrs Errors
+		if err == nil || errors.As(err, &fieldErrs) {
+			t.Errorf("Decode(%s) error = %v, want a syntax error", payload, err)
+		}
+	}
+}
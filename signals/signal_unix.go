@@ -12,3 +12,8 @@ import (
 )
 
 var ShutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// DebugToggleSignals temporarily enable the debug log level
+var DebugToggleSignals = []os.Signal{syscall.SIGUSR1}
+
+var ReloadSignals = []os.Signal{syscall.SIGHUP}
@@ -11,3 +11,8 @@ import (
 )
 
 var ShutdownSignals = []os.Signal{os.Interrupt}
+
+// DebugToggleSignals temporarily enable the debug log level, there is no such signal on windows
+var DebugToggleSignals = []os.Signal{}
+
+var ReloadSignals = []os.Signal{}
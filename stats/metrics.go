@@ -18,8 +18,18 @@ var (
 	NFUpdateCount       *prometheus.CounterVec
 	NFUpdateFailedCount *prometheus.CounterVec
 	NFRunning           *prometheus.GaugeVec
+	NFCrashLooping      *prometheus.GaugeVec
+	NFHealthy           *prometheus.GaugeVec
 	NFStartTime         *prometheus.GaugeVec
 	NFMonitorMap        *prometheus.GaugeVec
+	NFCPUUsageSeconds   *prometheus.GaugeVec
+	NFMemoryUsage       *prometheus.GaugeVec
+	NFProcessCount      *prometheus.GaugeVec
+	LogLevel            *prometheus.GaugeVec
+	TLSCertExpiry       *prometheus.GaugeVec
+	NFDrift             *prometheus.GaugeVec
+	NFReconcileCount    *prometheus.CounterVec
+	KernelFeature       *prometheus.GaugeVec
 )
 
 func SetupMetrics(hostname, daemonName, metricsAddr string) {
@@ -83,6 +93,36 @@ func SetupMetrics(hostname, daemonName, metricsAddr string) {
 
 	NFRunning = nfRunningVec.MustCurryWith(prometheus.Labels{"host": hostname})
 
+	nfCrashLoopingVec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: daemonName,
+			Name:      "NFCrashLooping",
+			Help:      "This value indicates network function exhausted its restart attempts and is crash looping",
+		},
+		[]string{"host", "ebpf_program", "version", "direction", "interface_name"},
+	)
+
+	if err := prometheus.Register(nfCrashLoopingVec); err != nil {
+		log.Warn().Err(err).Msg("Failed to register NFCrashLooping metrics")
+	}
+
+	NFCrashLooping = nfCrashLoopingVec.MustCurryWith(prometheus.Labels{"host": hostname})
+
+	nfHealthyVec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: daemonName,
+			Name:      "NFHealthy",
+			Help:      "This value indicates network function passed all its health checks or not",
+		},
+		[]string{"host", "ebpf_program", "version", "direction", "interface_name"},
+	)
+
+	if err := prometheus.Register(nfHealthyVec); err != nil {
+		log.Warn().Err(err).Msg("Failed to register NFHealthy metrics")
+	}
+
+	NFHealthy = nfHealthyVec.MustCurryWith(prometheus.Labels{"host": hostname})
+
 	nfStartTimeVec := prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: daemonName,
@@ -113,6 +153,122 @@ func SetupMetrics(hostname, daemonName, metricsAddr string) {
 
 	NFMonitorMap = nfMonitorMapVec.MustCurryWith(prometheus.Labels{"host": hostname})
 
+	nfCPUUsageSecondsVec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: daemonName,
+			Name:      "NFCPUUsageSeconds",
+			Help:      "This value indicates cpu time consumed by the user program of the network function in seconds",
+		},
+		[]string{"host", "ebpf_program", "direction", "interface_name"},
+	)
+
+	if err := prometheus.Register(nfCPUUsageSecondsVec); err != nil {
+		log.Warn().Err(err).Msg("Failed to register NFCPUUsageSeconds metrics")
+	}
+
+	NFCPUUsageSeconds = nfCPUUsageSecondsVec.MustCurryWith(prometheus.Labels{"host": hostname})
+
+	nfMemoryUsageVec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: daemonName,
+			Name:      "NFMemoryUsage",
+			Help:      "This value indicates memory used by the user program of the network function in bytes",
+		},
+		[]string{"host", "ebpf_program", "direction", "interface_name"},
+	)
+
+	if err := prometheus.Register(nfMemoryUsageVec); err != nil {
+		log.Warn().Err(err).Msg("Failed to register NFMemoryUsage metrics")
+	}
+
+	NFMemoryUsage = nfMemoryUsageVec.MustCurryWith(prometheus.Labels{"host": hostname})
+
+	nfProcessCountVec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: daemonName,
+			Name:      "NFProcessCount",
+			Help:      "This value indicates number of processes of the user program of the network function",
+		},
+		[]string{"host", "ebpf_program", "direction", "interface_name"},
+	)
+
+	if err := prometheus.Register(nfProcessCountVec); err != nil {
+		log.Warn().Err(err).Msg("Failed to register NFProcessCount metrics")
+	}
+
+	NFProcessCount = nfProcessCountVec.MustCurryWith(prometheus.Labels{"host": hostname})
+
+	logLevelVec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: daemonName,
+			Name:      "LogLevel",
+			Help:      "This value indicates the log level of the component, -1 trace, 0 debug, 1 info, 2 warn, 3 error",
+		},
+		[]string{"host", "component"},
+	)
+
+	if err := prometheus.Register(logLevelVec); err != nil {
+		log.Warn().Err(err).Msg("Failed to register LogLevel metrics")
+	}
+
+	LogLevel = logLevelVec.MustCurryWith(prometheus.Labels{"host": hostname})
+
+	tlsCertExpiryVec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: daemonName,
+			Name:      "TLSCertExpiry",
+			Help:      "This value indicates expiry time of the mTLS certificate since unix epoch in seconds",
+		},
+		[]string{"host", "certificate", "subject"},
+	)
+
+	if err := prometheus.Register(tlsCertExpiryVec); err != nil {
+		log.Warn().Err(err).Msg("Failed to register TLSCertExpiry metrics")
+	}
+
+	TLSCertExpiry = tlsCertExpiryVec.MustCurryWith(prometheus.Labels{"host": hostname})
+
+	nfDriftVec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: daemonName,
+			Name:      "NFDrift",
+			Help:      "This value indicates the running network function drifted from its desired config, by kind of drift",
+		},
+		[]string{"host", "ebpf_program", "direction", "interface_name", "drift"},
+	)
+
+	if err := prometheus.Register(nfDriftVec); err != nil {
+		log.Warn().Err(err).Msg("Failed to register NFDrift metrics")
+	}
+
+	NFDrift = nfDriftVec.MustCurryWith(prometheus.Labels{"host": hostname})
+
+	nfReconcileCountVec := promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: daemonName,
+			Name:      "NFReconcileCount",
+			Help:      "The count of actions taken by the reconciler to correct drifts of network functions, by result",
+		},
+		[]string{"host", "ebpf_program", "direction", "interface_name", "drift", "result"},
+	)
+
+	NFReconcileCount = nfReconcileCountVec.MustCurryWith(prometheus.Labels{"host": hostname})
+
+	kernelFeatureVec := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: daemonName,
+			Name:      "KernelFeature",
+			Help:      "This value indicates the kernel supports the eBPF feature or not, by kind of feature",
+		},
+		[]string{"host", "kind", "name"},
+	)
+
+	if err := prometheus.Register(kernelFeatureVec); err != nil {
+		log.Warn().Err(err).Msg("Failed to register KernelFeature metrics")
+	}
+
+	KernelFeature = kernelFeatureVec.MustCurryWith(prometheus.Labels{"host": hostname})
+
 	// Prometheus handler
 	metricsHandler := promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{})
 
@@ -210,3 +366,86 @@ func SetWithVersion(value float64, gaugeVec *prometheus.GaugeVec, ebpfProgram, v
 	}
 	nfGauge.Set(value)
 }
+
+func SetComponentValue(value float64, gaugeVec *prometheus.GaugeVec, component string) {
+
+	if gaugeVec == nil {
+		log.Warn().Msg("Metrics: gauge vector is nil and needs to be initialized before SetComponentValue")
+		return
+	}
+	gauge, err := gaugeVec.GetMetricWith(prometheus.Labels{"component": component})
+	if err != nil {
+		log.Warn().Msgf("Metrics: unable to fetch gauge with fields: component: %s", component)
+		return
+	}
+	gauge.Set(value)
+}
+
+func SetDriftValue(value float64, gaugeVec *prometheus.GaugeVec, ebpfProgram, direction, ifaceName, drift string) {
+
+	if gaugeVec == nil {
+		log.Warn().Msg("Metrics: gauge vector is nil and needs to be initialized before SetDriftValue")
+		return
+	}
+	gauge, err := gaugeVec.GetMetricWith(prometheus.Labels{
+		"ebpf_program":   ebpfProgram,
+		"direction":      direction,
+		"interface_name": ifaceName,
+		"drift":          drift,
+	})
+	if err != nil {
+		log.Warn().Msgf("Metrics: unable to fetch gauge with fields: ebpf_program: %s, direction: %s, interface_name: %s, drift: %s",
+			ebpfProgram, direction, ifaceName, drift)
+		return
+	}
+	gauge.Set(value)
+}
+
+func IncrReconcile(counterVec *prometheus.CounterVec, ebpfProgram, direction, ifaceName, drift, result string) {
+
+	if counterVec == nil {
+		log.Warn().Msg("Metrics: counter vector is nil and needs to be initialized before IncrReconcile")
+		return
+	}
+	counter, err := counterVec.GetMetricWith(prometheus.Labels{
+		"ebpf_program":   ebpfProgram,
+		"direction":      direction,
+		"interface_name": ifaceName,
+		"drift":          drift,
+		"result":         result,
+	})
+	if err != nil {
+		log.Warn().Msgf("Metrics: unable to fetch counter with fields: ebpf_program: %s, direction: %s, interface_name: %s, drift: %s, result: %s",
+			ebpfProgram, direction, ifaceName, drift, result)
+		return
+	}
+	counter.Inc()
+}
+
+func SetCertificateValue(value float64, gaugeVec *prometheus.GaugeVec, certificate, subject string) {
+
+	if gaugeVec == nil {
+		log.Warn().Msg("Metrics: gauge vector is nil and needs to be initialized before SetCertificateValue")
+		return
+	}
+	gauge, err := gaugeVec.GetMetricWith(prometheus.Labels{"certificate": certificate, "subject": subject})
+	if err != nil {
+		log.Warn().Msgf("Metrics: unable to fetch gauge with fields: certificate: %s, subject: %s", certificate, subject)
+		return
+	}
+	gauge.Set(value)
+}
+
+func SetFeatureValue(value float64, gaugeVec *prometheus.GaugeVec, kind, name string) {
+
+	if gaugeVec == nil {
+		log.Warn().Msg("Metrics: gauge vector is nil and needs to be initialized before SetFeatureValue")
+		return
+	}
+	gauge, err := gaugeVec.GetMetricWith(prometheus.Labels{"kind": kind, "name": name})
+	if err != nil {
+		log.Warn().Msgf("Metrics: unable to fetch gauge with fields: kind: %s, name: %s", kind, name)
+		return
+	}
+	gauge.Set(value)
+}
@@ -0,0 +1,168 @@
+// Copyright Contributors to the L3AF Project.
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	chi "github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collectorStub - receives the spans exported with OTLP over HTTP
+type collectorStub struct {
+	mu    sync.Mutex
+	spans map[string]*tracepb.Span
+}
+
+func (c *collectorStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &coltracepb.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				c.spans[span.Name] = span
+			}
+		}
+	}
+	resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp)
+}
+
+func attributeValue(span *tracepb.Span, key string) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			if s := kv.Value.GetStringValue(); len(s) > 0 {
+				return s
+			}
+			return fmt.Sprint(kv.Value.GetIntValue())
+		}
+	}
+	return ""
+}
+
+func TestMiddlewareExport(t *testing.T) {
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+
+	collector := &collectorStub{spans: map[string]*tracepb.Span{}}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	shutdown, err := Setup(context.Background(), Config{
+		Enabled:     true,
+		Endpoint:    strings.TrimPrefix(srv.URL, "http://"),
+		Insecure:    true,
+		ServiceName: "l3afd",
+		SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Post("/l3af/configs/v1/{iface}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "BPF.Start", Program("ratelimiting", "1.0", chi.URLParam(r, "iface"), "xdpingress")...)
+		End(span, fmt.Errorf("attach failed"))
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/l3af/configs/v1/eth0", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error = %v", err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	server, ok := collector.spans["POST /l3af/configs/v1/{iface}"]
+	if !ok {
+		t.Fatalf("request span not exported, got %v", collector.spans)
+	}
+	if got := fmt.Sprintf("%x", server.TraceId); got != traceID {
+		t.Errorf("request span trace id = %s, want %s of the traceparent header", got, traceID)
+	}
+	if got := attributeValue(server, "http.status_code"); got != "500" {
+		t.Errorf("request span http.status_code = %s, want 500", got)
+	}
+	if server.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR {
+		t.Errorf("request span status = %v, want error", server.Status.GetCode())
+	}
+
+	child, ok := collector.spans["BPF.Start"]
+	if !ok {
+		t.Fatalf("program span not exported, got %v", collector.spans)
+	}
+	if string(child.ParentSpanId) != string(server.SpanId) {
+		t.Errorf("program span parent = %x, want request span %x", child.ParentSpanId, server.SpanId)
+	}
+	for key, want := range map[string]string{
+		"l3af.program":         "ratelimiting",
+		"l3af.program.version": "1.0",
+		"l3af.iface":           "eth0",
+		"l3af.direction":       "xdpingress",
+	} {
+		if got := attributeValue(child, key); got != want {
+			t.Errorf("program span %s = %s, want %s", key, got, want)
+		}
+	}
+	if child.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR || child.Status.GetMessage() != "attach failed" {
+		t.Errorf("program span status = %v, want error attach failed", child.Status)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "Disabled", cfg: Config{}},
+		{name: "MissingEndpoint", cfg: Config{Enabled: true, SampleRatio: 1}, wantErr: true},
+		{name: "InvalidSampleRatio", cfg: Config{Enabled: true, Endpoint: "localhost:4318", SampleRatio: 2}, wantErr: true},
+		{name: "Enabled", cfg: Config{Enabled: true, Endpoint: "localhost:4318", Insecure: true, SampleRatio: 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Setup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				shutdown(context.Background())
+			}
+		})
+	}
+}